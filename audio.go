@@ -0,0 +1,59 @@
+package govpr
+
+import (
+	"github.com/liuxp0827/govpr/constant"
+	"github.com/liuxp0827/govpr/log"
+	"github.com/liuxp0827/govpr/waveIO"
+	"io"
+)
+
+// AddTrainAudio adds a recording for training in any format waveIO.Decode
+// knows: WAV, FLAC, Ogg Vorbis, Ogg Opus or MP3. It is resampled to
+// constant.SAMPLERATE. channel selects one channel, -1 averages them.
+func (this *VPREngine) AddTrainAudio(r io.Reader, channel int) error {
+	samples, err := this.decodeAudio(r, channel)
+	if err != nil {
+		return err
+	}
+
+	if this.deleteSil {
+		samples = waveIO.DelSilence(samples, this.delSilRange)
+	}
+
+	this.trainBuf = append(this.trainBuf, samples...)
+	return nil
+}
+
+// AddVerifyAudio sets the recording to verify, see AddTrainAudio.
+func (this *VPREngine) AddVerifyAudio(r io.Reader, channel int) error {
+	samples, err := this.decodeAudio(r, channel)
+	if err != nil {
+		return err
+	}
+
+	this.verifySpans = nil
+	if this.deleteSil {
+		samples, this.verifySpans = waveIO.DelSilenceSpans(samples, this.delSilRange)
+	}
+
+	this.verifyBuf = samples
+	return nil
+}
+
+func (this *VPREngine) decodeAudio(r io.Reader, channel int) ([]int16, error) {
+	audio, err := waveIO.DecodeChannel(r, channel)
+	if err != nil {
+		log.Error(err)
+		return nil, NewError(LSV_ERR_INVALID_PARAM, err.Error())
+	}
+
+	if len(audio.Samples) == 0 {
+		return nil, LSV_ERR_NO_AVAILABLE_DATA
+	}
+
+	samples, err := waveIO.Resample(audio.Samples, audio.SampleRate, constant.SAMPLERATE)
+	if err != nil {
+		return nil, NewError(LSV_ERR_INVALID_PARAM, err.Error())
+	}
+	return samples, nil
+}
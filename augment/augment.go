@@ -0,0 +1,148 @@
+// Package augment makes perturbed copies of training speech for UBM and
+// back-end training: additive noise at a target SNR from a noise corpus,
+// room impulse response convolution, speed and volume perturbation and a
+// mu-law 8 kHz telephone channel.
+package augment
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+type Config struct {
+	NoiseProb float64   // probability of an additive noise mixture
+	SNRs      []float64 // target SNRs (dB), one is drawn per mixture
+	RIRProb   float64   // probability of a room impulse response convolution
+	Speeds    []float64 // speed factors, one is drawn per copy, 1 keeps the speed
+	VolumeMin float64   // lowest volume gain (dB)
+	VolumeMax float64   // highest volume gain (dB)
+	CodecProb float64   // probability of the telephone channel
+	Seed      int64     // random seed, the same seed gives the same copies
+}
+
+func DefaultConfig() Config {
+	return Config{
+		NoiseProb: 0.5,
+		SNRs:      []float64{0, 5, 10, 15, 20},
+		RIRProb:   0.3,
+		Speeds:    []float64{0.9, 1.0, 1.1},
+		VolumeMin: -6,
+		VolumeMax: 6,
+		CodecProb: 0.2,
+		Seed:      1,
+	}
+}
+
+// Recipe records what was applied to one copy, in the order applied:
+// speed, reverberation, noise, volume, codec.
+type Recipe struct {
+	Speed  float64 // 0 or 1 when not applied
+	RIR    string
+	Noise  string
+	SNR    float64
+	Volume float64 // dB
+	Codec  string
+}
+
+// String is the space separated key=value list written to the manifest.
+func (r Recipe) String() string {
+	var items []string
+	if r.Speed != 0 && r.Speed != 1 {
+		items = append(items, fmt.Sprintf("speed=%g", r.Speed))
+	}
+	if r.RIR != "" {
+		items = append(items, "rir="+r.RIR)
+	}
+	if r.Noise != "" {
+		items = append(items, "noise="+r.Noise, fmt.Sprintf("snr=%g", r.SNR))
+	}
+	if r.Volume != 0 {
+		items = append(items, fmt.Sprintf("volume=%.2f", r.Volume))
+	}
+	if r.Codec != "" {
+		items = append(items, "codec="+r.Codec)
+	}
+	if len(items) == 0 {
+		return "clean"
+	}
+	return strings.Join(items, " ")
+}
+
+// Augmenter draws the perturbations of every copy from its own random
+// source, it must not be shared between goroutines.
+type Augmenter struct {
+	cfg    Config
+	rng    *rand.Rand
+	noises []Clip
+	rirs   []Clip
+}
+
+// NewAugmenter takes the noise and impulse response clips, either may be
+// empty to disable that perturbation.
+func NewAugmenter(cfg Config, noises, rirs []Clip) (*Augmenter, error) {
+	if len(noises) > 0 && len(cfg.SNRs) == 0 {
+		return nil, fmt.Errorf("noise corpus given without SNRs")
+	}
+	if cfg.VolumeMax < cfg.VolumeMin {
+		return nil, fmt.Errorf("invalid volume range %g..%g dB", cfg.VolumeMin, cfg.VolumeMax)
+	}
+	for _, s := range cfg.Speeds {
+		if s <= 0 {
+			return nil, fmt.Errorf("invalid speed factor %g", s)
+		}
+	}
+
+	return &Augmenter{
+		cfg:    cfg,
+		rng:    rand.New(rand.NewSource(cfg.Seed)),
+		noises: noises,
+		rirs:   rirs,
+	}, nil
+}
+
+// Augment returns one perturbed copy of samples recorded at sampleRate.
+// Noise and impulse response clips must have the same sample rate.
+func (a *Augmenter) Augment(samples []int16, sampleRate int) ([]int16, Recipe, error) {
+	var recipe Recipe
+	var err error
+	out := append([]int16(nil), samples...)
+
+	if len(a.cfg.Speeds) > 0 {
+		recipe.Speed = a.cfg.Speeds[a.rng.Intn(len(a.cfg.Speeds))]
+		if out, err = Speed(out, recipe.Speed); err != nil {
+			return nil, recipe, err
+		}
+	}
+
+	if len(a.rirs) > 0 && a.rng.Float64() < a.cfg.RIRProb {
+		rir := a.rirs[a.rng.Intn(len(a.rirs))]
+		if out, err = Reverberate(out, rir.Samples); err != nil {
+			return nil, recipe, fmt.Errorf("%s: %v", rir.Name, err)
+		}
+		recipe.RIR = rir.Name
+	}
+
+	if len(a.noises) > 0 && a.rng.Float64() < a.cfg.NoiseProb {
+		noise := a.noises[a.rng.Intn(len(a.noises))]
+		recipe.SNR = a.cfg.SNRs[a.rng.Intn(len(a.cfg.SNRs))]
+		if out, err = AddNoise(out, noise.Samples, recipe.SNR, a.rng.Intn(len(noise.Samples))); err != nil {
+			return nil, recipe, fmt.Errorf("%s: %v", noise.Name, err)
+		}
+		recipe.Noise = noise.Name
+	}
+
+	if a.cfg.VolumeMax > a.cfg.VolumeMin || a.cfg.VolumeMin != 0 {
+		recipe.Volume = a.cfg.VolumeMin + a.rng.Float64()*(a.cfg.VolumeMax-a.cfg.VolumeMin)
+		out = Volume(out, recipe.Volume)
+	}
+
+	if a.rng.Float64() < a.cfg.CodecProb {
+		if out, err = Telephone(out, sampleRate); err != nil {
+			return nil, recipe, err
+		}
+		recipe.Codec = "mulaw8k"
+	}
+
+	return out, recipe, nil
+}
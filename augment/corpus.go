@@ -0,0 +1,101 @@
+package augment
+
+import (
+	"fmt"
+	"github.com/liuxp0827/govpr/waveIO"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Clip is one noise or impulse response recording.
+type Clip struct {
+	Name    string // file name relative to the corpus directory
+	Samples []int16
+}
+
+// LoadCorpus loads every recording under dir with an extension of
+// waveIO.Extensions. Clips of another sample rate are resampled to
+// sampleRate.
+func LoadCorpus(dir string, sampleRate int) ([]Clip, error) {
+	var names []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && audioFile(path) {
+			names = append(names, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	var clips []Clip
+	for _, name := range names {
+		samples, rate, err := ReadWave(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		if rate != sampleRate {
+			if samples, err = Resample(samples, rate, sampleRate); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			rel = name
+		}
+		clips = append(clips, Clip{Name: filepath.ToSlash(rel), Samples: samples})
+	}
+
+	if len(clips) == 0 {
+		return nil, fmt.Errorf("no audio files in %s", dir)
+	}
+	return clips, nil
+}
+
+func audioFile(name string) bool {
+	for _, ext := range waveIO.Extensions {
+		if strings.EqualFold(filepath.Ext(name), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadWave decodes a recording in any format of waveIO.Decode, averaging
+// its channels, and returns the samples and their sample rate.
+func ReadWave(name string) ([]int16, int, error) {
+	audio, err := waveIO.DecodeFile(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return audio.Samples, audio.SampleRate, nil
+}
+
+// AugmentFile writes an augmented copy of the recording src to dst with
+// waveIO.WaveSave.
+func (a *Augmenter) AugmentFile(src, dst string) (Recipe, error) {
+	samples, rate, err := ReadWave(src)
+	if err != nil {
+		return Recipe{}, err
+	}
+
+	out, recipe, err := a.Augment(samples, rate)
+	if err != nil {
+		return recipe, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return recipe, err
+	}
+	return recipe, waveIO.WaveSave(dst, out, uint32(rate), uint32(len(out)))
+}
@@ -0,0 +1,214 @@
+package augment
+
+import (
+	"fmt"
+	gomath "github.com/liuxp0827/govpr/math"
+	"github.com/liuxp0827/govpr/waveIO"
+	"math"
+)
+
+// rate of the simulated telephone channel
+const TelephoneRate = 8000
+
+func toFloat(samples []int16) []float64 {
+	out := make([]float64, len(samples))
+	for i, v := range samples {
+		out[i] = float64(v)
+	}
+	return out
+}
+
+func toInt16(x []float64) []int16 {
+	out := make([]int16, len(x))
+	for i, v := range x {
+		v = math.Floor(v + 0.5)
+		if v > math.MaxInt16 {
+			v = math.MaxInt16
+		} else if v < math.MinInt16 {
+			v = math.MinInt16
+		}
+		out[i] = int16(v)
+	}
+	return out
+}
+
+func power(x []float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range x {
+		sum += v * v
+	}
+	return sum / float64(len(x))
+}
+
+// AddNoise mixes noise into speech at snr dB, the noise is looped from
+// offset when it is shorter than the speech.
+func AddNoise(speech, noise []int16, snr float64, offset int) ([]int16, error) {
+	if len(noise) == 0 {
+		return nil, fmt.Errorf("empty noise")
+	}
+
+	x := toFloat(speech)
+	n := make([]float64, len(x))
+	for i := range n {
+		n[i] = float64(noise[(offset+i)%len(noise)])
+	}
+
+	ps, pn := power(x), power(n)
+	if pn == 0 {
+		return nil, fmt.Errorf("silent noise")
+	}
+
+	gain := math.Sqrt(ps / (pn * math.Pow(10, snr/10)))
+	for i := range x {
+		x[i] += gain * n[i]
+	}
+	return toInt16(x), nil
+}
+
+// Reverberate convolves speech with the room impulse response rir. The
+// output is aligned on the direct path, the strongest tap of rir, keeps
+// the length of speech and is scaled back to the input power.
+func Reverberate(speech, rir []int16) ([]int16, error) {
+	if len(rir) == 0 {
+		return nil, fmt.Errorf("empty impulse response")
+	}
+
+	h := toFloat(rir)
+	peak := 0
+	for i, v := range h {
+		if math.Abs(v) > math.Abs(h[peak]) {
+			peak = i
+		}
+	}
+
+	x := toFloat(speech)
+	y, err := convolve(x, h)
+	if err != nil {
+		return nil, err
+	}
+	y = y[peak : peak+len(x)]
+
+	if py := power(y); py > 0 {
+		gain := math.Sqrt(power(x) / py)
+		for i := range y {
+			y[i] *= gain
+		}
+	}
+	return toInt16(y), nil
+}
+
+// full linear convolution through the real fft
+func convolve(x, h []float64) ([]float64, error) {
+	n := len(x) + len(h) - 1
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+
+	plan, err := gomath.RealPlan(size)
+	if err != nil {
+		return nil, err
+	}
+
+	bins := size/2 + 1
+	xr, xi := make([]float64, bins), make([]float64, bins)
+	hr, hi := make([]float64, bins), make([]float64, bins)
+
+	buf := make([]float64, size)
+	copy(buf, x)
+	plan.Forward(buf, xr, xi)
+
+	for i := range buf {
+		buf[i] = 0
+	}
+	copy(buf, h)
+	plan.Forward(buf, hr, hi)
+
+	for k := 0; k < bins; k++ {
+		xr[k], xi[k] = xr[k]*hr[k]-xi[k]*hi[k], xr[k]*hi[k]+xi[k]*hr[k]
+	}
+	plan.Inverse(xr, xi, buf)
+	return buf[:n], nil
+}
+
+// Speed plays the samples factor times faster, changing tempo and pitch
+// together like a tape, as Kaldi's speed perturbation does.
+func Speed(samples []int16, factor float64) ([]int16, error) {
+	if factor <= 0 {
+		return nil, fmt.Errorf("invalid speed factor %g", factor)
+	}
+	if factor == 1 {
+		return append([]int16(nil), samples...), nil
+	}
+	return waveIO.ResampleStep(samples, factor), nil
+}
+
+// Volume scales the samples by gain dB, clipping at full scale.
+func Volume(samples []int16, gain float64) []int16 {
+	x := toFloat(samples)
+	g := math.Pow(10, gain/20)
+	for i := range x {
+		x[i] *= g
+	}
+	return toInt16(x)
+}
+
+// Resample converts samples from one sample rate to another.
+func Resample(samples []int16, from, to int) ([]int16, error) {
+	return waveIO.Resample(samples, from, to)
+}
+
+// Telephone simulates a G.711 telephone channel: the samples are
+// downsampled to 8 kHz, mu-law encoded and decoded and brought back to
+// sampleRate, so the result can go through the same front end.
+func Telephone(samples []int16, sampleRate int) ([]int16, error) {
+	narrow, err := Resample(samples, sampleRate, TelephoneRate)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range narrow {
+		narrow[i] = MuLawDecode(MuLawEncode(v))
+	}
+	return Resample(narrow, TelephoneRate, sampleRate)
+}
+
+const (
+	muLawBias = 0x84
+	muLawClip = 32635
+)
+
+// MuLawEncode is the G.711 mu-law compression of one sample.
+func MuLawEncode(sample int16) byte {
+	s := int(sample)
+	sign := 0
+	if s < 0 {
+		sign = 0x80
+		s = -s
+	}
+	if s > muLawClip {
+		s = muLawClip
+	}
+	s += muLawBias
+
+	exponent := 7
+	for mask := 0x4000; s&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (s >> uint(exponent+3)) & 0x0f
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+func MuLawDecode(code byte) int16 {
+	u := int(^code)
+	exponent := uint(u>>4) & 0x07
+	s := ((u&0x0f)<<3 + muLawBias) << exponent
+	s -= muLawBias
+	if u&0x80 != 0 {
+		s = -s
+	}
+	return int16(s)
+}
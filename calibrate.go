@@ -0,0 +1,71 @@
+package govpr
+
+import (
+	"github.com/liuxp0827/govpr/calibration"
+	"github.com/liuxp0827/govpr/log"
+)
+
+// Calibrate trains the calibration of the ubm on the scores of development
+// trials, from VerifyModel against known target and non-target speakers,
+// and saves it next to the ubm where NewVPREngine loads it from. prior is
+// the operating point of the training, see calibration.Train.
+func (this *VPREngine) Calibrate(targets, nontargets []float64, prior float64) (*calibration.Calibration, error) {
+	c, err := calibration.Train(targets, nontargets, prior)
+	if err != nil {
+		return nil, NewError(LSV_ERR_INVALID_PARAM, err.Error())
+	}
+
+	if err = c.Save(calibration.File(this.ubmFile)); err != nil {
+		log.Error(err)
+		return nil, NewError(LSV_ERR_FILE_ERROR, err.Error())
+	}
+
+	this.calibration = c
+	return c, nil
+}
+
+// SetCalibration replaces the calibration of the engine without saving it,
+// nil goes back to raw scores only.
+func (this *VPREngine) SetCalibration(c *calibration.Calibration) {
+	this.calibration = c
+}
+
+func (this *VPREngine) GetCalibration() *calibration.Calibration {
+	return this.calibration
+}
+
+func (this *VPREngine) Calibrated() bool {
+	return this.calibration != nil
+}
+
+// SetPrior sets the prior probability of a target trial of GetPosterior,
+// constant.TARGET_PRIOR by default.
+func (this *VPREngine) SetPrior(prior float64) error {
+	if prior <= 0 || prior >= 1 {
+		return NewError(LSV_ERR_INVALID_PARAM, "prior must be between 0 and 1")
+	}
+	this.prior = prior
+	return nil
+}
+
+func (this *VPREngine) GetPrior() float64 {
+	return this.prior
+}
+
+// GetLLR returns the calibrated log-likelihood ratio of the last score, of
+// VerifyModel or VerifySegments.
+func (this *VPREngine) GetLLR() (float64, error) {
+	if this.calibration == nil {
+		return 0, LSV_ERR_NOT_CALIBRATED
+	}
+	return this.calibration.LLR(this.score), nil
+}
+
+// GetPosterior returns the probability that the last score is of the
+// claimed speaker, at the prior of SetPrior.
+func (this *VPREngine) GetPosterior() (float64, error) {
+	if this.calibration == nil {
+		return 0, LSV_ERR_NOT_CALIBRATED
+	}
+	return this.calibration.Posterior(this.score, this.prior), nil
+}
@@ -0,0 +1,259 @@
+// Package calibration maps raw verification scores to calibrated
+// log-likelihood ratios with a linear logistic regression trained on the
+// scores of development trials, llr = Scale*score + Offset. The LLR does not
+// depend on the prior of a target trial, the posterior at any prior follows
+// from it. A calibration is only valid for the UBM and front end the
+// development scores came from, so it is stored next to the UBM.
+package calibration
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	MIN_TRIALS = 10    // fewest target and non-target scores of a training
+	MAX_ITER   = 100   // Newton iterations of a training
+	TOLERANCE  = 1e-10 // a training stops when the objective improves less
+)
+
+type Calibration struct {
+	Scale  float64
+	Offset float64
+	Prior  float64 // effective prior of a target trial the regression was trained at
+}
+
+// File is the calibration file of a UBM
+func File(ubmFile string) string {
+	return ubmFile + ".cal"
+}
+
+// Train fits the calibration to the scores of target and non-target trials
+// by minimising the prior-weighted cross entropy (the Cllr at prior). The
+// weighting makes the result independent of the proportion of targets in
+// the development set; prior only sets the operating point the fit favours,
+// 0.5 weighs misses and false alarms alike.
+func Train(targets, nontargets []float64, prior float64) (*Calibration, error) {
+	if len(targets) < MIN_TRIALS || len(nontargets) < MIN_TRIALS {
+		return nil, fmt.Errorf("calibration needs at least %d target and %d non-target scores", MIN_TRIALS, MIN_TRIALS)
+	}
+	if prior <= 0 || prior >= 1 {
+		return nil, fmt.Errorf("prior must be between 0 and 1")
+	}
+
+	for _, scores := range [][]float64{targets, nontargets} {
+		for _, s := range scores {
+			if math.IsNaN(s) || math.IsInf(s, 0) {
+				return nil, fmt.Errorf("scores must be finite")
+			}
+		}
+	}
+
+	t := trials{targets, nontargets, prior / float64(len(targets)), (1 - prior) / float64(len(nontargets)), Logit(prior)}
+
+	// Newton's method on (scale, offset), halving the step when it does not
+	// improve the objective. Separable scores have no minimum, the scale
+	// then grows until the improvement drops under TOLERANCE.
+	a, b := 1.0, 0.0
+	cost := t.cost(a, b)
+	for iter := 0; iter < MAX_ITER; iter++ {
+		ga, gb, haa, hab, hbb := t.derivatives(a, b)
+		det := haa*hbb - hab*hab
+		if det <= 0 {
+			break
+		}
+		da := (hbb*ga - hab*gb) / det
+		db := (haa*gb - hab*ga) / det
+
+		improved := false
+		for step := 1.0; step > 1e-8; step /= 2 {
+			na, nb := a-step*da, b-step*db
+			if c := t.cost(na, nb); c < cost {
+				a, b, improved = na, nb, cost-c > TOLERANCE
+				cost = c
+				break
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+
+	if a <= 0 {
+		return nil, fmt.Errorf("target scores are not above the non-target scores")
+	}
+	return &Calibration{Scale: a, Offset: b, Prior: prior}, nil
+}
+
+// trials of a training, with the weights of their cross entropy
+type trials struct {
+	targets, nontargets []float64
+	wt, wn              float64
+	logitPrior          float64
+}
+
+// cost is the prior-weighted cross entropy in nats
+func (this *trials) cost(a, b float64) float64 {
+	var c float64
+	for _, s := range this.targets {
+		c += this.wt * softplus(-(a*s + b + this.logitPrior))
+	}
+	for _, s := range this.nontargets {
+		c += this.wn * softplus(a*s+b+this.logitPrior)
+	}
+	return c
+}
+
+// derivatives returns the gradient and the hessian of the cost
+func (this *trials) derivatives(a, b float64) (ga, gb, haa, hab, hbb float64) {
+	add := func(s, g, h float64) {
+		ga += g * s
+		gb += g
+		haa += h * s * s
+		hab += h * s
+		hbb += h
+	}
+	for _, s := range this.targets {
+		p := Sigmoid(a*s + b + this.logitPrior)
+		add(s, -this.wt*(1-p), this.wt*p*(1-p))
+	}
+	for _, s := range this.nontargets {
+		p := Sigmoid(a*s + b + this.logitPrior)
+		add(s, this.wn*p, this.wn*p*(1-p))
+	}
+	return
+}
+
+// LLR is the calibrated log-likelihood ratio of a score
+func (this *Calibration) LLR(score float64) float64 {
+	return this.Scale*score + this.Offset
+}
+
+// Posterior is the probability of a target trial given the score, at the
+// prior probability of a target trial prior
+func (this *Calibration) Posterior(score, prior float64) float64 {
+	return Posterior(this.LLR(score), prior)
+}
+
+// Posterior is the probability of a target trial given its llr, at prior
+func Posterior(llr, prior float64) float64 {
+	return Sigmoid(llr + Logit(prior))
+}
+
+// Threshold is the score whose LLR is the Bayes decision threshold at prior,
+// -logit(prior), for equal costs of misses and false alarms
+func (this *Calibration) Threshold(prior float64) float64 {
+	return (-Logit(prior) - this.Offset) / this.Scale
+}
+
+// Cllr is the log-likelihood-ratio cost in bits of the calibrated scores of
+// target and non-target trials, 0 is perfect and 1 is an uninformative
+// system. It measures discrimination and calibration together.
+func (this *Calibration) Cllr(targets, nontargets []float64) float64 {
+	var ct, cn float64
+	for _, s := range targets {
+		ct += softplus(-this.LLR(s))
+	}
+	for _, s := range nontargets {
+		cn += softplus(this.LLR(s))
+	}
+	return (ct/float64(len(targets)) + cn/float64(len(nontargets))) / (2 * math.Ln2)
+}
+
+func Logit(p float64) float64 {
+	return math.Log(p / (1 - p))
+}
+
+func Sigmoid(x float64) float64 {
+	if x >= 0 {
+		return 1 / (1 + math.Exp(-x))
+	}
+	e := math.Exp(x)
+	return e / (1 + e)
+}
+
+// softplus is log(1+exp(x)) without overflow
+func softplus(x float64) float64 {
+	if x > 0 {
+		return x + math.Log1p(math.Exp(-x))
+	}
+	return math.Log1p(math.Exp(x))
+}
+
+// Plain text, '#' starts a comment:
+//
+//	calibration <scale> <offset> <prior>
+func (this *Calibration) Write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "calibration %s %s %s\n",
+		strconv.FormatFloat(this.Scale, 'g', -1, 64),
+		strconv.FormatFloat(this.Offset, 'g', -1, 64),
+		strconv.FormatFloat(this.Prior, 'g', -1, 64))
+	return err
+}
+
+func Read(r io.Reader) (*Calibration, error) {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] != "calibration" || len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: expected calibration <scale> <offset> <prior>", line)
+		}
+
+		var values [3]float64
+		for i, field := range fields[1:] {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			values[i] = v
+		}
+
+		c := &Calibration{Scale: values[0], Offset: values[1], Prior: values[2]}
+		if c.Scale <= 0 || c.Prior <= 0 || c.Prior >= 1 {
+			return nil, fmt.Errorf("line %d: scale must be positive and prior between 0 and 1", line)
+		}
+		return c, nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no calibration")
+}
+
+func Load(filename string) (*Calibration, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+func (this *Calibration) Save(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err = this.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
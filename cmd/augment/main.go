@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/liuxp0827/govpr/augment"
+	"github.com/liuxp0827/govpr/constant"
+	"github.com/liuxp0827/govpr/log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var listFile, noiseDir, rirDir, outDir, manifest string
+var snrs, speeds, volume string
+var noiseProb, rirProb, codecProb float64
+var copies, sampleRate int
+var seed int64
+var help bool
+
+func init() {
+	cfg := augment.DefaultConfig()
+	flag.StringVar(&listFile, "list", "", "file with one wave path per line, wave paths may also be given as arguments")
+	flag.StringVar(&noiseDir, "noise", "", "directory of noise waves")
+	flag.StringVar(&rirDir, "rir", "", "directory of room impulse response waves")
+	flag.StringVar(&outDir, "out", "augmented", "output directory")
+	flag.StringVar(&manifest, "manifest", "", "manifest file, default <out>/manifest.txt")
+	flag.StringVar(&snrs, "snrs", "0,5,10,15,20", "target SNRs in dB")
+	flag.StringVar(&speeds, "speeds", "0.9,1.0,1.1", "speed factors")
+	flag.StringVar(&volume, "volume", "-6,6", "volume gain range in dB")
+	flag.Float64Var(&noiseProb, "noiseprob", cfg.NoiseProb, "probability of additive noise")
+	flag.Float64Var(&rirProb, "rirprob", cfg.RIRProb, "probability of reverberation")
+	flag.Float64Var(&codecProb, "codecprob", cfg.CodecProb, "probability of the mu-law 8 kHz telephone channel")
+	flag.IntVar(&copies, "copies", 1, "augmented copies per wave")
+	flag.IntVar(&sampleRate, "rate", constant.SAMPLERATE, "sample rate the noise and impulse responses are resampled to")
+	flag.Int64Var(&seed, "seed", cfg.Seed, "random seed")
+	flag.BoolVar(&help, "h", false, "help bool default false")
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: augment [flags] [wave ...]\n"+
+		"writes <out>/<name>-aug<k>.wav and a manifest of \"output<TAB>source<TAB>recipe\" lines\n")
+	flag.PrintDefaults()
+	os.Exit(0)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if help {
+		usage()
+	}
+
+	waves, err := waveList()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(waves) == 0 {
+		log.Fatal("no wave files given")
+	}
+
+	cfg := augment.DefaultConfig()
+	cfg.NoiseProb = noiseProb
+	cfg.RIRProb = rirProb
+	cfg.CodecProb = codecProb
+	cfg.Seed = seed
+	if cfg.SNRs, err = parseFloats(snrs); err != nil {
+		log.Fatalf("-snrs: %v", err)
+	}
+	if cfg.Speeds, err = parseFloats(speeds); err != nil {
+		log.Fatalf("-speeds: %v", err)
+	}
+	gains, err := parseFloats(volume)
+	if err != nil || len(gains) != 2 {
+		log.Fatalf("-volume: expected min,max")
+	}
+	cfg.VolumeMin, cfg.VolumeMax = gains[0], gains[1]
+
+	var noises, rirs []augment.Clip
+	if noiseDir != "" {
+		if noises, err = augment.LoadCorpus(noiseDir, sampleRate); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if rirDir != "" {
+		if rirs, err = augment.LoadCorpus(rirDir, sampleRate); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	augmenter, err := augment.NewAugmenter(cfg, noises, rirs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = os.MkdirAll(outDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	if manifest == "" {
+		manifest = filepath.Join(outDir, "manifest.txt")
+	}
+
+	f, err := os.Create(manifest)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	defer w.Flush()
+
+	for _, wave := range waves {
+		key := strings.TrimSuffix(filepath.Base(wave), filepath.Ext(wave))
+		for k := 0; k < copies; k++ {
+			dst := filepath.Join(outDir, fmt.Sprintf("%s-aug%d.wav", key, k))
+			recipe, err := augmenter.AugmentFile(wave, dst)
+			if err != nil {
+				log.Errorf("%s: %v", wave, err)
+				break
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\n", dst, wave, recipe)
+			log.Infof("%s: %s", dst, recipe)
+		}
+	}
+}
+
+func waveList() ([]string, error) {
+	waves := flag.Args()
+	if listFile == "" {
+		return waves, nil
+	}
+
+	f, err := os.Open(listFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			waves = append(waves, line)
+		}
+	}
+	return waves, scanner.Err()
+}
+
+func parseFloats(s string) ([]float64, error) {
+	var out []float64
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
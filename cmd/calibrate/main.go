@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/liuxp0827/govpr/calibration"
+	"github.com/liuxp0827/govpr/constant"
+	"github.com/liuxp0827/govpr/log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var targetFile, nontargetFile, ubmFile, out string
+var prior float64
+var help bool
+
+func init() {
+	flag.StringVar(&targetFile, "targets", "", "scores of target trials, the last field of every line")
+	flag.StringVar(&nontargetFile, "nontargets", "", "scores of non-target trials, the last field of every line")
+	flag.StringVar(&ubmFile, "ubm", "", "ubm the scores were computed with, the calibration is saved next to it")
+	flag.StringVar(&out, "out", "", "calibration output, default next to -ubm")
+	flag.Float64Var(&prior, "prior", constant.TARGET_PRIOR, "prior of a target trial the regression is trained at")
+	flag.BoolVar(&help, "h", false, "help bool default false")
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: calibrate -targets file -nontargets file (-ubm ubm | -out file) [-prior p]\n"+
+		"score files hold one trial per line, e.g. \"model test score\" or just \"score\"\n")
+	flag.PrintDefaults()
+	os.Exit(0)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if help || targetFile == "" || nontargetFile == "" || (ubmFile == "" && out == "") {
+		usage()
+	}
+	if out == "" {
+		out = calibration.File(ubmFile)
+	}
+
+	targets, err := loadScores(targetFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	nontargets, err := loadScores(nontargetFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c, err := calibration.Train(targets, nontargets, prior)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = c.Save(out); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infof("%d target and %d non-target trials -> %s: llr = %g * score + %g",
+		len(targets), len(nontargets), out, c.Scale, c.Offset)
+	log.Infof("Cllr %.4f bits, threshold %g at prior %g", c.Cllr(targets, nontargets), c.Threshold(prior), prior)
+}
+
+// loadScores reads the last field of every line, '#' starts a comment
+func loadScores(filename string) ([]float64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var scores []float64
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		score, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", filename, line, err)
+		}
+		scores = append(scores, score)
+	}
+	return scores, scanner.Err()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/liuxp0827/govpr/diarization"
+	"github.com/liuxp0827/govpr/gmm"
+	"github.com/liuxp0827/govpr/log"
+	"github.com/liuxp0827/govpr/waveIO"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var waveFile, ubmFile, speakers, out string
+var numSpeakers int
+var threshold float64
+var help bool
+
+func init() {
+	flag.StringVar(&waveFile, "wav", "", "wave, flac, ogg or mp3 file to diarize")
+	flag.StringVar(&ubmFile, "ubm", "", "ubm model, needed with -speakers")
+	flag.StringVar(&speakers, "speakers", "", "enrolled speakers, name=model[,name=model...]")
+	flag.Float64Var(&threshold, "threshold", 1.0, "minimum average log-likelihood ratio to label a cluster")
+	flag.IntVar(&numSpeakers, "n", 0, "number of speakers, 0 = estimate")
+	flag.StringVar(&out, "out", "", "rttm output, default stdout")
+	flag.BoolVar(&help, "h", false, "help bool default false")
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: diarize -wav file [-ubm ubm -speakers name=model,...] [-out file.rttm]\n")
+	flag.PrintDefaults()
+	os.Exit(0)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if help || waveFile == "" {
+		usage()
+	}
+
+	audio, err := waveIO.DecodeFile(waveFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := diarization.DefaultConfig()
+	samples, err := waveIO.Resample(audio.Samples, audio.SampleRate, cfg.Feature.SampleRate)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg.NumSpeakers = numSpeakers
+	diarizer, err := diarization.NewDiarizer(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	result, err := diarizer.Diarize(samples)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if speakers != "" {
+		if ubmFile == "" {
+			log.Fatal("-speakers needs -ubm")
+		}
+
+		ubm := gmm.NewGMM()
+		if err = ubm.LoadModel(ubmFile); err != nil {
+			log.Fatal(err)
+		}
+
+		var enrolled []diarization.Speaker
+		for _, item := range strings.Split(speakers, ",") {
+			kv := strings.SplitN(item, "=", 2)
+			if len(kv) != 2 {
+				log.Fatalf("invalid speaker %q, expected name=model", item)
+			}
+
+			model := gmm.NewGMM()
+			if err = model.LoadModel(kv[1]); err != nil {
+				log.Fatalf("%s: %v", kv[1], err)
+			}
+			enrolled = append(enrolled, diarization.Speaker{Name: kv[0], Model: model})
+		}
+
+		if err = result.Label(ubm, enrolled, threshold); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fileID := strings.TrimSuffix(filepath.Base(waveFile), filepath.Ext(waveFile))
+	if out == "" {
+		err = result.WriteRTTM(os.Stdout, fileID)
+	} else {
+		err = result.SaveRTTM(out, fileID)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/liuxp0827/govpr/constant"
+	"github.com/liuxp0827/govpr/feature"
+	"github.com/liuxp0827/govpr/log"
+	"github.com/liuxp0827/govpr/param"
+	"github.com/liuxp0827/govpr/waveIO"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var listFile, format, outDir, frontEnd, denoise, norm string
+var sampleRate, normWindow int
+var exactFFT bool
+var help bool
+
+func init() {
+	flag.StringVar(&listFile, "list", "", "file with one wave path per line, wave paths may also be given as arguments")
+	flag.StringVar(&format, "format", "htk", "output format [ htk | ark | npy ]")
+	flag.StringVar(&outDir, "out", ".", "output directory, one file per wave for htk and npy, feats.ark and feats.scp for ark")
+	flag.StringVar(&frontEnd, "frontend", "mfcc", "front end [ mfcc | lfcc | plp | rasta-plp | ssc | prosody ]")
+	flag.StringVar(&denoise, "denoise", "none", "noise reduction [ none | subtraction | wiener ]")
+	flag.StringVar(&norm, "norm", "static-cmvn", "normalisation [ static-cmvn | cmvn | sliding-cmvn | warping ]")
+	flag.IntVar(&normWindow, "normwin", constant.NORM_WIN_SIZE, "sliding-cmvn and warping window in frames")
+	flag.IntVar(&sampleRate, "rate", constant.SAMPLERATE, "sample rate of the front end, the inputs are resampled to it")
+	flag.BoolVar(&exactFFT, "exactfft", false, "fft over exactly one frame instead of the next 2^N")
+	flag.BoolVar(&help, "h", false, "help bool default false")
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: featdump [flags] [wave ...]\nwaves may also be flac, ogg vorbis, ogg opus or mp3, resampled to -rate\n")
+	flag.PrintDefaults()
+	os.Exit(0)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if help {
+		usage()
+	}
+
+	waves, err := waveList()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(waves) == 0 {
+		log.Fatal("no wave files given")
+	}
+
+	cfg := feature.DefaultConfig()
+	cfg.SampleRate = sampleRate
+	cfg.ExactFFT = exactFFT
+	if cfg.FrontEnd, err = param.ParseFrontEnd(frontEnd); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.NoiseReduction, err = param.ParseNoiseReduction(denoise); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Norm, err = param.ParseNormMode(norm); err != nil {
+		log.Fatal(err)
+	}
+	cfg.NormWindow = normWindow
+
+	extractor, err := feature.NewExtractor(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = os.MkdirAll(outDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	var kaldi *feature.KaldiWriter
+	if format == "ark" {
+		arkName := filepath.Join(outDir, "feats.ark")
+		ark, err := os.Create(arkName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer ark.Close()
+
+		scp, err := os.Create(filepath.Join(outDir, "feats.scp"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer scp.Close()
+
+		arkW := bufio.NewWriter(ark)
+		scpW := bufio.NewWriter(scp)
+		defer scpW.Flush()
+		defer arkW.Flush()
+		kaldi = feature.NewKaldiWriter(arkW, scpW, arkName)
+	} else if format != "htk" && format != "npy" {
+		log.Fatalf("unknown format %q", format)
+	}
+
+	// frame shift in 100ns units
+	sampPeriod := int32(cfg.FrameShift * 10000)
+	parmKind := feature.HTKParmKind(cfg)
+
+	for _, wave := range waves {
+		features, err := waveFeatures(extractor, wave)
+		if err != nil {
+			log.Errorf("%s: %v", wave, err)
+			continue
+		}
+
+		key := strings.TrimSuffix(filepath.Base(wave), filepath.Ext(wave))
+		switch format {
+		case "htk":
+			err = feature.SaveHTK(filepath.Join(outDir, key+".htk"), features, sampPeriod, parmKind)
+		case "npy":
+			err = feature.SaveNpy(filepath.Join(outDir, key+".npy"), features)
+		case "ark":
+			err = kaldi.Write(key, features)
+		}
+
+		if err != nil {
+			log.Fatalf("%s: %v", wave, err)
+		}
+		log.Infof("%s: %d frames x %d", key, len(features), len(features[0]))
+	}
+}
+
+func waveList() ([]string, error) {
+	waves := flag.Args()
+	if listFile == "" {
+		return waves, nil
+	}
+
+	f, err := os.Open(listFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			waves = append(waves, line)
+		}
+	}
+	return waves, scanner.Err()
+}
+
+func waveFeatures(extractor *feature.Extractor, wave string) ([][]float32, error) {
+	audio, err := waveIO.DecodeFile(wave)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := waveIO.Resample(audio.Samples, audio.SampleRate, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	features, err := extractor.Features(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(features) == 0 {
+		return nil, fmt.Errorf("wave too short")
+	}
+	return features, nil
+}
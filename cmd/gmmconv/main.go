@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/liuxp0827/govpr/gmm"
+	"github.com/liuxp0827/govpr/log"
+	"os"
+	"strings"
+)
+
+var from, to, in, out string
+var help bool
+
+func init() {
+	flag.StringVar(&from, "from", "auto", "input format [ auto | govpr | alize | kaldi | text ]")
+	flag.StringVar(&to, "to", "kaldi", "output format [ govpr | alize | kaldi | kaldi-text | text ]")
+	flag.StringVar(&in, "in", "", "input model")
+	flag.StringVar(&out, "out", "", "output model")
+	flag.BoolVar(&help, "h", false, "help bool default false")
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gmmconv -in model -out model [-from format] [-to format]\n"+
+		"govpr model files are ALIZE RAW mixtures, kaldi reads both binary and text DiagGmm\n")
+	flag.PrintDefaults()
+	os.Exit(0)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if help || in == "" || out == "" {
+		usage()
+	}
+
+	if from == "auto" {
+		var err error
+		if from, err = detect(in); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	model := gmm.NewGMM()
+	if err := load(model, from, in); err != nil {
+		log.Fatalf("load %s: %v", in, err)
+	}
+
+	if err := save(model, to, out); err != nil {
+		log.Fatalf("save %s: %v", out, err)
+	}
+
+	log.Infof("%s (%s) -> %s (%s): %d mixtures x %d", in, from, out, to, model.Mixtures, model.VectorSize)
+}
+
+// detect the format from the first bytes of the file
+func detect(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head, _ := bufio.NewReader(f).Peek(16)
+	text := strings.TrimLeft(string(head), " \t\r\n")
+	switch {
+	case len(head) >= 2 && head[0] == 0 && head[1] == 'B':
+		return "kaldi", nil
+	case strings.HasPrefix(text, "<DiagGMM>"):
+		return "kaldi", nil
+	case strings.HasPrefix(text, "gmm ") || strings.HasPrefix(text, "#"):
+		return "text", nil
+	}
+	return "alize", nil
+}
+
+func load(model *gmm.GMM, format, filename string) error {
+	switch format {
+	case "govpr", "alize":
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return model.ReadAlize(f)
+	case "kaldi", "kaldi-text":
+		return model.LoadKaldi(filename)
+	case "text":
+		return model.LoadText(filename)
+	}
+	return fmt.Errorf("unknown input format %q", format)
+}
+
+func save(model *gmm.GMM, format, filename string) error {
+	switch format {
+	case "govpr", "alize":
+		f, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err = model.WriteAlize(f); err != nil {
+			return err
+		}
+		return f.Close()
+	case "kaldi":
+		return model.SaveKaldi(filename, true)
+	case "kaldi-text":
+		return model.SaveKaldi(filename, false)
+	case "text":
+		return model.SaveText(filename)
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/liuxp0827/govpr/httpapi/redis"
+	"github.com/liuxp0827/govpr/log"
+	"os"
+)
+
+var addr, password string
+var help bool
+
+func init() {
+	flag.StringVar(&addr, "addr", "127.0.0.1:6379", "listen address")
+	flag.StringVar(&password, "password", "", "password of AUTH, empty for none")
+	flag.BoolVar(&help, "h", false, "help bool default false")
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: redis-standin [-addr host:port] [-password password]\n"+
+		"serves the user cache and locks of httpapi servers with cache = redis from memory, for development\n")
+	flag.PrintDefaults()
+	os.Exit(0)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if help {
+		usage()
+	}
+
+	standin := redis.NewStandin()
+	standin.Password = password
+	ln, err := standin.Listen(addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infof("redis stand-in listening on %s", ln)
+	select {}
+}
@@ -59,5 +59,21 @@ const (
 	SIL_FLOOR                = 50
 	ENERGY_SCALE             = 19
 	FEATURE_WARPING_WIN_SIZE = 300
+	NORM_WIN_SIZE            = 300   // sliding cmvn and warping window in frames (3 s)
+	STREAM_BLOCK_LEN         = 30000 // block of the feature stream (ms)
 	RASTA_COFF               = 0.94
+
+	MIN_F0        = 60   // lowest pitch searched by the prosody front end (Hz)
+	MAX_F0        = 400  // highest pitch searched by the prosody front end (Hz)
+	YIN_THRESHOLD = 0.15 // YIN absolute threshold for a voiced frame
+
+	SEGMENT_WINDOW = 1000 // sliding window of segment scoring (ms)
+	SEGMENT_HOP    = 250  // hop between segment scoring windows (ms)
+
+	NOISE_FRAME_RATIO = 0.1  // share of the quietest frames the noise spectrum is estimated from
+	OVER_SUBTRACTION  = 1.0  // spectral subtraction over-subtraction factor
+	SPECTRAL_FLOOR    = 0.3  // spectral floor relative to the noise, also the minimum Wiener a priori SNR
+	WIENER_SMOOTHING  = 0.98 // decision-directed smoothing of the Wiener a priori SNR
+
+	TARGET_PRIOR = 0.5 // prior of a target trial of the calibrated posterior
 )
@@ -0,0 +1,245 @@
+package diarization
+
+import (
+	"math"
+)
+
+// variance floor of the diagonal Gaussians
+const varFloor = 1e-4
+
+// stats are the sufficient statistics of a diagonal Gaussian.
+type stats struct {
+	n   int
+	sum []float64
+	sqr []float64
+}
+
+func newStats(dim int) *stats {
+	return &stats{
+		sum: make([]float64, dim),
+		sqr: make([]float64, dim),
+	}
+}
+
+func (s *stats) add(frame []float32) {
+	s.n++
+	for j, v := range frame {
+		x := float64(v)
+		s.sum[j] += x
+		s.sqr[j] += x * x
+	}
+}
+
+func (s *stats) merge(o *stats) {
+	s.n += o.n
+	for j := range s.sum {
+		s.sum[j] += o.sum[j]
+		s.sqr[j] += o.sqr[j]
+	}
+}
+
+// n * log|covariance| of the maximum likelihood diagonal Gaussian
+func (s *stats) nLogDet() float64 {
+	if s.n == 0 {
+		return 0
+	}
+
+	n := float64(s.n)
+	var ld float64
+	for j := range s.sum {
+		mean := s.sum[j] / n
+		v := s.sqr[j]/n - mean*mean
+		if v < varFloor {
+			v = varFloor
+		}
+		ld += math.Log(v)
+	}
+	return n * ld
+}
+
+// deltaBIC of modelling a and b with two Gaussians instead of one, > 0
+// means they are better kept apart.
+func deltaBIC(a, b *stats, lambda float64) float64 {
+	dim := len(a.sum)
+	n := a.n + b.n
+
+	var ldAll float64
+	nf := float64(n)
+	for j := 0; j < dim; j++ {
+		mean := (a.sum[j] + b.sum[j]) / nf
+		v := (a.sqr[j]+b.sqr[j])/nf - mean*mean
+		if v < varFloor {
+			v = varFloor
+		}
+		ldAll += math.Log(v)
+	}
+
+	// the second Gaussian costs dim means and dim variances
+	penalty := lambda * 0.5 * float64(2*dim) * math.Log(nf)
+	return 0.5*(nf*ldAll-a.nLogDet()-b.nLogDet()) - penalty
+}
+
+// prefix sums of a frame range, stats of any sub range in O(dim)
+type prefix struct {
+	start int
+	sum   [][]float64
+	sqr   [][]float64
+}
+
+func newPrefix(features [][]float32, start, end int) *prefix {
+	dim := len(features[start])
+	p := &prefix{
+		start: start,
+		sum:   make([][]float64, end-start+1),
+		sqr:   make([][]float64, end-start+1),
+	}
+
+	p.sum[0] = make([]float64, dim)
+	p.sqr[0] = make([]float64, dim)
+	for i := start; i < end; i++ {
+		k := i - start
+		p.sum[k+1] = make([]float64, dim)
+		p.sqr[k+1] = make([]float64, dim)
+		for j, v := range features[i] {
+			x := float64(v)
+			p.sum[k+1][j] = p.sum[k][j] + x
+			p.sqr[k+1][j] = p.sqr[k][j] + x*x
+		}
+	}
+	return p
+}
+
+func (p *prefix) stats(from, to int) *stats {
+	a, b := from-p.start, to-p.start
+	s := newStats(len(p.sum[0]))
+	s.n = to - from
+	for j := range s.sum {
+		s.sum[j] = p.sum[b][j] - p.sum[a][j]
+		s.sqr[j] = p.sqr[b][j] - p.sqr[a][j]
+	}
+	return s
+}
+
+// changePoints finds speaker changes in the frames [start, end) with a
+// growing window: the best split of the window is accepted when its
+// deltaBIC is positive, otherwise the window grows up to WindowMax and then
+// slides.
+func (d *Diarizer) changePoints(features [][]float32, start, end int) []int {
+	minSeg := d.frames(d.cfg.MinSegment)
+	winMin := d.frames(d.cfg.WindowMin)
+	winMax := d.frames(d.cfg.WindowMax)
+	step := d.frames(d.cfg.WindowStep)
+
+	if end-start < 2*minSeg {
+		return nil
+	}
+
+	p := newPrefix(features, start, end)
+	var changes []int
+
+	a := start
+	b := a + winMin
+	if b > end {
+		b = end
+	}
+
+	for b-a >= 2*minSeg {
+		best, bestT := 0.0, -1
+		for t := a + minSeg; t <= b-minSeg; t += step {
+			if v := deltaBIC(p.stats(a, t), p.stats(t, b), d.cfg.BICLambda); v > best {
+				best, bestT = v, t
+			}
+		}
+
+		if bestT >= 0 {
+			changes = append(changes, bestT)
+			a = bestT
+			b = a + winMin
+			if b > end {
+				b = end
+			}
+			continue
+		}
+
+		if b == end {
+			break
+		}
+
+		b += step
+		if b > end {
+			b = end
+		}
+		if b-a > winMax {
+			a = b - winMax
+		}
+	}
+	return changes
+}
+
+// cluster merges the segments bottom-up, always the pair with the lowest
+// deltaBIC, until no pair has a negative deltaBIC or NumSpeakers is
+// reached. The cluster index is written to every segment, the number of
+// clusters is returned.
+func (d *Diarizer) cluster(features [][]float32, segments []Segment) int {
+	if len(segments) == 0 {
+		return 0
+	}
+
+	dim := len(features[0])
+	clusters := make([]*stats, len(segments))
+	owner := make([]int, len(segments)) // segment -> cluster
+	for i, seg := range segments {
+		clusters[i] = newStats(dim)
+		for _, frame := range features[seg.Start:seg.End] {
+			clusters[i].add(frame)
+		}
+		owner[i] = i
+	}
+
+	alive := len(clusters)
+	for alive > 1 {
+		bi, bj, best := -1, -1, math.Inf(1)
+		for i := range clusters {
+			if clusters[i] == nil {
+				continue
+			}
+			for j := i + 1; j < len(clusters); j++ {
+				if clusters[j] == nil {
+					continue
+				}
+				if v := deltaBIC(clusters[i], clusters[j], d.cfg.ClusterLambda); v < best {
+					bi, bj, best = i, j, v
+				}
+			}
+		}
+
+		if d.cfg.NumSpeakers > 0 {
+			if alive <= d.cfg.NumSpeakers {
+				break
+			}
+		} else if best >= 0 {
+			break
+		}
+
+		clusters[bi].merge(clusters[bj])
+		clusters[bj] = nil
+		for k := range owner {
+			if owner[k] == bj {
+				owner[k] = bi
+			}
+		}
+		alive--
+	}
+
+	// number the clusters in order of first appearance
+	index := make(map[int]int)
+	for k := range segments {
+		c, ok := index[owner[k]]
+		if !ok {
+			c = len(index)
+			index[owner[k]] = c
+		}
+		segments[k].Cluster = c
+	}
+	return len(index)
+}
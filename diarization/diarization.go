@@ -0,0 +1,180 @@
+// Package diarization finds who spoke when: energy VAD, BIC speaker change
+// detection on the MFCC frames of feature.Extractor, agglomerative BIC
+// clustering and, optionally, labelling of the clusters against enrolled
+// speaker models with the log-likelihood ratio the engine verifies with.
+package diarization
+
+import (
+	"fmt"
+	"github.com/liuxp0827/govpr/feature"
+	"github.com/liuxp0827/govpr/gmm"
+)
+
+type Config struct {
+	Feature feature.Config
+
+	VadThreshold float64 // speech is this many dB above the noise floor
+	MinSpeech    int     // shortest speech run kept (ms)
+	MinSilence   int     // shorter pauses are bridged (ms)
+
+	WindowMin  int     // initial change detection window (ms)
+	WindowMax  int     // longest change detection window (ms)
+	WindowStep int     // window growth and candidate step (ms)
+	MinSegment int     // shortest segment on either side of a change (ms)
+	BICLambda  float64 // penalty weight of the change detection
+
+	ClusterLambda float64 // penalty weight of the clustering
+	NumSpeakers   int     // cluster down to this many speakers, <= 0 stops on BIC
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Feature:       feature.DefaultConfig(),
+		VadThreshold:  12,
+		MinSpeech:     300,
+		MinSilence:    300,
+		WindowMin:     2000,
+		WindowMax:     5000,
+		WindowStep:    200,
+		MinSegment:    1000,
+		BICLambda:     2.0,
+		ClusterLambda: 2.0,
+	}
+}
+
+// Segment is a run of frames [Start, End) attributed to one cluster.
+type Segment struct {
+	Start, End int
+	Cluster    int
+	Speaker    string  // enrolled speaker, or "speaker<cluster>"
+	Score      float64 // LLR of Speaker on the whole cluster, 0 when not labelled
+}
+
+type Result struct {
+	Segments   []Segment   // in time order
+	Clusters   int         // number of clusters
+	Features   [][]float32 // frames the segments index
+	FrameShift int         // ms per frame
+}
+
+// Speaker is an enrolled speaker model, adapted from the ubm passed to Label.
+type Speaker struct {
+	Name  string
+	Model *gmm.GMM
+}
+
+type Diarizer struct {
+	cfg       Config
+	extractor *feature.Extractor
+}
+
+func NewDiarizer(cfg Config) (*Diarizer, error) {
+	if cfg.Feature.FrameShift <= 0 || cfg.WindowStep <= 0 || cfg.WindowMin <= 0 ||
+		cfg.WindowMax < cfg.WindowMin || cfg.MinSegment <= 0 || 2*cfg.MinSegment > cfg.WindowMin {
+		return nil, fmt.Errorf("invalid diarization window settings")
+	}
+
+	extractor, err := feature.NewExtractor(cfg.Feature)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Diarizer{
+		cfg:       cfg,
+		extractor: extractor,
+	}, nil
+}
+
+// Diarize segments and clusters the samples. Segments are labelled
+// "speaker<cluster>" until Label is called.
+func (d *Diarizer) Diarize(samples []int16) (*Result, error) {
+	features, err := d.extractor.Features(samples)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(features) == 0 {
+		return nil, fmt.Errorf("not enough samples")
+	}
+
+	result := &Result{
+		Features:   features,
+		FrameShift: d.cfg.Feature.FrameShift,
+	}
+
+	var segments []Segment
+	for _, region := range d.speechRegions(samples, len(features)) {
+		start := region[0]
+		for _, change := range d.changePoints(features, region[0], region[1]) {
+			segments = append(segments, Segment{Start: start, End: change})
+			start = change
+		}
+		segments = append(segments, Segment{Start: start, End: region[1]})
+	}
+
+	result.Clusters = d.cluster(features, segments)
+	for i := range segments {
+		segments[i].Speaker = fmt.Sprintf("speaker%d", segments[i].Cluster)
+	}
+	result.Segments = segments
+	return result, nil
+}
+
+// Label every cluster with the enrolled speaker of the highest average
+// log-likelihood ratio against ubm, if that ratio reaches threshold.
+func (r *Result) Label(ubm *gmm.GMM, speakers []Speaker, threshold float64) error {
+	if len(speakers) == 0 {
+		return nil
+	}
+
+	for _, s := range speakers {
+		if s.Model.VectorSize != ubm.VectorSize {
+			return fmt.Errorf("speaker %s has dimension %d, ubm has %d", s.Name, s.Model.VectorSize, ubm.VectorSize)
+		}
+	}
+	if len(r.Features) > 0 && len(r.Features[0]) != ubm.VectorSize {
+		return fmt.Errorf("feature dimension %d, ubm has %d", len(r.Features[0]), ubm.VectorSize)
+	}
+
+	for c := 0; c < r.Clusters; c++ {
+		var frames [][]float32
+		for _, seg := range r.Segments {
+			if seg.Cluster == c {
+				frames = append(frames, r.Features[seg.Start:seg.End]...)
+			}
+		}
+		if len(frames) == 0 {
+			continue
+		}
+
+		n := int64(len(frames))
+		world := ubm.LProb(frames, 0, n)
+
+		best, bestScore := -1, threshold
+		for i, s := range speakers {
+			score := (s.Model.LProb(frames, 0, n) - world) / float64(n)
+			if score >= bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		if best < 0 {
+			continue
+		}
+		for i := range r.Segments {
+			if r.Segments[i].Cluster == c {
+				r.Segments[i].Speaker = speakers[best].Name
+				r.Segments[i].Score = bestScore
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Diarizer) frames(ms int) int {
+	n := ms / d.cfg.Feature.FrameShift
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
@@ -0,0 +1,44 @@
+package diarization
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// WriteRTTM writes one SPEAKER line per speaker turn, neighbouring segments
+// of the same speaker are joined:
+//
+//	SPEAKER <fileID> 1 <start> <duration> <NA> <NA> <speaker> <NA> <NA>
+func (r *Result) WriteRTTM(w io.Writer, fileID string) error {
+	bw := bufio.NewWriter(w)
+	sec := float64(r.FrameShift) / 1000
+
+	for i := 0; i < len(r.Segments); {
+		seg := r.Segments[i]
+		end := seg.End
+		for i++; i < len(r.Segments) && r.Segments[i].Speaker == seg.Speaker && r.Segments[i].Start == end; i++ {
+			end = r.Segments[i].End
+		}
+
+		fmt.Fprintf(bw, "SPEAKER %s 1 %.3f %.3f <NA> <NA> %s <NA> <NA>\n",
+			fileID, float64(seg.Start)*sec, float64(end-seg.Start)*sec, seg.Speaker)
+	}
+
+	// bufio.Writer keeps the first write error
+	return bw.Flush()
+}
+
+func (r *Result) SaveRTTM(filename, fileID string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = r.WriteRTTM(f, fileID); err != nil {
+		return err
+	}
+	return f.Close()
+}
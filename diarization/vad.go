@@ -0,0 +1,76 @@
+package diarization
+
+import (
+	"math"
+	"sort"
+)
+
+// speechRegions returns the [start, end) frame ranges of speech. A frame is
+// speech when its energy is VadThreshold dB above the noise floor, the 10th
+// percentile of the frame energies; short pauses are bridged and short
+// bursts dropped.
+func (d *Diarizer) speechRegions(samples []int16, frames int) [][2]int {
+	frameSize := d.cfg.Feature.SampleRate * d.cfg.Feature.FrameLength / 1000
+	shift := d.cfg.Feature.SampleRate * d.cfg.Feature.FrameShift / 1000
+
+	energy := make([]float64, frames)
+	for i := range energy {
+		end := i*shift + frameSize
+		if end > len(samples) {
+			end = len(samples)
+		}
+
+		var sum float64
+		for _, v := range samples[i*shift : end] {
+			sum += float64(v) * float64(v)
+		}
+		energy[i] = 10 * math.Log10(sum/float64(frameSize)+1)
+	}
+
+	sorted := append([]float64(nil), energy...)
+	sort.Float64s(sorted)
+	threshold := sorted[len(sorted)/10] + d.cfg.VadThreshold
+
+	speech := make([]bool, frames)
+	for i, e := range energy {
+		speech[i] = e > threshold
+	}
+
+	// bridge short pauses
+	minSilence := d.frames(d.cfg.MinSilence)
+	for _, run := range runs(speech, false) {
+		if run[0] > 0 && run[1] < frames && run[1]-run[0] < minSilence {
+			for i := run[0]; i < run[1]; i++ {
+				speech[i] = true
+			}
+		}
+	}
+
+	// drop short bursts
+	minSpeech := d.frames(d.cfg.MinSpeech)
+	var regions [][2]int
+	for _, run := range runs(speech, true) {
+		if run[1]-run[0] >= minSpeech {
+			regions = append(regions, run)
+		}
+	}
+	return regions
+}
+
+// runs of value in flags as [start, end) ranges
+func runs(flags []bool, value bool) [][2]int {
+	var out [][2]int
+	start := -1
+	for i, f := range flags {
+		if f == value && start < 0 {
+			start = i
+		} else if f != value && start >= 0 {
+			out = append(out, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		out = append(out, [2]int{start, len(flags)})
+	}
+	return out
+}
@@ -2,6 +2,7 @@ package govpr
 
 import (
 	"fmt"
+	"github.com/liuxp0827/govpr/calibration"
 	"github.com/liuxp0827/govpr/constant"
 	"github.com/liuxp0827/govpr/feature"
 	"github.com/liuxp0827/govpr/gmm"
@@ -15,6 +16,19 @@ type VPREngine struct {
 	trainBuf  []int16
 	verifyBuf []int16
 
+	// where the blocks of verifyBuf kept by the silence removal start in
+	// the verify audio, nil if verifyBuf is all of it
+	verifySpans []waveIO.Span
+
+	// precomputed feature frames, used together with the buffers above
+	trainFeatures  [][]float32
+	verifyFeatures [][]float32
+
+	// statistics of the wave streams added with AddTrainReader and
+	// AddVerifyReader, their samples are not kept
+	trainStats   *gmm.Stats
+	verifyStream *verifyStats
+
 	score float64
 
 	ubmFile       string
@@ -25,8 +39,14 @@ type VPREngine struct {
 
 	ubm *gmm.GMM
 
-	_minTrainLen int64
-	_minVerLen   int64
+	// calibration of the ubm, nil without one, and the prior of the posterior
+	calibration *calibration.Calibration
+	prior       float64
+
+	_minTrainLen    int64
+	_minVerLen      int64
+	_minTrainFrames int
+	_minVerFrames   int
 }
 
 func NewVPREngine(sampleRate, delSilRange int, deleteSil bool, ubmFile, userModelFile string) (*VPREngine, error) {
@@ -38,8 +58,13 @@ func NewVPREngine(sampleRate, delSilRange int, deleteSil bool, ubmFile, userMode
 		deleteSil:     deleteSil,
 		delSilRange:   delSilRange,
 		ubm:           gmm.NewGMM(),
+		prior:         constant.TARGET_PRIOR,
 		_minTrainLen:  int64(sampleRate * 2),
 		_minVerLen:    int64(float64(sampleRate) * 0.25),
+
+		// the same durations in frames, for precomputed features
+		_minTrainFrames: 2 * 1000 / constant.FRAME_SHIFTt,
+		_minVerFrames:   250 / constant.FRAME_SHIFTt,
 	}
 
 	err := engine.init()
@@ -59,12 +84,26 @@ func (this *VPREngine) init() error {
 		log.Error(err)
 		return NewError(LSV_ERR_MODEL_LOAD_FAILED, err.Error())
 	}
+
+	// the calibration is optional, the raw scores need none
+	c, err := calibration.Load(calibration.File(this.ubmFile))
+	if err != nil && !os.IsNotExist(err) {
+		log.Error(err)
+		return NewError(LSV_ERR_MODEL_LOAD_FAILED, err.Error())
+	}
+	this.calibration = c
 	return nil
 }
 
 func (this *VPREngine) TrainModel() error {
-	if this.trainBuf == nil || int64(len(this.trainBuf)) < this._minTrainLen {
-		return LSV_ERR_NO_AVAILABLE_DATA
+	if this.trainStats != nil {
+		return this.trainFromStats()
+	}
+
+	if len(this.trainFeatures) == 0 {
+		if this.trainBuf == nil || int64(len(this.trainBuf)) < this._minTrainLen {
+			return LSV_ERR_NO_AVAILABLE_DATA
+		}
 	}
 
 	tmpubm := gmm.NewGMM()
@@ -72,11 +111,20 @@ func (this *VPREngine) TrainModel() error {
 
 	client := gmm.NewGMM()
 	client.DupModel(this.ubm)
-	if err := feature.Extract(this.trainBuf, tmpubm); err != nil {
+
+	features, err := this.features(this.trainBuf, this.trainFeatures)
+	if err != nil {
 		log.Error(err)
 		return NewError(LSV_ERR_MEM_INSUFFICIENT, err.Error())
 	}
 
+	if len(this.trainFeatures) > 0 && len(features) < this._minTrainFrames {
+		return LSV_ERR_NO_AVAILABLE_DATA
+	}
+
+	tmpubm.Frames = len(features)
+	tmpubm.FeatureData = features
+
 	for k := 0; k < constant.MAXLOP; k++ {
 		if ret, err := tmpubm.EM(tmpubm.Mixtures); ret == 0 || err != nil {
 			log.Error(err)
@@ -93,6 +141,10 @@ func (this *VPREngine) TrainModel() error {
 		}
 	}
 
+	return this.saveModel(client)
+}
+
+func (this *VPREngine) saveModel(client *gmm.GMM) error {
 	userModelPath := path.Dir(this.userModelFile)
 	err := os.MkdirAll(userModelPath, 0755)
 	if err != nil {
@@ -108,8 +160,27 @@ func (this *VPREngine) TrainModel() error {
 }
 
 func (this *VPREngine) VerifyModel() error {
-	if this.verifyBuf == nil || len(this.verifyBuf) <= 0 {
-		return LSV_ERR_NO_AVAILABLE_DATA
+	if this.verifyStream != nil {
+		return this.verifyFromStats()
+	}
+
+	client, tmpubm, err := this.verifyModels()
+	if err != nil {
+		return err
+	}
+
+	var logClient, logWorld float64
+	logClient = client.LProb(client.FeatureData, 0, int64(client.Frames))
+	logWorld = tmpubm.LProb(tmpubm.FeatureData, 0, int64(tmpubm.Frames))
+	this.score = (logClient - logWorld) / float64(client.Frames)
+	return nil
+}
+
+// verifyModels loads the user model and extracts the verify features into
+// it and into a copy of the ubm.
+func (this *VPREngine) verifyModels() (*gmm.GMM, *gmm.GMM, error) {
+	if (this.verifyBuf == nil || len(this.verifyBuf) <= 0) && len(this.verifyFeatures) == 0 {
+		return nil, nil, LSV_ERR_NO_AVAILABLE_DATA
 	}
 
 	var buf []int16 = this.verifyBuf
@@ -118,37 +189,40 @@ func (this *VPREngine) VerifyModel() error {
 	//buf = waveIO.DelSilence(this.verifyBuf, this.delSilRange)
 
 	length = int64(len(buf))
-	if length < this._minVerLen {
-		return LSV_ERR_NEED_MORE_SAMPLE
+	if len(this.verifyFeatures) == 0 && length < this._minVerLen {
+		return nil, nil, LSV_ERR_NEED_MORE_SAMPLE
 	}
 
 	var client *gmm.GMM = gmm.NewGMM()
 	err := client.LoadModel(this.userModelFile)
 	if err != nil {
 		log.Error(err)
-		return NewError(LSV_ERR_MODEL_LOAD_FAILED, err.Error())
+		return nil, nil, NewError(LSV_ERR_MODEL_LOAD_FAILED, err.Error())
 	}
 
 	tmpubm := gmm.NewGMM()
 	tmpubm.Copy(this.ubm)
 
-	err = feature.Extract(buf, client)
+	features, err := this.features(buf, this.verifyFeatures)
 	if err != nil {
 		log.Error(err)
-		return NewError(LSV_ERR_MEM_INSUFFICIENT, err.Error())
+		return nil, nil, NewError(LSV_ERR_MEM_INSUFFICIENT, err.Error())
 	}
 
+	if len(this.verifyFeatures) > 0 && len(features) < this._minVerFrames {
+		return nil, nil, LSV_ERR_NEED_MORE_SAMPLE
+	}
+
+	client.Frames = len(features)
+	client.FeatureData = features
+
 	err = tmpubm.CopyFeatureData(client)
 	if err != nil {
 		log.Error(err)
-		return NewError(LSV_ERR_MEM_INSUFFICIENT, err.Error())
+		return nil, nil, NewError(LSV_ERR_MEM_INSUFFICIENT, err.Error())
 	}
 
-	var logClient, logWorld float64
-	logClient = client.LProb(client.FeatureData, 0, int64(client.Frames))
-	logWorld = tmpubm.LProb(tmpubm.FeatureData, 0, int64(tmpubm.Frames))
-	this.score = (logClient - logWorld) / float64(client.Frames)
-	return nil
+	return client, tmpubm, nil
 }
 
 func (this *VPREngine) AddTrainBuffer(buf []byte) error {
@@ -185,20 +259,79 @@ func (this *VPREngine) AddVerifyBuffer(buf []byte) error {
 		sBuff = append(sBuff, cBuff16)
 	}
 
+	this.verifySpans = nil
 	if this.deleteSil {
-		sBuff = waveIO.DelSilence(sBuff, this.delSilRange)
+		sBuff, this.verifySpans = waveIO.DelSilenceSpans(sBuff, this.delSilRange)
 	}
 
 	this.verifyBuf = sBuff
 	return nil
 }
 
+// Add precomputed feature frames for training, e.g. from
+// feature.LoadFeatureFile. They must come from the front end the UBM was
+// trained with.
+func (this *VPREngine) AddTrainFeatures(features [][]float32) error {
+	if err := this.checkFeatures(features); err != nil {
+		return err
+	}
+
+	this.trainFeatures = append(this.trainFeatures, features...)
+	return nil
+}
+
+// Set precomputed feature frames to verify.
+func (this *VPREngine) AddVerifyFeatures(features [][]float32) error {
+	if err := this.checkFeatures(features); err != nil {
+		return err
+	}
+
+	this.verifyFeatures = features
+	return nil
+}
+
+func (this *VPREngine) checkFeatures(features [][]float32) error {
+	if len(features) == 0 {
+		return LSV_ERR_NO_AVAILABLE_DATA
+	}
+
+	for i, frame := range features {
+		if len(frame) != this.ubm.VectorSize {
+			return NewError(LSV_ERR_INVALID_PARAM,
+				fmt.Sprintf("frame %d has %d coefficients, ubm expects %d", i, len(frame), this.ubm.VectorSize))
+		}
+	}
+	return nil
+}
+
+// features of the samples in buf followed by the precomputed frames
+func (this *VPREngine) features(buf []int16, precomputed [][]float32) ([][]float32, error) {
+	if len(buf) == 0 {
+		return precomputed, nil
+	}
+
+	features, err := feature.Features(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(features) > 0 && len(features[0]) != this.ubm.VectorSize {
+		return nil, fmt.Errorf("feature dimension %d, ubm expects %d", len(features[0]), this.ubm.VectorSize)
+	}
+	return append(features, precomputed...), nil
+}
+
 func (this *VPREngine) ClearTrainBuffer() {
 	this.trainBuf = this.trainBuf[:0]
+	this.trainFeatures = nil
+	this.trainStats = nil
 }
 
 func (this *VPREngine) ClearVerifyBuffer() {
 	this.verifyBuf = this.verifyBuf[:0]
+	this.verifySpans = nil
+	this.verifyFeatures = nil
+	this.verifyStream = nil
 }
 
 func (this *VPREngine) ClearAllBuffer() {
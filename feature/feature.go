@@ -7,202 +7,326 @@ import (
 	"github.com/liuxp0827/govpr/log"
 	"github.com/liuxp0827/govpr/param"
 	"github.com/liuxp0827/govpr/waveIO"
+	"runtime"
+	"strings"
+	"sync"
 )
 
-type parameter struct {
-	lowCutOff              int  // low cut-off
-	highCutOff             int  // high cut-off
-	filterBankSize         int  // num of filter-bank
-	frameLength            int  // frame length
-	frameShift             int  // frame shift
-	mfccOrder              int  // mfcc order
-	isStatic               bool // static mfcc
-	isDynamic              bool // dynamic mfcc
-	isAcce                 bool // acce mfcc
-	cmsvn                  bool // cmsvn
-	isZeroGlobalMean       bool // zero global mean
-	isDBNorm               bool // decibel normalization
-	isDiffPolish           bool // polish differential formula
-	isDiffPowerSpectrum    bool // differentail power spectrum
-	isPredDiffAmplSpectrum bool // predictive differential amplitude spectrum
-	isEnergyNorm           bool
-	silFloor               int16
-	energyscale            int16
-	isFeatWarping          bool
-	featWarpWinSize        int16
-	isRasta                bool
-	rastaCoff              float64
+// Config holds the front-end settings, DefaultConfig returns the values the
+// shipped UBM was trained with.
+type Config struct {
+	SampleRate             int                  // sample rate
+	LowCutOff              int                  // low cut-off
+	HighCutOff             int                  // high cut-off
+	FilterBankSize         int                  // num of filter-bank
+	FrameLength            int                  // frame length
+	FrameShift             int                  // frame shift
+	MfccOrder              int                  // mfcc order
+	IsStatic               bool                 // static mfcc
+	IsDynamic              bool                 // dynamic mfcc
+	IsAcce                 bool                 // acce mfcc
+	CMSVN                  bool                 // feature normalisation, the mode is Norm
+	IsZeroGlobalMean       bool                 // zero global mean
+	IsDBNorm               bool                 // decibel normalization
+	IsDiffPolish           bool                 // polish differential formula
+	IsDiffPowerSpectrum    bool                 // differentail power spectrum
+	IsPredDiffAmplSpectrum bool                 // predictive differential amplitude spectrum
+	IsEnergyNorm           bool                 // energy normalization
+	SilFloor               int16                // silence floor in dB for energy normalization
+	EnergyScale            int16                // energy scale for energy normalization
+	IsFeatWarping          bool                 // feature warping
+	FeatWarpWinSize        int16                // feature warping window in frames
+	IsRasta                bool                 // rasta filtering
+	RastaCoff              float64              // rasta filter pole
+	ExactFFT               bool                 // fft over exactly one frame, for sample rates where the frame is not 2^N samples
+	FrontEnd               param.FrontEnd       // mfcc (default), lfcc, plp, rasta-plp, ssc or prosody
+	NoiseReduction         param.NoiseReduction // none (default), spectral subtraction or wiener filtering before the filter bank
+	Norm                   param.NormMode       // static-cmvn (default), cmvn, sliding-cmvn or warping
+	NormWindow             int                  // window of sliding-cmvn and warping in frames
 }
 
-func Extract(data []int16, gmm *gmm.GMM) error {
-	var p, para []float32
+func DefaultConfig() Config {
+	return Config{
+		SampleRate:             constant.SAMPLERATE,
+		LowCutOff:              constant.LOW_CUT_OFF,
+		HighCutOff:             constant.HIGH_CUT_OFF,
+		FilterBankSize:         constant.FILTER_BANK_SIZE,
+		FrameLength:            constant.FRAME_LENGTH,
+		FrameShift:             constant.FRAME_SHIFTt,
+		MfccOrder:              constant.MFCC_ORDER,
+		IsStatic:               constant.BSTATIC,
+		IsDynamic:              constant.BDYNAMIC,
+		IsAcce:                 constant.BACCE,
+		CMSVN:                  constant.CMSVN,
+		IsZeroGlobalMean:       constant.ZEROGLOBALMEAN,
+		IsDBNorm:               constant.DBNORM,
+		IsDiffPolish:           constant.DIFPOL,
+		IsDiffPowerSpectrum:    constant.DPSCC,
+		IsPredDiffAmplSpectrum: constant.PDASCC,
+		IsEnergyNorm:           constant.ENERGYNORM,
+		SilFloor:               constant.SIL_FLOOR,
+		EnergyScale:            constant.ENERGY_SCALE,
+		IsFeatWarping:          constant.FEATWARP,
+		FeatWarpWinSize:        constant.FEATURE_WARPING_WIN_SIZE,
+		IsRasta:                constant.RASTA,
+		RastaCoff:              constant.RASTA_COFF,
+		NormWindow:             constant.NORM_WIN_SIZE,
+	}
+}
+
+// Extractor converts samples to feature vectors. The filter bank, windows
+// and lifter are built once by NewExtractor, every call then borrows a
+// clone of that CParam with its own FFT buffers, so one Extractor can be
+// used from many goroutines.
+type Extractor struct {
+	cfg   Config
+	proto *param.CParam
+	pool  sync.Pool
+}
+
+func NewExtractor(cfg Config) (*Extractor, error) {
+	cp, err := newCParam(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Extractor{
+		cfg:   cfg,
+		proto: cp,
+	}
+	e.pool.New = func() interface{} {
+		return e.proto.Clone()
+	}
+	return e, nil
+}
+
+func (e *Extractor) Config() Config {
+	return e.cfg
+}
+
+// Features returns the normalized feature matrix [frame][dimension] of data.
+func (e *Extractor) Features(data []int16) ([][]float32, error) {
+	features, err := e.rawFeatures(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// CMS & CVN
+	if e.cfg.CMSVN {
+		if err := param.Normalize(features, e.cfg.Norm, e.cfg.NormWindow); err != nil {
+			log.Error(err)
+			return nil, fmt.Errorf("Feature Extract error -3")
+		}
+	}
+
+	return features, nil
+}
+
+// features of data before CMSVN
+func (e *Extractor) rawFeatures(data []int16) ([][]float32, error) {
+	var para []float32
 	var info waveIO.WavInfo
-	var cp *param.CParam = param.NewCParam()
-	var pm *parameter = new(parameter)
-	var err error
 	var icol, irow int
 	var buflen int = len(data)
 
-	p = make([]float32, buflen, buflen)
+	cp := e.pool.Get().(*param.CParam)
+	defer e.pool.Put(cp)
+
+	p := make([]float32, buflen, buflen)
 	for i := 0; i < buflen; i++ {
 		p[i] = float32(data[i])
 	}
 
-	pm.lowCutOff = constant.LOW_CUT_OFF
-	pm.highCutOff = constant.HIGH_CUT_OFF
-	pm.filterBankSize = constant.FILTER_BANK_SIZE
-	pm.frameLength = constant.FRAME_LENGTH
-	pm.frameShift = constant.FRAME_SHIFTt
-	pm.mfccOrder = constant.MFCC_ORDER
-
-	pm.isStatic = constant.BSTATIC
-	pm.isDynamic = constant.BDYNAMIC
-	pm.isAcce = constant.BACCE
-
-	pm.cmsvn = constant.CMSVN
-	pm.isZeroGlobalMean = constant.ZEROGLOBALMEAN
-	pm.isDiffPolish = constant.DIFPOL
-	pm.isDiffPowerSpectrum = constant.DPSCC
-	pm.isPredDiffAmplSpectrum = constant.PDASCC
-	pm.isEnergyNorm = constant.ENERGYNORM
-	pm.silFloor = constant.SIL_FLOOR
-
-	pm.energyscale = constant.ENERGY_SCALE
-	pm.isFeatWarping = constant.FEATWARP
-	pm.featWarpWinSize = constant.FEATURE_WARPING_WIN_SIZE
-	pm.isDBNorm = constant.DBNORM
-	pm.isRasta = constant.RASTA
-	pm.rastaCoff = constant.RASTA_COFF
-
-	info.SampleRate = constant.SAMPLERATE
+	info.SampleRate = e.cfg.SampleRate
 	info.Length = int64(buflen)
 	info.BitSPSample = constant.BIT_PER_SAMPLE
 
-	if pm.highCutOff > pm.lowCutOff {
-		err = cp.InitFBank2(info.SampleRate, pm.frameLength, pm.filterBankSize, pm.lowCutOff, pm.highCutOff)
-	} else {
-		err = cp.InitFBank(info.SampleRate, pm.frameLength, pm.filterBankSize)
+	// an error with enough frames still leaves usable features
+	if err := cp.Wav2Mfcc(p, info, &para, &icol, &irow); err != nil && irow < constant.MIN_FRAMES {
+		log.Error(err)
+		return nil, fmt.Errorf("Feature Extract error -2")
 	}
 
-	if err != nil {
-		return err
+	// one backing array for the whole matrix
+	features := make([][]float32, irow, irow)
+	for i := 0; i < irow; i++ {
+		features[i] = para[i*icol : (i+1)*icol : (i+1)*icol]
 	}
+	return features, nil
+}
 
-	err = cp.InitMfcc(pm.mfccOrder, float32(pm.frameShift))
+// NewNormalizer returns a streaming normaliser with the settings of
+// Features, for frames computed without CMSVN. It returns nil when CMSVN is
+// off.
+func (e *Extractor) NewNormalizer() (*param.Normalizer, error) {
+	if !e.cfg.CMSVN {
+		return nil, nil
+	}
+	return param.NewNormalizer(e.cfg.Norm, e.cfg.NormWindow)
+}
+
+// Extract computes the features of data into gmm.FeatureData.
+func (e *Extractor) Extract(data []int16, gmm *gmm.GMM) error {
+	features, err := e.Features(data)
 	if err != nil {
 		return err
 	}
 
-	if pm.isStatic {
-		cp.GetMfcc().IsStatic = true
-	} else {
-		cp.GetMfcc().IsStatic = false
+	gmm.Frames = len(features)
+	gmm.FeatureData = features
+	if gmm.Frames > 0 {
+		gmm.VectorSize = len(features[0])
 	}
+	return nil
+}
 
-	if pm.isDynamic {
-		cp.GetMfcc().IsDynamic = true
-	} else {
-		cp.GetMfcc().IsDynamic = false
+// ExtractBatch computes the features of every utterance in data on
+// runtime.GOMAXPROCS(0) goroutines. The result is in the order of data,
+// the first failing utterance aborts the batch.
+func (e *Extractor) ExtractBatch(data [][]int16) ([][][]float32, error) {
+	out := make([][][]float32, len(data))
+	errs := make([]error, len(data))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := runtime.GOMAXPROCS(0); w > 0; w-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				out[i], errs[i] = e.Features(data[i])
+			}
+		}()
 	}
 
-	if pm.isAcce {
-		cp.GetMfcc().IsAcce = true
-	} else {
-		cp.GetMfcc().IsAcce = false
+	for i := range data {
+		jobs <- i
 	}
+	close(jobs)
+	wg.Wait()
 
-	if pm.isZeroGlobalMean {
-		cp.GetMfcc().IsZeroGlobalMean = true
-	} else {
-		cp.GetMfcc().IsZeroGlobalMean = false
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("utterance %d: %v", i, err)
+		}
 	}
+	return out, nil
+}
 
-	if pm.isDBNorm {
-		cp.GetMfcc().IsDBNorm = true
-	} else {
-		cp.GetMfcc().IsDBNorm = false
+// LoadFeatureFile reads a feature matrix by name: "*.npy" files are NumPy
+// arrays, "archive.ark:offset" is a matrix inside a Kaldi archive and
+// anything else is read as an HTK parameter file.
+func LoadFeatureFile(name string) ([][]float32, error) {
+	if strings.HasSuffix(name, ".npy") {
+		return LoadNpy(name)
 	}
 
-	if pm.isDiffPolish {
-		cp.GetMfcc().IsPolishDiff = true
-	} else {
-		cp.GetMfcc().IsPolishDiff = false
+	if strings.Contains(name, ".ark:") {
+		entry, err := parseKaldiRxspecifier(name)
+		if err != nil {
+			return nil, err
+		}
+		return entry.Load()
 	}
 
-	if pm.isDiffPowerSpectrum {
-		cp.GetMfcc().IsDiffPowerSpectrum = true
-	} else {
-		cp.GetMfcc().IsDiffPowerSpectrum = false
-	}
+	features, _, err := LoadHTK(name)
+	return features, err
+}
 
-	if pm.isPredDiffAmplSpectrum {
-		cp.GetMfcc().IsPredDiffAmpSpetrum = true
-	} else {
-		cp.GetMfcc().IsPredDiffAmpSpetrum = false
-	}
+var (
+	defaultExtractor     *Extractor
+	defaultExtractorErr  error
+	defaultExtractorOnce sync.Once
+)
 
-	if pm.isEnergyNorm {
-		cp.GetMfcc().IsEnergyNorm = true
-	} else {
-		cp.GetMfcc().IsEnergyNorm = false
-	}
+func getDefaultExtractor() (*Extractor, error) {
+	defaultExtractorOnce.Do(func() {
+		defaultExtractor, defaultExtractorErr = NewExtractor(DefaultConfig())
+	})
+	return defaultExtractor, defaultExtractorErr
+}
 
-	if pm.isEnergyNorm {
-		cp.GetMfcc().SilFloor = pm.silFloor
-	} else {
-		cp.GetMfcc().SilFloor = constant.SIL_FLOOR
+// NewStream returns a feature stream with DefaultConfig.
+func NewStream(blockLength int, emit func(frames [][]float32) error) (*Stream, error) {
+	e, err := getDefaultExtractor()
+	if err != nil {
+		return nil, err
 	}
+	return e.NewStream(blockLength, emit)
+}
 
-	if pm.isEnergyNorm {
-		cp.GetMfcc().EnergyScale = pm.energyscale
-	} else {
-		cp.GetMfcc().EnergyScale = constant.ENERGY_SCALE
+// Extract computes the features of data with DefaultConfig.
+func Extract(data []int16, gmm *gmm.GMM) error {
+	e, err := getDefaultExtractor()
+	if err != nil {
+		return err
 	}
+	return e.Extract(data, gmm)
+}
 
-	if pm.isFeatWarping {
-		cp.GetMfcc().IsFeatWarping = true
-	} else {
-		cp.GetMfcc().IsFeatWarping = false
+// Features returns the feature matrix of data with DefaultConfig.
+func Features(data []int16) ([][]float32, error) {
+	e, err := getDefaultExtractor()
+	if err != nil {
+		return nil, err
 	}
+	return e.Features(data)
+}
 
-	if pm.isFeatWarping {
-		cp.GetMfcc().FeatWarpWinSize = pm.featWarpWinSize
-	} else {
-		cp.GetMfcc().FeatWarpWinSize = constant.FEATURE_WARPING_WIN_SIZE
+func newCParam(cfg Config) (*param.CParam, error) {
+	var cp *param.CParam = param.NewCParam()
+	var err error
+
+	cp.SetExactFFT(cfg.ExactFFT)
+	if err = cp.SetNoiseReduction(cfg.NoiseReduction); err != nil {
+		return nil, err
+	}
+	if err = cp.SetFrontEnd(cfg.FrontEnd); err != nil {
+		return nil, err
 	}
 
-	if pm.isRasta {
-		cp.GetMfcc().IsRasta = true
+	if cfg.HighCutOff > cfg.LowCutOff {
+		err = cp.InitFBank2(cfg.SampleRate, cfg.FrameLength, cfg.FilterBankSize, cfg.LowCutOff, cfg.HighCutOff)
 	} else {
-		cp.GetMfcc().IsRasta = false
+		err = cp.InitFBank(cfg.SampleRate, cfg.FrameLength, cfg.FilterBankSize)
 	}
 
-	cp.GetMfcc().RastaCoff = pm.rastaCoff
-
-	if nil != cp.Wav2Mfcc(p, info, &para, &icol, &irow) && irow < constant.MIN_FRAMES {
-		return fmt.Errorf("Feature Extract error -2")
+	if err != nil {
+		return nil, err
 	}
 
-	gmm.VectorSize = icol
-	gmm.Frames = irow
-	gmm.FeatureData = make([][]float32, gmm.Frames, gmm.Frames)
-	for i := 0; i < gmm.Frames; i++ {
-		gmm.FeatureData[i] = make([]float32, gmm.VectorSize, gmm.VectorSize)
+	err = cp.InitMfcc(cfg.MfccOrder, float32(cfg.FrameShift))
+	if err != nil {
+		return nil, err
 	}
 
-	for ii := 0; ii < irow; ii++ {
-		for jj := 0; jj < icol; jj++ {
-			gmm.FeatureData[ii][jj] = para[ii*icol+jj]
-		}
+	mfcc := cp.GetMfcc()
+	mfcc.IsStatic = cfg.IsStatic
+	mfcc.IsDynamic = cfg.IsDynamic
+	mfcc.IsAcce = cfg.IsAcce
+	mfcc.IsZeroGlobalMean = cfg.IsZeroGlobalMean
+	mfcc.IsDBNorm = cfg.IsDBNorm
+	mfcc.IsPolishDiff = cfg.IsDiffPolish
+	mfcc.IsDiffPowerSpectrum = cfg.IsDiffPowerSpectrum
+	mfcc.IsPredDiffAmpSpetrum = cfg.IsPredDiffAmplSpectrum
+	mfcc.IsEnergyNorm = cfg.IsEnergyNorm
+	mfcc.IsFeatWarping = cfg.IsFeatWarping
+	mfcc.IsRasta = cfg.IsRasta
+	mfcc.RastaCoff = cfg.RastaCoff
+
+	if cfg.IsEnergyNorm {
+		mfcc.SilFloor = cfg.SilFloor
+		mfcc.EnergyScale = cfg.EnergyScale
+	} else {
+		mfcc.SilFloor = constant.SIL_FLOOR
+		mfcc.EnergyScale = constant.ENERGY_SCALE
 	}
 
-	// CMS & CVN
-	if pm.cmsvn {
-		if err = cp.FeatureNorm(gmm.FeatureData, icol, irow); err != nil {
-			log.Error(err)
-			return fmt.Errorf("Feature Extract error -3")
-		}
+	if cfg.IsFeatWarping {
+		mfcc.FeatWarpWinSize = cfg.FeatWarpWinSize
+	} else {
+		mfcc.FeatWarpWinSize = constant.FEATURE_WARPING_WIN_SIZE
 	}
 
-	return nil
+	return cp, nil
 }
@@ -0,0 +1,148 @@
+package feature
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/liuxp0827/govpr/constant"
+)
+
+// testSignal returns seconds of a vowel-like signal: harmonics of a pitch
+// drifting around 150 Hz under a syllable envelope, over a little noise
+func testSignal(seed int64, seconds float64) []int16 {
+	rng := rand.New(rand.NewSource(seed))
+	n := int(seconds * constant.SAMPLERATE)
+	data := make([]int16, n)
+	var phase float64
+	for i := range data {
+		t := float64(i) / constant.SAMPLERATE
+		phase += 2 * math.Pi * (150 + 20*math.Sin(2*math.Pi*0.5*t)) / constant.SAMPLERATE
+		var v float64
+		for h := 1; h <= 10; h++ {
+			v += math.Sin(float64(h)*phase) / float64(h)
+		}
+		env := 0.6 + 0.4*math.Sin(2*math.Pi*4*t)
+		data[i] = int16(4000*env*v + 100*rng.NormFloat64())
+	}
+	return data
+}
+
+func TestExtractorConcurrent(t *testing.T) {
+	e, err := NewExtractor(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signals := make([][]int16, 6)
+	want := make([][][]float32, len(signals))
+	for i := range signals {
+		signals[i] = testSignal(int64(i), 4)
+		if want[i], err = e.Features(signals[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the pooled buffers of a goroutine do not leak into another's features
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		for i := range signals {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				got, err := e.Features(signals[i])
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !equalFeatures(got, want[i]) {
+					t.Errorf("concurrent features of signal %d differ from the serial ones", i)
+				}
+			}(i)
+		}
+	}
+	wg.Wait()
+
+	batch, err := e.ExtractBatch(signals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range signals {
+		if !equalFeatures(batch[i], want[i]) {
+			t.Errorf("batch features of signal %d differ from the serial ones", i)
+		}
+	}
+}
+
+func equalFeatures(a, b [][]float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// BenchmarkFeatures extracts with one Extractor, borrowing its pooled
+// buffers
+func BenchmarkFeatures(b *testing.B) {
+	e, err := NewExtractor(DefaultConfig())
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := testSignal(1, 5)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := e.Features(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkFeaturesNewExtractor builds the filter bank and buffers on every
+// call, as before the Extractor
+func BenchmarkFeaturesNewExtractor(b *testing.B) {
+	data := testSignal(1, 5)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e, err := NewExtractor(DefaultConfig())
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := e.Features(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExtractBatch(b *testing.B) {
+	e, err := NewExtractor(DefaultConfig())
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := make([][]int16, 8)
+	for i := range data {
+		data[i] = testSignal(int64(i), 5)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := e.ExtractBatch(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package feature
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/liuxp0827/govpr/file"
+	"github.com/liuxp0827/govpr/param"
+	"io"
+	"os"
+)
+
+// HTK parameter kinds and qualifiers
+const (
+	HTK_LPCEPSTRA = 3
+	HTK_MFCC      = 6
+	HTK_FBANK     = 7
+	HTK_USER      = 9
+	HTK_PLP       = 11
+
+	HTK_E = 0000100 // has energy
+	HTK_N = 0000200 // absolute energy suppressed
+	HTK_D = 0000400 // has delta coefficients
+	HTK_A = 0001000 // has acceleration coefficients
+	HTK_C = 0002000 // is compressed
+	HTK_Z = 0004000 // has zero mean static coef.
+	HTK_K = 0010000 // has CRC checksum
+	HTK_0 = 0020000 // has 0th cepstral coef.
+)
+
+// HTKHeader is the 12 byte big-endian header of an HTK parameter file.
+type HTKHeader struct {
+	Samples    int32 // number of frames
+	SampPeriod int32 // frame shift in 100ns units
+	SampSize   int16 // bytes per frame
+	ParmKind   int16 // base kind and qualifiers
+}
+
+// HTKParmKind returns the HTK parameter kind matching the output of cfg.
+func HTKParmKind(cfg Config) int16 {
+	var kind int16
+	switch cfg.FrontEnd {
+	case param.FrontEndMFCC:
+		kind = HTK_MFCC
+	case param.FrontEndPLP, param.FrontEndRastaPLP:
+		kind = HTK_PLP
+	default:
+		return HTK_USER
+	}
+
+	if cfg.IsDynamic {
+		kind |= HTK_D
+	}
+	if cfg.IsAcce {
+		kind |= HTK_A
+	}
+	return kind
+}
+
+// Write features as an uncompressed HTK parameter file.
+func WriteHTK(w io.Writer, features [][]float32, sampPeriod int32, parmKind int16) error {
+	var dim int
+	if len(features) > 0 {
+		dim = len(features[0])
+	}
+
+	var buf []byte = make([]byte, 12, 12)
+	file.PutUint32BE(buf[0:], uint32(len(features)))
+	file.PutUint32BE(buf[4:], uint32(sampPeriod))
+	file.PutUint16BE(buf[8:], uint16(dim*4))
+	file.PutUint16BE(buf[10:], uint16(parmKind&^(HTK_C|HTK_K)))
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+
+	buf = make([]byte, dim*4, dim*4)
+	for i, frame := range features {
+		if len(frame) != dim {
+			return fmt.Errorf("frame %d has %d coefficients, expected %d", i, len(frame), dim)
+		}
+		for j, v := range frame {
+			file.PutFloat32BE(buf[j*4:], v)
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read an HTK parameter file, compressed (_C) files are decompressed and a
+// trailing CRC (_K) is ignored.
+func ReadHTK(r io.Reader) ([][]float32, HTKHeader, error) {
+	var hdr HTKHeader
+	var buf []byte = make([]byte, 12, 12)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, hdr, err
+	}
+
+	hdr.Samples = int32(file.GetUint32BE(buf[0:]))
+	hdr.SampPeriod = int32(file.GetUint32BE(buf[4:]))
+	hdr.SampSize = int16(file.GetUint16BE(buf[8:]))
+	hdr.ParmKind = int16(file.GetUint16BE(buf[10:]))
+
+	if hdr.Samples < 0 || hdr.SampSize <= 0 {
+		return nil, hdr, fmt.Errorf("invalid htk header")
+	}
+
+	if hdr.ParmKind&HTK_C == 0 {
+		if hdr.SampSize%4 != 0 {
+			return nil, hdr, fmt.Errorf("invalid htk sample size %d", hdr.SampSize)
+		}
+
+		features, _ := newMatrix(int(hdr.Samples), int(hdr.SampSize)/4)
+		buf = make([]byte, hdr.SampSize)
+		for i := range features {
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return nil, hdr, err
+			}
+			for j := range features[i] {
+				features[i][j] = file.GetFloat32BE(buf[j*4:])
+			}
+		}
+		return features, hdr, nil
+	}
+
+	// compressed: int16 values, x = (v + B) / A, the A and B vectors take
+	// the room of the first 4 frames
+	if hdr.SampSize%2 != 0 {
+		return nil, hdr, fmt.Errorf("invalid htk sample size %d", hdr.SampSize)
+	}
+
+	dim := int(hdr.SampSize) / 2
+	hdr.Samples -= 4
+	if hdr.Samples < 0 {
+		return nil, hdr, fmt.Errorf("invalid htk header")
+	}
+
+	buf = make([]byte, dim*4)
+	scale := make([]float32, dim)
+	bias := make([]float32, dim)
+	for _, vec := range [][]float32{scale, bias} {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, hdr, err
+		}
+		for j := range vec {
+			vec[j] = file.GetFloat32BE(buf[j*4:])
+		}
+	}
+
+	features, _ := newMatrix(int(hdr.Samples), dim)
+	buf = make([]byte, dim*2)
+	for i := range features {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, hdr, err
+		}
+		for j := range features[i] {
+			v := float32(int16(file.GetUint16BE(buf[j*2:])))
+			features[i][j] = (v + bias[j]) / scale[j]
+		}
+	}
+
+	hdr.SampSize = int16(dim * 4)
+	hdr.ParmKind &^= HTK_C | HTK_K
+	return features, hdr, nil
+}
+
+func SaveHTK(filename string, features [][]float32, sampPeriod int32, parmKind int16) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if err = WriteHTK(w, features, sampPeriod, parmKind); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func LoadHTK(filename string) ([][]float32, HTKHeader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, HTKHeader{}, err
+	}
+	defer f.Close()
+
+	return ReadHTK(bufio.NewReader(f))
+}
@@ -0,0 +1,364 @@
+package feature
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/liuxp0827/govpr/file"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// KaldiWriter writes float matrices to a binary Kaldi archive and, when scp
+// is not nil, the matching "key ark:offset" script lines.
+type KaldiWriter struct {
+	ark     io.Writer
+	scp     io.Writer
+	arkName string
+	offset  int64
+}
+
+// NewKaldiWriter writes the archive to ark. arkName is the archive path
+// written to the scp lines.
+func NewKaldiWriter(ark io.Writer, scp io.Writer, arkName string) *KaldiWriter {
+	return &KaldiWriter{
+		ark:     ark,
+		scp:     scp,
+		arkName: arkName,
+	}
+}
+
+func (kw *KaldiWriter) Write(key string, features [][]float32) error {
+	if key == "" || strings.ContainsAny(key, " \t\n") {
+		return fmt.Errorf("invalid kaldi key %q", key)
+	}
+
+	var dim int
+	if len(features) > 0 {
+		dim = len(features[0])
+	}
+
+	// key, then the binary marker "\0B" where the scp offset points to
+	head := key + " "
+	buf := make([]byte, 0, len(head)+2+3+10+dim*4)
+	buf = append(buf, head...)
+	objOffset := kw.offset + int64(len(buf))
+	buf = append(buf, 0, 'B')
+	buf = append(buf, "FM "...)
+	buf = appendKaldiInt32(buf, int32(len(features)))
+	buf = appendKaldiInt32(buf, int32(dim))
+	if err := kw.write(buf); err != nil {
+		return err
+	}
+
+	row := make([]byte, dim*4)
+	for i, frame := range features {
+		if len(frame) != dim {
+			return fmt.Errorf("frame %d has %d coefficients, expected %d", i, len(frame), dim)
+		}
+		for j, v := range frame {
+			file.PutFloat32LE(row[j*4:], v)
+		}
+		if err := kw.write(row); err != nil {
+			return err
+		}
+	}
+
+	if kw.scp != nil {
+		if _, err := fmt.Fprintf(kw.scp, "%s %s:%d\n", key, kw.arkName, objOffset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (kw *KaldiWriter) write(b []byte) error {
+	n, err := kw.ark.Write(b)
+	kw.offset += int64(n)
+	return err
+}
+
+func appendKaldiInt32(b []byte, v int32) []byte {
+	var tmp [4]byte
+	file.PutUint32LE(tmp[:], uint32(v))
+	return append(append(b, 4), tmp[:]...)
+}
+
+// KaldiReader reads the matrices of a binary Kaldi archive in order.
+type KaldiReader struct {
+	r *bufio.Reader
+}
+
+func NewKaldiReader(r io.Reader) *KaldiReader {
+	return &KaldiReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next key and matrix, io.EOF after the last one.
+func (kr *KaldiReader) Next() (string, [][]float32, error) {
+	// skip white space between entries
+	for {
+		c, err := kr.r.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			kr.r.UnreadByte()
+			break
+		}
+	}
+
+	key, err := kr.r.ReadString(' ')
+	if err != nil {
+		return "", nil, fmt.Errorf("truncated kaldi archive")
+	}
+
+	features, err := ReadKaldiMatrix(kr.r)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %v", key[:len(key)-1], err)
+	}
+	return key[:len(key)-1], features, nil
+}
+
+// ReadKaldiMatrix reads one binary Kaldi matrix starting at the "\0B"
+// marker. FM, DM and the compressed CM, CM2, CM3 forms are supported.
+func ReadKaldiMatrix(r io.Reader) ([][]float32, error) {
+	var marker [2]byte
+	if _, err := io.ReadFull(r, marker[:]); err != nil {
+		return nil, err
+	}
+	if marker[0] != 0 || marker[1] != 'B' {
+		return nil, fmt.Errorf("only binary kaldi matrices are supported")
+	}
+
+	token, err := readKaldiToken(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case "FM", "DM":
+		rows, err := readKaldiInt32(r)
+		if err != nil {
+			return nil, err
+		}
+		cols, err := readKaldiInt32(r)
+		if err != nil {
+			return nil, err
+		}
+		if rows < 0 || cols < 0 {
+			return nil, fmt.Errorf("invalid matrix size %dx%d", rows, cols)
+		}
+
+		size := 4
+		if token == "DM" {
+			size = 8
+		}
+
+		features, data := newMatrix(int(rows), int(cols))
+		buf := make([]byte, int(cols)*size)
+		for i := 0; i < int(rows); i++ {
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return nil, err
+			}
+			for j := 0; j < int(cols); j++ {
+				if size == 4 {
+					data[i*int(cols)+j] = file.GetFloat32LE(buf[j*4:])
+				} else {
+					data[i*int(cols)+j] = float32(file.GetFloat64LE(buf[j*8:]))
+				}
+			}
+		}
+		return features, nil
+
+	case "CM", "CM2", "CM3":
+		return readKaldiCompressed(r, token)
+	}
+
+	return nil, fmt.Errorf("unsupported kaldi object %q", token)
+}
+
+func readKaldiCompressed(r io.Reader, token string) ([][]float32, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	minValue := file.GetFloat32LE(hdr[0:])
+	valueRange := file.GetFloat32LE(hdr[4:])
+	rows := int(int32(file.GetUint32LE(hdr[8:])))
+	cols := int(int32(file.GetUint32LE(hdr[12:])))
+	if rows < 0 || cols < 0 {
+		return nil, fmt.Errorf("invalid matrix size %dx%d", rows, cols)
+	}
+
+	features, data := newMatrix(rows, cols)
+	switch token {
+	case "CM2":
+		// uint16 per element, row major
+		buf := make([]byte, rows*cols*2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		for i := range data {
+			data[i] = minValue + valueRange*float32(file.GetUint16LE(buf[i*2:]))/65535
+		}
+
+	case "CM3":
+		// uint8 per element, row major
+		buf := make([]byte, rows*cols)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		for i := range data {
+			data[i] = minValue + valueRange*float32(buf[i])/255
+		}
+
+	default:
+		// per column percentile headers, then uint8 per element, column major
+		colHdr := make([]byte, cols*8)
+		if _, err := io.ReadFull(r, colHdr); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, rows*cols)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+
+		toFloat := func(v uint16) float32 {
+			return minValue + valueRange*float32(v)/65535
+		}
+		for j := 0; j < cols; j++ {
+			p0 := toFloat(file.GetUint16LE(colHdr[j*8:]))
+			p25 := toFloat(file.GetUint16LE(colHdr[j*8+2:]))
+			p75 := toFloat(file.GetUint16LE(colHdr[j*8+4:]))
+			p100 := toFloat(file.GetUint16LE(colHdr[j*8+6:]))
+			for i := 0; i < rows; i++ {
+				v := float32(buf[j*rows+i])
+				switch {
+				case v <= 64:
+					data[i*cols+j] = p0 + (p25-p0)*v/64
+				case v <= 192:
+					data[i*cols+j] = p25 + (p75-p25)*(v-64)/128
+				default:
+					data[i*cols+j] = p75 + (p100-p75)*(v-192)/63
+				}
+			}
+		}
+	}
+
+	return features, nil
+}
+
+// KaldiScpEntry is one line of a Kaldi script file, "key ark:offset".
+type KaldiScpEntry struct {
+	Key    string
+	Ark    string
+	Offset int64
+}
+
+func ReadKaldiScp(r io.Reader) ([]KaldiScpEntry, error) {
+	var entries []KaldiScpEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("scp line %d: expected \"key ark:offset\"", line)
+		}
+
+		entry, err := parseKaldiRxspecifier(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("scp line %d: %v", line, err)
+		}
+		entry.Key = fields[0]
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func LoadKaldiScp(filename string) ([]KaldiScpEntry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadKaldiScp(f)
+}
+
+// Load the matrix an scp entry points to.
+func (e KaldiScpEntry) Load() ([][]float32, error) {
+	f, err := os.Open(e.Ark)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, err = f.Seek(e.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return ReadKaldiMatrix(bufio.NewReader(f))
+}
+
+// "foo.ark:123" -> foo.ark, 123. Range specifiers are not supported.
+func parseKaldiRxspecifier(spec string) (KaldiScpEntry, error) {
+	var entry KaldiScpEntry
+	if strings.HasSuffix(spec, "]") {
+		return entry, fmt.Errorf("matrix ranges are not supported: %s", spec)
+	}
+
+	i := strings.LastIndex(spec, ":")
+	if i <= 0 {
+		return entry, fmt.Errorf("missing archive offset: %s", spec)
+	}
+
+	offset, err := strconv.ParseInt(spec[i+1:], 10, 64)
+	if err != nil || offset < 0 {
+		return entry, fmt.Errorf("invalid archive offset: %s", spec)
+	}
+
+	entry.Ark = spec[:i]
+	entry.Offset = offset
+	return entry, nil
+}
+
+func readKaldiToken(r io.Reader) (string, error) {
+	var token []byte
+	var c [1]byte
+	for {
+		if _, err := io.ReadFull(r, c[:]); err != nil {
+			return "", err
+		}
+		if c[0] == ' ' {
+			return string(token), nil
+		}
+		token = append(token, c[0])
+		if len(token) > 16 {
+			return "", fmt.Errorf("invalid kaldi token")
+		}
+	}
+}
+
+func readKaldiInt32(r io.Reader) (int32, error) {
+	var buf [5]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+	if buf[0] != 4 {
+		return 0, fmt.Errorf("invalid kaldi int32 size %d", buf[0])
+	}
+	return int32(file.GetUint32LE(buf[1:])), nil
+}
+
+// rows x cols matrix on one backing array
+func newMatrix(rows, cols int) ([][]float32, []float32) {
+	data := make([]float32, rows*cols)
+	features := make([][]float32, rows)
+	for i := range features {
+		features[i] = data[i*cols : (i+1)*cols : (i+1)*cols]
+	}
+	return features, data
+}
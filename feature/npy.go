@@ -0,0 +1,191 @@
+package feature
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/liuxp0827/govpr/file"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var npyMagic = []byte("\x93NUMPY")
+
+// Write features as a 2-D little-endian float32 .npy array (format 1.0).
+func WriteNpy(w io.Writer, features [][]float32) error {
+	var dim int
+	if len(features) > 0 {
+		dim = len(features[0])
+	}
+
+	header := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%d, %d), }", len(features), dim)
+
+	// magic, version and header length take 10 bytes, the header is padded
+	// with spaces so the data starts on a 64 byte boundary
+	pad := 64 - (10+len(header)+1)%64
+	if pad == 64 {
+		pad = 0
+	}
+	header += strings.Repeat(" ", pad) + "\n"
+
+	buf := make([]byte, 0, 10+len(header))
+	buf = append(buf, npyMagic...)
+	buf = append(buf, 1, 0, 0, 0)
+	file.PutUint16LE(buf[8:10], uint16(len(header)))
+	buf = append(buf, header...)
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+
+	row := make([]byte, dim*4)
+	for i, frame := range features {
+		if len(frame) != dim {
+			return fmt.Errorf("frame %d has %d coefficients, expected %d", i, len(frame), dim)
+		}
+		for j, v := range frame {
+			file.PutFloat32LE(row[j*4:], v)
+		}
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	npyDescr   = regexp.MustCompile(`'descr'\s*:\s*'([<>|=])([fi])(\d)'`)
+	npyFortran = regexp.MustCompile(`'fortran_order'\s*:\s*(True|False)`)
+	npyShape   = regexp.MustCompile(`'shape'\s*:\s*\(([^)]*)\)`)
+)
+
+// Read a 1-D or 2-D float32/float64 .npy array, C or Fortran order. A 1-D
+// array is returned as a single column.
+func ReadNpy(r io.Reader) ([][]float32, error) {
+	var pre [8]byte
+	if _, err := io.ReadFull(r, pre[:]); err != nil {
+		return nil, err
+	}
+	if string(pre[:6]) != string(npyMagic) {
+		return nil, fmt.Errorf("not a npy file")
+	}
+
+	var hlen int
+	switch pre[6] {
+	case 1:
+		var b [2]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, err
+		}
+		hlen = int(file.GetUint16LE(b[:]))
+	case 2, 3:
+		var b [4]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, err
+		}
+		hlen = int(file.GetUint32LE(b[:]))
+	default:
+		return nil, fmt.Errorf("unsupported npy version %d.%d", pre[6], pre[7])
+	}
+
+	hbuf := make([]byte, hlen)
+	if _, err := io.ReadFull(r, hbuf); err != nil {
+		return nil, err
+	}
+	header := string(hbuf)
+
+	m := npyDescr.FindStringSubmatch(header)
+	if m == nil || m[2] != "f" || (m[3] != "4" && m[3] != "8") {
+		return nil, fmt.Errorf("unsupported npy dtype, only float32 and float64 are supported")
+	}
+	bigEndian := m[1] == ">"
+	size, _ := strconv.Atoi(m[3])
+
+	fortran := false
+	if fm := npyFortran.FindStringSubmatch(header); fm != nil {
+		fortran = fm[1] == "True"
+	}
+
+	sm := npyShape.FindStringSubmatch(header)
+	if sm == nil {
+		return nil, fmt.Errorf("npy header without shape")
+	}
+	var shape []int
+	for _, s := range strings.Split(sm[1], ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid npy shape (%s)", sm[1])
+		}
+		shape = append(shape, n)
+	}
+
+	var rows, cols int
+	switch len(shape) {
+	case 1:
+		rows, cols = shape[0], 1
+	case 2:
+		rows, cols = shape[0], shape[1]
+	default:
+		return nil, fmt.Errorf("npy array must be 1-D or 2-D, got %d-D", len(shape))
+	}
+
+	buf := make([]byte, rows*cols*size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	features, data := newMatrix(rows, cols)
+	for k := range data {
+		var v float32
+		b := buf[k*size:]
+		switch {
+		case size == 4 && bigEndian:
+			v = file.GetFloat32BE(b)
+		case size == 4:
+			v = file.GetFloat32LE(b)
+		case bigEndian:
+			v = float32(file.GetFloat64BE(b))
+		default:
+			v = float32(file.GetFloat64LE(b))
+		}
+
+		if fortran {
+			data[(k%rows)*cols+k/rows] = v
+		} else {
+			data[k] = v
+		}
+	}
+	return features, nil
+}
+
+func SaveNpy(filename string, features [][]float32) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if err = WriteNpy(w, features); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func LoadNpy(filename string) ([][]float32, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadNpy(bufio.NewReader(f))
+}
@@ -0,0 +1,132 @@
+package feature
+
+import (
+	"fmt"
+	"github.com/liuxp0827/govpr/constant"
+	"github.com/liuxp0827/govpr/param"
+	"github.com/liuxp0827/govpr/waveIO"
+	"io"
+)
+
+// Stream computes the features of a recording of any length in blocks, so
+// only about two blocks of samples are held at a time. Every block goes
+// through the front end like a separate utterance, the framing continues
+// across blocks without dropping or repeating samples. Sliding-cmvn and
+// warping run across the blocks, static-cmvn and cmvn normalise each block
+// on its own.
+type Stream struct {
+	e     *Extractor
+	block int // samples per block
+	shift int // samples per frame shift
+	span  int // samples per frame
+	buf   []int16
+	norm  *param.Normalizer
+	emit  func(frames [][]float32) error
+}
+
+// NewStream passes the frames of every block to emit as soon as they are
+// computed. blockLength is in ms, <= 0 means STREAM_BLOCK_LEN.
+func (e *Extractor) NewStream(blockLength int, emit func(frames [][]float32) error) (*Stream, error) {
+	if blockLength <= 0 {
+		blockLength = constant.STREAM_BLOCK_LEN
+	}
+
+	s := &Stream{
+		e:     e,
+		block: e.cfg.SampleRate * blockLength / 1000,
+		shift: int(1e-3 * float32(e.cfg.FrameShift) * float32(e.cfg.SampleRate)),
+		span:  int(float32(e.cfg.SampleRate) * float32(e.cfg.FrameLength) * 1e-3),
+		emit:  emit,
+	}
+	if s.shift <= 0 || s.block < s.span {
+		return nil, fmt.Errorf("block of %d ms shorter than a frame", blockLength)
+	}
+
+	norm, err := e.NewNormalizer()
+	if err != nil {
+		return nil, err
+	}
+	s.norm = norm
+	return s, nil
+}
+
+// Write adds samples, full blocks are processed while at least one more
+// block is buffered so the last block is never shorter than a block.
+func (s *Stream) Write(samples []int16) error {
+	s.buf = append(s.buf, samples...)
+	for len(s.buf) >= 2*s.block {
+		if err := s.process(s.block, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteWave reads r to the end and writes its samples.
+func (s *Stream) WriteWave(r *waveIO.Reader) error {
+	if r.SampleRate != s.e.cfg.SampleRate {
+		return fmt.Errorf("wave sample rate %d, features expect %d", r.SampleRate, s.e.cfg.SampleRate)
+	}
+
+	chunk := make([]int16, s.block/4+1)
+	for {
+		n, err := r.Read(chunk)
+		if n > 0 {
+			if werr := s.Write(chunk[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close processes the buffered samples and flushes the normaliser.
+func (s *Stream) Close() error {
+	if len(s.buf) >= s.span {
+		if err := s.process(len(s.buf), true); err != nil {
+			return err
+		}
+	} else if s.norm != nil {
+		if out := s.norm.Flush(); len(out) > 0 {
+			return s.emit(out)
+		}
+	}
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// process the first length samples, keeping the samples the next frame
+// starts at
+func (s *Stream) process(length int, last bool) error {
+	features, err := s.e.rawFeatures(s.buf[:length])
+	if err != nil {
+		return err
+	}
+
+	used := (length - (s.span - s.shift)) / s.shift * s.shift
+	if last {
+		used = len(s.buf)
+	}
+	s.buf = s.buf[:copy(s.buf, s.buf[used:])]
+
+	if s.norm != nil {
+		var out [][]float32
+		for _, frame := range features {
+			out = append(out, s.norm.Push(frame)...)
+		}
+		if last || s.e.cfg.Norm == param.NormStaticCMVN || s.e.cfg.Norm == param.NormCMVN {
+			out = append(out, s.norm.Flush()...)
+		}
+		features = out
+	}
+
+	if len(features) == 0 {
+		return nil
+	}
+	return s.emit(features)
+}
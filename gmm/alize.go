@@ -0,0 +1,133 @@
+package gmm
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/liuxp0827/govpr/constant"
+	"github.com/liuxp0827/govpr/file"
+	"io"
+	"math"
+)
+
+// The model files of LoadModel/SaveModel are ALIZE RAW mixtures (MixtureGD,
+// little-endian):
+//
+//	uint32 distribCount, uint32 vectSize
+//	float64 weight[distribCount]
+//	per distribution: float64 cst, float64 det, byte 0,
+//	                  float64 covariance[vectSize], float64 mean[vectSize]
+//
+// ReadAlize and WriteAlize do the same on streams.
+
+// ALIZE distribution constants, det = prod(covariance) and
+// cst = 1 / ((2*PI)^(vectSize/2) * sqrt(det))
+func (g *GMM) alizeConstants(mixture int) (float64, float64) {
+	var logDet float64
+	for j := 0; j < g.VectorSize; j++ {
+		logDet += math.Log(g.Covar[mixture][j])
+	}
+
+	det := math.Exp(logDet)
+	cst := math.Exp(-(float64(g.VectorSize)*math.Log(2*constant.PI) + logDet) / 2)
+	return cst, det
+}
+
+func (g *GMM) ReadAlize(r io.Reader) error {
+	br := bufio.NewReader(r)
+	var buf [8]byte
+
+	readUint32 := func() (int, error) {
+		if _, err := io.ReadFull(br, buf[:4]); err != nil {
+			return 0, err
+		}
+		return int(file.GetUint32LE(buf[:4])), nil
+	}
+	readFloat64 := func() (float64, error) {
+		if _, err := io.ReadFull(br, buf[:8]); err != nil {
+			return 0, err
+		}
+		return file.GetFloat64LE(buf[:8]), nil
+	}
+
+	mixtures, err := readUint32()
+	if err != nil {
+		return err
+	}
+	vectorSize, err := readUint32()
+	if err != nil {
+		return err
+	}
+	if mixtures <= 0 || vectorSize <= 0 || mixtures > 1<<20 || vectorSize > 1<<16 {
+		return fmt.Errorf("invalid alize mixture size %d x %d", mixtures, vectorSize)
+	}
+
+	g.alloc(mixtures, vectorSize)
+	for i := 0; i < mixtures; i++ {
+		if g.MixtureWeight[i], err = readFloat64(); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < mixtures; i++ {
+		// cst, det and the covariance type are derived values
+		if _, err = io.ReadFull(br, buf[:8]); err != nil {
+			return err
+		}
+		if _, err = io.ReadFull(br, buf[:8]); err != nil {
+			return err
+		}
+		if _, err = br.ReadByte(); err != nil {
+			return err
+		}
+
+		for j := 0; j < vectorSize; j++ {
+			if g.Covar[i][j], err = readFloat64(); err != nil {
+				return err
+			}
+		}
+		for j := 0; j < vectorSize; j++ {
+			if g.Mean[i][j], err = readFloat64(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return g.finishLoad()
+}
+
+func (g *GMM) WriteAlize(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var buf [8]byte
+
+	putUint32 := func(v int) {
+		file.PutUint32LE(buf[:4], uint32(v))
+		bw.Write(buf[:4])
+	}
+	putFloat64 := func(v float64) {
+		file.PutFloat64LE(buf[:8], v)
+		bw.Write(buf[:8])
+	}
+
+	putUint32(g.Mixtures)
+	putUint32(g.VectorSize)
+	for i := 0; i < g.Mixtures; i++ {
+		putFloat64(g.MixtureWeight[i])
+	}
+
+	for i := 0; i < g.Mixtures; i++ {
+		cst, det := g.alizeConstants(i)
+		putFloat64(cst)
+		putFloat64(det)
+		bw.WriteByte(0)
+
+		for j := 0; j < g.VectorSize; j++ {
+			putFloat64(g.Covar[i][j])
+		}
+		for j := 0; j < g.VectorSize; j++ {
+			putFloat64(g.Mean[i][j])
+		}
+	}
+
+	// bufio.Writer keeps the first write error
+	return bw.Flush()
+}
@@ -0,0 +1,156 @@
+package gmm
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// checkModel compares the parameters of got and want within a relative
+// tolerance
+func checkModel(t *testing.T, format string, got, want *GMM, tolerance float64) {
+	t.Helper()
+	if got.Mixtures != want.Mixtures || got.VectorSize != want.VectorSize {
+		t.Fatalf("%s: model of %d x %d, want %d x %d", format, got.Mixtures, got.VectorSize, want.Mixtures, want.VectorSize)
+	}
+
+	close := func(a, b float64) bool {
+		return math.Abs(a-b) <= tolerance*(1+math.Abs(b))
+	}
+	for i := 0; i < want.Mixtures; i++ {
+		if !close(got.MixtureWeight[i], want.MixtureWeight[i]) {
+			t.Fatalf("%s: weight %d = %v, want %v", format, i, got.MixtureWeight[i], want.MixtureWeight[i])
+		}
+		for j := 0; j < want.VectorSize; j++ {
+			if !close(got.Mean[i][j], want.Mean[i][j]) || !close(got.Covar[i][j], want.Covar[i][j]) {
+				t.Fatalf("%s: mixture %d dimension %d is %v/%v, want %v/%v", format, i, j,
+					got.Mean[i][j], got.Covar[i][j], want.Mean[i][j], want.Covar[i][j])
+			}
+		}
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := testFeatures(rng, 1000, 13, 8)
+	want := testModel(data, 8)
+	if _, err := want.EM(want.Mixtures); err != nil {
+		t.Fatal(err)
+	}
+	lprob := want.LProb(data, 0, int64(len(data)))
+
+	for _, c := range []struct {
+		format    string
+		write     func(g *GMM, buf *bytes.Buffer) error
+		read      func(g *GMM, buf *bytes.Buffer) error
+		tolerance float64 // kaldi binary keeps float parameters
+	}{
+		{"alize", func(g *GMM, buf *bytes.Buffer) error { return g.WriteAlize(buf) },
+			func(g *GMM, buf *bytes.Buffer) error { return g.ReadAlize(buf) }, 1e-12},
+		{"text", func(g *GMM, buf *bytes.Buffer) error { return g.WriteText(buf) },
+			func(g *GMM, buf *bytes.Buffer) error { return g.ReadText(buf) }, 1e-12},
+		{"kaldi binary", func(g *GMM, buf *bytes.Buffer) error { return g.WriteKaldi(buf, true) },
+			func(g *GMM, buf *bytes.Buffer) error { return g.ReadKaldi(buf) }, 1e-5},
+		{"kaldi text", func(g *GMM, buf *bytes.Buffer) error { return g.WriteKaldi(buf, false) },
+			func(g *GMM, buf *bytes.Buffer) error { return g.ReadKaldi(buf) }, 1e-5},
+	} {
+		var buf bytes.Buffer
+		if err := c.write(want, &buf); err != nil {
+			t.Fatalf("%s: %v", c.format, err)
+		}
+		raw := buf.Bytes()
+
+		got := NewGMM()
+		if err := c.read(got, &buf); err != nil {
+			t.Fatalf("%s: %v", c.format, err)
+		}
+		checkModel(t, c.format, got, want, c.tolerance)
+		if l := got.LProb(data, 0, int64(len(data))); math.Abs(l-lprob) > c.tolerance*10*math.Abs(lprob) {
+			t.Errorf("%s: log likelihood %v after the round trip, want %v", c.format, l, lprob)
+		}
+
+		// a truncated model is an error, not a partial model
+		if err := c.read(NewGMM(), bytes.NewBuffer(raw[:len(raw)*2/3])); err == nil {
+			t.Errorf("%s: reading a truncated model succeeded", c.format)
+		}
+	}
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	want := testModel(testFeatures(rng, 200, 4, 2), 2)
+	dir := t.TempDir()
+
+	if err := want.SaveModel(filepath.Join(dir, "model.gmm")); err != nil {
+		t.Fatal(err)
+	}
+	got := NewGMM()
+	if err := got.LoadModel(filepath.Join(dir, "model.gmm")); err != nil {
+		t.Fatal(err)
+	}
+	checkModel(t, "model file", got, want, 1e-12)
+
+	if err := want.SaveKaldi(filepath.Join(dir, "final.dubm"), true); err != nil {
+		t.Fatal(err)
+	}
+	got = NewGMM()
+	if err := got.LoadKaldi(filepath.Join(dir, "final.dubm")); err != nil {
+		t.Fatal(err)
+	}
+	checkModel(t, "kaldi file", got, want, 1e-5)
+
+	if err := want.SaveText(filepath.Join(dir, "model.txt")); err != nil {
+		t.Fatal(err)
+	}
+	got = NewGMM()
+	if err := got.LoadText(filepath.Join(dir, "model.txt")); err != nil {
+		t.Fatal(err)
+	}
+	checkModel(t, "text file", got, want, 1e-12)
+}
+
+// one mixture of mean [1 2] and variance [0.5 2], as written by Kaldi
+// gmm-copy --binary=false
+const kaldiText = `<DiagGMM>
+<GCONSTS>  [ -3.837877 ]
+<WEIGHTS>  [ 1 ]
+<MEANS_INVVARS>  [
+  2 1 ]
+<INV_VARS>  [
+  2 0.5 ]
+</DiagGMM>
+`
+
+const plainText = `# one mixture
+gmm 1 2
+weight 1
+mean 1 2
+var 0.5 2
+`
+
+func TestReadKnownModels(t *testing.T) {
+	want := NewGMM()
+	want.alloc(1, 2)
+	want.MixtureWeight[0] = 1
+	want.Mean[0][0], want.Mean[0][1] = 1, 2
+	want.Covar[0][0], want.Covar[0][1] = 0.5, 2
+
+	got := NewGMM()
+	if err := got.ReadKaldi(strings.NewReader(kaldiText)); err != nil {
+		t.Fatal(err)
+	}
+	checkModel(t, "kaldi text", got, want, 1e-12)
+
+	got = NewGMM()
+	if err := got.ReadText(strings.NewReader(plainText)); err != nil {
+		t.Fatal(err)
+	}
+	checkModel(t, "text", got, want, 1e-12)
+
+	if err := NewGMM().ReadText(strings.NewReader("gmm 1 2\nweight 1\nmean 1 2\nvar 0.5 0\n")); err == nil {
+		t.Error("reading a zero variance succeeded")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/liuxp0827/govpr/file"
 	"github.com/liuxp0827/govpr/log"
 	"math"
+	"sync"
 )
 
 type GMM struct {
@@ -18,6 +19,10 @@ type GMM struct {
 	MixtureWeight   []float64   // weight of each mixture[mixture]						1
 	Mean            [][]float64 // mean vector [mixture,dimension]						1
 	Covar           [][]float64 // covariance (diagonal) [mixture,dimension]			1
+
+	// Workers is the number of goroutines EM and LProb split the frames
+	// across, values <= 0 mean runtime.GOMAXPROCS(0).
+	Workers int
 }
 
 func NewGMM() *GMM {
@@ -34,6 +39,7 @@ func (g *GMM) Copy(gmm *GMM) {
 	g.Frames = gmm.Frames
 	g.VectorSize = gmm.VectorSize
 	g.Mixtures = gmm.Mixtures
+	g.Workers = gmm.Workers
 
 	g.FeatureData = make([][]float32, gmm.Frames, gmm.Frames)
 	g.deterCovariance = make([]float64, g.Mixtures, g.Mixtures)
@@ -66,6 +72,7 @@ func (g *GMM) Copy(gmm *GMM) {
 func (g *GMM) DupModel(gmm *GMM) {
 	g.Mixtures = gmm.Mixtures
 	g.VectorSize = gmm.VectorSize
+	g.Workers = gmm.Workers
 	g.deterCovariance = make([]float64, g.Mixtures, g.Mixtures)
 	g.MixtureWeight = make([]float64, g.Mixtures, g.Mixtures)
 	g.Mean = make([][]float64, g.Mixtures, g.Mixtures)
@@ -83,6 +90,42 @@ func (g *GMM) DupModel(gmm *GMM) {
 	}
 }
 
+// alloc sizes the model for mixtures x vectorSize, all parameters zero.
+func (g *GMM) alloc(mixtures, vectorSize int) {
+	g.Mixtures = mixtures
+	g.VectorSize = vectorSize
+	g.deterCovariance = make([]float64, mixtures, mixtures)
+	g.MixtureWeight = make([]float64, mixtures, mixtures)
+	g.Mean = make([][]float64, mixtures, mixtures)
+	g.Covar = make([][]float64, mixtures, mixtures)
+	for i := 0; i < mixtures; i++ {
+		g.Mean[i] = make([]float64, vectorSize, vectorSize)
+		g.Covar[i] = make([]float64, vectorSize, vectorSize)
+	}
+}
+
+// check the imported parameters and compute the log determinants
+func (g *GMM) finishLoad() error {
+	if g.Mixtures <= 0 || g.VectorSize <= 0 {
+		return fmt.Errorf("invalid model size %d x %d", g.Mixtures, g.VectorSize)
+	}
+
+	for i := 0; i < g.Mixtures; i++ {
+		if g.MixtureWeight[i] < 0 || math.IsNaN(g.MixtureWeight[i]) {
+			return fmt.Errorf("mixture %d has invalid weight %v", i, g.MixtureWeight[i])
+		}
+
+		g.deterCovariance[i] = 0.0
+		for j := 0; j < g.VectorSize; j++ {
+			if !(g.Covar[i][j] > 0) || math.IsInf(g.Covar[i][j], 0) {
+				return fmt.Errorf("mixture %d has invalid variance %v", i, g.Covar[i][j])
+			}
+			g.deterCovariance[i] += math.Log(g.Covar[i][j])
+		}
+	}
+	return nil
+}
+
 func (g *GMM) LoadModel(filename string) error {
 	reader, err := file.NewVPRFile(filename)
 	if err != nil {
@@ -188,12 +231,13 @@ func (g *GMM) SaveModel(filename string) error {
 	}
 
 	for i := 0; i < g.Mixtures; i++ {
-		_, err = writer.PutFloat64(0.0) // not used
+		cst, det := g.alizeConstants(i)
+		_, err = writer.PutFloat64(cst) // not used by LoadModel, ALIZE cst
 		if err != nil {
 			return err
 		}
 
-		_, err = writer.PutFloat64(0.0) // not used
+		_, err = writer.PutFloat64(det) // not used by LoadModel, ALIZE det
 		if err != nil {
 			return err
 		}
@@ -240,83 +284,36 @@ func (g *GMM) CopyFeatureData(gmm *GMM) error {
 }
 
 func (g *GMM) EM(mixtures int) (int, error) {
-	var dlogfrmprob, rubbish, lastrubbish float64
-	var dsumgama, dlogmixw, dgama, dmixw []float64
+	var rubbish, lastrubbish float64
 	var threshold float64 = 1e-5
-	var mean, covar [][]float64
 	var loop int = 0
 
-	mean = make([][]float64, mixtures, mixtures)
-	covar = make([][]float64, mixtures, mixtures)
-	for i := 0; i < mixtures; i++ {
-		mean[i] = make([]float64, g.VectorSize, g.VectorSize)
-		covar[i] = make([]float64, g.VectorSize, g.VectorSize)
+	if mixtures > g.Mixtures {
+		return 0, fmt.Errorf("mixtures %d greater than model mixtures %d", mixtures, g.Mixtures)
 	}
 
-	dmixw = make([]float64, mixtures, mixtures)
-	dlogmixw = make([]float64, mixtures, mixtures)
-	dgama = make([]float64, mixtures, mixtures)
-	dsumgama = make([]float64, mixtures, mixtures)
-	rubbish = .0
+	if g.Frames <= 0 {
+		return 0, fmt.Errorf("no feature data for training")
+	}
 
-	doing := func() (int, error) {
+	for {
 		lastrubbish = rubbish
-		rubbish = .0
-		for i := 0; i < mixtures; i++ {
-
-			// speed up
-			if g.MixtureWeight[i] <= 0 {
-				dlogmixw[i] = constant.LOGZERO
-			} else {
-				dlogmixw[i] = math.Log(g.MixtureWeight[i])
-			}
-
-			// clean up temporary values
-			dmixw[i] = .0
-			dsumgama[i] = .0
-			for j := 0; j < g.VectorSize; j++ {
-				mean[i][j] = .0
-				covar[i][j] = .0
-			}
-		}
-
-		for i := 0; i < g.Frames; i++ {
-			dlogfrmprob = constant.LOGZERO
-			for j := 0; j < mixtures; j++ {
-				dgama[j] = g.LMixProb(g.FeatureData[i], j)
-				dgama[j] += dlogmixw[j]
-				dlogfrmprob = g.LogAdd(dgama[j], dlogfrmprob)
-			}
-
-			rubbish += dlogfrmprob
 
-			for j := 0; j < mixtures; j++ {
-				dgama[j] -= dlogfrmprob
-				dgama[j] = math.Exp(dgama[j])
-				dsumgama[j] += dgama[j]
-
-				// update weights
-				dmixw[j] += dgama[j]
-				for k := 0; k < g.VectorSize; k++ {
-					mean[j][k] += dgama[j] * float64(g.FeatureData[i][k])
-					covar[j][k] += dgama[j] * float64(g.FeatureData[i][k]) * float64(g.FeatureData[i][k])
-				}
-			}
-		}
-
-		rubbish /= float64(g.Frames)
+		acc := g.accumulate(mixtures)
+		rubbish = acc.lprob / float64(g.Frames)
 
 		for i := 0; i < mixtures; i++ {
-			if dsumgama[i] == .0 {
-				return -1, nil
+			if acc.occ[i] == .0 {
+				return 0, fmt.Errorf("error train loop")
 			}
 
-			g.MixtureWeight[i] = dmixw[i] / float64(g.Frames)
+			g.MixtureWeight[i] = acc.occ[i] / float64(g.Frames)
 
+			g.deterCovariance[i] = .0
 			for j := 0; j < g.VectorSize; j++ {
-				g.Mean[i][j] = mean[i][j] / dsumgama[i]
-				g.Covar[i][j] = covar[i][j] / dsumgama[i]
-				g.Covar[i][j] -= g.Mean[i][j] * g.Mean[i][j]
+				k := i*g.VectorSize + j
+				g.Mean[i][j] = acc.sum[k] / acc.occ[i]
+				g.Covar[i][j] = acc.sqr[k]/acc.occ[i] - g.Mean[i][j]*g.Mean[i][j]
 
 				if g.Covar[i][j] < constant.VAR_FLOOR {
 					g.Covar[i][j] = constant.VAR_FLOOR
@@ -325,78 +322,87 @@ func (g *GMM) EM(mixtures int) (int, error) {
 				if g.Covar[i][j] > constant.VAR_CEILING {
 					g.Covar[i][j] = constant.VAR_CEILING
 				}
-			}
-		}
 
-		for i := 0; i < mixtures; i++ {
-			g.deterCovariance[i] = .0
-			for j := 0; j < g.VectorSize; j++ {
 				g.deterCovariance[i] += math.Log(g.Covar[i][j])
 			}
 		}
 		loop++
-		return 0, nil
-	}
-
-DO:
-	ret, err := doing()
-	if err != nil {
-		return 0, err
-	} else if ret == -1 {
-		return 0, fmt.Errorf("error train loop")
-	}
 
-	for loop < constant.MAX_LOOP && math.Abs((rubbish-lastrubbish)/(lastrubbish+0.01)) > threshold {
-		goto DO
+		if loop >= constant.MAX_LOOP || math.Abs((rubbish-lastrubbish)/(lastrubbish+0.01)) <= threshold {
+			break
+		}
 	}
 
 	return loop, nil
 }
 
+// Return the total log likelihood of the frames [start, start+length)
+// of featureBuf. Frames are split across the worker pool and the partial
+// sums are added in frame order, so the result does not depend on the
+// number of workers beyond floating point rounding.
 func (g *GMM) LProb(featureBuf [][]float32, start, length int64) float64 {
-	var dgama, dlogfrmprob, sum float64 = .0, .0, .0
-	dlogmixw := make([]float64, g.Mixtures, g.Mixtures)
-	for ij := 0; ij < g.Mixtures; ij++ {
-		if g.MixtureWeight[ij] <= 0 {
-			dlogmixw[ij] = constant.LOGZERO
-		} else {
-			dlogmixw[ij] = math.Log(g.MixtureWeight[ij])
-		}
+	if length <= 0 {
+		return .0
 	}
 
-	for ii := int64(start); ii < (start + length); ii++ {
-		dlogfrmprob = constant.LOGZERO
-		for jj := 0; jj < g.Mixtures; jj++ {
-			dgama = g.LMixProb(featureBuf[ii], jj) + dlogmixw[jj]
-			dlogfrmprob = g.LogAdd(dgama, dlogfrmprob)
-		}
-		sum += dlogfrmprob
+	k := g.kernel(g.Mixtures)
+	frames := featureBuf[start : start+length]
+	parts := splitFrames(len(frames), g.workers())
+	sums := make([]float64, len(parts))
+
+	var wg sync.WaitGroup
+	for w, part := range parts {
+		wg.Add(1)
+		go func(w int, part [2]int) {
+			defer wg.Done()
+			lmix := make([]float64, k.mixtures)
+			var sum float64
+			for _, frame := range frames[part[0]:part[1]] {
+				sum += k.mixLProbs(frame, lmix)
+			}
+			sums[w] = sum
+		}(w, part)
 	}
+	wg.Wait()
 
-	dlogmixw = nil
+	var sum float64
+	for _, v := range sums {
+		sum += v
+	}
 	return sum
 }
 
+// Return the log likelihood of every frame in [start, start+length) of
+// featureBuf, in frame order.
+func (g *GMM) FrameLProbs(featureBuf [][]float32, start, length int64) []float64 {
+	if length <= 0 {
+		return []float64{}
+	}
+
+	k := g.kernel(g.Mixtures)
+	frames := featureBuf[start : start+length]
+	out := make([]float64, len(frames))
+
+	var wg sync.WaitGroup
+	for _, part := range splitFrames(len(frames), g.workers()) {
+		wg.Add(1)
+		go func(part [2]int) {
+			defer wg.Done()
+			lmix := make([]float64, k.mixtures)
+			for i := part[0]; i < part[1]; i++ {
+				out[i] = k.mixLProbs(frames[i], lmix)
+			}
+		}(part)
+	}
+	wg.Wait()
+
+	return out
+}
+
 // Routine for adding two log-values in a linear scale, return the log
 // result in double
 func (g *GMM) LogAdd(lvar1 float64, lvar2 float64) float64 {
-	var diff, z float64
-	var minLogExp = -math.Log(-(constant.LOGZERO))
-	if lvar1 < lvar2 {
-		lvar1, lvar2 = lvar2, lvar1
-	}
-
-	diff = lvar2 - lvar1
-	if diff < minLogExp {
-		if lvar1 < constant.LSMALL {
-			return constant.LOGZERO
-		} else {
-			return lvar1
-		}
-	} else {
-		z = math.Exp(diff)
-		return lvar1 + math.Log(1.0+z)
-	}
+	return logAdd(lvar1, lvar2)
 }
 
 // Return the log likelihood of the given vector to the given
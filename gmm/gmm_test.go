@@ -0,0 +1,157 @@
+package gmm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// testFeatures draws frames of dim around mixtures random centres
+func testFeatures(rng *rand.Rand, frames, dim, mixtures int) [][]float32 {
+	centres := make([][]float64, mixtures)
+	for i := range centres {
+		centres[i] = make([]float64, dim)
+		for j := range centres[i] {
+			centres[i][j] = rng.NormFloat64() * 2
+		}
+	}
+
+	data := make([][]float32, frames)
+	for t := range data {
+		c := centres[rng.Intn(mixtures)]
+		data[t] = make([]float32, dim)
+		for j := range data[t] {
+			data[t][j] = float32(c[j] + rng.NormFloat64()*0.5)
+		}
+	}
+	return data
+}
+
+// testModel returns a model of mixtures of unit variance seeded from frames
+// of data, with the data loaded for EM
+func testModel(data [][]float32, mixtures int) *GMM {
+	dim := len(data[0])
+	g := NewGMM()
+	g.Mixtures, g.VectorSize = mixtures, dim
+	g.deterCovariance = make([]float64, mixtures)
+	g.MixtureWeight = make([]float64, mixtures)
+	g.Mean = make([][]float64, mixtures)
+	g.Covar = make([][]float64, mixtures)
+	for i := 0; i < mixtures; i++ {
+		g.MixtureWeight[i] = 1.0 / float64(mixtures)
+		g.Mean[i] = make([]float64, dim)
+		g.Covar[i] = make([]float64, dim)
+		for j := 0; j < dim; j++ {
+			g.Mean[i][j] = float64(data[i*len(data)/mixtures][j])
+			g.Covar[i][j] = 1
+		}
+	}
+	g.Frames, g.FeatureData = len(data), data
+	return g
+}
+
+// refLProb is the frame by frame log likelihood of LMixProb, as before the
+// kernel
+func refLProb(g *GMM, data [][]float32) float64 {
+	var sum float64
+	for _, frame := range data {
+		lprob := -1e10
+		for i := 0; i < g.Mixtures; i++ {
+			lprob = g.LogAdd(math.Log(g.MixtureWeight[i])+g.LMixProb(frame, i), lprob)
+		}
+		sum += lprob
+	}
+	return sum
+}
+
+func TestLProb(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := testFeatures(rng, 1000, 13, 8)
+	g := testModel(data, 8)
+
+	want := refLProb(g, data)
+	for _, workers := range []int{1, 3, 8} {
+		g.Workers = workers
+		got := g.LProb(data, 0, int64(len(data)))
+		if math.Abs(got-want) > 1e-6*math.Abs(want) {
+			t.Errorf("LProb with %d workers = %v, want %v", workers, got, want)
+		}
+
+		var sum float64
+		for _, l := range g.FrameLProbs(data, 0, int64(len(data))) {
+			sum += l
+		}
+		if math.Abs(sum-want) > 1e-6*math.Abs(want) {
+			t.Errorf("sum of FrameLProbs with %d workers = %v, want %v", workers, sum, want)
+		}
+	}
+}
+
+func TestEM(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := testFeatures(rng, 2000, 13, 4)
+
+	var lprobs []float64
+	for _, workers := range []int{1, 4} {
+		g := testModel(data, 4)
+		g.Workers = workers
+		before := g.LProb(data, 0, int64(len(data)))
+		if _, err := g.EM(g.Mixtures); err != nil {
+			t.Fatal(err)
+		}
+		after := g.LProb(data, 0, int64(len(data)))
+		if after <= before {
+			t.Errorf("EM with %d workers took the log likelihood from %v to %v", workers, before, after)
+		}
+		lprobs = append(lprobs, after)
+	}
+	if math.Abs(lprobs[0]-lprobs[1]) > 1e-6*math.Abs(lprobs[0]) {
+		t.Errorf("EM gives %v with 1 worker and %v with 4", lprobs[0], lprobs[1])
+	}
+}
+
+func benchmarkLProb(b *testing.B, workers int) {
+	rng := rand.New(rand.NewSource(1))
+	data := testFeatures(rng, 3000, 36, 64)
+	g := testModel(data, 64)
+	g.Workers = workers
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.LProb(data, 0, int64(len(data)))
+	}
+}
+
+func BenchmarkLProb(b *testing.B)       { benchmarkLProb(b, 0) }
+func BenchmarkLProbSerial(b *testing.B) { benchmarkLProb(b, 1) }
+
+// BenchmarkLMixProb scores the frames of BenchmarkLProb one mixture at a
+// time, as before the kernel
+func BenchmarkLMixProb(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	data := testFeatures(rng, 3000, 36, 64)
+	g := testModel(data, 64)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		refLProb(g, data)
+	}
+}
+
+func benchmarkEM(b *testing.B, workers int) {
+	rng := rand.New(rand.NewSource(1))
+	data := testFeatures(rng, 3000, 36, 64)
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		g := testModel(data, 64)
+		g.Workers = workers
+		b.StartTimer()
+		if _, err := g.EM(g.Mixtures); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEM(b *testing.B)       { benchmarkEM(b, 0) }
+func BenchmarkEMSerial(b *testing.B) { benchmarkEM(b, 1) }
@@ -0,0 +1,453 @@
+package gmm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/liuxp0827/govpr/constant"
+	"github.com/liuxp0827/govpr/file"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Kaldi DiagGmm, e.g. final.dubm of the sre recipes:
+//
+//	<DiagGMM> <GCONSTS> vector <WEIGHTS> vector
+//	<MEANS_INVVARS> matrix <INV_VARS> matrix </DiagGMM>
+//
+// with means_invvars = mean / var, inv_vars = 1 / var and
+// gconst = log(weight) - (dim*log(2*PI) + sum(log(var)) + sum(mean^2/var)) / 2.
+
+// ReadKaldi reads a binary ("\0B" header) or text DiagGmm.
+func (g *GMM) ReadKaldi(r io.Reader) error {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(2)
+	if err != nil {
+		return err
+	}
+
+	var kr kaldiReader
+	if head[0] == 0 && head[1] == 'B' {
+		br.Discard(2)
+		kr = &kaldiBinaryReader{r: br}
+	} else {
+		kr = &kaldiTextReader{r: br}
+	}
+
+	if err = kaldiExpect(kr, "<DiagGMM>"); err != nil {
+		return err
+	}
+
+	var weights []float64
+	var meansInvVars, invVars [][]float64
+	for {
+		token, err := kr.token()
+		if err != nil {
+			return err
+		}
+
+		switch token {
+		case "<GCONSTS>":
+			// derived, recomputed from the other parameters
+			if _, err = kr.vector(); err != nil {
+				return err
+			}
+		case "<WEIGHTS>":
+			if weights, err = kr.vector(); err != nil {
+				return err
+			}
+		case "<MEANS_INVVARS>":
+			if meansInvVars, err = kr.matrix(); err != nil {
+				return err
+			}
+		case "<INV_VARS>":
+			if invVars, err = kr.matrix(); err != nil {
+				return err
+			}
+		case "</DiagGMM>":
+			return g.fromKaldi(weights, meansInvVars, invVars)
+		default:
+			return fmt.Errorf("unexpected kaldi token %q", token)
+		}
+	}
+}
+
+func (g *GMM) fromKaldi(weights []float64, meansInvVars, invVars [][]float64) error {
+	mixtures := len(weights)
+	if mixtures == 0 || len(meansInvVars) != mixtures || len(invVars) != mixtures {
+		return fmt.Errorf("kaldi gmm has %d weights, %d means and %d variances",
+			len(weights), len(meansInvVars), len(invVars))
+	}
+
+	vectorSize := len(invVars[0])
+	g.alloc(mixtures, vectorSize)
+	for i := 0; i < mixtures; i++ {
+		if len(meansInvVars[i]) != vectorSize || len(invVars[i]) != vectorSize {
+			return fmt.Errorf("kaldi gmm mixture %d has the wrong dimension", i)
+		}
+
+		g.MixtureWeight[i] = weights[i]
+		for j := 0; j < vectorSize; j++ {
+			g.Covar[i][j] = 1.0 / invVars[i][j]
+			g.Mean[i][j] = meansInvVars[i][j] * g.Covar[i][j]
+		}
+	}
+	return g.finishLoad()
+}
+
+// WriteKaldi writes the model as a Kaldi DiagGmm, binary with float
+// parameters or text.
+func (g *GMM) WriteKaldi(w io.Writer, binary bool) error {
+	gconsts := make([]float64, g.Mixtures)
+	meansInvVars := make([][]float64, g.Mixtures)
+	invVars := make([][]float64, g.Mixtures)
+	for i := 0; i < g.Mixtures; i++ {
+		meansInvVars[i] = make([]float64, g.VectorSize)
+		invVars[i] = make([]float64, g.VectorSize)
+
+		gc := float64(g.VectorSize) * math.Log(2*constant.PI)
+		for j := 0; j < g.VectorSize; j++ {
+			invVars[i][j] = 1.0 / g.Covar[i][j]
+			meansInvVars[i][j] = g.Mean[i][j] * invVars[i][j]
+			gc += math.Log(g.Covar[i][j]) + g.Mean[i][j]*meansInvVars[i][j]
+		}
+		gconsts[i] = math.Log(g.MixtureWeight[i]) - gc/2
+	}
+
+	bw := bufio.NewWriter(w)
+	var kw kaldiWriter = &kaldiTextWriter{w: bw}
+	if binary {
+		bw.Write([]byte{0, 'B'})
+		kw = &kaldiBinaryWriter{w: bw}
+	}
+
+	kw.token("<DiagGMM>")
+	if !binary {
+		bw.WriteString("\n")
+	}
+	kw.token("<GCONSTS>")
+	kw.vector(gconsts)
+	kw.token("<WEIGHTS>")
+	kw.vector(g.MixtureWeight)
+	kw.token("<MEANS_INVVARS>")
+	kw.matrix(meansInvVars)
+	kw.token("<INV_VARS>")
+	kw.matrix(invVars)
+	kw.token("</DiagGMM>")
+	if !binary {
+		bw.WriteString("\n")
+	}
+
+	// bufio.Writer keeps the first write error
+	return bw.Flush()
+}
+
+func (g *GMM) LoadKaldi(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return g.ReadKaldi(f)
+}
+
+func (g *GMM) SaveKaldi(filename string, binary bool) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = g.WriteKaldi(f, binary); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+type kaldiReader interface {
+	token() (string, error)
+	vector() ([]float64, error)
+	matrix() ([][]float64, error)
+}
+
+type kaldiWriter interface {
+	token(token string)
+	vector(v []float64)
+	matrix(m [][]float64)
+}
+
+func kaldiExpect(kr kaldiReader, want string) error {
+	token, err := kr.token()
+	if err != nil {
+		return err
+	}
+	if token != want {
+		return fmt.Errorf("expected kaldi token %s, got %q", want, token)
+	}
+	return nil
+}
+
+// binary: tokens end with a space, sizes are a 1 byte length + int32,
+// float vectors are "FV " and matrices "FM " (D for double).
+type kaldiBinaryReader struct {
+	r *bufio.Reader
+}
+
+func (kr *kaldiBinaryReader) token() (string, error) {
+	token, err := kr.r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	return token[:len(token)-1], nil
+}
+
+func (kr *kaldiBinaryReader) int32() (int, error) {
+	var buf [5]byte
+	if _, err := io.ReadFull(kr.r, buf[:]); err != nil {
+		return 0, err
+	}
+	if buf[0] != 4 {
+		return 0, fmt.Errorf("invalid kaldi int32 size %d", buf[0])
+	}
+
+	n := int(int32(file.GetUint32LE(buf[1:])))
+	if n < 0 || n > 1<<24 {
+		return 0, fmt.Errorf("invalid kaldi size %d", n)
+	}
+	return n, nil
+}
+
+func (kr *kaldiBinaryReader) floats(n int, size int) ([]float64, error) {
+	buf := make([]byte, n*size)
+	if _, err := io.ReadFull(kr.r, buf); err != nil {
+		return nil, err
+	}
+
+	v := make([]float64, n)
+	for i := range v {
+		if size == 4 {
+			v[i] = float64(file.GetFloat32LE(buf[i*4:]))
+		} else {
+			v[i] = file.GetFloat64LE(buf[i*8:])
+		}
+	}
+	return v, nil
+}
+
+func (kr *kaldiBinaryReader) vector() ([]float64, error) {
+	token, err := kr.token()
+	if err != nil {
+		return nil, err
+	}
+	if token != "FV" && token != "DV" {
+		return nil, fmt.Errorf("expected kaldi vector, got %q", token)
+	}
+
+	n, err := kr.int32()
+	if err != nil {
+		return nil, err
+	}
+	if token == "FV" {
+		return kr.floats(n, 4)
+	}
+	return kr.floats(n, 8)
+}
+
+func (kr *kaldiBinaryReader) matrix() ([][]float64, error) {
+	token, err := kr.token()
+	if err != nil {
+		return nil, err
+	}
+	if token != "FM" && token != "DM" {
+		return nil, fmt.Errorf("expected kaldi matrix, got %q", token)
+	}
+
+	rows, err := kr.int32()
+	if err != nil {
+		return nil, err
+	}
+	cols, err := kr.int32()
+	if err != nil {
+		return nil, err
+	}
+
+	size := 4
+	if token == "DM" {
+		size = 8
+	}
+
+	m := make([][]float64, rows)
+	for i := range m {
+		if m[i], err = kr.floats(cols, size); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// text: white space separated, vectors are "[ a b c ]" and matrices
+// "[ a b c \n d e f ]"
+type kaldiTextReader struct {
+	r *bufio.Reader
+}
+
+func (kr *kaldiTextReader) token() (string, error) {
+	var token []byte
+	for {
+		c, err := kr.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(token) > 0 {
+				return string(token), nil
+			}
+			return "", err
+		}
+
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			if len(token) > 0 {
+				return string(token), nil
+			}
+			continue
+		}
+		token = append(token, c)
+	}
+}
+
+func (kr *kaldiTextReader) rows() ([][]float64, error) {
+	if err := kaldiExpect(kr, "["); err != nil {
+		return nil, err
+	}
+
+	var rows [][]float64
+	var row []float64
+	for {
+		line, err := kr.r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return nil, err
+		}
+
+		end := strings.Contains(line, "]")
+		if end {
+			line = line[:strings.Index(line, "]")]
+		}
+
+		for _, field := range strings.Fields(line) {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid kaldi number %q", field)
+			}
+			row = append(row, v)
+		}
+
+		if len(row) > 0 {
+			rows = append(rows, row)
+			row = nil
+		}
+		if end {
+			return rows, nil
+		}
+	}
+}
+
+func (kr *kaldiTextReader) vector() ([]float64, error) {
+	rows, err := kr.rows()
+	if err != nil {
+		return nil, err
+	}
+
+	var v []float64
+	for _, row := range rows {
+		v = append(v, row...)
+	}
+	return v, nil
+}
+
+func (kr *kaldiTextReader) matrix() ([][]float64, error) {
+	return kr.rows()
+}
+
+type kaldiBinaryWriter struct {
+	w *bufio.Writer
+}
+
+func (kw *kaldiBinaryWriter) token(token string) {
+	kw.w.WriteString(token)
+	kw.w.WriteByte(' ')
+}
+
+func (kw *kaldiBinaryWriter) int32(v int) {
+	var buf [5]byte
+	buf[0] = 4
+	file.PutUint32LE(buf[1:], uint32(v))
+	kw.w.Write(buf[:])
+}
+
+func (kw *kaldiBinaryWriter) floats(v []float64) {
+	var buf [4]byte
+	for _, x := range v {
+		file.PutFloat32LE(buf[:], float32(x))
+		kw.w.Write(buf[:])
+	}
+}
+
+func (kw *kaldiBinaryWriter) vector(v []float64) {
+	kw.token("FV")
+	kw.int32(len(v))
+	kw.floats(v)
+}
+
+func (kw *kaldiBinaryWriter) matrix(m [][]float64) {
+	var cols int
+	if len(m) > 0 {
+		cols = len(m[0])
+	}
+
+	kw.token("FM")
+	kw.int32(len(m))
+	kw.int32(cols)
+	for _, row := range m {
+		kw.floats(row)
+	}
+}
+
+type kaldiTextWriter struct {
+	w *bufio.Writer
+}
+
+func (kw *kaldiTextWriter) token(token string) {
+	kw.w.WriteString(token)
+	kw.w.WriteByte(' ')
+}
+
+func (kw *kaldiTextWriter) floats(v []float64) {
+	var buf bytes.Buffer
+	for _, x := range v {
+		buf.WriteString(strconv.FormatFloat(x, 'g', -1, 32))
+		buf.WriteByte(' ')
+	}
+	kw.w.Write(buf.Bytes())
+}
+
+func (kw *kaldiTextWriter) vector(v []float64) {
+	kw.w.WriteString(" [ ")
+	kw.floats(v)
+	kw.w.WriteString("]\n")
+}
+
+func (kw *kaldiTextWriter) matrix(m [][]float64) {
+	kw.w.WriteString(" [")
+	for i, row := range m {
+		kw.w.WriteString("\n  ")
+		kw.floats(row)
+		if i == len(m)-1 {
+			kw.w.WriteString("]")
+		}
+	}
+	if len(m) == 0 {
+		kw.w.WriteString(" ]")
+	}
+	kw.w.WriteString("\n")
+}
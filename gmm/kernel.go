@@ -0,0 +1,202 @@
+package gmm
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/liuxp0827/govpr/constant"
+)
+
+// minimum frames handed to one worker, below this the goroutine overhead
+// costs more than it saves
+const minWorkerFrames = 64
+
+// kernel is a read-only snapshot of the model laid out for the frame loops:
+// means and inverse covariances are flattened to [mixture*dimension] and the
+// per-mixture constants are computed once instead of once per frame.
+type kernel struct {
+	mixtures  int
+	dim       int
+	mean      []float64 // [mixture*dimension]
+	invCovar  []float64 // 1 / covariance [mixture*dimension]
+	gconst    []float64 // -(dimension*log(2pi) + log|covariance|) / 2 [mixture]
+	logWeight []float64 // log of the mixture weight [mixture]
+}
+
+// accumulator holds the sufficient statistics of one EM pass.
+type accumulator struct {
+	lprob float64   // total log likelihood
+	occ   []float64 // occupation count [mixture]
+	sum   []float64 // first order statistics [mixture*dimension]
+	sqr   []float64 // second order statistics [mixture*dimension]
+}
+
+func (g *GMM) kernel(mixtures int) *kernel {
+	k := &kernel{
+		mixtures:  mixtures,
+		dim:       g.VectorSize,
+		mean:      make([]float64, mixtures*g.VectorSize),
+		invCovar:  make([]float64, mixtures*g.VectorSize),
+		gconst:    make([]float64, mixtures),
+		logWeight: make([]float64, mixtures),
+	}
+
+	for i := 0; i < mixtures; i++ {
+		if g.MixtureWeight[i] <= 0 {
+			k.logWeight[i] = constant.LOGZERO
+		} else {
+			k.logWeight[i] = math.Log(g.MixtureWeight[i])
+		}
+
+		k.gconst[i] = -(float64(g.VectorSize)*constant.DLOG2PAI + g.deterCovariance[i]) / 2
+		for j := 0; j < g.VectorSize; j++ {
+			k.mean[i*g.VectorSize+j] = g.Mean[i][j]
+			k.invCovar[i*g.VectorSize+j] = 1.0 / g.Covar[i][j]
+		}
+	}
+	return k
+}
+
+// mixLProbs fills lmix with log(weight) + log likelihood of frame for every
+// mixture and returns their log sum, i.e. the frame log likelihood.
+func (k *kernel) mixLProbs(frame []float32, lmix []float64) float64 {
+	lprob := constant.LOGZERO
+	for i := 0; i < k.mixtures; i++ {
+		mean := k.mean[i*k.dim : (i+1)*k.dim]
+		invCovar := k.invCovar[i*k.dim : (i+1)*k.dim]
+
+		var dsum float64
+		for j, v := range frame[:k.dim] {
+			d := float64(v) - mean[j]
+			dsum += d * d * invCovar[j]
+		}
+
+		l := k.gconst[i] - dsum/2
+		if l < constant.LOGZERO {
+			l = constant.LOGZERO
+		}
+
+		lmix[i] = l + k.logWeight[i]
+		lprob = logAdd(lmix[i], lprob)
+	}
+	return lprob
+}
+
+func newAccumulator(mixtures, dim int) *accumulator {
+	return &accumulator{
+		occ: make([]float64, mixtures),
+		sum: make([]float64, mixtures*dim),
+		sqr: make([]float64, mixtures*dim),
+	}
+}
+
+// add the posterior weighted statistics of one frame
+func (a *accumulator) add(k *kernel, frame []float32, lmix []float64) {
+	lprob := k.mixLProbs(frame, lmix)
+	a.lprob += lprob
+
+	for i := 0; i < k.mixtures; i++ {
+		gama := math.Exp(lmix[i] - lprob)
+		if gama == 0 {
+			continue
+		}
+
+		a.occ[i] += gama
+		sum := a.sum[i*k.dim : (i+1)*k.dim]
+		sqr := a.sqr[i*k.dim : (i+1)*k.dim]
+		for j, v := range frame[:k.dim] {
+			x := float64(v)
+			sum[j] += gama * x
+			sqr[j] += gama * x * x
+		}
+	}
+}
+
+func (a *accumulator) merge(b *accumulator) {
+	a.lprob += b.lprob
+	for i := range a.occ {
+		a.occ[i] += b.occ[i]
+	}
+	for i := range a.sum {
+		a.sum[i] += b.sum[i]
+		a.sqr[i] += b.sqr[i]
+	}
+}
+
+// accumulate runs the E step over all frames of g.FeatureData, every worker
+// owns its accumulator and they are merged in frame order at the end.
+func (g *GMM) accumulate(mixtures int) *accumulator {
+	k := g.kernel(mixtures)
+	parts := splitFrames(g.Frames, g.workers())
+	accs := make([]*accumulator, len(parts))
+
+	var wg sync.WaitGroup
+	for w, part := range parts {
+		wg.Add(1)
+		go func(w int, part [2]int) {
+			defer wg.Done()
+			acc := newAccumulator(mixtures, g.VectorSize)
+			lmix := make([]float64, mixtures)
+			for _, frame := range g.FeatureData[part[0]:part[1]] {
+				acc.add(k, frame, lmix)
+			}
+			accs[w] = acc
+		}(w, part)
+	}
+	wg.Wait()
+
+	acc := accs[0]
+	for _, a := range accs[1:] {
+		acc.merge(a)
+	}
+	return acc
+}
+
+func (g *GMM) workers() int {
+	if g.Workers > 0 {
+		return g.Workers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// splitFrames cuts [0, frames) into at most workers contiguous ranges.
+func splitFrames(frames, workers int) [][2]int {
+	if max := frames / minWorkerFrames; workers > max {
+		workers = max
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	parts := make([][2]int, workers)
+	step := frames / workers
+	rest := frames % workers
+	start := 0
+	for i := range parts {
+		end := start + step
+		if i < rest {
+			end++
+		}
+		parts[i] = [2]int{start, end}
+		start = end
+	}
+	return parts
+}
+
+func logAdd(lvar1, lvar2 float64) float64 {
+	if lvar1 < lvar2 {
+		lvar1, lvar2 = lvar2, lvar1
+	}
+
+	diff := lvar2 - lvar1
+	if diff < minLogExp {
+		if lvar1 < constant.LSMALL {
+			return constant.LOGZERO
+		}
+		return lvar1
+	}
+	return lvar1 + math.Log(1.0+math.Exp(diff))
+}
+
+var minLogExp = -math.Log(-(constant.LOGZERO))
@@ -0,0 +1,79 @@
+package gmm
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Stats are the posterior statistics of frames against one model, summed
+// block by block with Accumulate so the frames never have to be held
+// together.
+type Stats struct {
+	Frames int
+	acc    *accumulator
+}
+
+func (g *GMM) NewStats() *Stats {
+	return &Stats{acc: newAccumulator(g.Mixtures, g.VectorSize)}
+}
+
+// Total log likelihood of the accumulated frames.
+func (s *Stats) LProb() float64 {
+	return s.acc.lprob
+}
+
+// Occupation count of mixture i.
+func (s *Stats) Occupation(i int) float64 {
+	return s.acc.occ[i]
+}
+
+// Accumulate adds the E step statistics of frames against g.
+func (g *GMM) Accumulate(s *Stats, frames [][]float32) {
+	if len(frames) == 0 {
+		return
+	}
+
+	k := g.kernel(g.Mixtures)
+	parts := splitFrames(len(frames), g.workers())
+	accs := make([]*accumulator, len(parts))
+
+	var wg sync.WaitGroup
+	for w, part := range parts {
+		wg.Add(1)
+		go func(w int, part [2]int) {
+			defer wg.Done()
+			acc := newAccumulator(g.Mixtures, g.VectorSize)
+			lmix := make([]float64, g.Mixtures)
+			for _, frame := range frames[part[0]:part[1]] {
+				acc.add(k, frame, lmix)
+			}
+			accs[w] = acc
+		}(w, part)
+	}
+	wg.Wait()
+
+	for _, a := range accs {
+		s.acc.merge(a)
+	}
+	s.Frames += len(frames)
+}
+
+// MAPAdapt moves the means of g towards the statistics, which must have
+// been accumulated against g, mean = (sum + relevance*mean) / (occupation +
+// relevance). Weights and covariances are kept.
+func (g *GMM) MAPAdapt(s *Stats, relevance float64) error {
+	if len(s.acc.occ) != g.Mixtures || len(s.acc.sum) != g.Mixtures*g.VectorSize {
+		return fmt.Errorf("statistics of %d mixtures, model has %d", len(s.acc.occ), g.Mixtures)
+	}
+	if s.Frames == 0 {
+		return fmt.Errorf("no feature data for training")
+	}
+
+	for i := 0; i < g.Mixtures; i++ {
+		occ := s.acc.occ[i]
+		for j := 0; j < g.VectorSize; j++ {
+			g.Mean[i][j] = (s.acc.sum[i*g.VectorSize+j] + relevance*g.Mean[i][j]) / (occ + relevance)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package gmm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Plain text model, one keyword per line, '#' starts a comment:
+//
+//	gmm <mixtures> <dimension>
+//	weight <w>
+//	mean <m1> ... <mD>
+//	var <v1> ... <vD>
+//	... weight/mean/var for every mixture
+func (g *GMM) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "gmm %d %d\n", g.Mixtures, g.VectorSize)
+
+	writeVector := func(key string, v []float64) {
+		bw.WriteString(key)
+		for _, x := range v {
+			bw.WriteByte(' ')
+			bw.WriteString(strconv.FormatFloat(x, 'g', -1, 64))
+		}
+		bw.WriteByte('\n')
+	}
+
+	for i := 0; i < g.Mixtures; i++ {
+		writeVector("weight", g.MixtureWeight[i:i+1])
+		writeVector("mean", g.Mean[i])
+		writeVector("var", g.Covar[i])
+	}
+
+	// bufio.Writer keeps the first write error
+	return bw.Flush()
+}
+
+func (g *GMM) ReadText(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	mixture := -1
+	var seen [3]bool
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		values := make([]float64, len(fields)-1)
+		for i, field := range fields[1:] {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return fmt.Errorf("line %d: invalid number %q", line, field)
+			}
+			values[i] = v
+		}
+
+		if fields[0] == "gmm" {
+			if mixture >= 0 || len(values) != 2 || values[0] <= 0 || values[1] <= 0 {
+				return fmt.Errorf("line %d: expected \"gmm <mixtures> <dimension>\" once", line)
+			}
+			g.alloc(int(values[0]), int(values[1]))
+			mixture = 0
+			continue
+		}
+
+		if mixture < 0 {
+			return fmt.Errorf("line %d: missing \"gmm <mixtures> <dimension>\" header", line)
+		}
+
+		var key int
+		switch fields[0] {
+		case "weight":
+			key = 0
+		case "mean":
+			key = 1
+		case "var":
+			key = 2
+		default:
+			return fmt.Errorf("line %d: unknown keyword %q", line, fields[0])
+		}
+
+		if seen[key] {
+			// next mixture
+			if !(seen[0] && seen[1] && seen[2]) {
+				return fmt.Errorf("line %d: mixture %d is incomplete", line, mixture)
+			}
+			mixture++
+			seen = [3]bool{}
+		}
+		if mixture >= g.Mixtures {
+			return fmt.Errorf("line %d: more than %d mixtures", line, g.Mixtures)
+		}
+		seen[key] = true
+
+		want := g.VectorSize
+		if key == 0 {
+			want = 1
+		}
+		if len(values) != want {
+			return fmt.Errorf("line %d: %s has %d values, expected %d", line, fields[0], len(values), want)
+		}
+
+		switch key {
+		case 0:
+			g.MixtureWeight[mixture] = values[0]
+		case 1:
+			copy(g.Mean[mixture], values)
+		case 2:
+			copy(g.Covar[mixture], values)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if mixture != g.Mixtures-1 || !(seen[0] && seen[1] && seen[2]) {
+		return fmt.Errorf("expected %d complete mixtures", g.Mixtures)
+	}
+	return g.finishLoad()
+}
+
+func (g *GMM) LoadText(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return g.ReadText(f)
+}
+
+func (g *GMM) SaveText(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = g.WriteText(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
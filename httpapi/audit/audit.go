@@ -0,0 +1,241 @@
+// Package audit keeps the trail of the enrolments, verifications and
+// deletions of the users of the apps: app, user, operation, result, score
+// and decision, hash of the audio, client address and latency of every
+// request, in the hash chained models.AuditEvent and, if audit_file is set,
+// as JSON lines appended to that file.
+//
+// Only authenticated requests are audited, the ones refused by the rate
+// limits are counted in the usage of the app instead. Erase keeps the
+// events of an erased user without what identifies it.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/liuxp0827/govpr/httpapi/constants"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/log"
+)
+
+// audited operations
+const (
+	OP_ADD_SAMPLE    = "addsample"
+	OP_TRAIN_MODEL   = "trainmodel"
+	OP_VERIFY_MODEL  = "verifymodel"
+	OP_IDENTIFY      = "identify"
+	OP_DELETE_MODEL  = "deletemodel"
+	OP_DELETE_USER   = "deleteuser"
+	OP_CLEAR_SAMPLES = "clearsamples"
+
+	OP_DELETE_RETAINED = "deleteretained"
+	OP_ERASE_USER      = "eraseuser"
+	OP_EXPORT_USER     = "exportuser"
+)
+
+// APIs of the events
+const (
+	API_V1   = "v1"
+	API_V2   = "v2"
+	API_GRPC = "grpc"
+)
+
+// success codes of the operations, the v2 API answers with HTTP statuses
+var successCodes = map[string]int{
+	OP_ADD_SAMPLE:    constants.SUCCESS_ADDSAMPLE,
+	OP_TRAIN_MODEL:   constants.SUCCESS_TRAIN_MODEL,
+	OP_VERIFY_MODEL:  constants.SUCCESS_VERIFY_MODEL,
+	OP_IDENTIFY:      constants.SUCCESS_IDENTIFY,
+	OP_DELETE_MODEL:  constants.SUCCESS_DELETE_MODEL,
+	OP_DELETE_USER:   constants.SUCCESS_DELETE_USER,
+	OP_CLEAR_SAMPLES: constants.SUCCESS_CLEAR_SAMPLES,
+
+	OP_DELETE_RETAINED: constants.SUCCESS_DELETE_RETAINED,
+	OP_ERASE_USER:      constants.SUCCESS_ERASE_USER,
+	OP_EXPORT_USER:     constants.SUCCESS_EXPORT_USER,
+}
+
+// File mirrors the events as JSON lines, empty for the database only
+var File = beego.AppConfig.DefaultString("audit_file", "")
+
+// Trail collects what the handler of an audited request knows of it. Its
+// methods do nothing on a nil Trail, the one of a request not audited.
+type Trail struct {
+	op       string
+	api      string
+	start    time.Time
+	app      *models.AppInfo
+	audio    hash.Hash
+	score    float64
+	decision string
+	done     bool
+}
+
+func newTrail(op, api string) *Trail {
+	return &Trail{op: op, api: api, start: time.Now()}
+}
+
+// Audio adds data to the audio of the request, the hash is of all of it
+func (this *Trail) Audio(data ...[]byte) {
+	if this == nil {
+		return
+	}
+	if this.audio == nil {
+		this.audio = sha256.New()
+	}
+	for _, d := range data {
+		this.audio.Write(d)
+	}
+}
+
+// Decide records the score and the decision of a verification
+func (this *Trail) Decide(score float64, decision string) {
+	if this == nil {
+		return
+	}
+	this.score, this.decision = score, decision
+}
+
+// SetApp sets the app of the request, for the APIs without auth.App
+func (this *Trail) SetApp(app *models.AppInfo) {
+	if this == nil {
+		return
+	}
+	this.app = app
+}
+
+// Record stores the event of the trail once, code being the errCode of the
+// v1 API or 0 for an error without one. Requests without an app are not
+// recorded. An event failing to append is queued and appended again.
+func (this *Trail) Record(userid, ip string, code int) {
+	if this == nil || this.done || this.app == nil {
+		return
+	}
+	this.done = true
+
+	e := &models.AuditEvent{
+		Time:     this.start,
+		AppId:    this.app.AppId,
+		UserId:   userid,
+		Op:       this.op,
+		Api:      this.api,
+		Code:     code,
+		Success:  code == successCodes[this.op],
+		Decision: this.decision,
+		Ip:       ip,
+		Latency:  int64(time.Since(this.start) / time.Millisecond),
+	}
+	if this.decision != "" {
+		e.Score = this.score
+	}
+	if this.audio != nil {
+		e.AudioHash = hex.EncodeToString(this.audio.Sum(nil))
+	}
+
+	if err := models.AppendAudit(e); err != nil {
+		log.Errorf("应用[%s]: 写入审计日志失败, 稍后重试, 用户账号[%s] %s, %v", e.AppId, userid, this.op, err)
+		retryLater(e)
+		return
+	}
+	if File != "" {
+		appendFile(File, e)
+	}
+}
+
+// most events waiting for another append
+const RETRY_QUEUE = 10000
+
+// The events whose append failed are appended again in the background until
+// stored: the response of their request is already sent, so it cannot fail
+// instead. The queue is lost with the process.
+var (
+	retryOnce sync.Once
+	retries   = make(chan *models.AuditEvent, RETRY_QUEUE)
+)
+
+func retryLater(e *models.AuditEvent) {
+	retryOnce.Do(func() { go retryLoop() })
+	select {
+	case retries <- e:
+	default:
+		log.Errorf("应用[%s]: 审计日志重试队列已满, 丢弃事件 %s, 用户账号[%s]", e.AppId, e.Op, e.UserId)
+	}
+}
+
+func retryLoop() {
+	for e := range retries {
+		backoff := time.Second
+		for {
+			err := models.AppendAudit(e)
+			if err == nil {
+				break
+			}
+			log.Errorf("应用[%s]: 重试写入审计日志失败, 用户账号[%s] %s, %v", e.AppId, e.UserId, e.Op, err)
+			time.Sleep(backoff)
+			if backoff < time.Minute {
+				backoff *= 2
+			}
+		}
+		if File != "" {
+			appendFile(File, e)
+		}
+	}
+}
+
+// Entry is the JSON form of an event, of the audit_file lines and the
+// audit query
+type Entry struct {
+	Id        int64    `json:"id"`
+	Time      string   `json:"time"`
+	AppId     string   `json:"appid"`
+	UserId    string   `json:"userid,omitempty"`
+	Op        string   `json:"op"`
+	Api       string   `json:"api"`
+	Code      int      `json:"code"`
+	Success   bool     `json:"success"`
+	Score     *float64 `json:"score,omitempty"`
+	Decision  string   `json:"decision,omitempty"`
+	AudioHash string   `json:"audiohash,omitempty"`
+	Ip        string   `json:"ip"`
+	Latency   int64    `json:"latency"`
+	Subject   string   `json:"subject"`
+	Erased    bool     `json:"erased,omitempty"` // userid, ip and audiohash were erased
+	PrevHash  string   `json:"prevhash"`
+	Hash      string   `json:"hash"`
+}
+
+func EntryOf(e *models.AuditEvent) Entry {
+	entry := Entry{e.Id, e.Time.Format(time.RFC3339), e.AppId, e.UserId, e.Op, e.Api, e.Code, e.Success, nil,
+		e.Decision, e.AudioHash, e.Ip, e.Latency, e.Subject, e.Erased(), e.PrevHash, e.Hash}
+	if e.Decision != "" {
+		score := e.Score
+		entry.Score = &score
+	}
+	return entry
+}
+
+var fileLock sync.Mutex
+
+func appendFile(filename string, e *models.AuditEvent) {
+	line, _ := json.Marshal(EntryOf(e))
+
+	fileLock.Lock()
+	defer fileLock.Unlock()
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err == nil {
+		_, err = f.Write(append(line, '\n'))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		log.Errorf("应用[%s]: 写入审计文件 %s 失败, %v", e.AppId, filename, err)
+	}
+}
@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/liuxp0827/govpr/httpapi/constants"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/log"
+)
+
+// Erase deletes everything stored about the user of the app: the user,
+// its model, train samples and retained audio, and the userid, ip and
+// audio hash of its audit events, in the database and in audit_file. The
+// erasure is audited without the user, its event carrying the digest of
+// the receipt returned, see models.VerifyErasureReceipt.
+//
+// The user is locked until the receipt is stored: an upload, training or
+// verification of the user in between would store files or audit events
+// after their erasure. The error is models.ErrUserBusy when another request
+// holds the user for all the wait.
+func Erase(app *models.AppInfo, userid, api, ip string) (*models.ErasureReceipt, error) {
+	start := time.Now()
+	unlock, err := models.LockUser(app.Token, userid)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	r, err := models.EraseUser(app, userid)
+	if err != nil {
+		return nil, err
+	}
+
+	if File != "" {
+		if r.AuditLines, err = redactFile(File, app.AppId, userid); err != nil {
+			return nil, err
+		}
+	}
+	r.Digest = r.ContentDigest()
+
+	e := &models.AuditEvent{
+		Time:      start,
+		AppId:     app.AppId,
+		Op:        OP_ERASE_USER,
+		Api:       api,
+		Code:      constants.SUCCESS_ERASE_USER,
+		Success:   true,
+		AudioHash: r.Digest,
+		Ip:        ip,
+		Latency:   int64(time.Since(start) / time.Millisecond),
+	}
+	if err = models.AppendAudit(e); err != nil {
+		return nil, err
+	}
+	if File != "" {
+		appendFile(File, e)
+	}
+
+	r.AuditHash = e.Hash
+	if err = models.AddErasureReceipt(r); err != nil {
+		return nil, err
+	}
+	log.Infof("应用[%s]: 擦除用户数据成功, 回执 %d", app.AppId, r.Id)
+	return r, nil
+}
+
+// redactFile erases the userid, ip and audio hash of the lines of the user
+// of the app in the audit file, and returns how many lines were redacted
+func redactFile(filename, appid, userid string) (int, error) {
+	fileLock.Lock()
+	defer fileLock.Unlock()
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var out bytes.Buffer
+	n := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var entry Entry
+		if json.Unmarshal(line, &entry) == nil && entry.AppId == appid && entry.UserId == userid && userid != "" {
+			entry.UserId, entry.Ip, entry.AudioHash, entry.Erased = "", "", "", true
+			line, _ = json.Marshal(entry)
+			n++
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	tmp := filename + ".tmp"
+	if err = ioutil.WriteFile(tmp, out.Bytes(), 0600); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp, filename)
+}
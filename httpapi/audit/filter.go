@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"strings"
+
+	"github.com/astaxie/beego/context"
+	"github.com/liuxp0827/govpr/httpapi/auth"
+)
+
+// TRAIL is the context data of the *Trail of an audited request
+const TRAIL = "audit.trail"
+
+// operations of the routes, by "METHOD pattern"
+var ops = map[string]string{}
+
+// Audit makes the requests of method on the route pattern audited as op
+func Audit(method, pattern, op string) {
+	ops[strings.ToUpper(method)+" "+pattern] = op
+}
+
+// Of returns the trail of the request, nil if it is not audited
+func Of(ctx *context.Context) *Trail {
+	t, _ := ctx.Input.GetData(TRAIL).(*Trail)
+	return t
+}
+
+// Start begins the trail of the audited routes, at beego.BeforeExec before
+// auth.Filter so the latency covers the authentication.
+func Start(ctx *context.Context) {
+	pattern, _ := ctx.Input.GetData("RouterPattern").(string)
+	op := ops[ctx.Request.Method+" "+pattern]
+	if op == "" {
+		return
+	}
+
+	api := API_V1
+	if strings.HasPrefix(ctx.Request.URL.Path, "/v2/") {
+		api = API_V2
+	}
+	ctx.Input.SetData(TRAIL, newTrail(op, api))
+}
+
+// Filter records the event of the request, at beego.FinishRouter with
+// returnOnOutput false. beego skips it for the requests stopped with
+// StopRun, whose handlers call Finish themselves.
+func Filter(ctx *context.Context) {
+	Finish(ctx)
+}
+
+// Finish records the event of the request once its response is set. The
+// user is the ":uid" of the path or the form value "userid".
+func Finish(ctx *context.Context) {
+	t := Of(ctx)
+	if t == nil || t.done {
+		return
+	}
+	t.SetApp(auth.App(ctx))
+
+	userid := ctx.Input.Param(":uid")
+	if userid == "" {
+		userid = ctx.Request.FormValue("userid")
+	}
+	t.Record(userid, ctx.Input.IP(), code(ctx, t))
+}
+
+// code is the errCode of the response, of its body or for the v2 API of
+// the HTTP status of a success
+func code(ctx *context.Context, t *Trail) int {
+	body, _ := ctx.Input.GetData("json").(map[string]interface{})
+	if t.api == API_V1 {
+		code, _ := body["errCode"].(int)
+		return code
+	}
+
+	status := ctx.ResponseWriter.Status
+	if status == 0 {
+		status = ctx.Output.Status
+	}
+	if status < 400 {
+		return successCodes[t.op]
+	}
+	e, _ := body["error"].(map[string]interface{})
+	code, _ := e["code"].(int)
+	return code
+}
@@ -0,0 +1,19 @@
+package audit
+
+import (
+	"context"
+)
+
+type trailKey struct{}
+
+// NewContext returns ctx with a new trail of op, for the gRPC calls
+func NewContext(ctx context.Context, op string) (context.Context, *Trail) {
+	t := newTrail(op, API_GRPC)
+	return context.WithValue(ctx, trailKey{}, t), t
+}
+
+// FromContext returns the trail of the call, nil if it is not audited
+func FromContext(ctx context.Context) *Trail {
+	t, _ := ctx.Value(trailKey{}).(*Trail)
+	return t
+}
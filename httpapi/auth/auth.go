@@ -0,0 +1,237 @@
+// Package auth signs and verifies the requests of apps.
+//
+// A request carries the appid, a unix timestamp, a nonce and a signature in
+// the X-Vpr-* headers. The signature is the hex HMAC-SHA256, under the app
+// key, of
+//
+//	METHOD \n PATH \n PARAMS \n TIMESTAMP \n NONCE \n SHA256(PAYLOAD)
+//
+// PARAMS are the query and form values, url encoded and sorted by key.
+// PAYLOAD is the request body, except for multipart/form-data where it is
+// the content of the "file" part. A request is accepted within WINDOW of its
+// timestamp, and its nonce only once.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/httpapi/redis"
+)
+
+const (
+	HEADER_APPID     = "X-Vpr-Appid"
+	HEADER_TIMESTAMP = "X-Vpr-Timestamp"
+	HEADER_NONCE     = "X-Vpr-Nonce"
+	HEADER_SIGNATURE = "X-Vpr-Signature"
+
+	WINDOW = 5 * time.Minute // accepted clock skew, the replay window
+
+	NONCE_MIN_LEN = 16
+	NONCE_MAX_LEN = 64
+)
+
+var (
+	ErrNoSignature  = errors.New("request is not signed")
+	ErrUnknownApp   = errors.New("unknown appid")
+	ErrRevoked      = errors.New("keys of the app are revoked")
+	ErrTimestamp    = errors.New("timestamp is outside the replay window")
+	ErrNonce        = errors.New("nonce must be 16 to 64 characters")
+	ErrReplay       = errors.New("nonce is already used")
+	ErrBadSignature = errors.New("signature mismatch")
+)
+
+// Request is the signed part of a request
+type Request struct {
+	AppId     string
+	Timestamp string
+	Nonce     string
+	Signature string
+
+	Method  string
+	Path    string
+	Params  url.Values
+	Payload []byte
+}
+
+// CanonicalString is the string signed for r
+func CanonicalString(r *Request) string {
+	sum := sha256.Sum256(r.Payload)
+	return strings.Join([]string{
+		strings.ToUpper(r.Method),
+		r.Path,
+		r.Params.Encode(),
+		r.Timestamp,
+		r.Nonce,
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+}
+
+// Sign returns the signature of r under key
+func Sign(key string, r *Request) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(CanonicalString(r)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignNow fills the timestamp, a new nonce and the signature of r
+func SignNow(appid, key string, r *Request) {
+	r.AppId = appid
+	r.Timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+	r.Nonce = newNonce()
+	r.Signature = Sign(key, r)
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// NonceStore remembers the nonces seen within the window. Use records the
+// nonce key until expires, and tells false if it is already recorded.
+type NonceStore interface {
+	Use(key string, now, expires time.Time) (bool, error)
+}
+
+// nonces remembers the nonces in the memory of this server
+type nonces struct {
+	sync.Mutex
+	seen  map[string]time.Time
+	purge time.Time
+}
+
+func NewMemNonces() NonceStore {
+	return &nonces{seen: make(map[string]time.Time)}
+}
+
+func (n *nonces) Use(key string, now, expires time.Time) (bool, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	if now.After(n.purge) {
+		for k, t := range n.seen {
+			if now.After(t) {
+				delete(n.seen, k)
+			}
+		}
+		n.purge = now.Add(WINDOW)
+	}
+
+	if t, ok := n.seen[key]; ok && !now.After(t) {
+		return false, nil
+	}
+	n.seen[key] = expires
+	return true, nil
+}
+
+// prefix of the keys of the nonces
+const REDIS_NONCE_PREFIX = "govpr:nonce:"
+
+// RedisNonces remembers the nonces in Redis, so a request replayed to
+// another server of the deployment is refused too
+type RedisNonces struct {
+	client *redis.Client
+}
+
+func NewRedisNonces(client *redis.Client) *RedisNonces {
+	return &RedisNonces{client: client}
+}
+
+func (this *RedisNonces) Use(key string, now, expires time.Time) (bool, error) {
+	ttl := expires.Sub(now)
+	if ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+	return this.client.SetNX(REDIS_NONCE_PREFIX+key, "1", ttl)
+}
+
+// Verifier checks signed requests against the keys of the apps
+type Verifier struct {
+	Nonces NonceStore
+
+	// lookup and clock, replaced in tools
+	Lookup func(appid string) (*models.AppInfo, error)
+	Now    func() time.Time
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{
+		Nonces: NewMemNonces(),
+		Lookup: models.GetAppInfoByAppId,
+		Now:    time.Now,
+	}
+}
+
+// Verify returns the app of a correctly signed, fresh request
+func (this *Verifier) Verify(r *Request) (*models.AppInfo, error) {
+	if r.AppId == "" || r.Signature == "" {
+		return nil, ErrNoSignature
+	}
+
+	now := this.Now()
+	ts, err := strconv.ParseInt(r.Timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrTimestamp
+	}
+	t := time.Unix(ts, 0)
+	if t.Before(now.Add(-WINDOW)) || t.After(now.Add(WINDOW)) {
+		return nil, ErrTimestamp
+	}
+
+	if len(r.Nonce) < NONCE_MIN_LEN || len(r.Nonce) > NONCE_MAX_LEN {
+		return nil, ErrNonce
+	}
+
+	app, err := this.Lookup(r.AppId)
+	if err == orm.ErrNoRows {
+		return nil, ErrUnknownApp
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys := app.SigningKeys(now)
+	if len(keys) == 0 {
+		return nil, ErrRevoked
+	}
+
+	sig, err := hex.DecodeString(r.Signature)
+	if err != nil {
+		return nil, ErrBadSignature
+	}
+
+	valid := false
+	for _, key := range keys {
+		want, _ := hex.DecodeString(Sign(key, r))
+		if hmac.Equal(sig, want) {
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, ErrBadSignature
+	}
+
+	// only a valid signature spends the nonce, past the window the
+	// timestamp check rejects a replay
+	fresh, err := this.Nonces.Use(r.AppId+":"+r.Nonce, now, t.Add(WINDOW))
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, ErrReplay
+	}
+	return app, nil
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/liuxp0827/govpr/httpapi/redis"
+)
+
+func testNonces(t *testing.T, a, b NonceStore) {
+	now := time.Now()
+	if ok, err := a.Use("app:n1", now, now.Add(time.Minute)); err != nil || !ok {
+		t.Fatalf("Use of a new nonce = %t, %v, want true", ok, err)
+	}
+	if ok, err := b.Use("app:n1", now, now.Add(time.Minute)); err != nil || ok {
+		t.Fatalf("Use of a replayed nonce = %t, %v, want false", ok, err)
+	}
+	if ok, err := b.Use("app:n2", now, now.Add(time.Minute)); err != nil || !ok {
+		t.Fatalf("Use of another nonce = %t, %v, want true", ok, err)
+	}
+}
+
+func TestMemNonces(t *testing.T) {
+	n := NewMemNonces()
+	testNonces(t, n, n)
+}
+
+func TestRedisNonces(t *testing.T) {
+	s := redis.NewStandin()
+	addr, err := s.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// a nonce used on one server is refused by another
+	a, b := redis.NewClient(addr, "", 0), redis.NewClient(addr, "", 0)
+	defer a.Close()
+	defer b.Close()
+	testNonces(t, NewRedisNonces(a), NewRedisNonces(b))
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
+	"github.com/astaxie/beego/orm"
+	"github.com/liuxp0827/govpr/httpapi/constants"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/log"
+)
+
+// APP is the context data of the authenticated *models.AppInfo
+const APP = "auth.app"
+
+var (
+	DefaultVerifier = NewVerifier()
+
+	// LegacyToken also accepts unsigned requests carrying the static app
+	// token, while clients move to signing. Off by default.
+	LegacyToken = beego.AppConfig.DefaultBool("auth_legacy_token", false)
+)
+
+// App returns the app authenticated by Filter, nil without one
+func App(ctx *context.Context) *models.AppInfo {
+	app, _ := ctx.Input.GetData(APP).(*models.AppInfo)
+	return app
+}
+
+// Filter authenticates the request for the routes it is inserted on, at
+// beego.BeforeExec. The form value "token" is set to the token of the app,
+// where the v1 routes read it.
+func Filter(ctx *context.Context) {
+	if ctx.Request.Form == nil {
+		ctx.Request.ParseForm()
+	}
+
+	app, err := authenticate(ctx)
+	if err != nil {
+		log.Warnf("应用[%s]: %s %s 认证失败, %v", ctx.Input.Header(HEADER_APPID), ctx.Request.Method, ctx.Request.URL.Path, err)
+		deny(ctx, err)
+		return
+	}
+
+	ctx.Input.SetData(APP, app)
+	ctx.Request.Form.Set("token", app.Token)
+}
+
+func authenticate(ctx *context.Context) (*models.AppInfo, error) {
+	r := &Request{
+		AppId:     ctx.Input.Header(HEADER_APPID),
+		Timestamp: ctx.Input.Header(HEADER_TIMESTAMP),
+		Nonce:     ctx.Input.Header(HEADER_NONCE),
+		Signature: ctx.Input.Header(HEADER_SIGNATURE),
+		Method:    ctx.Request.Method,
+		Path:      ctx.Request.URL.Path,
+		Params:    url.Values{},
+	}
+
+	if r.AppId == "" && LegacyToken {
+		return legacyApp(ctx)
+	}
+
+	for k, v := range ctx.Request.Form {
+		r.Params[k] = v
+	}
+
+	payload, err := payload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.Payload = payload
+
+	return DefaultVerifier.Verify(r)
+}
+
+// payload is the signed content of the request, the body or the file of a
+// multipart form, which beego parses without keeping the body
+func payload(ctx *context.Context) ([]byte, error) {
+	if !ctx.Input.IsUpload() {
+		return ctx.Input.RequestBody, nil
+	}
+
+	form := ctx.Request.MultipartForm
+	if form == nil || len(form.File["file"]) == 0 {
+		return nil, nil
+	}
+
+	file, err := form.File["file"][0].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+// legacyApp is the app of the static token of the form, or the bearer
+// token of the /v2 routes
+func legacyApp(ctx *context.Context) (*models.AppInfo, error) {
+	token := ctx.Request.Form.Get("token")
+	if auth := ctx.Input.Header("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimSpace(auth[7:])
+	}
+	if token == "" {
+		return nil, ErrNoSignature
+	}
+
+	app, err := models.GetAppInfoByToken(token)
+	if err == orm.ErrNoRows {
+		return nil, ErrUnknownApp
+	}
+	if err != nil {
+		return nil, err
+	}
+	if app.KeyRevoked {
+		return nil, ErrRevoked
+	}
+	return app, nil
+}
+
+func deny(ctx *context.Context, err error) {
+	status, code, msg := http.StatusUnauthorized, constants.ERROR_SIGNATURE_ILLEGAL, err.Error()
+	switch err {
+	case ErrUnknownApp, ErrRevoked:
+		code = constants.ERROR_APP_TOKEN
+	case ErrNoSignature, ErrTimestamp, ErrNonce, ErrReplay, ErrBadSignature:
+	default:
+		status, code, msg = http.StatusInternalServerError, constants.ERROR_APP_TOKEN, "authenticate request failed"
+	}
+
+	ctx.Output.SetStatus(status)
+	if strings.HasPrefix(ctx.Request.URL.Path, "/v2/") {
+		ctx.Output.JSON(map[string]interface{}{"error": map[string]interface{}{"status": status, "code": code, "message": msg}}, false, false)
+		return
+	}
+	ctx.Output.JSON(map[string]interface{}{"ret": code, "errCode": code, "msg": msg}, false, false)
+}
@@ -10,16 +10,21 @@ const (
 	SUCCESS_VERIFY_MODEL    = 1007 // 验证成功
 	SUCCESS_DETECT_REGISTER = 1010 // 登记检测通过
 	SUCCESS_DETECT_QUERY    = 1011 // 验证检测通过
+	SUCCESS_IDENTIFY        = 1012 // 辨认成功
+	SUCCESS_DELETE_RETAINED = 1013 // 删除留存的验证语音成功
+	SUCCESS_ERASE_USER      = 1014 // 擦除用户数据成功
+	SUCCESS_EXPORT_USER     = 1015 // 导出用户数据成功
 
-	FAILED_REGISTER_USER   = 100 // 注册用户失败
-	FAILED_DELETE_USER     = 200 // 删除用失败
-	FAILED_CLEAR_SAMPLES   = 300 // 清除数据库中训练语音缓存失败
-	FAILED_TRAIN_MODEL     = 400 // 训练模型失败
-	FAILED_DELETE_MODEL    = 500 // 删除模型失败
-	FAILED_ADDSAMPLE       = 600 // 添加语音到数据库训练语音缓存失败
-	FAILED_VERIFY_MODEL    = 700 // 验证失败
-	FAILED_DETECT_REGISTER = 800 // 登记检测失败
-	FAILED_DETECT_QUERY    = 900 // 验证检测失败
+	FAILED_REGISTER_USER   = 100  // 注册用户失败
+	FAILED_DELETE_USER     = 200  // 删除用失败
+	FAILED_CLEAR_SAMPLES   = 300  // 清除数据库中训练语音缓存失败
+	FAILED_TRAIN_MODEL     = 400  // 训练模型失败
+	FAILED_DELETE_MODEL    = 500  // 删除模型失败
+	FAILED_ADDSAMPLE       = 600  // 添加语音到数据库训练语音缓存失败
+	FAILED_VERIFY_MODEL    = 700  // 验证失败
+	FAILED_DETECT_REGISTER = 800  // 登记检测失败
+	FAILED_DETECT_QUERY    = 900  // 验证检测失败
+	FAILED_IDENTIFY        = 1000 // 辨认失败
 
 	ERROR_USER_EXISTENT        = 2001 // 用户已存在
 	ERROR_USER_NONEXISTENT     = 2002 // 用户不存在
@@ -35,4 +40,15 @@ const (
 	ERROR_USER_ILLEGAL         = 2012 // 用户名不合法
 	ERROR_APP_TOKEN            = 2018 // 权限不合法
 	ERROR_URL_PARAM_ILLEGAL    = 2019 // url参数不合法
+	ERROR_IDENTIFY_FAILED      = 2020 // 辨认失败
+	ERROR_SAMPLE_TOO_LARGE     = 2021 // 上传语音过大
+	ERROR_SIGNATURE_ILLEGAL    = 2022 // 请求签名不合法
+	ERROR_RATE_LIMITED         = 2023 // 请求过于频繁
+	ERROR_QUOTA_EXCEEDED       = 2024 // 超出每日配额
+	ERROR_USER_LOCKED          = 2025 // 连续验证失败, 声纹已锁定
+	ERROR_RETAINED_NONEXISTENT = 2026 // 留存的验证语音不存在
+	ERROR_ERASE_USER_FAILED    = 2027 // 擦除用户数据失败
+	ERROR_RECEIPT_NONEXISTENT  = 2028 // 擦除回执不存在
+	ERROR_EXPORT_USER_FAILED   = 2029 // 导出用户数据失败
+	ERROR_USER_BUSY            = 2030 // 用户正被其他请求修改
 )
@@ -4,6 +4,11 @@ import (
 	"fmt"
 	"github.com/astaxie/beego"
 	"github.com/liuxp0827/govpr/httpapi/models"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 )
 
 type AppInfoController struct {
@@ -11,10 +16,9 @@ type AppInfoController struct {
 }
 
 func (this *AppInfoController) RegisterApp() {
-	q := this.Ctx.Request.URL.Query()
-	name := q.Get("devname")
-	pwd := q.Get("password")
-	appname := q.Get("appname")
+	name := this.Ctx.Request.PostFormValue("devname")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	appname := this.Ctx.Request.PostFormValue("appname")
 
 	if len(name) == 0 {
 		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Register App name can not be \"\"")}
@@ -72,10 +76,9 @@ func (this *AppInfoController) RegisterApp() {
 }
 
 func (this *AppInfoController) DeleteApp() {
-	q := this.Ctx.Request.URL.Query()
-	name := q.Get("devname")
-	pwd := q.Get("password")
-	appname := q.Get("appname")
+	name := this.Ctx.Request.PostFormValue("devname")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	appname := this.Ctx.Request.PostFormValue("appname")
 
 	if len(name) == 0 {
 		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Delete App name can not be \"\"")}
@@ -122,10 +125,9 @@ func (this *AppInfoController) DeleteApp() {
 }
 
 func (this *AppInfoController) GetAppInfo() {
-	q := this.Ctx.Request.URL.Query()
-	name := q.Get("devname")
-	pwd := q.Get("password")
-	appname := q.Get("appname")
+	name := this.Ctx.Request.PostFormValue("devname")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	appname := this.Ctx.Request.PostFormValue("appname")
 
 	if len(name) == 0 {
 		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Get App Info name can not be \"\"")}
@@ -174,3 +176,542 @@ func (this *AppInfoController) GetAppInfo() {
 	this.ServeJSON(false)
 	return
 }
+
+// RotateKey gives the app a new signing key. The old one stays valid for
+// "grace" seconds, key_rotation_grace of app.conf by default.
+func (this *AppInfoController) RotateKey() {
+	name := this.Ctx.Request.PostFormValue("devname")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	appname := this.Ctx.Request.PostFormValue("appname")
+
+	if len(name) == 0 || len(pwd) == 0 || len(appname) == 0 {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Rotate Key devname, password and appname can not be \"\"")}
+		this.ServeJSON(false)
+		return
+	}
+
+	grace := time.Duration(beego.AppConfig.DefaultInt("key_rotation_grace", 86400)) * time.Second
+	if s := this.Ctx.Request.PostFormValue("grace"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Rotate Key grace must be seconds")}
+			this.ServeJSON(false)
+			return
+		}
+		grace = time.Duration(n) * time.Second
+	}
+
+	db := models.NewDBEngine()
+	b, err := db.CheckDeveloper(name, pwd)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Rotate Key failed: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+	if !b {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Rotate Key failed: Developer %s is not exist, or password is wrong", name)}
+		this.ServeJSON(false)
+		return
+	}
+
+	app, err := db.RotateAppKey(name, appname, grace)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Rotate Key of App %s failed: %v", appname, err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	reply := map[string]interface{}{
+		"msg":    fmt.Sprintf("Rotate Key successfully"),
+		"appid":  app.AppId,
+		"appkey": app.Key,
+	}
+	if app.PrevKey != "" {
+		reply["prevkeyexpires"] = app.PrevKeyExpires.Format(time.RFC3339)
+	}
+
+	this.Data["json"] = reply
+	this.ServeJSON(false)
+}
+
+// RevokeKey rejects every request of the app until its key is rotated
+func (this *AppInfoController) RevokeKey() {
+	name := this.Ctx.Request.PostFormValue("devname")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	appname := this.Ctx.Request.PostFormValue("appname")
+
+	if len(name) == 0 || len(pwd) == 0 || len(appname) == 0 {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Revoke Key devname, password and appname can not be \"\"")}
+		this.ServeJSON(false)
+		return
+	}
+
+	db := models.NewDBEngine()
+	b, err := db.CheckDeveloper(name, pwd)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Revoke Key failed: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+	if !b {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Revoke Key failed: Developer %s is not exist, or password is wrong", name)}
+		this.ServeJSON(false)
+		return
+	}
+
+	if err = db.RevokeAppKeys(name, appname); err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Revoke Key of App %s failed: %v", appname, err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Revoke Key successfully")}
+	this.ServeJSON(false)
+}
+
+// SetQuota sets the rate limit, requests per second, and the daily quotas
+// of the app, 0 for the default rate and no quota. The values not given
+// are kept. Only the successful requests use the quotas, see package limit.
+func (this *AppInfoController) SetQuota() {
+	name := this.Ctx.Request.PostFormValue("devname")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	appname := this.Ctx.Request.PostFormValue("appname")
+
+	if len(name) == 0 || len(pwd) == 0 || len(appname) == 0 {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Quota devname, password and appname can not be \"\"")}
+		this.ServeJSON(false)
+		return
+	}
+
+	db := models.NewDBEngine()
+	b, err := db.CheckDeveloper(name, pwd)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Quota failed: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+	if !b {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Quota failed: Developer %s is not exist, or password is wrong", name)}
+		this.ServeJSON(false)
+		return
+	}
+
+	app, err := db.GetAppInfoByName(name, appname)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Quota of App %s failed: %v", appname, err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	rate := int64(app.RateLimit)
+	values := []struct {
+		key string
+		v   *int64
+	}{
+		{"ratelimit", &rate},
+		{"verifyquota", &app.DailyVerifyQuota},
+		{"trainquota", &app.DailyTrainQuota},
+		{"samplequota", &app.DailySampleQuota},
+	}
+	for _, value := range values {
+		s := this.Ctx.Request.PostFormValue(value.key)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil || n < 0 {
+			this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Quota %s must be a count", value.key)}
+			this.ServeJSON(false)
+			return
+		}
+		*value.v = n
+	}
+
+	app, err = db.SetAppQuota(name, appname, int(rate), app.DailyVerifyQuota, app.DailyTrainQuota, app.DailySampleQuota)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Quota of App %s failed: %v", appname, err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	this.Data["json"] = map[string]interface{}{
+		"msg":   fmt.Sprintf("Set Quota successfully"),
+		"appid": app.AppId,
+		"quota": quotaOf(app),
+	}
+	this.ServeJSON(false)
+}
+
+// GetUsage returns the usage of the app by day, from day "from" to "to"
+// included, as 2006-01-02. Both default to today.
+func (this *AppInfoController) GetUsage() {
+	name := this.Ctx.Request.PostFormValue("devname")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	appname := this.Ctx.Request.PostFormValue("appname")
+
+	if len(name) == 0 || len(pwd) == 0 || len(appname) == 0 {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Get Usage devname, password and appname can not be \"\"")}
+		this.ServeJSON(false)
+		return
+	}
+
+	from, to, err := usageDays(this.Ctx.Request.PostFormValue("from"), this.Ctx.Request.PostFormValue("to"))
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Get Usage failed: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	db := models.NewDBEngine()
+	b, err := db.CheckDeveloper(name, pwd)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Get Usage failed: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+	if !b {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Get Usage failed: Developer %s is not exist, or password is wrong", name)}
+		this.ServeJSON(false)
+		return
+	}
+
+	app, usage, err := db.GetAppUsage(name, appname, from, to)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Get Usage of App %s failed: %v", appname, err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	this.Data["json"] = map[string]interface{}{
+		"msg":   fmt.Sprintf("Get Usage successfully"),
+		"appid": app.AppId,
+		"quota": quotaOf(app),
+		"usage": usageOf(usage),
+	}
+	this.ServeJSON(false)
+}
+
+// UnlockUser ends the lock of the voiceprint of a user of the app after
+// repeated failed verifications
+func (this *AppInfoController) UnlockUser() {
+	name := this.Ctx.Request.PostFormValue("devname")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	appname := this.Ctx.Request.PostFormValue("appname")
+	userid := this.Ctx.Request.PostFormValue("userid")
+
+	if len(name) == 0 || len(pwd) == 0 || len(appname) == 0 || len(userid) == 0 {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Unlock User devname, password, appname and userid can not be \"\"")}
+		this.ServeJSON(false)
+		return
+	}
+
+	db := models.NewDBEngine()
+	b, err := db.CheckDeveloper(name, pwd)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Unlock User failed: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+	if !b {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Unlock User failed: Developer %s is not exist, or password is wrong", name)}
+		this.ServeJSON(false)
+		return
+	}
+
+	if err = db.UnlockUser(name, appname, userid); err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Unlock User %s of App %s failed: %v", userid, appname, err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Unlock User successfully")}
+	this.ServeJSON(false)
+}
+
+// SetRetention opts the app in to retaining the audio of its
+// verifications with their score and decision for "days" days, 0 to opt
+// out and delete the audio retained.
+func (this *AppInfoController) SetRetention() {
+	name := this.Ctx.Request.PostFormValue("devname")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	appname := this.Ctx.Request.PostFormValue("appname")
+
+	if len(name) == 0 || len(pwd) == 0 || len(appname) == 0 {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Retention devname, password and appname can not be \"\"")}
+		this.ServeJSON(false)
+		return
+	}
+
+	days, err := strconv.Atoi(this.Ctx.Request.PostFormValue("days"))
+	if err != nil || days < 0 || days > models.MAX_RETAIN_DAYS {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Retention days must be 0 to %d", models.MAX_RETAIN_DAYS)}
+		this.ServeJSON(false)
+		return
+	}
+
+	db := models.NewDBEngine()
+	b, err := db.CheckDeveloper(name, pwd)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Retention failed: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+	if !b {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Retention failed: Developer %s is not exist, or password is wrong", name)}
+		this.ServeJSON(false)
+		return
+	}
+
+	app, err := db.SetRetention(name, appname, days)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Retention of App %s failed: %v", appname, err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	this.Data["json"] = map[string]interface{}{
+		"msg":        fmt.Sprintf("Set Retention successfully"),
+		"appid":      app.AppId,
+		"retaindays": app.RetainDays,
+	}
+	this.ServeJSON(false)
+}
+
+// SetPolicy sets the threshold policy deciding the verifications of the
+// app, or of its user "userid". The policy is "kind" with its "threshold",
+// "male" and "female" or "far"; an empty kind removes it.
+func (this *AppInfoController) SetPolicy() {
+	name := this.Ctx.Request.PostFormValue("devname")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	appname := this.Ctx.Request.PostFormValue("appname")
+	userid := this.Ctx.Request.PostFormValue("userid")
+	kind := this.Ctx.Request.PostFormValue("kind")
+
+	if len(name) == 0 || len(pwd) == 0 || len(appname) == 0 {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Policy devname, password and appname can not be \"\"")}
+		this.ServeJSON(false)
+		return
+	}
+
+	var policy *models.ThresholdPolicy
+	if kind != "" {
+		policy = &models.ThresholdPolicy{Kind: kind}
+		values := []struct {
+			key string
+			set func(float64)
+		}{
+			{"threshold", func(f float64) { policy.Threshold = f }},
+			{"male", func(f float64) { policy.Male = &f }},
+			{"female", func(f float64) { policy.Female = &f }},
+			{"far", func(f float64) { policy.FAR = f }},
+		}
+		for _, value := range values {
+			s := this.Ctx.Request.PostFormValue(value.key)
+			if s == "" {
+				continue
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Policy %s must be a number", value.key)}
+				this.ServeJSON(false)
+				return
+			}
+			value.set(f)
+		}
+	}
+
+	db := models.NewDBEngine()
+	b, err := db.CheckDeveloper(name, pwd)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Policy failed: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+	if !b {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Policy failed: Developer %s is not exist, or password is wrong", name)}
+		this.ServeJSON(false)
+		return
+	}
+
+	if err = db.SetPolicy(name, appname, userid, policy); err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Policy of App %s failed: %v", appname, err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Set Policy successfully"), "policy": policy}
+	this.ServeJSON(false)
+}
+
+// Calibrate stores the scores of development trials of the app, "targets"
+// and "nontargets" separated by commas or spaces, for the far policy and
+// the percentile of verifications. It answers the thresholds of some false
+// accept rates.
+func (this *AppInfoController) Calibrate() {
+	name := this.Ctx.Request.PostFormValue("devname")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	appname := this.Ctx.Request.PostFormValue("appname")
+
+	if len(name) == 0 || len(pwd) == 0 || len(appname) == 0 {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Calibrate devname, password and appname can not be \"\"")}
+		this.ServeJSON(false)
+		return
+	}
+
+	targets, err := parseScores(this.Ctx.Request.PostFormValue("targets"))
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Calibrate targets: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+	nontargets, err := parseScores(this.Ctx.Request.PostFormValue("nontargets"))
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Calibrate nontargets: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	db := models.NewDBEngine()
+	b, err := db.CheckDeveloper(name, pwd)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Calibrate failed: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+	if !b {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Calibrate failed: Developer %s is not exist, or password is wrong", name)}
+		this.ServeJSON(false)
+		return
+	}
+
+	c, err := db.SetCalibration(name, appname, targets, nontargets)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Calibrate App %s failed: %v", appname, err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	thresholds := make([]map[string]float64, 0)
+	for _, far := range []float64{0.1, 0.01, 0.001} {
+		if far*float64(len(nontargets)) < 1 {
+			break
+		}
+		t := c.ThresholdAt(far)
+		thresholds = append(thresholds, map[string]float64{"far": far, "threshold": t, "frr": c.FalseRejectRate(t)})
+	}
+
+	this.Data["json"] = map[string]interface{}{
+		"msg":        fmt.Sprintf("Calibrate successfully"),
+		"targets":    len(targets),
+		"nontargets": len(nontargets),
+		"thresholds": thresholds,
+	}
+	this.ServeJSON(false)
+}
+
+func parseScores(s string) ([]float64, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	scores := make([]float64, len(fields))
+	for i, f := range fields {
+		score, err := strconv.ParseFloat(f, 64)
+		if err != nil || math.IsNaN(score) || math.IsInf(score, 0) {
+			return nil, fmt.Errorf("score %q is not a number", f)
+		}
+		scores[i] = score
+	}
+	return scores, nil
+}
+
+// GetAudit returns the audit events of the app in time order, filtered by
+// "userid", "op" and the times "from" and "to", paged by "offset" and
+// "limit"
+func (this *AppInfoController) GetAudit() {
+	name := this.Ctx.Request.PostFormValue("devname")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	appname := this.Ctx.Request.PostFormValue("appname")
+
+	if len(name) == 0 || len(pwd) == 0 || len(appname) == 0 {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Get Audit devname, password and appname can not be \"\"")}
+		this.ServeJSON(false)
+		return
+	}
+
+	q, err := auditQuery(this.Ctx.Request.PostFormValue)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Get Audit failed: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	db := models.NewDBEngine()
+	b, err := db.CheckDeveloper(name, pwd)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Get Audit failed: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+	if !b {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Get Audit failed: Developer %s is not exist, or password is wrong", name)}
+		this.ServeJSON(false)
+		return
+	}
+
+	app, events, total, err := db.QueryAudit(name, appname, q)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Get Audit of App %s failed: %v", appname, err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	this.Data["json"] = map[string]interface{}{
+		"msg":    fmt.Sprintf("Get Audit successfully"),
+		"appid":  app.AppId,
+		"total":  total,
+		"events": auditEntries(events),
+	}
+	this.ServeJSON(false)
+}
+
+// VerifyAudit recomputes the hash chain of the audit events of the app
+func (this *AppInfoController) VerifyAudit() {
+	name := this.Ctx.Request.PostFormValue("devname")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	appname := this.Ctx.Request.PostFormValue("appname")
+
+	if len(name) == 0 || len(pwd) == 0 || len(appname) == 0 {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Verify Audit devname, password and appname can not be \"\"")}
+		this.ServeJSON(false)
+		return
+	}
+
+	db := models.NewDBEngine()
+	b, err := db.CheckDeveloper(name, pwd)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Verify Audit failed: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+	if !b {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Verify Audit failed: Developer %s is not exist, or password is wrong", name)}
+		this.ServeJSON(false)
+		return
+	}
+
+	app, n, head, broken, err := db.VerifyAudit(name, appname)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Verify Audit of App %s failed: %v", appname, err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	if broken != 0 {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Audit of App %s is broken at event %d", appname, broken),
+			"appid": app.AppId, "intact": false, "brokenat": broken}
+		this.ServeJSON(false)
+		return
+	}
+
+	this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Verify Audit successfully"),
+		"appid": app.AppId, "intact": true, "events": n, "head": head}
+	this.ServeJSON(false)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/astaxie/beego"
 	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/log"
 )
 
 type DeveloperController struct {
@@ -11,10 +12,9 @@ type DeveloperController struct {
 }
 
 func (this *DeveloperController) RegisterDeveloper() {
-	q := this.Ctx.Request.URL.Query()
-	name := q.Get("name")
-	pwd := q.Get("password")
-	email := q.Get("email")
+	name := this.Ctx.Request.PostFormValue("name")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	email := this.Ctx.Request.PostFormValue("email")
 
 	if len(name) == 0 {
 		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Register Developer name can not be \"\"")}
@@ -48,9 +48,8 @@ func (this *DeveloperController) RegisterDeveloper() {
 }
 
 func (this *DeveloperController) DeleteDeveloper() {
-	q := this.Ctx.Request.URL.Query()
-	name := q.Get("name")
-	pwd := q.Get("password")
+	name := this.Ctx.Request.PostFormValue("name")
+	pwd := this.Ctx.Request.PostFormValue("password")
 
 	if len(name) == 0 {
 		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Register Developer name can not be \"\"")}
@@ -87,3 +86,89 @@ func (this *DeveloperController) DeleteDeveloper() {
 	this.ServeJSON(false)
 	return
 }
+
+func (this *DeveloperController) ChangePassword() {
+	name := this.Ctx.Request.PostFormValue("name")
+	pwd := this.Ctx.Request.PostFormValue("password")
+	newPwd := this.Ctx.Request.PostFormValue("newpassword")
+
+	if len(name) == 0 || len(pwd) == 0 || len(newPwd) == 0 {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Change Password name, password and newpassword can not be \"\"")}
+		this.ServeJSON(false)
+		return
+	}
+
+	db := models.NewDBEngine()
+	_, err := db.UpdateDeveloperPassword(name, pwd, newPwd)
+	if err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Change Password failed: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	log.Infof("Developer %s password changed", name)
+	this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Change Password successfully")}
+	this.ServeJSON(false)
+}
+
+// ForgotPassword mails a password reset token to the email of the
+// developer. The reply is the same whether or not name and email match.
+// The token is never in the reply, the route fails without smtp_addr.
+func (this *DeveloperController) ForgotPassword() {
+	name := this.Ctx.Request.PostFormValue("name")
+	email := this.Ctx.Request.PostFormValue("email")
+
+	if len(name) == 0 || len(email) == 0 {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Forgot Password name and email can not be \"\"")}
+		this.ServeJSON(false)
+		return
+	}
+
+	if smtp_addr == "" {
+		log.Errorf("Developer %s forgot password: smtp_addr is not configured, no reset token can be mailed", name)
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Forgot Password failed: mail is not configured")}
+		this.ServeJSON(false)
+		return
+	}
+
+	reply := map[string]interface{}{"msg": fmt.Sprintf("Forgot Password: a reset token is sent to the email of the developer if it matches")}
+
+	db := models.NewDBEngine()
+	token, err := db.NewPasswordResetToken(name, email)
+	if err == nil {
+		if err = sendResetMail(email, name, token); err != nil {
+			log.Errorf("Developer %s send password reset mail failed: %v", name, err)
+			this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Forgot Password failed: send mail failed")}
+			this.ServeJSON(false)
+			return
+		}
+	} else if err != models.ErrBadCredentials {
+		log.Errorf("Developer %s new password reset token failed: %v", name, err)
+	}
+
+	this.Data["json"] = reply
+	this.ServeJSON(false)
+}
+
+func (this *DeveloperController) ResetPassword() {
+	name := this.Ctx.Request.PostFormValue("name")
+	token := this.Ctx.Request.PostFormValue("resettoken")
+	newPwd := this.Ctx.Request.PostFormValue("newpassword")
+
+	if len(name) == 0 || len(token) == 0 || len(newPwd) == 0 {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Reset Password name, resettoken and newpassword can not be \"\"")}
+		this.ServeJSON(false)
+		return
+	}
+
+	db := models.NewDBEngine()
+	if err := db.ResetDeveloperPassword(name, token, newPwd); err != nil {
+		this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Reset Password failed: %v", err)}
+		this.ServeJSON(false)
+		return
+	}
+
+	log.Infof("Developer %s password reset", name)
+	this.Data["json"] = map[string]interface{}{"msg": fmt.Sprintf("Reset Password successfully")}
+	this.ServeJSON(false)
+}
@@ -3,8 +3,11 @@ package controllers
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
+	"time"
 
 	"github.com/astaxie/beego"
+	"github.com/liuxp0827/govpr/httpapi/audit"
 	"github.com/liuxp0827/govpr/httpapi/constants"
 	"github.com/liuxp0827/govpr/httpapi/engine"
 	"github.com/liuxp0827/govpr/httpapi/models"
@@ -34,6 +37,15 @@ func (this *ModelController) TrainModel() {
 		return
 	}
 
+	unlock, err := models.LockUser(token, userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 训练自适应模型失败, %v", userid, err)
+		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_TRAIN_MODEL, "errCode": lockErrCode(err, constants.ERROR_TRAIN_MODEL_FAILED), "msg": "userid " + userid + " train model failed, " + err.Error()}
+		this.ServeJSON(false)
+		return
+	}
+	defer unlock()
+
 	db := models.NewDBEngine()
 
 	usr, err := db.GetUserByIdForTrain(token, userid)
@@ -76,6 +88,7 @@ func (this *ModelController) TrainModel() {
 		}
 	}
 
+	audit.Of(this.Ctx).Audio(usr.Waves...)
 	x, err := engine.NewEngine(16000, 50, model_dir+token+"_"+userid+"/"+userid+".dat")
 	if err != nil {
 		log.Errorf("用户账号[%s]: 训练自适应模型失败, 训练过程有误, %v", userid, err)
@@ -124,8 +137,17 @@ func (this *ModelController) DeleteModel() {
 		return
 	}
 
+	unlock, err := models.LockUser(token, userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 删除自适应模型失败, %v", userid, err)
+		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_DELETE_MODEL, "errCode": lockErrCode(err, constants.ERROR_MODEL_NONEXISTENT), "msg": "userid " + userid + " delete model failed, " + err.Error()}
+		this.ServeJSON(false)
+		return
+	}
+	defer unlock()
+
 	db := models.NewDBEngine()
-	_, err := db.GetUserById(token, userid)
+	_, err = db.GetUserById(token, userid)
 	if err != nil {
 		if err.Error() == "token" {
 			log.Warnf("用户账号[%s]: 删除自适应模型失败, 没有应用权限", userid)
@@ -141,6 +163,9 @@ func (this *ModelController) DeleteModel() {
 	}
 
 	db.UpdateIsTrained(token, userid, false)
+	if err = os.Remove(model_dir + token + "_" + userid + "/" + userid + ".dat"); err != nil && !os.IsNotExist(err) {
+		log.Errorf("用户账号[%s]: 删除模型文件失败, %v", userid, err)
+	}
 	log.Infof("用户账号[%s]: 删除自适应模型成功", userid)
 	this.Data["json"] = map[string]interface{}{"ret": constants.SUCCESS_DELETE_MODEL, "errCode": constants.SUCCESS_DELETE_MODEL, "msg": "userid " + userid + " delete model success."}
 	this.ServeJSON(false)
@@ -184,6 +209,8 @@ func (this *ModelController) VerifyModel() {
 	file, _, err := this.Ctx.Request.FormFile("file")
 	if err != nil {
 		log.Errorf("FormFile: %s", err.Error())
+		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_VERIFY_MODEL, "errCode": constants.ERROR_SAMPLE_IS_NULL, "msg": "read upload sample failed, " + err.Error()}
+		this.ServeJSON(false)
 		return
 	}
 
@@ -192,8 +219,11 @@ func (this *ModelController) VerifyModel() {
 	data, err := ioutil.ReadAll(file)
 	if err != nil {
 		log.Errorf("ReadAll: %s", err.Error())
+		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_VERIFY_MODEL, "errCode": constants.ERROR_SAMPLE_IS_NULL, "msg": "read upload sample failed, " + err.Error()}
+		this.ServeJSON(false)
 		return
 	}
+	audit.Of(this.Ctx).Audio(data)
 
 	if data == nil || len(data) <= 0 {
 		log.Errorf("用户账号[%s]: 验证语音数据失败, 语音数据为空", userid)
@@ -202,25 +232,37 @@ func (this *ModelController) VerifyModel() {
 		return
 	}
 
-	x, err := engine.NewEngine(16000, 50, model_dir+token+"_"+userid+"/"+userid+".dat")
-	if err != nil {
-		log.Errorf("用户账号[%s]: 验证语音数据失败, 验证过程有误, %v", userid, err)
-		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_VERIFY_MODEL, "errCode": constants.ERROR_VERIFY_MODEL_FAILED, "msg": fmt.Sprintf("verify userid %s failed: %v", userid, err)}
+	v, err := engine.Verify(db, token, u.UserId, model_dir+token+"_"+userid+"/"+userid+".dat", data, content)
+	if err == engine.ErrLocked {
+		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_VERIFY_MODEL, "errCode": constants.ERROR_USER_LOCKED,
+			"msg": "userid " + userid + " is locked after repeated failed verifications", "lockeduntil": v.LockedUntil.Format(time.RFC3339)}
 		this.ServeJSON(false)
 		return
 	}
-
-	score, err := x.RecSpeech(data, content, u.UserId, u.Token)
-	x.DestroyEngine()
 	if err != nil {
-		log.Errorf("用户账号[%s]: 验证语音数据失败, 验证过程有误, %v", userid, err)
-		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_VERIFY_MODEL, "errCode": constants.ERROR_VERIFY_MODEL_FAILED, "msg": fmt.Sprintf("verify userid %s failed: %v", userid, err)}
+		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_VERIFY_MODEL, "errCode": lockErrCode(err, constants.ERROR_VERIFY_MODEL_FAILED), "msg": fmt.Sprintf("verify userid %s failed: %v", userid, err)}
 		this.ServeJSON(false)
 		return
 	}
 
-	log.Infof("用户账号[%s]: 验证口令: %s, 最终得分: %f", userid, content, score)
-	this.Data["json"] = map[string]interface{}{"ret": constants.SUCCESS_VERIFY_MODEL, "score": score, "errCode": constants.SUCCESS_VERIFY_MODEL, "msg": "verify userid " + userid + " success."}
+	d := v.Decision
+	audit.Of(this.Ctx).Decide(v.Score, d.Result())
+	reply := map[string]interface{}{"ret": constants.SUCCESS_VERIFY_MODEL, "score": v.Score, "errCode": constants.SUCCESS_VERIFY_MODEL, "msg": "verify userid " + userid + " success.",
+		"decision": d.Result(), "pass": d.Accept, "threshold": d.Threshold, "policy": d.Policy}
+	if d.Percentile != nil {
+		reply["percentile"] = *d.Percentile
+	}
+	if v.Calibrated {
+		reply["llr"], reply["posterior"] = v.LLR, v.Posterior
+	}
+	if !v.LockedUntil.IsZero() {
+		reply["lockeduntil"] = v.LockedUntil.Format(time.RFC3339)
+	}
+	if v.Retained != nil {
+		reply["retainedid"] = v.Retained.Id
+	}
+
+	this.Data["json"] = reply
 	this.ServeJSON(false)
 
 	return
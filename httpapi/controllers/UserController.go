@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"github.com/liuxp0827/govpr/httpapi/constants"
+	"github.com/liuxp0827/govpr/httpapi/audit"
 	"github.com/astaxie/beego"
 	"github.com/liuxp0827/govpr/log"
 	"github.com/liuxp0827/govpr/httpapi/models"
@@ -24,17 +25,25 @@ func (this *UserController) RegisterUser() {
 
 	userid := this.Input().Get("userid")
 	token := this.Input().Get("token")
+	gender := this.Input().Get("gender")
 
-	if userid == "" {
+	if !models.ValidUserId(userid) {
 		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_REGISTER_USER, "errCode": constants.ERROR_USER_ILLEGAL,
-			"msg": "get userid " + userid + " failed, userid is illegal"}
+			"msg": "register userid " + userid + " failed, userid must be 1 to 32 letters, digits or '_.@-'"}
+		this.ServeJSON(false)
+		return
+	}
+
+	if !models.ValidGender(gender) {
+		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_REGISTER_USER, "errCode": constants.ERROR_URL_PARAM_ILLEGAL,
+			"msg": "register userid " + userid + " failed, gender must be m, f or empty"}
 		this.ServeJSON(false)
 		return
 	}
 
 	db := models.NewDBEngine()
 
-	err := db.AddUser(token, userid)
+	err := db.AddUser(token, userid, gender)
 	if err != nil {
 		if err.Error() == "token" {
 			log.Warnf("用户账号[%s]: 添加用户失败, 没有应用权限", userid)
@@ -112,8 +121,17 @@ func (this *UserController) DeleteUser() {
 		return
 	}
 
+	unlock, err := models.LockUser(token, userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 删除用户失败, %v", userid, err)
+		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_DELETE_USER, "errCode": lockErrCode(err, constants.ERROR_USER_NONEXISTENT), "msg": "delete userid " + userid + " failed, " + err.Error()}
+		this.ServeJSON(false)
+		return
+	}
+	defer unlock()
+
 	db := models.NewDBEngine()
-	err := db.DeleteUser(token, userid)
+	err = db.DeleteUser(token, userid)
 	if err != nil {
 		if err.Error() == "token" {
 			log.Warnf("用户账号[%s]: 删除用户失败, 没有应用权限", userid)
@@ -157,6 +175,15 @@ func (this *UserController) AddSample() {
 		return
 	}
 
+	unlock, err := models.LockUser(token, userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 添加语音数据失败, %v", userid, err)
+		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_ADDSAMPLE, "errCode": lockErrCode(err, constants.ERROR_ADDSAMPLE_FAILED), "msg": "userid " + userid + " add sample failed, " + err.Error()}
+		this.ServeJSON(false)
+		return
+	}
+	defer unlock()
+
 	db := models.NewDBEngine()
 	u, err := db.GetUserById(token, userid)
 	if err != nil {
@@ -183,6 +210,8 @@ func (this *UserController) AddSample() {
 	file, _, err := this.Ctx.Request.FormFile("file")
 	if err != nil {
 		log.Errorf("FormFile: %s", err.Error())
+		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_ADDSAMPLE, "errCode": constants.ERROR_SAMPLE_IS_NULL, "msg": "read upload sample failed, " + err.Error()}
+		this.ServeJSON(false)
 		return
 	}
 
@@ -196,8 +225,11 @@ func (this *UserController) AddSample() {
 	data, err := ioutil.ReadAll(file)
 	if err != nil {
 		log.Errorf("ReadAll: %s", err.Error())
+		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_ADDSAMPLE, "errCode": constants.ERROR_SAMPLE_IS_NULL, "msg": "read upload sample failed, " + err.Error()}
+		this.ServeJSON(false)
 		return
 	}
+	audit.Of(this.Ctx).Audio(data)
 
 	var lengthOfData int
 	if data == nil || len(data) <= 10000 {
@@ -246,8 +278,17 @@ func (this *UserController) ClearSamples() {
 		return
 	}
 
+	unlock, err := models.LockUser(token, userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 删除用户语音数据失败, %v", userid, err)
+		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_CLEAR_SAMPLES, "errCode": lockErrCode(err, constants.ERROR_CLEAR_SAMPLES_FAILED), "msg": "userid " + userid + " clear samples failed, " + err.Error()}
+		this.ServeJSON(false)
+		return
+	}
+	defer unlock()
+
 	db := models.NewDBEngine()
-	_, err := db.GetUserById(token, userid)
+	_, err = db.GetUserById(token, userid)
 	if err != nil {
 		if err.Error() == "token" {
 			log.Warnf("用户账号[%s]: 删除用户语音数据失败, 没有应用权限", userid)
@@ -289,9 +330,9 @@ func (this *UserController) DetectRegister() {
 	userid := this.Input().Get("userid")
 	token := this.Input().Get("token")
 
-	if userid == "" {
+	if !models.ValidUserId(userid) {
 		this.Data["json"] = map[string]interface{}{"ret": constants.FAILED_DETECT_REGISTER, "errCode": constants.ERROR_USER_ILLEGAL,
-			"msg": "get userid " + userid + " failed, userid is illegal"}
+			"msg": "get userid " + userid + " failed, userid must be 1 to 32 letters, digits or '_.@-'"}
 		this.ServeJSON(false)
 		return
 	}
@@ -310,7 +351,7 @@ func (this *UserController) DetectRegister() {
 
 		log.Errorf("用户账号[%s]: 用户不存在: %s", userid, err.Error())
 
-		err = db.AddUser(token, userid)
+		err = db.AddUser(token, userid, "")
 		if err != nil {
 			if err.Error() == "token" {
 				log.Warnf("用户账号[%s]: 添加用户失败, 没有应用权限", userid)
@@ -339,3 +380,12 @@ func (this *UserController) DetectRegister() {
 		}
 	}
 }
+
+// lockErrCode is the errCode of a failed models.LockUser, code unless
+// another request held the user
+func lockErrCode(err error, code int) int {
+	if err == models.ErrUserBusy {
+		return constants.ERROR_USER_BUSY
+	}
+	return code
+}
@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/liuxp0827/govpr/httpapi/constants"
+	"github.com/liuxp0827/govpr/httpapi/models"
+)
+
+// The app of the credentials, its quotas and usage, of the /v2 API
+type V2AppController struct {
+	V2Controller
+}
+
+func (this *V2AppController) GetUsage() {
+	from, to, err := usageDays(this.GetString("from"), this.GetString("to"))
+	if err != nil {
+		this.fail(http.StatusBadRequest, constants.ERROR_URL_PARAM_ILLEGAL, err.Error())
+	}
+
+	usage, err := models.GetUsage(this.app.AppId, from, to)
+	if err != nil {
+		this.fail(http.StatusInternalServerError, constants.ERROR_APP_TOKEN, "get usage failed")
+	}
+
+	this.reply(http.StatusOK, map[string]interface{}{
+		"appid": this.app.AppId,
+		"quota": quotaOf(this.app),
+		"usage": usageOf(usage),
+	})
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/astaxie/beego"
+	"github.com/liuxp0827/govpr/httpapi/audit"
+	"github.com/liuxp0827/govpr/httpapi/auth"
+	"github.com/liuxp0827/govpr/httpapi/constants"
+	"github.com/liuxp0827/govpr/httpapi/limit"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/log"
+	"github.com/liuxp0827/govpr/waveIO"
+)
+
+// largest audio accepted by the /v2 API, in bytes
+const MAX_AUDIO_SIZE = 32 << 20
+
+// shortest train sample accepted, as the /addsample route
+const MIN_SAMPLE_SIZE = 10000
+
+// V2Controller is embedded by the controllers of the /v2 API. Requests are
+// authenticated by auth.Filter and must name the app of their credentials
+// in the path; failures are answered with the HTTP status and the body
+// {"error": {"status", "code", "message"}}, code being the errCode of the
+// v1 API.
+type V2Controller struct {
+	beego.Controller
+
+	db    *models.DBEngine
+	app   *models.AppInfo
+	token string
+}
+
+func (this *V2Controller) Prepare() {
+	app := auth.App(this.Ctx)
+	if app == nil {
+		this.fail(http.StatusUnauthorized, constants.ERROR_APP_TOKEN, "request is not authenticated")
+	}
+
+	if app.AppId != this.Ctx.Input.Param(":id") {
+		this.fail(http.StatusForbidden, constants.ERROR_APP_TOKEN, "credentials are not granted for app "+this.Ctx.Input.Param(":id"))
+	}
+
+	this.app = app
+	this.token = app.Token
+	this.db = models.NewDBEngine()
+}
+
+// fail answers the request with the error body and stops it, the audit and
+// limit filters do not run after StopRun
+func (this *V2Controller) fail(status, code int, msg string) {
+	this.Ctx.Output.SetStatus(status)
+	this.Data["json"] = map[string]interface{}{"error": map[string]interface{}{"status": status, "code": code, "message": msg}}
+	this.ServeJSON(false)
+	audit.Finish(this.Ctx)
+	limit.Settle(this.Ctx)
+	this.StopRun()
+}
+
+func (this *V2Controller) reply(status int, v interface{}) {
+	this.Ctx.Output.SetStatus(status)
+	this.Data["json"] = v
+	this.ServeJSON(false)
+}
+
+func (this *V2Controller) noContent() {
+	this.Ctx.Output.SetStatus(http.StatusNoContent)
+}
+
+// userid returns the validated ":uid" of the path
+func (this *V2Controller) userid() string {
+	userid := this.Ctx.Input.Param(":uid")
+	if !models.ValidUserId(userid) {
+		this.fail(http.StatusBadRequest, constants.ERROR_USER_ILLEGAL, "userid must be 1 to 32 letters, digits or '_.@-'")
+	}
+	return userid
+}
+
+// user returns the user of the path, answering 404 if there is none
+func (this *V2Controller) user() *models.User {
+	userid := this.userid()
+	u, err := this.db.GetUserById(this.token, userid)
+	if err != nil {
+		this.fail(http.StatusNotFound, constants.ERROR_USER_NONEXISTENT, "userid "+userid+" not found")
+	}
+	return u
+}
+
+// lockUser locks the user against the sample uploads, trainings and
+// verifications of the other requests, answering 409 if it stays busy.
+// Defer the unlock returned, it also runs on the StopRun of fail.
+func (this *V2Controller) lockUser(userid string) func() {
+	unlock, err := models.LockUser(this.token, userid)
+	if err == models.ErrUserBusy {
+		this.fail(http.StatusConflict, constants.ERROR_USER_BUSY, "userid "+userid+" is being changed by another request, retry later")
+	}
+	if err != nil {
+		log.Errorf("用户账号[%s]: 锁定用户失败, %v", userid, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_USER_BUSY, "lock userid "+userid+" failed")
+	}
+	return unlock
+}
+
+func (this *V2Controller) modelFile(userid string) string {
+	return model_dir + this.token + "_" + userid + "/" + userid + ".dat"
+}
+
+// content returns the validated text of the audio, the "content" query or
+// multipart field. It names the stored sample file, so it must be a plain
+// file name component.
+func (this *V2Controller) content(required bool) string {
+	content := this.GetString("content")
+	if content == "" && !required {
+		return ""
+	}
+	if content == "" || utf8.RuneCountInString(content) > 32 || strings.ContainsAny(content, "/\\\x00") || content[0] == '.' {
+		this.fail(http.StatusBadRequest, constants.ERROR_URL_PARAM_ILLEGAL, "content must be 1 to 32 characters, without '/' or '\\' and not starting with '.'")
+	}
+	return content
+}
+
+// decodeJSON decodes the json request body into v
+func (this *V2Controller) decodeJSON(v interface{}) {
+	media, _, _ := mime.ParseMediaType(this.Ctx.Input.Header("Content-Type"))
+	if media != "application/json" {
+		this.fail(http.StatusUnsupportedMediaType, constants.ERROR_URL_PARAM_ILLEGAL, "request body must be application/json")
+	}
+
+	if err := json.Unmarshal(this.Ctx.Input.RequestBody, v); err != nil {
+		this.fail(http.StatusBadRequest, constants.ERROR_URL_PARAM_ILLEGAL, "invalid json body, "+err.Error())
+	}
+}
+
+// audio returns the uploaded audio, the "file" part of a multipart form or
+// the whole body of an audio/* or application/octet-stream request. Audio
+// in a container format must decode; raw 16 bit PCM is taken as is.
+func (this *V2Controller) audio() []byte {
+	if this.Ctx.Request.ContentLength > MAX_AUDIO_SIZE {
+		this.fail(http.StatusRequestEntityTooLarge, constants.ERROR_SAMPLE_TOO_LARGE, fmt.Sprintf("audio larger than %d bytes", MAX_AUDIO_SIZE))
+	}
+
+	var data []byte
+	media, _, _ := mime.ParseMediaType(this.Ctx.Input.Header("Content-Type"))
+	switch {
+	case media == "multipart/form-data":
+		file, _, err := this.Ctx.Request.FormFile("file")
+		if err != nil {
+			this.fail(http.StatusBadRequest, constants.ERROR_SAMPLE_IS_NULL, "multipart form has no file, "+err.Error())
+		}
+		defer file.Close()
+
+		data, err = ioutil.ReadAll(file)
+		if err != nil {
+			this.fail(http.StatusBadRequest, constants.ERROR_SAMPLE_IS_NULL, "read file failed, "+err.Error())
+		}
+	case strings.HasPrefix(media, "audio/") || media == "application/octet-stream":
+		data = this.Ctx.Input.RequestBody
+	default:
+		this.fail(http.StatusUnsupportedMediaType, constants.ERROR_URL_PARAM_ILLEGAL, "audio must be multipart/form-data, audio/* or application/octet-stream")
+	}
+
+	if len(data) > MAX_AUDIO_SIZE {
+		this.fail(http.StatusRequestEntityTooLarge, constants.ERROR_SAMPLE_TOO_LARGE, fmt.Sprintf("audio larger than %d bytes", MAX_AUDIO_SIZE))
+	}
+	if len(data) == 0 {
+		this.fail(http.StatusBadRequest, constants.ERROR_SAMPLE_IS_NULL, "audio is empty")
+	}
+	audit.Of(this.Ctx).Audio(data)
+
+	if _, err := waveIO.Sniff(bufio.NewReader(bytes.NewReader(data))); err == nil {
+		if _, err = waveIO.Decode(bytes.NewReader(data)); err != nil {
+			this.fail(http.StatusUnprocessableEntity, constants.ERROR_SAMPLE_IS_NULL, "decode audio failed, "+err.Error())
+		}
+	}
+	return data
+}
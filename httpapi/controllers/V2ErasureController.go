@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/liuxp0827/govpr/httpapi/audit"
+	"github.com/liuxp0827/govpr/httpapi/constants"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/log"
+)
+
+type v2Erasure struct {
+	Id          int64     `json:"id"`
+	AppId       string    `json:"appid"`
+	Subject     string    `json:"subject"`
+	Time        time.Time `json:"time"`
+	User        bool      `json:"user"`
+	Models      int       `json:"models"`
+	Samples     int       `json:"samples"`
+	Retained    int64     `json:"retained"`
+	AuditEvents int64     `json:"auditevents"`
+	AuditLines  int       `json:"auditlines"`
+	Digest      string    `json:"digest"`
+	AuditHash   string    `json:"audithash"`
+
+	Valid  *bool  `json:"valid,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	Erased *bool  `json:"erased,omitempty"`
+	Left   string `json:"left,omitempty"`
+}
+
+func erasureOf(r *models.ErasureReceipt) v2Erasure {
+	return v2Erasure{Id: r.Id, AppId: r.AppId, Subject: r.Subject, Time: r.Time, User: r.User, Models: r.Models, Samples: r.Samples,
+		Retained: r.Retained, AuditEvents: r.AuditEvents, AuditLines: r.AuditLines, Digest: r.Digest, AuditHash: r.AuditHash}
+}
+
+// Erasures of all the data of users of the /v2 API, with their receipts
+type V2ErasureController struct {
+	V2Controller
+}
+
+// Erase deletes everything stored about a user, registered or not, and
+// answers the receipt
+func (this *V2ErasureController) Erase() {
+	var req struct {
+		UserId string `json:"userid"`
+	}
+	this.decodeJSON(&req)
+
+	if !models.ValidUserId(req.UserId) {
+		this.fail(http.StatusBadRequest, constants.ERROR_USER_ILLEGAL, "userid must be 1 to 32 letters, digits or '_.@-'")
+	}
+
+	r, err := audit.Erase(this.app, req.UserId, audit.API_V2, this.Ctx.Input.IP())
+	if err == models.ErrUserBusy {
+		this.fail(http.StatusConflict, constants.ERROR_USER_BUSY, "userid "+req.UserId+" is being changed by another request, retry later")
+	}
+	if err != nil {
+		log.Errorf("应用[%s]: 擦除用户数据失败, %v", this.app.AppId, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_ERASE_USER_FAILED, "erase userid "+req.UserId+" failed")
+	}
+
+	this.Ctx.Output.Header("Location", fmt.Sprintf("/v2/apps/%s/erasures/%d", this.app.AppId, r.Id))
+	this.reply(http.StatusCreated, erasureOf(r))
+}
+
+// GetErasure answers a receipt with its verification against the audit
+// chain. With the "userid" query, it also tells if the receipt is of that
+// user and nothing is stored about it since.
+func (this *V2ErasureController) GetErasure() {
+	id, err := strconv.ParseInt(this.Ctx.Input.Param(":rid"), 10, 64)
+	if err != nil || id <= 0 {
+		this.fail(http.StatusBadRequest, constants.ERROR_URL_PARAM_ILLEGAL, "erasure id must be a number")
+	}
+
+	r, err := models.GetErasureReceipt(this.app.AppId, id)
+	if err == orm.ErrNoRows {
+		this.fail(http.StatusNotFound, constants.ERROR_RECEIPT_NONEXISTENT, fmt.Sprintf("erasure %d not found", id))
+	}
+	if err != nil {
+		log.Errorf("应用[%s]: 获取擦除回执失败, %v", this.app.AppId, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_RECEIPT_NONEXISTENT, fmt.Sprintf("read erasure %d failed", id))
+	}
+
+	v := erasureOf(r)
+	reason, err := models.VerifyErasureReceipt(r)
+	if err != nil {
+		log.Errorf("应用[%s]: 校验擦除回执失败, %v", this.app.AppId, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_RECEIPT_NONEXISTENT, fmt.Sprintf("verify erasure %d failed", id))
+	}
+	valid := reason == ""
+	v.Valid, v.Reason = &valid, reason
+
+	if userid := this.GetString("userid"); userid != "" {
+		left := "the receipt is of another user"
+		if r.IsOf(userid) {
+			if left, err = models.UserDataLeft(this.app, r, userid); err != nil {
+				log.Errorf("应用[%s]: 校验擦除回执失败, %v", this.app.AppId, err)
+				this.fail(http.StatusInternalServerError, constants.ERROR_RECEIPT_NONEXISTENT, fmt.Sprintf("verify erasure %d failed", id))
+			}
+		}
+		erased := left == ""
+		v.Erased, v.Left = &erased, left
+	}
+	this.reply(http.StatusOK, v)
+}
@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/liuxp0827/govpr/httpapi/audit"
+	"github.com/liuxp0827/govpr/httpapi/constants"
+	"github.com/liuxp0827/govpr/httpapi/engine"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/log"
+)
+
+type v2Model struct {
+	UserId  string `json:"userid"`
+	Trained bool   `json:"trained"`
+}
+
+type v2Verification struct {
+	Id          int64      `json:"id,omitempty"`
+	UserId      string     `json:"userid"`
+	Content     string     `json:"content"`
+	Score       float64    `json:"score"`
+	Decision    string     `json:"decision"`
+	Pass        bool       `json:"pass"`
+	Threshold   float64    `json:"threshold"`
+	Policy      string     `json:"policy"`
+	Percentile  *float64   `json:"percentile,omitempty"`
+	LLR         *float64   `json:"llr,omitempty"`
+	Posterior   *float64   `json:"posterior,omitempty"`
+	LockedUntil *time.Time `json:"lockeduntil,omitempty"`
+}
+
+type v2Retained struct {
+	Id       int64     `json:"id"`
+	Content  string    `json:"content"`
+	Score    float64   `json:"score"`
+	Decision string    `json:"decision"`
+	Size     int64     `json:"size"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Models and verifications of the /v2 API
+type V2ModelController struct {
+	V2Controller
+}
+
+func (this *V2ModelController) TrainModel() {
+	userid := this.userid()
+	defer this.lockUser(userid)()
+	usr, err := this.db.GetUserByIdForTrain(this.token, userid)
+	if err != nil {
+		if _, e := this.db.GetUserById(this.token, userid); e != nil {
+			this.fail(http.StatusNotFound, constants.ERROR_USER_NONEXISTENT, "userid "+userid+" not found")
+		}
+		// the user exists, but has no sample stored
+		this.fail(http.StatusUnprocessableEntity, constants.ERROR_SAMPLES_NOT_ENOUGH, "userid "+userid+" has no samples")
+	}
+
+	if usr.IsTrain {
+		log.Warnf("用户账号[%s]: 训练自适应模型失败, 模型已存在", userid)
+		this.fail(http.StatusConflict, constants.ERROR_MODEL_EXISTENT, "the model of userid "+userid+" exists")
+	}
+
+	if len(usr.Waves) < 5 {
+		log.Errorf("用户账号[%s]: 训练自适应模型失败, 训练数据不足", userid)
+		this.fail(http.StatusUnprocessableEntity, constants.ERROR_SAMPLES_NOT_ENOUGH, fmt.Sprintf("5 samples are needed, userid %s has %d", userid, len(usr.Waves)))
+	}
+
+	for i, wave := range usr.Waves {
+		if len(wave) <= 5000 {
+			log.Errorf("用户账号[%s]: 训练自适应模型失败, 第%d条训练数据不足", userid, i+1)
+			this.fail(http.StatusUnprocessableEntity, constants.ERROR_SAMPLES_NOT_ENOUGH, fmt.Sprintf("sample %d is too short", i+1))
+		}
+	}
+
+	audit.Of(this.Ctx).Audio(usr.Waves...)
+	x, err := engine.NewEngine(16000, 50, this.modelFile(userid))
+	if err == nil {
+		err = x.TrainSpeech(len(usr.Waves), usr.Waves, usr.Contents, usr.UserId, usr.Token)
+		x.DestroyEngine()
+	}
+	if err != nil {
+		log.Errorf("用户账号[%s]: 训练自适应模型失败, 训练过程有误, %v", userid, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_TRAIN_MODEL_FAILED, fmt.Sprintf("train model of userid %s failed: %v", userid, err))
+	}
+
+	if err = this.db.UpdateIsTrained(this.token, userid, true); err != nil {
+		log.Errorf("用户账号[%s]: 训练自适应模型失败,更新数据库失败", userid)
+		this.fail(http.StatusInternalServerError, constants.ERROR_TRAIN_MODEL_FAILED, "update database failed")
+	}
+
+	log.Infof("用户账号[%s]: 训练自适应模型成功", userid)
+	this.Ctx.Output.Header("Location", "/v2/apps/"+this.app.AppId+"/users/"+userid+"/models")
+	this.reply(http.StatusCreated, v2Model{UserId: userid, Trained: true})
+}
+
+func (this *V2ModelController) GetModel() {
+	u := this.user()
+	if !u.IsTrain {
+		this.fail(http.StatusNotFound, constants.ERROR_MODEL_NONEXISTENT, "userid "+u.UserId+" has no model")
+	}
+	this.reply(http.StatusOK, v2Model{UserId: u.UserId, Trained: true})
+}
+
+func (this *V2ModelController) DeleteModel() {
+	defer this.lockUser(this.userid())()
+	u := this.user()
+	if !u.IsTrain {
+		this.fail(http.StatusNotFound, constants.ERROR_MODEL_NONEXISTENT, "userid "+u.UserId+" has no model")
+	}
+
+	if err := this.db.UpdateIsTrained(this.token, u.UserId, false); err != nil {
+		log.Errorf("用户账号[%s]: 删除自适应模型失败, %v", u.UserId, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_MODEL_NONEXISTENT, "delete model of userid "+u.UserId+" failed")
+	}
+	if err := os.Remove(this.modelFile(u.UserId)); err != nil && !os.IsNotExist(err) {
+		log.Errorf("用户账号[%s]: 删除模型文件失败, %v", u.UserId, err)
+	}
+
+	log.Infof("用户账号[%s]: 删除自适应模型成功", u.UserId)
+	this.noContent()
+}
+
+// Verify scores the audio against the model of the user
+func (this *V2ModelController) Verify() {
+	u := this.user()
+	if !u.IsTrain {
+		log.Warnf("用户账号[%s]: 验证语音数据失败, 模型不存在", u.UserId)
+		this.fail(http.StatusConflict, constants.ERROR_MODEL_NONEXISTENT, "userid "+u.UserId+" has no model, train it first")
+	}
+
+	content := this.content(false)
+	data := this.audio()
+
+	r, err := engine.Verify(this.db, this.token, u.UserId, this.modelFile(u.UserId), data, content)
+	switch err.(type) {
+	case nil:
+	case *engine.ScoreError:
+		this.fail(http.StatusUnprocessableEntity, constants.ERROR_VERIFY_MODEL_FAILED, fmt.Sprintf("verify userid %s failed: %v", u.UserId, err))
+	default:
+		if err == models.ErrUserBusy {
+			this.fail(http.StatusConflict, constants.ERROR_USER_BUSY, "userid "+u.UserId+" is being changed by another request, retry later")
+		}
+		if err == engine.ErrLocked {
+			this.Ctx.Output.Header("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(r.LockedUntil).Seconds()))))
+			this.fail(http.StatusLocked, constants.ERROR_USER_LOCKED, "userid "+u.UserId+" is locked after repeated failed verifications until "+r.LockedUntil.Format(time.RFC3339))
+		}
+		this.fail(http.StatusInternalServerError, constants.ERROR_VERIFY_MODEL_FAILED, fmt.Sprintf("verify userid %s failed: %v", u.UserId, err))
+	}
+
+	d := r.Decision
+	audit.Of(this.Ctx).Decide(r.Score, d.Result())
+	v := v2Verification{UserId: u.UserId, Content: content, Score: r.Score,
+		Decision: d.Result(), Pass: d.Accept, Threshold: d.Threshold, Policy: d.Policy, Percentile: d.Percentile}
+	if r.Calibrated {
+		v.LLR, v.Posterior = &r.LLR, &r.Posterior
+	}
+	if !r.LockedUntil.IsZero() {
+		v.LockedUntil = &r.LockedUntil
+	}
+	if r.Retained != nil {
+		v.Id = r.Retained.Id
+		this.Ctx.Output.Header("Location", this.retainedLocation(u.UserId, r.Retained.Id))
+	}
+	this.reply(http.StatusOK, v)
+}
+
+func (this *V2ModelController) retainedLocation(userid string, id int64) string {
+	return fmt.Sprintf("/v2/apps/%s/users/%s/verifications/%d", this.app.AppId, userid, id)
+}
+
+// retainedId returns the validated ":vid" of the path
+func (this *V2ModelController) retainedId() int64 {
+	id, err := strconv.ParseInt(this.Ctx.Input.Param(":vid"), 10, 64)
+	if err != nil || id <= 0 {
+		this.fail(http.StatusBadRequest, constants.ERROR_URL_PARAM_ILLEGAL, "verification id must be a number")
+	}
+	return id
+}
+
+// ListVerifications lists the verifications of the user retained by the
+// retention policy of the app, the latest first
+func (this *V2ModelController) ListVerifications() {
+	u := this.user()
+	retained, err := this.db.GetRetained(this.token, u.UserId)
+	if err != nil {
+		log.Errorf("用户账号[%s]: 获取留存的验证语音失败, %v", u.UserId, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_RETAINED_NONEXISTENT, "list verifications of userid "+u.UserId+" failed")
+	}
+
+	verifications := make([]v2Retained, len(retained))
+	for i, s := range retained {
+		verifications[i] = v2Retained{Id: s.Id, Content: s.Content, Score: s.Score, Decision: s.Decision, Size: s.Size, Created: s.Created, Expires: s.Expires}
+	}
+	this.reply(http.StatusOK, map[string]interface{}{"retaindays": this.app.RetainDays, "verifications": verifications})
+}
+
+// GetVerificationAudio answers the retained audio of a verification
+func (this *V2ModelController) GetVerificationAudio() {
+	userid := this.userid()
+	id := this.retainedId()
+	_, data, err := this.db.GetRetainedAudio(this.token, userid, id)
+	if err == orm.ErrNoRows {
+		this.fail(http.StatusNotFound, constants.ERROR_RETAINED_NONEXISTENT, fmt.Sprintf("verification %d of userid %s not found", id, userid))
+	}
+	if err != nil {
+		log.Errorf("用户账号[%s]: 获取留存的验证语音失败, %v", userid, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_RETAINED_NONEXISTENT, fmt.Sprintf("read verification %d of userid %s failed", id, userid))
+	}
+
+	this.Ctx.Output.Header("Content-Type", http.DetectContentType(data))
+	this.Ctx.Output.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s_%d\"", userid, id))
+	this.Ctx.Output.Body(data)
+}
+
+func (this *V2ModelController) DeleteVerification() {
+	userid := this.userid()
+	id := this.retainedId()
+	err := this.db.DeleteRetained(this.token, userid, id)
+	if err == orm.ErrNoRows {
+		this.fail(http.StatusNotFound, constants.ERROR_RETAINED_NONEXISTENT, fmt.Sprintf("verification %d of userid %s not found", id, userid))
+	}
+	if err != nil {
+		log.Errorf("用户账号[%s]: 删除留存的验证语音失败, %v", userid, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_RETAINED_NONEXISTENT, fmt.Sprintf("delete verification %d of userid %s failed", id, userid))
+	}
+
+	log.Infof("用户账号[%s]: 删除留存的验证语音 %d 成功", userid, id)
+	this.noContent()
+}
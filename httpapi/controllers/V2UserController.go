@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/liuxp0827/govpr/httpapi/audit"
+	"github.com/liuxp0827/govpr/httpapi/constants"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/log"
+)
+
+type v2User struct {
+	UserId  string     `json:"userid"`
+	Gender  string     `json:"gender,omitempty"`
+	Trained bool       `json:"trained"`
+	Samples []v2Sample `json:"samples,omitempty"`
+}
+
+type v2Sample struct {
+	Step    int    `json:"step"`
+	Content string `json:"content"`
+	Size    int64  `json:"size"`
+}
+
+// user.json of an export
+type v2UserExport struct {
+	AppId          string          `json:"appid"`
+	UserId         string          `json:"userid"`
+	Gender         string          `json:"gender,omitempty"`
+	Trained        bool            `json:"trained"`
+	Policy         json.RawMessage `json:"policy,omitempty"`
+	FailedVerifies int             `json:"failedverifies"`
+	FailureStart   *time.Time      `json:"failurestart,omitempty"`
+	Lockouts       int             `json:"lockouts"`
+	LockedUntil    *time.Time      `json:"lockeduntil,omitempty"`
+	Samples        []v2Sample      `json:"samples"`
+	Exported       time.Time       `json:"exported"`
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Users and their train samples of the /v2 API
+type V2UserController struct {
+	V2Controller
+}
+
+func (this *V2UserController) location(elem ...interface{}) string {
+	loc := "/v2/apps/" + this.app.AppId + "/users"
+	for _, e := range elem {
+		loc += fmt.Sprintf("/%v", e)
+	}
+	return loc
+}
+
+func (this *V2UserController) ListUsers() {
+	all, _, err := this.app.GetAllUsers()
+	if err != nil {
+		this.fail(http.StatusInternalServerError, constants.ERROR_USER_NONEXISTENT, "list users failed")
+	}
+
+	users := make([]v2User, 0, len(all))
+	for _, u := range all {
+		if u.Token == this.token {
+			users = append(users, v2User{UserId: u.UserId, Gender: u.Gender, Trained: u.IsTrain})
+		}
+	}
+	this.reply(http.StatusOK, map[string]interface{}{"users": users})
+}
+
+func (this *V2UserController) CreateUser() {
+	var req struct {
+		UserId string `json:"userid"`
+		Gender string `json:"gender"`
+	}
+	this.decodeJSON(&req)
+
+	if !models.ValidUserId(req.UserId) {
+		this.fail(http.StatusBadRequest, constants.ERROR_USER_ILLEGAL, "userid must be 1 to 32 letters, digits or '_.@-'")
+	}
+	if !models.ValidGender(req.Gender) {
+		this.fail(http.StatusBadRequest, constants.ERROR_URL_PARAM_ILLEGAL, "gender must be m, f or omitted")
+	}
+
+	if _, err := this.db.GetUserById(this.token, req.UserId); err == nil {
+		log.Warnf("用户账号[%s]: 添加用户失败, 用户已存在", req.UserId)
+		this.fail(http.StatusConflict, constants.ERROR_USER_EXISTENT, "userid "+req.UserId+" already exists")
+	}
+
+	if err := this.db.AddUser(this.token, req.UserId, req.Gender); err != nil {
+		log.Errorf("用户账号[%s]: 添加用户失败, %v", req.UserId, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_USER_EXISTENT, "register userid "+req.UserId+" failed")
+	}
+
+	log.Infof("用户账号[%s]: 添加用户成功", req.UserId)
+	this.Ctx.Output.Header("Location", this.location(req.UserId))
+	this.reply(http.StatusCreated, v2User{UserId: req.UserId, Gender: req.Gender})
+}
+
+func (this *V2UserController) samples(u *models.User) []v2Sample {
+	stored, err := u.GetSamples()
+	if err != nil {
+		log.Errorf("用户账号[%s]: 获取语音数据失败, %v", u.UserId, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_ADDSAMPLE_FAILED, "list samples failed")
+	}
+
+	samples := make([]v2Sample, len(stored))
+	for i, s := range stored {
+		samples[i] = v2Sample{Step: s.Step, Content: s.Content, Size: s.Size}
+	}
+	return samples
+}
+
+func (this *V2UserController) GetUser() {
+	u := this.user()
+	this.reply(http.StatusOK, v2User{UserId: u.UserId, Gender: u.Gender, Trained: u.IsTrain, Samples: this.samples(u)})
+}
+
+func (this *V2UserController) DeleteUser() {
+	defer this.lockUser(this.userid())()
+	u := this.user()
+	if err := this.db.DeleteUser(this.token, u.UserId); err != nil {
+		log.Errorf("用户账号[%s]: 删除用户失败, %v", u.UserId, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_USER_NONEXISTENT, "delete userid "+u.UserId+" failed")
+	}
+
+	log.Infof("用户账号[%s]: 删除用户成功", u.UserId)
+	this.noContent()
+}
+
+func (this *V2UserController) ListSamples() {
+	u := this.user()
+	this.reply(http.StatusOK, map[string]interface{}{"samples": this.samples(u)})
+}
+
+// PutSample stores the train sample of a step, replacing the one before
+func (this *V2UserController) PutSample() {
+	step, err := strconv.Atoi(this.Ctx.Input.Param(":step"))
+	if err != nil || step < 1 || step > 5 {
+		this.fail(http.StatusBadRequest, constants.ERROR_URL_PARAM_ILLEGAL, "step must between 1 and 5")
+	}
+
+	defer this.lockUser(this.userid())()
+	u := this.user()
+	if u.IsTrain {
+		log.Warnf("用户账号[%s]: 添加语音数据失败, 模型已存在", u.UserId)
+		this.fail(http.StatusConflict, constants.ERROR_MODEL_EXISTENT, "the model of userid "+u.UserId+" exists, delete it first")
+	}
+
+	content := this.content(true)
+	data := this.audio()
+	if len(data) <= MIN_SAMPLE_SIZE {
+		this.fail(http.StatusUnprocessableEntity, constants.ERROR_SAMPLE_IS_NULL, fmt.Sprintf("sample must be longer than %d bytes", MIN_SAMPLE_SIZE))
+	}
+
+	if err = this.db.AddWavesAndContents(this.token, u.UserId, data, content, step); err != nil {
+		log.Errorf("用户账号[%s]: 添加语音数据失败, 添加语音数据到数据库有误, %v", u.UserId, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_ADDSAMPLE_FAILED, "userid "+u.UserId+" add sample failed")
+	}
+
+	log.Infof("用户账号[%s]: 训练文本内容: %s, 当前训练步骤: %d, 添加语音数据成功, 语音长度为: %d", u.UserId, content, step, len(data))
+	this.Ctx.Output.Header("Location", this.location(u.UserId, "samples", step))
+	this.reply(http.StatusCreated, v2Sample{Step: step, Content: content, Size: int64(len(data))})
+}
+
+func (this *V2UserController) DeleteSamples() {
+	defer this.lockUser(this.userid())()
+	u := this.user()
+	if len(this.samples(u)) == 0 {
+		this.noContent()
+		return
+	}
+
+	if err := this.db.ClearWavesAndContents(this.token, u.UserId); err != nil {
+		log.Errorf("用户账号[%s]: 删除用户语音数据失败, %v", u.UserId, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_CLEAR_SAMPLES_FAILED, "clear samples of userid "+u.UserId+" failed")
+	}
+
+	log.Infof("用户账号[%s]: 删除用户语音数据成功", u.UserId)
+	this.noContent()
+}
+
+// Export answers everything stored about the user as a zip archive:
+// user.json, the files of the user, retained.json listing the retained
+// verifications and audit.json the audit events naming the user.
+func (this *V2UserController) Export() {
+	defer this.lockUser(this.userid())()
+	u := this.user()
+	failed := func(err error) {
+		log.Errorf("用户账号[%s]: 导出用户数据失败, %v", u.UserId, err)
+		this.fail(http.StatusInternalServerError, constants.ERROR_EXPORT_USER_FAILED, "export userid "+u.UserId+" failed")
+	}
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	add := func(name string, data []byte) error {
+		w, err := zw.Create(name)
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		return err
+	}
+	addJSON := func(name string, v interface{}) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		return add(name, data)
+	}
+
+	user := v2UserExport{AppId: this.app.AppId, UserId: u.UserId, Gender: u.Gender, Trained: u.IsTrain,
+		FailedVerifies: u.FailedVerifies, FailureStart: timeOrNil(u.FailureStart), Lockouts: u.Lockouts,
+		LockedUntil: timeOrNil(u.LockedUntil), Samples: this.samples(u), Exported: time.Now()}
+	if u.Policy != "" && json.Valid([]byte(u.Policy)) {
+		user.Policy = json.RawMessage(u.Policy)
+	}
+	if err := addJSON("user.json", user); err != nil {
+		failed(err)
+	}
+
+	if err := models.UserFiles(this.token, u.UserId, add); err != nil {
+		failed(err)
+	}
+
+	retained, err := this.db.GetRetained(this.token, u.UserId)
+	if err != nil {
+		failed(err)
+	}
+	verifications := make([]v2Retained, len(retained))
+	for i, s := range retained {
+		verifications[i] = v2Retained{Id: s.Id, Content: s.Content, Score: s.Score, Decision: s.Decision, Size: s.Size, Created: s.Created, Expires: s.Expires}
+	}
+	if err = addJSON("retained.json", verifications); err != nil {
+		failed(err)
+	}
+
+	entries := make([]audit.Entry, 0)
+	q := &models.AuditQuery{UserId: u.UserId, Limit: models.MAX_AUDIT_EVENTS}
+	for {
+		events, _, err := models.QueryAudit(this.app.AppId, q)
+		if err != nil {
+			failed(err)
+		}
+		entries = append(entries, auditEntries(events)...)
+		if len(events) < q.Limit {
+			break
+		}
+		q.Offset += q.Limit
+	}
+	if err = addJSON("audit.json", entries); err != nil {
+		failed(err)
+	}
+
+	if err = zw.Close(); err != nil {
+		failed(err)
+	}
+
+	log.Infof("用户账号[%s]: 导出用户数据成功, 大小为: %d", u.UserId, archive.Len())
+	this.Ctx.Output.Header("Content-Type", "application/zip")
+	this.Ctx.Output.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.zip\"", u.UserId))
+	this.Ctx.Output.Body(archive.Bytes())
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/liuxp0827/govpr/httpapi/audit"
+	"github.com/liuxp0827/govpr/httpapi/models"
+)
+
+// auditTime parses a bound of an audit query, a time as RFC 3339 or a day
+// as models.DAY_LAYOUT. A day "to" includes the whole day.
+func auditTime(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(models.DAY_LAYOUT, s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q must be a time as RFC 3339 or a day as %s", s, models.DAY_LAYOUT)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// auditQuery reads the filters "userid", "op", "from", "to", "offset" and
+// "limit" of an audit query
+func auditQuery(form func(string) string) (*models.AuditQuery, error) {
+	q := &models.AuditQuery{UserId: form("userid"), Op: form("op")}
+
+	var err error
+	if q.From, err = auditTime(form("from"), false); err != nil {
+		return nil, err
+	}
+	if q.To, err = auditTime(form("to"), true); err != nil {
+		return nil, err
+	}
+
+	for _, p := range []struct {
+		name string
+		v    *int
+	}{{"offset", &q.Offset}, {"limit", &q.Limit}} {
+		if s := form(p.name); s != "" {
+			if *p.v, err = strconv.Atoi(s); err != nil || *p.v < 0 {
+				return nil, fmt.Errorf("%s must be a number >= 0", p.name)
+			}
+		}
+	}
+	if q.Limit > models.MAX_AUDIT_EVENTS {
+		return nil, fmt.Errorf("limit must be at most %d", models.MAX_AUDIT_EVENTS)
+	}
+	return q, nil
+}
+
+func auditEntries(events []*models.AuditEvent) []audit.Entry {
+	entries := make([]audit.Entry, 0, len(events))
+	for _, e := range events {
+		entries = append(entries, audit.EntryOf(e))
+	}
+	return entries
+}
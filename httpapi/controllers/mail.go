@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/liuxp0827/govpr/httpapi/models"
+)
+
+var (
+	smtp_addr     string = beego.AppConfig.String("smtp_addr")
+	smtp_user     string = beego.AppConfig.String("smtp_user")
+	smtp_password string = beego.AppConfig.String("smtp_password")
+	smtp_from     string = beego.AppConfig.DefaultString("smtp_from", "govpr@localhost")
+)
+
+func sendResetMail(to, devname, token string) error {
+	if smtp_addr == "" {
+		return fmt.Errorf("smtp_addr is not configured")
+	}
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("illegal email %q", to)
+	}
+
+	var auth smtp.Auth
+	if smtp_user != "" {
+		host, _, _ := net.SplitHostPort(smtp_addr)
+		auth = smtp.PlainAuth("", smtp_user, smtp_password, host)
+	}
+
+	msg := "From: " + smtp_from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: govpr password reset\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"\r\n" +
+		"A password reset was requested for developer " + devname + ".\r\n" +
+		"Reset token: " + token + "\r\n" +
+		fmt.Sprintf("The token expires in %d minutes, ignore this mail if you did not ask for it.\r\n", int(models.RESET_TOKEN_TTL/time.Minute))
+
+	return smtp.SendMail(smtp_addr, auth, smtp_from, []string{to}, []byte(msg))
+}
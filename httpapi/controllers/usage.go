@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/liuxp0827/govpr/httpapi/limit"
+	"github.com/liuxp0827/govpr/httpapi/models"
+)
+
+// longest range of days of a usage query
+const MAX_USAGE_DAYS = 366
+
+type appQuota struct {
+	RateLimit     float64 `json:"ratelimit"`
+	Verifications int64   `json:"verifications"`
+	Trainings     int64   `json:"trainings"`
+	Samples       int64   `json:"samples"`
+}
+
+type appUsage struct {
+	Day           string `json:"day"`
+	Requests      int64  `json:"requests"`
+	Verifications int64  `json:"verifications"`
+	Trainings     int64  `json:"trainings"`
+	Samples       int64  `json:"samples"`
+	Throttled     int64  `json:"throttled"`
+}
+
+// usageDays validates the days of a usage query, "to" defaults to today
+// and "from" to "to"
+func usageDays(from, to string) (string, string, error) {
+	if to == "" {
+		to = models.Today(time.Now())
+	}
+	if from == "" {
+		from = to
+	}
+
+	t0, err := time.Parse(models.DAY_LAYOUT, from)
+	if err != nil {
+		return "", "", fmt.Errorf("from must be a day as %s", models.DAY_LAYOUT)
+	}
+	t1, err := time.Parse(models.DAY_LAYOUT, to)
+	if err != nil {
+		return "", "", fmt.Errorf("to must be a day as %s", models.DAY_LAYOUT)
+	}
+	if t1.Before(t0) || t1.Sub(t0) >= MAX_USAGE_DAYS*24*time.Hour {
+		return "", "", fmt.Errorf("from must be at most %d days before to", MAX_USAGE_DAYS-1)
+	}
+	return from, to, nil
+}
+
+// quotaOf returns the quotas of the app, a rate limit of 0 is replaced by
+// the default one
+func quotaOf(app *models.AppInfo) appQuota {
+	q := appQuota{float64(app.RateLimit), app.DailyVerifyQuota, app.DailyTrainQuota, app.DailySampleQuota}
+	if q.RateLimit == 0 {
+		q.RateLimit = limit.AppRate
+	}
+	return q
+}
+
+func usageOf(usage []*models.AppUsage) []appUsage {
+	days := make([]appUsage, 0, len(usage))
+	for _, u := range usage {
+		days = append(days, appUsage{u.Day, u.Requests, u.Verifications, u.Trainings, u.Samples, u.Throttled})
+	}
+	return days
+}
@@ -1,9 +1,13 @@
 package engine
 
 import (
+	"bufio"
+	"bytes"
 	"github.com/astaxie/beego"
 	"github.com/liuxp0827/govpr"
+	"github.com/liuxp0827/govpr/constant"
 	"github.com/liuxp0827/govpr/log"
+	"github.com/liuxp0827/govpr/waveIO"
 )
 
 type engine struct {
@@ -11,7 +15,8 @@ type engine struct {
 }
 
 var (
-	ubm_path string = beego.AppConfig.DefaultString("ubm_path", "vpr/ubm")
+	ubm_path     string  = beego.AppConfig.DefaultString("ubm_path", "vpr/ubm")
+	verify_prior float64 = beego.AppConfig.DefaultFloat("verify_prior", constant.TARGET_PRIOR)
 )
 
 func NewEngine(sampleRate, delSilRange int, userModelFile string) (*engine, error) {
@@ -20,6 +25,9 @@ func NewEngine(sampleRate, delSilRange int, userModelFile string) (*engine, erro
 	if err != nil {
 		return nil, err
 	}
+	if err = vEngine.SetPrior(verify_prior); err != nil {
+		return nil, err
+	}
 
 	return &engine{
 		vprEngine: vEngine,
@@ -34,7 +42,7 @@ func (this *engine) TrainSpeech(c int, buffers [][]byte, texts []string, userid,
 	var err error
 	count := len(buffers)
 	for i := 0; i < count; i++ {
-		err = this.vprEngine.AddTrainBuffer(buffers[i])
+		err = this.addTrain(buffers[i])
 		if err != nil {
 			log.Error(err)
 			return err
@@ -54,7 +62,7 @@ func (this *engine) TrainSpeech(c int, buffers [][]byte, texts []string, userid,
 }
 
 func (this *engine) RecSpeech(buffer []byte, text string, userid, token string) (float64, error) {
-	err := this.vprEngine.AddVerifyBuffer(buffer)
+	err := this.addVerify(buffer)
 	defer this.vprEngine.ClearVerifyBuffer()
 	if err != nil {
 		return -1.0, err
@@ -67,3 +75,49 @@ func (this *engine) RecSpeech(buffer []byte, text string, userid, token string)
 
 	return this.vprEngine.GetScore(), nil
 }
+
+// Calibrated returns the calibrated log-likelihood ratio of the score of
+// the last RecSpeech and the posterior probability of the user at
+// verify_prior, ok is false if the ubm has no calibration.
+func (this *engine) Calibrated() (llr, posterior float64, ok bool) {
+	if !this.vprEngine.Calibrated() {
+		return 0, 0, false
+	}
+	llr, _ = this.vprEngine.GetLLR()
+	posterior, _ = this.vprEngine.GetPosterior()
+	return llr, posterior, true
+}
+
+// IdentifySpeech scores the buffer against the user models in modelFiles,
+// the scores are in the same order.
+func (this *engine) IdentifySpeech(buffer []byte, modelFiles []string) ([]float64, error) {
+	err := this.addVerify(buffer)
+	defer this.vprEngine.ClearVerifyBuffer()
+	if err != nil {
+		return nil, err
+	}
+
+	return this.vprEngine.ScoreModels(modelFiles)
+}
+
+// Uploads are decoded when they are in one of the formats of
+// waveIO.Decode, anything else is taken as raw 16 bit PCM as older
+// clients send it.
+func isEncoded(buf []byte) bool {
+	_, err := waveIO.Sniff(bufio.NewReader(bytes.NewReader(buf)))
+	return err == nil
+}
+
+func (this *engine) addTrain(buf []byte) error {
+	if isEncoded(buf) {
+		return this.vprEngine.AddTrainAudio(bytes.NewReader(buf), -1)
+	}
+	return this.vprEngine.AddTrainBuffer(buf)
+}
+
+func (this *engine) addVerify(buf []byte) error {
+	if isEncoded(buf) {
+		return this.vprEngine.AddVerifyAudio(bytes.NewReader(buf), -1)
+	}
+	return this.vprEngine.AddVerifyBuffer(buf)
+}
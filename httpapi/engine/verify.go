@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/log"
+	"time"
+)
+
+// ErrLocked is returned by Verify when the voiceprint of the user is locked
+// after repeated failed verifications, until Verification.LockedUntil
+var ErrLocked = errors.New("user is locked after repeated failed verifications")
+
+// ScoreError is returned by Verify when the audio cannot be scored against
+// the model
+type ScoreError struct {
+	Err error
+}
+
+func (this *ScoreError) Error() string {
+	return this.Err.Error()
+}
+
+// Verification is the outcome of Verify
+type Verification struct {
+	Score          float64
+	LLR, Posterior float64 // set if Calibrated
+	Calibrated     bool
+	Decision       *models.Decision
+	LockedUntil    time.Time              // end of the lock refusing or caused by the verification, zero if none
+	Retained       *models.RetainedSample // nil if the app retains no audio
+}
+
+// Verify scores data against the model of the user in modelFile, decides
+// the score with the policy of the user and counts the verification
+// towards the lockout of user-044, every transport goes through it.
+//
+// The lockout check, the scoring and the count are one step under the user
+// lock, so parallel failed verifications all count against the lockout.
+// The caller reads the audio before: a slow client would hold the lock of
+// the user. A verification that cannot be counted fails, as it would
+// escape the lockout.
+//
+// The error is models.ErrUserBusy when another request holds the user for
+// the whole wait, ErrLocked when the voiceprint is locked, a *ScoreError
+// when the audio cannot be scored, any other error is internal.
+func Verify(db *models.DBEngine, token, userid, modelFile string, data []byte, content string) (*Verification, error) {
+	unlock, err := models.LockUser(token, userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 验证语音数据失败, %v", userid, err)
+		return nil, err
+	}
+	defer unlock()
+
+	v := &Verification{}
+	if v.LockedUntil, err = db.VerifyLockedUntil(token, userid); err != nil {
+		log.Errorf("用户账号[%s]: 验证语音数据失败, 读取锁定状态有误, %v", userid, err)
+		return nil, fmt.Errorf("read lock failed")
+	}
+	if !v.LockedUntil.IsZero() {
+		log.Warnf("用户账号[%s]: 验证语音数据失败, 声纹已锁定", userid)
+		return v, ErrLocked
+	}
+
+	x, err := NewEngine(16000, 50, modelFile)
+	if err == nil {
+		v.Score, err = x.RecSpeech(data, content, userid, token)
+		v.LLR, v.Posterior, v.Calibrated = x.Calibrated()
+		x.DestroyEngine()
+	}
+	if err != nil {
+		log.Errorf("用户账号[%s]: 验证语音数据失败, 验证过程有误, %v", userid, err)
+		return nil, &ScoreError{Err: err}
+	}
+	log.Infof("用户账号[%s]: 验证口令: %s, 最终得分: %f", userid, content, v.Score)
+
+	if v.Decision, err = db.Decide(token, userid, v.Score); err != nil {
+		log.Errorf("用户账号[%s]: 验证语音数据失败, 判决有误, %v", userid, err)
+		return nil, fmt.Errorf("decide failed")
+	}
+
+	if v.LockedUntil, err = db.RecordVerification(token, userid, v.Decision.Accept); err != nil {
+		log.Errorf("用户账号[%s]: 验证语音数据失败, 记录验证结果失败, %v", userid, err)
+		return nil, fmt.Errorf("record verification failed")
+	}
+
+	if v.Retained, err = db.RetainVerification(token, userid, data, content, v.Score, v.Decision.Result()); err != nil {
+		// the verification stands without its audio
+		log.Errorf("用户账号[%s]: 留存验证语音失败, %v", userid, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,93 @@
+package limit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/astaxie/beego/context"
+	"github.com/liuxp0827/govpr/httpapi/auth"
+	"github.com/liuxp0827/govpr/httpapi/constants"
+	"github.com/liuxp0827/govpr/log"
+)
+
+// CHARGE is the context data of the *Charge of an admitted request
+const CHARGE = "limit.charge"
+
+// kinds of the routes, by "METHOD pattern"
+var kinds = map[string]Kind{}
+
+// Count makes the requests of method on the route pattern count as kind,
+// the others count as OTHER
+func Count(method, pattern string, kind Kind) {
+	kinds[strings.ToUpper(method)+" "+pattern] = kind
+}
+
+// Filter throttles the requests of the app authenticated by auth.Filter,
+// at beego.BeforeExec after it. The user is the ":uid" of the path or the
+// form value "userid".
+func Filter(ctx *context.Context) {
+	app := auth.App(ctx)
+	if app == nil {
+		return
+	}
+
+	userid := ctx.Input.Param(":uid")
+	if userid == "" {
+		userid = ctx.Request.Form.Get("userid")
+	}
+
+	pattern, _ := ctx.Input.GetData("RouterPattern").(string)
+	kind := kinds[ctx.Request.Method+" "+pattern]
+
+	charge, err := DefaultLimiter.Admit(app, userid, kind)
+	if err == nil {
+		if charge != nil {
+			ctx.Input.SetData(CHARGE, charge)
+		}
+		return
+	}
+
+	status, code, msg := http.StatusTooManyRequests, constants.ERROR_RATE_LIMITED, err.Error()
+	if r, ok := err.(*Rejection); ok {
+		code = r.Code
+		ctx.Output.Header("Retry-After", strconv.Itoa(int(math.Ceil(r.RetryAfter.Seconds()))))
+	} else {
+		log.Errorf("应用[%s]: 记录用量失败, %v", app.AppId, err)
+		status, code, msg = http.StatusInternalServerError, constants.ERROR_APP_TOKEN, "count usage failed"
+	}
+
+	ctx.Output.SetStatus(status)
+	if strings.HasPrefix(ctx.Request.URL.Path, "/v2/") {
+		ctx.Output.JSON(map[string]interface{}{"error": map[string]interface{}{"status": status, "code": code, "message": msg}}, false, false)
+		return
+	}
+	ctx.Output.JSON(map[string]interface{}{"ret": code, "errCode": code, "msg": msg}, false, false)
+}
+
+// Settle refunds the charge of a failed request, at beego.FinishRouter with
+// returnOnOutput false. beego skips it for the requests stopped with
+// StopRun, whose handlers call it themselves.
+func Settle(ctx *context.Context) {
+	charge, _ := ctx.Input.GetData(CHARGE).(*Charge)
+	if charge == nil {
+		return
+	}
+
+	if strings.HasPrefix(ctx.Request.URL.Path, "/v2/") {
+		status := ctx.ResponseWriter.Status
+		if status == 0 {
+			status = ctx.Output.Status
+		}
+		if status >= 400 {
+			charge.Refund()
+		}
+		return
+	}
+	body, _ := ctx.Input.GetData("json").(map[string]interface{})
+	code, _ := body["errCode"].(int)
+	if !charge.Kind.Success(code) {
+		charge.Refund()
+	}
+}
@@ -0,0 +1,214 @@
+// Package limit throttles the requests of apps and of their users with
+// token buckets, enforces the daily quotas of models.AppInfo and counts the
+// usage of every app by day.
+//
+// A bucket holds Burst seconds of its rate, so short bursts pass. The
+// buckets are in memory, each server throttles on its own; the quotas and
+// the usage are in the database.
+//
+// A request is charged to the quota of its kind when admitted, so parallel
+// requests cannot overrun it, and refunded when it fails: only the
+// verifications, trainings and samples that succeed use the quota. The
+// refund does not give back the token of the buckets.
+package limit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/liuxp0827/govpr/httpapi/constants"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/log"
+)
+
+// Kind is what a request counts as in the usage of its app
+type Kind int
+
+const (
+	OTHER Kind = iota
+	VERIFY
+	TRAIN
+	SAMPLE
+)
+
+var (
+	// requests per second of an app without AppInfo.RateLimit, and of a
+	// user of any app, 0 for no limit
+	AppRate  = beego.AppConfig.DefaultFloat("rate_app", 20)
+	UserRate = beego.AppConfig.DefaultFloat("rate_user", 2)
+
+	// seconds of its rate a bucket holds
+	Burst = beego.AppConfig.DefaultFloat("rate_burst", 2)
+
+	DefaultLimiter = NewLimiter()
+)
+
+// Rejection is the error of a throttled request
+type Rejection struct {
+	Code       int // errCode of the response
+	Msg        string
+	RetryAfter time.Duration
+}
+
+func (this *Rejection) Error() string {
+	return this.Msg
+}
+
+// success codes of the requests of the kinds, as the v1 API answers them
+var successCodes = map[Kind][]int{
+	VERIFY: {constants.SUCCESS_VERIFY_MODEL, constants.SUCCESS_IDENTIFY},
+	TRAIN:  {constants.SUCCESS_TRAIN_MODEL},
+	SAMPLE: {constants.SUCCESS_ADDSAMPLE},
+}
+
+// Success tells if code, the errCode of a reply, is the success of a
+// request of kind k
+func (k Kind) Success(code int) bool {
+	for _, c := range successCodes[k] {
+		if code == c {
+			return true
+		}
+	}
+	return false
+}
+
+// usage returns the usage column counting the kind and its quota in app
+func (k Kind) usage(app *models.AppInfo) (string, int64) {
+	switch k {
+	case VERIFY:
+		return models.USAGE_VERIFICATIONS, app.DailyVerifyQuota
+	case TRAIN:
+		return models.USAGE_TRAININGS, app.DailyTrainQuota
+	case SAMPLE:
+		return models.USAGE_SAMPLES, app.DailySampleQuota
+	}
+	return "", 0
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	rate   float64
+	burst  float64
+}
+
+// Limiter keeps the token buckets of the apps and users
+type Limiter struct {
+	sync.Mutex
+	buckets map[string]*bucket
+	purge   time.Time
+
+	// clock, replaced in tools
+	Now func() time.Time
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket), Now: time.Now}
+}
+
+// take takes a token of the bucket key, or returns the wait for the next one
+func (this *Limiter) take(key string, rate float64, now time.Time) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+
+	this.Lock()
+	defer this.Unlock()
+
+	// drop the buckets full again, the ones of idle apps and users
+	if now.After(this.purge) {
+		for k, b := range this.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst {
+				delete(this.buckets, k)
+			}
+		}
+		this.purge = now.Add(time.Minute)
+	}
+
+	burst := math.Max(rate*Burst, 1)
+	b, ok := this.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		this.buckets[key] = b
+	}
+
+	// a changed rate applies from now
+	b.rate, b.burst = rate, burst
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// Charge is the quota used by an admitted request
+type Charge struct {
+	Kind     Kind
+	appid    string
+	column   string
+	day      string
+	refunded bool
+}
+
+// Refund gives the quota back once, for a request that failed. It does
+// nothing on a nil Charge, the one of a request counted in no quota.
+func (this *Charge) Refund() {
+	if this == nil || this.refunded {
+		return
+	}
+	this.refunded = true
+	if err := models.RefundUsage(this.appid, this.day, this.column); err != nil {
+		log.Errorf("应用[%s]: 退还用量失败, %v", this.appid, err)
+	}
+}
+
+// Admit counts a request of kind by userid, empty if none, of the app, and
+// returns its charge to refund should it fail, or rejects it with a
+// *Rejection.
+func (this *Limiter) Admit(app *models.AppInfo, userid string, kind Kind) (*Charge, error) {
+	now := this.Now()
+	day := models.Today(now)
+
+	rate := AppRate
+	if app.RateLimit > 0 {
+		rate = float64(app.RateLimit)
+	}
+
+	if wait := this.take(app.AppId, rate, now); wait > 0 {
+		return nil, reject(app, day, &Rejection{constants.ERROR_RATE_LIMITED, "request rate of the app exceeded", wait})
+	}
+	if userid != "" {
+		if wait := this.take(app.AppId+"/"+userid, UserRate, now); wait > 0 {
+			return nil, reject(app, day, &Rejection{constants.ERROR_RATE_LIMITED, "request rate of userid " + userid + " exceeded", wait})
+		}
+	}
+
+	column, quota := kind.usage(app)
+	ok, err := models.CountUsage(app.AppId, day, column, quota)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if column == "" {
+			return nil, nil
+		}
+		return &Charge{Kind: kind, appid: app.AppId, column: column, day: day}, nil
+	}
+
+	y, m, d := now.Date()
+	midnight := time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+	return nil, reject(app, day, &Rejection{constants.ERROR_QUOTA_EXCEEDED, "daily quota of " + column + " exceeded", midnight.Sub(now)})
+}
+
+func reject(app *models.AppInfo, day string, rejection *Rejection) error {
+	if err := models.CountThrottled(app.AppId, day); err != nil {
+		log.Errorf("应用[%s]: 记录限流失败, %v", app.AppId, err)
+	}
+	log.Warnf("应用[%s]: %s", app.AppId, rejection.Msg)
+	return rejection
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"time"
+
 	"github.com/astaxie/beego"
+	"github.com/liuxp0827/govpr/httpapi/auth"
 	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/httpapi/redis"
 	_ "github.com/liuxp0827/govpr/httpapi/routers"
+	"github.com/liuxp0827/govpr/httpapi/rpc"
 	"github.com/liuxp0827/govpr/log"
 )
 
@@ -23,6 +28,35 @@ func main() {
 		log.Fatal(err)
 	}
 
-	models.InitUserCache(beego.AppConfig.DefaultInt("local_cache_max_size", 500))
+	switch cache := beego.AppConfig.DefaultString("cache", "memory"); cache {
+	case "memory":
+		models.InitUserCache(beego.AppConfig.DefaultInt("local_cache_max_size", 500))
+	case "redis":
+		redisAddr := beego.AppConfig.DefaultString("redis_addr", "127.0.0.1:6379")
+		log.Infof("Redis Addr: %s", redisAddr)
+
+		client := redis.NewClient(redisAddr, beego.AppConfig.String("redis_password"), beego.AppConfig.DefaultInt("redis_db", 0))
+		if err = client.Ping(); err != nil {
+			log.Fatal(err)
+		}
+		models.InitRedisCache(client, time.Duration(beego.AppConfig.DefaultInt("cache_ttl", 3600))*time.Second)
+		auth.DefaultVerifier.Nonces = auth.NewRedisNonces(client)
+	default:
+		log.Fatalf("unknown cache %s, must be memory or redis", cache)
+	}
+
+	if addr := beego.AppConfig.String("grpc_addr"); addr != "" {
+		server := rpc.NewServer(models.NewDBEngine(), beego.AppConfig.DefaultString("model_dir", "mod/"))
+		go func() {
+			if err := server.ListenAndServe(addr, beego.AppConfig.String("grpc_tls_cert"), beego.AppConfig.String("grpc_tls_key")); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	if interval := beego.AppConfig.DefaultInt("retention_purge_interval", 3600); interval > 0 {
+		go models.PurgeRetainedEvery(time.Duration(interval) * time.Second)
+	}
+
 	beego.Run()
 }
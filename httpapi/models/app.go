@@ -1,10 +1,10 @@
 package models
 
 import (
-	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
-	"strconv"
 	"sync"
 	"time"
 
@@ -19,23 +19,32 @@ func init() {
 
 // AppInfo 应用信息
 type AppInfo struct {
-	Id        int64      // Id号
-	AppId     string     `orm:"unique;size(50)"`         //appid
-	Key       string     `orm:"size(50)"`                //秘钥
-	Name      string     `orm:"unique;size(32)"`         //app名字
-	Developer *Developer `orm:"rel(fk)"`                 //应用所属的开发者
-	Created   time.Time  `orm:"auto_now_add;type(date)"` //应用创建时间
-	Email     string     `orm:"size(100)"`               //与应用绑定的Email
-	Token     string     `orm:"size(100)"`               // app授权token值
-	Users     []*User    `orm:"reverse(many)"`
-	lock      *sync.Mutex
+	Id               int64      // Id号
+	AppId            string     `orm:"unique;size(50)"`         //appid
+	Key              string     `orm:"size(50)"`                //秘钥
+	Name             string     `orm:"unique;size(32)"`         //app名字
+	Developer        *Developer `orm:"rel(fk)"`                 //应用所属的开发者
+	Created          time.Time  `orm:"auto_now_add;type(date)"` //应用创建时间
+	Email            string     `orm:"size(100)"`               //与应用绑定的Email
+	Token            string     `orm:"size(100)"`               // app标识, 用户与模型按它归属
+	PrevKey          string     `orm:"size(50)"`                // 轮换前的秘钥, 宽限期内仍可签名
+	PrevKeyExpires   time.Time  `orm:"null;type(datetime)"`     // 轮换前秘钥的宽限期
+	KeyRevoked       bool       // 秘钥已吊销, 轮换前不可访问
+	RateLimit        int        // 每秒请求数, 0 为 app.conf 的 rate_app
+	DailyVerifyQuota int64      // 每日验证次数, 0 为不限
+	DailyTrainQuota  int64      // 每日训练次数, 0 为不限
+	DailySampleQuota int64      // 每日上传训练语音次数, 0 为不限
+	Policy           string     `orm:"size(255)"` // 验证阈值策略 json, 空为默认阈值
+	RetainDays       int        // 验证语音的留存天数, 0 为不留存
+	Users            []*User    `orm:"reverse(many)"`
+	lock             *sync.Mutex
 }
 
 func (this *Developer) NewAppInfo(appname string) *AppInfo {
 
 	t := time.Now()
 	appid := fmt.Sprintf("%d", t.UnixNano())
-	key := appGenKey(t, appname)
+	key := appGenKey()
 
 	app := &AppInfo{
 		AppId:     appid,
@@ -45,7 +54,7 @@ func (this *Developer) NewAppInfo(appname string) *AppInfo {
 		Created:   t,
 		Email:     this.Email,
 		Users:     make([]*User, 0),
-		Token:     appGenToken(appid, key),
+		Token:     appGenToken(),
 		lock:      &sync.Mutex{},
 	}
 
@@ -258,7 +267,7 @@ func (this *Developer) GetAppInfoById(id int64) (*AppInfo, error) {
 	app.lock = &sync.Mutex{}
 	app.Users, _, err = app.GetAllUsers()
 	if err != nil {
-		return nil, fmt.Errorf("Developer %s GetAppInfoById %s failed: %v", err)
+		return nil, fmt.Errorf("Developer %s GetAppInfoById %d failed: %v", this.DeveloperName, id, err)
 	}
 
 	return &app, nil
@@ -280,13 +289,141 @@ func (this *Developer) GetAllAppInfo() (appInfos []*AppInfo, count int64, err er
 	return
 }
 
-func appGenKey(t time.Time, appname string) string {
-	return baseCoder.EncodeToString([]byte(strconv.FormatInt(t.UnixNano(), 10) + appname))
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// appGenKey returns a new random signing key
+func appGenKey() string {
+	return randomString(32)
+}
+
+// appGenToken returns the identifier of a new app. It is no credential,
+// requests are signed with the key.
+func appGenToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// SigningKeys returns the keys a request of the app may be signed with at
+// now, the current one and the one before a rotation within its grace.
+func (this *AppInfo) SigningKeys(now time.Time) []string {
+	if this.KeyRevoked {
+		return nil
+	}
+
+	keys := []string{this.Key}
+	if this.PrevKey != "" && now.Before(this.PrevKeyExpires) {
+		keys = append(keys, this.PrevKey)
+	}
+	return keys
+}
+
+func (this *Developer) getOwnAppInfo(appname string) (*AppInfo, error) {
+	var app AppInfo
+	o := orm.NewOrm()
+	err := o.QueryTable("app_info").Filter("name", appname).Filter("developer_id", this.Id).One(&app)
+	if err != nil {
+		return nil, err
+	}
+
+	app.Developer = this
+	app.lock = &sync.Mutex{}
+	return &app, nil
+}
+
+// RotateAppKey gives the app a new key, the old one stays valid for grace.
+// It also ends a revocation, the revoked key is not kept.
+func (this *Developer) RotateAppKey(appname string, grace time.Duration) (*AppInfo, error) {
+	app, err := this.getOwnAppInfo(appname)
+	if err != nil {
+		return nil, err
+	}
+
+	app.PrevKey, app.PrevKeyExpires = "", time.Time{}
+	if !app.KeyRevoked && grace > 0 {
+		app.PrevKey, app.PrevKeyExpires = app.Key, time.Now().Add(grace)
+	}
+	app.Key = appGenKey()
+	app.KeyRevoked = false
+
+	o := orm.NewOrm()
+	if _, err = o.Update(app, "Key", "PrevKey", "PrevKeyExpires", "KeyRevoked"); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Developer %s rotated key of app %s", this.DeveloperName, appname)
+	return app, nil
+}
+
+// RevokeAppKeys rejects every request of the app until RotateAppKey
+func (this *Developer) RevokeAppKeys(appname string) error {
+	app, err := this.getOwnAppInfo(appname)
+	if err != nil {
+		return err
+	}
+
+	app.PrevKey, app.PrevKeyExpires = "", time.Time{}
+	app.KeyRevoked = true
+
+	o := orm.NewOrm()
+	if _, err = o.Update(app, "PrevKey", "PrevKeyExpires", "KeyRevoked"); err != nil {
+		return err
+	}
+
+	log.Warnf("Developer %s revoked keys of app %s", this.DeveloperName, appname)
+	return nil
+}
+
+// SetAppQuota sets the request rate and the daily quotas of the app, 0 for
+// the default rate and no quota
+func (this *Developer) SetAppQuota(appname string, rate int, verify, train, sample int64) (*AppInfo, error) {
+	app, err := this.getOwnAppInfo(appname)
+	if err != nil {
+		return nil, err
+	}
+
+	app.RateLimit = rate
+	app.DailyVerifyQuota, app.DailyTrainQuota, app.DailySampleQuota = verify, train, sample
+
+	o := orm.NewOrm()
+	if _, err = o.Update(app, "RateLimit", "DailyVerifyQuota", "DailyTrainQuota", "DailySampleQuota"); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Developer %s set quota of app %s: rate %d, verify %d, train %d, sample %d", this.DeveloperName, appname, rate, verify, train, sample)
+	return app, nil
+}
+
+// GetAppUsage returns the app and its usage from day "from" to "to"
+func (this *Developer) GetAppUsage(appname, from, to string) (*AppInfo, []*AppUsage, error) {
+	app, err := this.getOwnAppInfo(appname)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	usage, err := GetUsage(app.AppId, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	return app, usage, nil
 }
 
-func appGenToken(appid, key string) string {
-	str := fmt.Sprintf("%s&%s", appid, key)
-	h := md5.New()
-	h.Write([]byte(str))
-	return hex.EncodeToString(h.Sum(nil))
+func GetAppInfoByAppId(appid string) (*AppInfo, error) {
+	var app AppInfo
+	o := orm.NewOrm()
+	err := o.QueryTable("app_info").Filter("app_id", appid).One(&app)
+	if err != nil {
+		return nil, err
+	}
+
+	app.lock = &sync.Mutex{}
+	return &app, nil
 }
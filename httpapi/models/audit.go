@@ -0,0 +1,215 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+)
+
+func init() {
+	orm.RegisterModel(new(AuditEvent))
+}
+
+// most events returned by one QueryAudit
+const MAX_AUDIT_EVENTS = 1000
+
+// AuditEvent 审计事件, 只追加. Every event carries the hash of the event
+// before it of the same app, so a changed, inserted or deleted event breaks
+// the chain at the next one, see VerifyAudit. The fields identifying the
+// user are chained through Subject, a salted hash of them, so RedactAudit
+// can erase them and their salt without breaking the chain.
+type AuditEvent struct {
+	Id        int64
+	Time      time.Time `orm:"index;type(datetime)"` // 请求开始时间, 精确到秒
+	AppId     string    `orm:"index;size(50)"`
+	UserId    string    `orm:"size(32)"`
+	Op        string    `orm:"size(20)"` // 操作 addsample, trainmodel, verifymodel, deletemodel ...
+	Api       string    `orm:"size(8)"`  // v1, v2 或 grpc
+	Code      int       // v1 的 errCode, 成功为 SUCCESS_*
+	Success   bool
+	Score     float64 // 验证得分, 仅当 Decision 不为空
+	Decision  string  `orm:"size(8)"`  // accept, reject 或空
+	AudioHash string  `orm:"size(64)"` // 语音的 sha256, 训练为所有训练语音的, 擦除为回执的摘要
+	Ip        string  `orm:"size(64)"` // 客户端地址
+	Latency   int64   // 处理时长, 毫秒
+	Salt      string  `orm:"size(32)"` // Subject 的盐, 擦除后为空
+	Subject   string  `orm:"size(64)"` // UserId, Ip 与 AudioHash 加盐的 sha256
+	PrevHash  string  `orm:"size(64)"` // 同一应用上一事件的 Hash, 第一个为空
+	Hash      string  `orm:"size(64);index"`
+}
+
+func (this *AuditEvent) subject() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%s|%s", this.Salt, this.UserId, this.Ip, this.AudioHash)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (this *AuditEvent) digest() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%d|%s|%s|%s|%d|%t|%s|%s|%s|%d",
+		this.PrevHash, this.Time.Unix(), this.AppId, this.Op, this.Api, this.Code, this.Success,
+		strconv.FormatFloat(this.Score, 'g', -1, 64), this.Decision, this.Subject, this.Latency)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Erased tells if the identifying fields of the event were redacted
+func (this *AuditEvent) Erased() bool {
+	return this.Salt == ""
+}
+
+// the chains are appended to by one request at a time, before AuditLocks
+// is set up
+var auditLock sync.Mutex
+
+// lockAudit locks the chain of the app, across all the servers sharing
+// AuditLocks, else in this process. Two appends reading the same last hash
+// would fork the chain.
+func lockAudit(appid string) (func(), error) {
+	if AuditLocks != nil {
+		return AuditLocks.Lock("audit#" + appid)
+	}
+	auditLock.Lock()
+	return auditLock.Unlock, nil
+}
+
+// AppendAudit chains the event to the last one of its app and stores it
+func AppendAudit(e *AuditEvent) error {
+	unlock, err := lockAudit(e.AppId)
+	if err != nil {
+		return fmt.Errorf("lock audit chain of app %s failed: %v", e.AppId, err)
+	}
+	defer unlock()
+
+	o := orm.NewOrm()
+	var last AuditEvent
+	err = o.QueryTable("audit_event").Filter("app_id", e.AppId).OrderBy("-id").Limit(1).One(&last, "Hash")
+	if err != nil && err != orm.ErrNoRows {
+		return err
+	}
+
+	salt := make([]byte, 16)
+	if _, err = rand.Read(salt); err != nil {
+		return err
+	}
+
+	e.Id = 0
+	e.Time = e.Time.Truncate(time.Second)
+	e.Salt = hex.EncodeToString(salt)
+	e.Subject = e.subject()
+	e.PrevHash = last.Hash
+	e.Hash = e.digest()
+	_, err = o.Insert(e)
+	return err
+}
+
+// AuditQuery filters the events of an app, the empty fields match all
+type AuditQuery struct {
+	UserId   string
+	Op       string
+	From, To time.Time // To excluded
+	Offset   int
+	Limit    int // at most MAX_AUDIT_EVENTS, 0 for MAX_AUDIT_EVENTS
+}
+
+// QueryAudit returns the events of the app matching q in time order, and
+// the number of them without the offset and limit
+func QueryAudit(appid string, q *AuditQuery) ([]*AuditEvent, int64, error) {
+	o := orm.NewOrm()
+	qs := o.QueryTable("audit_event").Filter("app_id", appid)
+	if q.UserId != "" {
+		qs = qs.Filter("user_id", q.UserId)
+	}
+	if q.Op != "" {
+		qs = qs.Filter("op", q.Op)
+	}
+	if !q.From.IsZero() {
+		qs = qs.Filter("time__gte", q.From)
+	}
+	if !q.To.IsZero() {
+		qs = qs.Filter("time__lt", q.To)
+	}
+
+	total, err := qs.Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 || limit > MAX_AUDIT_EVENTS {
+		limit = MAX_AUDIT_EVENTS
+	}
+	var events []*AuditEvent
+	if _, err = qs.OrderBy("id").Limit(limit, q.Offset).All(&events); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// RedactAudit erases the identifying fields of the events of the user of
+// the app, and returns how many events were redacted
+func RedactAudit(appid, userid string) (int64, error) {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+
+	return orm.NewOrm().QueryTable("audit_event").Filter("app_id", appid).Filter("user_id", userid).
+		Update(orm.Params{"user_id": "", "ip": "", "audio_hash": "", "salt": ""})
+}
+
+// VerifyAudit recomputes the chain of the app. It returns the number of
+// events, the hash of the last one and the id of the first event that does
+// not match its content or its predecessor, 0 if the chain is intact.
+func VerifyAudit(appid string) (int64, string, int64, error) {
+	o := orm.NewOrm()
+	var n int64
+	prev := ""
+	for offset := 0; ; offset += MAX_AUDIT_EVENTS {
+		var events []*AuditEvent
+		_, err := o.QueryTable("audit_event").Filter("app_id", appid).OrderBy("id").Limit(MAX_AUDIT_EVENTS, offset).All(&events)
+		if err != nil {
+			return 0, "", 0, err
+		}
+
+		for _, e := range events {
+			n++
+			if e.PrevHash != prev || e.Hash != e.digest() || (!e.Erased() && e.Subject != e.subject()) {
+				return n, prev, e.Id, nil
+			}
+			prev = e.Hash
+		}
+		if len(events) < MAX_AUDIT_EVENTS {
+			return n, prev, 0, nil
+		}
+	}
+}
+
+func (this *Developer) QueryAudit(appname string, q *AuditQuery) (*AppInfo, []*AuditEvent, int64, error) {
+	app, err := this.getOwnAppInfo(appname)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	events, total, err := QueryAudit(app.AppId, q)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return app, events, total, nil
+}
+
+func (this *Developer) VerifyAudit(appname string) (*AppInfo, int64, string, int64, error) {
+	app, err := this.getOwnAppInfo(appname)
+	if err != nil {
+		return nil, 0, "", 0, err
+	}
+
+	n, head, broken, err := VerifyAudit(app.AppId)
+	if err != nil {
+		return nil, 0, "", 0, err
+	}
+	return app, n, head, broken, nil
+}
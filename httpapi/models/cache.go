@@ -0,0 +1,98 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/liuxp0827/govpr/httpapi/redis"
+	"github.com/liuxp0827/govpr/log"
+)
+
+// Cache caches the users by "token#userid". The writes of a user remove it,
+// so the next read loads it from the database.
+type Cache interface {
+	Get(key string) (*User, bool)
+	Add(key string, u *User) error
+	Remove(key string) error
+}
+
+var UserCache Cache
+
+// InitRedisCache caches the users in the Redis server of client for ttl,
+// shared by the servers of a deployment, and locks them there
+func InitRedisCache(client *redis.Client, ttl time.Duration) {
+	UserCache = NewRedisCache(client, ttl)
+	UserLocks = NewRedisLocker(client, UserLockTTL, UserLockWait)
+	AuditLocks = NewRedisLocker(client, UserLockTTL, 0)
+}
+
+// prefix of the keys of the cached users
+const REDIS_USER_PREFIX = "govpr:user:"
+
+// RedisCache keeps the users in Redis, without their waves and contents
+type RedisCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewRedisCache(client *redis.Client, ttl time.Duration) *RedisCache {
+	return &RedisCache{client: client, ttl: ttl}
+}
+
+// cachedUser is the columns of a User
+type cachedUser struct {
+	Id             int64
+	AppId          int64
+	UserId         string
+	Token          string
+	IsTrain        bool
+	Gender         string
+	Policy         string
+	FailedVerifies int
+	FailureStart   time.Time
+	Lockouts       int
+	LockedUntil    time.Time
+}
+
+// Get misses on any error, the user is read from the database then
+func (this *RedisCache) Get(key string) (*User, bool) {
+	data, err := this.client.Get(REDIS_USER_PREFIX + key)
+	if err != nil {
+		if err != redis.ErrNil {
+			log.Errorf("RedisCache get %s failed: %v", key, err)
+		}
+		return nil, false
+	}
+
+	var c cachedUser
+	if err = json.Unmarshal(data, &c); err != nil {
+		log.Errorf("RedisCache get %s failed: %v", key, err)
+		return nil, false
+	}
+	u := &User{Id: c.Id, UserId: c.UserId, Token: c.Token, IsTrain: c.IsTrain, Gender: c.Gender, Policy: c.Policy,
+		FailedVerifies: c.FailedVerifies, FailureStart: c.FailureStart, Lockouts: c.Lockouts, LockedUntil: c.LockedUntil,
+		Contents: make([]string, 5, 5), Waves: make([][]byte, 5, 5)}
+	if c.AppId != 0 {
+		u.App = &AppInfo{Id: c.AppId}
+	}
+	return u, true
+}
+
+func (this *RedisCache) Add(key string, u *User) error {
+	c := cachedUser{Id: u.Id, UserId: u.UserId, Token: u.Token, IsTrain: u.IsTrain, Gender: u.Gender, Policy: u.Policy,
+		FailedVerifies: u.FailedVerifies, FailureStart: u.FailureStart, Lockouts: u.Lockouts, LockedUntil: u.LockedUntil}
+	if u.App != nil {
+		c.AppId = u.App.Id
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return this.client.Set(REDIS_USER_PREFIX+key, data, this.ttl)
+}
+
+func (this *RedisCache) Remove(key string) error {
+	_, err := this.client.Del(REDIS_USER_PREFIX + key)
+	return err
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/liuxp0827/govpr/log"
+)
+
+func init() {
+	orm.RegisterModel(new(Calibration))
+}
+
+// fewest non-target scores of a calibration
+const CALIBRATION_MIN_TRIALS = 100
+
+// Calibration 应用的分数校准, 开发集上的目标与冒认分数
+//
+// It is the empirical score distribution of the far policy and of the
+// percentile of verifications, unlike the logistic calibration of the ubm
+// (package calibration) giving their llr and posterior.
+type Calibration struct {
+	Id         int64
+	AppId      string    `orm:"unique;size(50)"`
+	Targets    string    `orm:"type(text)"`              // 目标分数, 升序 json
+	Nontargets string    `orm:"type(text)"`              // 冒认分数, 升序 json
+	Updated    time.Time `orm:"auto_now;type(datetime)"` // 校准时间
+	targets    []float64 `orm:"-"`
+	nontargets []float64 `orm:"-"`
+}
+
+func (this *Calibration) decode() error {
+	if this.nontargets != nil {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(this.Targets), &this.targets); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(this.Nontargets), &this.nontargets)
+}
+
+// Trials returns the counts of target and non-target scores
+func (this *Calibration) Trials() (int, int) {
+	return len(this.targets), len(this.nontargets)
+}
+
+// FalseAcceptRate is the share of non-target scores reaching score
+func (this *Calibration) FalseAcceptRate(score float64) float64 {
+	n := len(this.nontargets)
+	i := sort.SearchFloat64s(this.nontargets, score)
+	return float64(n-i) / float64(n)
+}
+
+// FalseRejectRate is the share of target scores under score
+func (this *Calibration) FalseRejectRate(score float64) float64 {
+	if len(this.targets) == 0 {
+		return 0
+	}
+	return float64(sort.SearchFloat64s(this.targets, score)) / float64(len(this.targets))
+}
+
+// ThresholdAt returns the lowest threshold with a false accept rate at
+// most far, just above the non-target score it must reject
+func (this *Calibration) ThresholdAt(far float64) float64 {
+	n := len(this.nontargets)
+	allowed := int(far * float64(n))
+	if allowed >= n {
+		return this.nontargets[0]
+	}
+	return math.Nextafter(this.nontargets[n-1-allowed], math.Inf(1))
+}
+
+// Percentile of a score is its empirical percentile rank among the
+// non-target scores, the share of them it exceeds. It is not a probability
+// that the speaker is the user.
+func (this *Calibration) Percentile(score float64) float64 {
+	return 1 - this.FalseAcceptRate(score)
+}
+
+// GetCalibration returns the calibration of the app, orm.ErrNoRows if it
+// has none
+func GetCalibration(appid string) (*Calibration, error) {
+	var c Calibration
+	o := orm.NewOrm()
+	if err := o.QueryTable("calibration").Filter("app_id", appid).One(&c); err != nil {
+		return nil, err
+	}
+	if err := c.decode(); err != nil {
+		return nil, fmt.Errorf("Calibration of app %s is corrupt: %v", appid, err)
+	}
+	return &c, nil
+}
+
+// SetCalibration stores the scores of development trials as the
+// calibration of the app, replacing the one before
+func (this *Developer) SetCalibration(appname string, targets, nontargets []float64) (*Calibration, error) {
+	if len(nontargets) < CALIBRATION_MIN_TRIALS {
+		return nil, fmt.Errorf("calibration needs at least %d non-target scores", CALIBRATION_MIN_TRIALS)
+	}
+
+	app, err := this.getOwnAppInfo(appname)
+	if err != nil {
+		return nil, err
+	}
+
+	targets = append([]float64(nil), targets...)
+	nontargets = append([]float64(nil), nontargets...)
+	sort.Float64s(targets)
+	sort.Float64s(nontargets)
+	t, _ := json.Marshal(targets)
+	n, _ := json.Marshal(nontargets)
+
+	c := &Calibration{AppId: app.AppId, Targets: string(t), Nontargets: string(n), targets: targets, nontargets: nontargets}
+	o := orm.NewOrm()
+	if _, _, err = o.ReadOrCreate(&Calibration{AppId: app.AppId}, "AppId"); err != nil {
+		return nil, err
+	}
+	if _, err = o.QueryTable("calibration").Filter("app_id", app.AppId).Update(orm.Params{
+		"targets": c.Targets, "nontargets": c.Nontargets, "updated": time.Now()}); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Developer %s calibrated app %s with %d target and %d non-target scores", this.DeveloperName, appname, len(targets), len(nontargets))
+	return c, nil
+}
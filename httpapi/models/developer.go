@@ -1,12 +1,19 @@
 package models
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/astaxie/beego/orm"
 	"github.com/liuxp0827/govpr/log"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func init() {
@@ -14,27 +21,56 @@ func init() {
 	orm.RegisterModel(new(Developer))
 }
 
+const (
+	PASSWORD_MIN_LEN = 8
+	PASSWORD_MAX_LEN = 72 // bcrypt ignores the bytes after
+
+	MAX_LOGIN_FAILURES = 5 // consecutive failures locking the developer
+	LOGIN_LOCK_TIME    = 15 * time.Minute
+	RESET_TOKEN_TTL    = 30 * time.Minute
+)
+
+var (
+	ErrBadCredentials  = errors.New("developer is not exist, or password is wrong")
+	ErrDeveloperLocked = errors.New("developer is locked for too many failed logins, try again later")
+	ErrPasswordPolicy  = fmt.Errorf("password must be %d to %d bytes", PASSWORD_MIN_LEN, PASSWORD_MAX_LEN)
+	ErrResetToken      = errors.New("password reset token is invalid or expired")
+)
+
+// compared against when the developer does not exist, so that the time of
+// a login does not tell whether a name is registered
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("govpr"), bcrypt.DefaultCost)
+
 type Developer struct {
 	Id            int64
 	DeveloperName string     `orm:"unique;size(32)"`
-	Password      string     `orm:"size(50)"`
+	Password      string     `orm:"size(100)"` // bcrypt hash, or legacyEncode of rows not logged in since
 	Email         string     `orm:"size(50)"`
 	CreateTime    time.Time  `orm:"auto_now_add;type(date)"`
+	FailedLogins  int        // consecutive failed logins
+	LockedUntil   time.Time  `orm:"null;type(datetime)"`
+	ResetToken    string     `orm:"size(64)"` // sha256 of the pending password reset token
+	ResetExpires  time.Time  `orm:"null;type(datetime)"`
 	Apps          []*AppInfo `orm:"reverse(many)"`
 	lock          *sync.Mutex
 }
 
-func NewDeveloper(developername, password, email string) *Developer {
+func NewDeveloper(developername, password, email string) (*Developer, error) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
 	t := time.Now()
 	dev := &Developer{
 		DeveloperName: developername,
-		Password:      encryptBase64(password),
+		Password:      hash,
 		Email:         email,
 		CreateTime:    t,
 		Apps:          make([]*AppInfo, 0),
 		lock:          &sync.Mutex{},
 	}
-	return dev
+	return dev, nil
 }
 
 func AddDeveloper(d *Developer) error {
@@ -114,15 +150,98 @@ func GetAllDevelopers() (developers []*Developer, count int64, err error) {
 	return
 }
 
-func checkDeveloper(developername, password string) (bool, error) {
+func hashPassword(password string) (string, error) {
+	if len(password) < PASSWORD_MIN_LEN || len(password) > PASSWORD_MAX_LEN {
+		return "", ErrPasswordPolicy
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// verifyPassword reports whether password is the one of the developer, and
+// whether it is still stored in the legacy encoding
+func (developer *Developer) verifyPassword(password string) (ok, legacy bool) {
+	if strings.HasPrefix(developer.Password, "$2") {
+		return bcrypt.CompareHashAndPassword([]byte(developer.Password), []byte(password)) == nil, false
+	}
+	return subtle.ConstantTimeCompare([]byte(legacyEncode([]byte(password))), []byte(developer.Password)) == 1, true
+}
+
+// authenticate returns the developer of the name and password. Every failure
+// counts towards the lockout of the developer, a success resets the count
+// and rehashes a legacy password with bcrypt.
+func authenticate(developername, password string) (*Developer, error) {
 	dev, err := GetDeveloperByName(developername)
-	if dev == nil {
-		return false, err
+	if err == orm.ErrNoRows {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrBadCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if dev.LockedUntil.After(now) {
+		return nil, ErrDeveloperLocked
+	}
+
+	ok, legacy := dev.verifyPassword(password)
+	if !ok {
+		if err = failedLogin(dev, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrBadCredentials
+	}
+
+	o := orm.NewOrm()
+	if dev.FailedLogins != 0 {
+		dev.FailedLogins = 0
+		if _, err = o.QueryTable("developer").Filter("id", dev.Id).Update(orm.Params{"failed_logins": 0}); err != nil {
+			return nil, err
+		}
+	}
+	if legacy {
+		if hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost); err == nil {
+			dev.Password = string(hash)
+			if _, err = o.Update(dev, "Password"); err != nil {
+				return nil, err
+			}
+			log.Infof("Developer %s password upgraded to bcrypt", developername)
+		}
+	}
+	return dev, nil
+}
+
+// failedLogin counts a failed login of the developer at now, locking it on
+// MAX_LOGIN_FAILURES. Both are single UPDATEs, so concurrent failed logins
+// all count and only one of them locks.
+func failedLogin(dev *Developer, now time.Time) error {
+	o := orm.NewOrm()
+	qs := o.QueryTable("developer").Filter("id", dev.Id)
+	if _, err := qs.Update(orm.Params{"failed_logins": orm.ColValue(orm.ColAdd, 1)}); err != nil {
+		return err
+	}
+
+	locked, err := qs.Filter("failed_logins__gte", MAX_LOGIN_FAILURES).Update(orm.Params{"failed_logins": 0, "locked_until": now.Add(LOGIN_LOCK_TIME)})
+	if err != nil {
+		return err
+	}
+	if locked > 0 {
+		log.Warnf("Developer %s locked until %s after %d failed logins", dev.DeveloperName, now.Add(LOGIN_LOCK_TIME).Format(time.RFC3339), MAX_LOGIN_FAILURES)
 	}
-	if encryptBase64(password) != dev.Password {
+	return nil
+}
+
+func checkDeveloper(developername, password string) (bool, error) {
+	_, err := authenticate(developername, password)
+	if err == ErrBadCredentials {
 		return false, nil
 	}
-	return true, nil
+	return err == nil, err
 }
 
 func checkEmailIsExist(email string) bool {
@@ -135,14 +254,44 @@ func checkEmailIsExist(email string) bool {
 	return false
 }
 
-func (developer *Developer) updatePassword(oldPassword, newPassword string) (bool, error) {
-	if developer.Password != oldPassword {
-		return false, errors.New("The password is incorrect.")
+// setPassword stores the hash of password, unlocking the developer and
+// dropping a pending reset token
+func (developer *Developer) setPassword(password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	developer.Password = hash
+	developer.FailedLogins = 0
+	developer.LockedUntil = time.Time{}
+	developer.ResetToken = ""
+	developer.ResetExpires = time.Time{}
+	return UpdateDeveloper(developer)
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newResetToken returns a password reset token valid for RESET_TOKEN_TTL,
+// only its hash is stored
+func (developer *Developer) newResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	developer.Password = encryptBase64(newPassword)
-	return true, UpdateDeveloper(developer)
+
+	token := hex.EncodeToString(b)
+	developer.ResetToken = hashResetToken(token)
+	developer.ResetExpires = time.Now().Add(RESET_TOKEN_TTL)
+	return token, UpdateDeveloper(developer)
 }
 
-func encryptBase64(password string) string {
-	return baseCoder.EncodeToString([]byte(password))
+func (developer *Developer) checkResetToken(token string) bool {
+	if developer.ResetToken == "" || time.Now().After(developer.ResetExpires) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashResetToken(token)), []byte(developer.ResetToken)) == 1
 }
@@ -0,0 +1,256 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+)
+
+func init() {
+	orm.RegisterModel(new(ErasureReceipt))
+}
+
+// ErasureReceipt 擦除回执 of all the data of a user of an app. The user is
+// only kept as Subject, which the holder of the userid can check with IsOf.
+// Digest covers the content of the receipt and is carried
+// by the audit event of the erasure, whose Hash is AuditHash, so the
+// receipt is proven by the audit chain of the app.
+type ErasureReceipt struct {
+	Id          int64
+	AppId       string    `orm:"index;size(50)"`
+	Salt        string    `orm:"size(32)"` // Subject 的盐
+	Subject     string    `orm:"size(64)"` // 用户的 HMAC, 以 ErasureSecret 为密钥
+	Time        time.Time `orm:"type(datetime)"`
+	User        bool      // 删除了用户记录
+	Models      int       // 删除的模型文件数
+	Samples     int       // 删除的训练语音数
+	Retained    int64     // 删除的留存验证语音数
+	AuditEvents int64     // 擦除了用户信息的审计事件数
+	AuditLines  int       // 擦除了用户信息的 audit_file 行数
+	Digest      string    `orm:"size(64)"`
+	AuditHash   string    `orm:"size(64)"`
+}
+
+// ErasureSecret keys the subjects of the receipts, of app.conf. Without it
+// a subject is only salted, and a userid can be searched for in one receipt
+// by trying them all.
+var ErasureSecret = beego.AppConfig.DefaultString("erasure_secret", "")
+
+// subject is the HMAC of the user of the receipt
+func (this *ErasureReceipt) subject(userid string) string {
+	h := hmac.New(sha256.New, []byte(ErasureSecret))
+	fmt.Fprintf(h, "%s|%s|%s", this.Salt, this.AppId, userid)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// IsOf tells if the receipt is of the user
+func (this *ErasureReceipt) IsOf(userid string) bool {
+	return hmac.Equal([]byte(this.Subject), []byte(this.subject(userid)))
+}
+
+// ContentDigest is the sha256 of the receipt without its Digest and
+// AuditHash
+func (this *ErasureReceipt) ContentDigest() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%d|%t|%d|%d|%d|%d|%d",
+		this.AppId, this.Subject, this.Time.Unix(), this.User, this.Models, this.Samples, this.Retained, this.AuditEvents, this.AuditLines)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// userDir returns the directory token_userid of the user strictly inside
+// base, an error if a path in the userid names another directory
+func userDir(base, token, userid string) (string, error) {
+	dir := path.Clean(base + token + "_" + userid)
+	rel, err := filepath.Rel(path.Clean(base), dir)
+	if err != nil || rel != token+"_"+userid || strings.ContainsAny(rel, "/\\") {
+		return "", fmt.Errorf("directory %s of userid %s is not inside %s", dir, userid, base)
+	}
+	return dir, nil
+}
+
+// userDirs returns the directories of the files of the user: train
+// samples and retained audio under model_path, the model under model_dir
+func userDirs(token, userid string) ([]string, error) {
+	dir, err := userDir(beego.AppConfig.DefaultString("model_path", "mod/"), token, userid)
+	if err != nil {
+		return nil, err
+	}
+	dirs := []string{dir}
+
+	if dir, err = userDir(beego.AppConfig.DefaultString("model_dir", "mod/"), token, userid); err != nil {
+		return nil, err
+	}
+	if dir != dirs[0] {
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+// removeUserFiles deletes the directories of the user, and returns the
+// number of models and train samples in them. It refuses to delete any
+// directory not strictly inside model_path or model_dir.
+func removeUserFiles(token, userid string) (int, int, error) {
+	dirs, err := userDirs(token, userid)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var models, samples int
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			if filepath.Dir(name) == dir && strings.HasPrefix(info.Name(), "_0") {
+				samples++
+			} else if strings.HasSuffix(info.Name(), ".dat") {
+				models++
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return models, samples, err
+		}
+		if err = os.RemoveAll(dir); err != nil {
+			return models, samples, err
+		}
+	}
+	return models, samples, nil
+}
+
+// EraseUser deletes the user of the app with its model, train samples and
+// retained audio, whether the user is still registered or not, and redacts
+// its audit events. It returns the receipt, without the audit_file lines,
+// digest or audit hash, and not stored yet. The caller holds the lock of
+// the user, so no request stores anything of it meanwhile.
+func EraseUser(app *AppInfo, userid string) (*ErasureReceipt, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	r := &ErasureReceipt{AppId: app.AppId, Salt: hex.EncodeToString(salt), Time: time.Now().Truncate(time.Second)}
+	r.Subject = r.subject(userid)
+
+	o := orm.NewOrm()
+	n, err := o.QueryTable("user").Filter("user_id", userid).Filter("token", app.Token).Delete()
+	if err != nil {
+		return nil, err
+	}
+	r.User = n > 0
+	UserCache.Remove(fmt.Sprintf("%s#%s", app.Token, userid))
+
+	if r.Retained, err = deleteUserRetained(app.Token, userid); err != nil {
+		return nil, err
+	}
+	if r.Models, r.Samples, err = removeUserFiles(app.Token, userid); err != nil {
+		return nil, err
+	}
+	if r.AuditEvents, err = RedactAudit(app.AppId, userid); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func AddErasureReceipt(r *ErasureReceipt) error {
+	_, err := orm.NewOrm().Insert(r)
+	return err
+}
+
+// GetErasureReceipt returns the receipt id of the app, orm.ErrNoRows if
+// there is none
+func GetErasureReceipt(appid string, id int64) (*ErasureReceipt, error) {
+	var r ErasureReceipt
+	err := orm.NewOrm().QueryTable("erasure_receipt").Filter("id", id).Filter("app_id", appid).One(&r)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// VerifyErasureReceipt checks the receipt against its digest and the audit
+// chain of its app. It returns why the receipt is not valid, "" if it is.
+func VerifyErasureReceipt(r *ErasureReceipt) (string, error) {
+	if r.Digest != r.ContentDigest() {
+		return "the receipt does not match its digest", nil
+	}
+
+	var e AuditEvent
+	err := orm.NewOrm().QueryTable("audit_event").Filter("app_id", r.AppId).Filter("hash", r.AuditHash).One(&e)
+	if err == orm.ErrNoRows {
+		return "the audit chain has no event of the erasure", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if e.AudioHash != r.Digest {
+		return "the audit event of the erasure is of another receipt", nil
+	}
+
+	_, _, broken, err := VerifyAudit(r.AppId)
+	if err != nil {
+		return "", err
+	}
+	if broken != 0 && broken <= e.Id {
+		return fmt.Sprintf("the audit chain is broken at event %d", broken), nil
+	}
+	return "", nil
+}
+
+// UserDataLeft tells what is stored about the user of the app erased by
+// the receipt: the user, its files, retained audio or audit events before
+// the erasure that still name it. It returns "" if there is nothing.
+func UserDataLeft(app *AppInfo, r *ErasureReceipt, userid string) (string, error) {
+	o := orm.NewOrm()
+	n, err := o.QueryTable("user").Filter("user_id", userid).Filter("token", app.Token).Count()
+	if err != nil {
+		return "", err
+	}
+	if n > 0 {
+		return "the user is registered", nil
+	}
+
+	dirs, err := userDirs(app.Token, userid)
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range dirs {
+		if IsExist(dir) {
+			return "the files of the user are stored", nil
+		}
+	}
+
+	n, err = o.QueryTable("retained_sample").Filter("token", app.Token).Filter("user_id", userid).Count()
+	if err != nil {
+		return "", err
+	}
+	if n > 0 {
+		return "verification audio of the user is retained", nil
+	}
+
+	var e AuditEvent
+	err = o.QueryTable("audit_event").Filter("app_id", app.AppId).Filter("hash", r.AuditHash).One(&e, "Id")
+	if err != nil && err != orm.ErrNoRows {
+		return "", err
+	}
+	qs := o.QueryTable("audit_event").Filter("app_id", app.AppId).Filter("user_id", userid)
+	if e.Id > 0 {
+		qs = qs.Filter("id__lt", e.Id)
+	}
+	if n, err = qs.Count(); err != nil {
+		return "", err
+	}
+	if n > 0 {
+		return "audit events of the user name it", nil
+	}
+	return "", nil
+}
@@ -0,0 +1,55 @@
+package models
+
+import "testing"
+
+func TestUserDir(t *testing.T) {
+	for _, c := range []struct {
+		base, userid, dir string
+	}{
+		{"mod/", "bob", "mod/tok_bob"},
+		{"mod/", "bob.smith@x", "mod/tok_bob.smith@x"},
+		{"/var/govpr/mod/", "..", "/var/govpr/mod/tok_.."},
+		{"mod/", "/../../vpr", ""},
+		{"mod/", "/../../..", ""},
+		{"mod/", "/../tok_x", ""},
+		{"mod/", "a/b", ""},
+		{"mod/", "/..", ""},
+	} {
+		dir, err := userDir(c.base, "tok", c.userid)
+		if c.dir == "" {
+			if err == nil {
+				t.Errorf("userDir(%q, %q) = %q, want an error", c.base, c.userid, dir)
+			}
+			continue
+		}
+		if err != nil || dir != c.dir {
+			t.Errorf("userDir(%q, %q) = %q, %v, want %q", c.base, c.userid, dir, err, c.dir)
+		}
+	}
+}
+
+func TestValidUserId(t *testing.T) {
+	for userid, valid := range map[string]bool{
+		"bob": true, "a_b.c@d-e": true, "": false, "/../../vpr": false, "a b": false,
+		"0123456789012345678901234567890123": false,
+	} {
+		if ValidUserId(userid) != valid {
+			t.Errorf("ValidUserId(%q) = %t, want %t", userid, !valid, valid)
+		}
+	}
+}
+
+func TestErasureSubject(t *testing.T) {
+	a := &ErasureReceipt{AppId: "app", Salt: "00"}
+	a.Subject = a.subject("bob")
+	b := &ErasureReceipt{AppId: "app", Salt: "01"}
+	b.Subject = b.subject("bob")
+
+	if !a.IsOf("bob") || a.IsOf("alice") {
+		t.Errorf("IsOf of the receipt of bob: bob %t, alice %t", a.IsOf("bob"), a.IsOf("alice"))
+	}
+	// the salts keep two receipts of a user apart
+	if a.Subject == b.Subject {
+		t.Error("two receipts of bob have the same subject")
+	}
+}
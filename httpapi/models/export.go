@@ -0,0 +1,51 @@
+package models
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UserFiles calls add with the archive name and the content of every file
+// of the user: samples/ the train samples, model/ the model, retained/ the
+// retained verification audio by id and files/ any other.
+func UserFiles(token, userid string, add func(name string, data []byte) error) error {
+	dirs, err := userDirs(token, userid)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(dir, name)
+			if err != nil {
+				return err
+			}
+
+			rel = filepath.ToSlash(rel)
+			switch {
+			case !strings.Contains(rel, "/") && strings.HasPrefix(rel, "_0"):
+				rel = "samples/" + rel
+			case strings.HasSuffix(rel, ".dat"):
+				rel = "model/" + rel
+			case strings.HasPrefix(rel, "verify/"):
+				rel = "retained/" + strings.TrimPrefix(rel, "verify/")
+			default:
+				rel = "files/" + rel
+			}
+
+			data, err := ioutil.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			return add(rel, data)
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+	"github.com/liuxp0827/govpr/log"
+)
+
+// Verification lockout policy, of app.conf. VerifyMaxFailures failed
+// verifications of a user within VerifyFailureWindow lock its voiceprint
+// for VerifyLockTime, doubled by every lockout after the first up to
+// VerifyLockMax. A passed verification or an unlock ends the back-off, as
+// does VerifyLockMax without failures after a lock.
+var (
+	VerifyMaxFailures   = beego.AppConfig.DefaultInt("verify_max_failures", 5)
+	VerifyFailureWindow = time.Duration(beego.AppConfig.DefaultInt("verify_failure_window", 600)) * time.Second
+	VerifyLockTime      = time.Duration(beego.AppConfig.DefaultInt("verify_lock_time", 60)) * time.Second
+	VerifyLockMax       = time.Duration(beego.AppConfig.DefaultInt("verify_lock_max", 86400)) * time.Second
+)
+
+var lockoutColumns = []string{"FailedVerifies", "FailureStart", "Lockouts", "LockedUntil"}
+
+// Locked tells if the voiceprint of the user is locked at now
+func (this *User) Locked(now time.Time) bool {
+	return now.Before(this.LockedUntil)
+}
+
+// recordVerification counts a verification of the user at now, locking it
+// on too many failures
+func (this *User) recordVerification(pass bool, now time.Time) {
+	if pass {
+		this.FailedVerifies, this.FailureStart, this.Lockouts = 0, time.Time{}, 0
+		return
+	}
+
+	if !this.LockedUntil.IsZero() && now.Sub(this.LockedUntil) > VerifyLockMax {
+		this.Lockouts = 0
+	}
+	if this.FailureStart.IsZero() || now.Sub(this.FailureStart) > VerifyFailureWindow {
+		this.FailedVerifies, this.FailureStart = 0, now
+	}
+
+	this.FailedVerifies++
+	if this.FailedVerifies < VerifyMaxFailures {
+		return
+	}
+
+	lock := VerifyLockTime
+	for i := 0; i < this.Lockouts && lock < VerifyLockMax; i++ {
+		lock *= 2
+	}
+	if lock > VerifyLockMax {
+		lock = VerifyLockMax
+	}
+
+	this.Lockouts++
+	this.LockedUntil = now.Add(lock)
+	this.FailedVerifies, this.FailureStart = 0, time.Time{}
+}
+
+// freshUser reads the user from the database, the cached one may not
+// have the last verifications or policy
+func freshUser(token, id string) (*AppInfo, *User, error) {
+	app, err := GetAppInfoByToken(token)
+	if app == nil || err != nil {
+		return nil, nil, fmt.Errorf("token")
+	}
+
+	u, err := app.GetUserById(id, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	return app, u, nil
+}
+
+func (this *DBEngine) updateLockout(app *AppInfo, u *User) error {
+	o := orm.NewOrm()
+	if _, err := o.Update(u, lockoutColumns...); err != nil {
+		log.Errorf("AppInfo %s update lockout of %s failed: %v", app.Name, u.UserId, err)
+		return err
+	}
+
+	UserCache.Remove(fmt.Sprintf("%s#%s", u.Token, u.UserId))
+	return nil
+}
+
+// VerifyLockedUntil returns the end of the lock of the voiceprint of the
+// user, the zero time if it is not locked
+func (this *DBEngine) VerifyLockedUntil(token, id string) (time.Time, error) {
+	_, u, err := freshUser(token, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if u.Locked(time.Now()) {
+		return u.LockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+// RecordVerification counts a passed or failed verification of the user,
+// and returns the end of the lock it caused, the zero time if none.
+func (this *DBEngine) RecordVerification(token, id string, pass bool) (time.Time, error) {
+	app, u, err := freshUser(token, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	now := time.Now()
+	locked := u.LockedUntil
+	u.recordVerification(pass, now)
+	if err = this.updateLockout(app, u); err != nil {
+		return time.Time{}, err
+	}
+
+	if !u.LockedUntil.Equal(locked) {
+		log.Warnf("用户账号[%s]: 连续验证失败, 声纹锁定至 %s", id, u.LockedUntil.Format(time.RFC3339))
+		return u.LockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+// UnlockUser ends the lock of the voiceprint of the user of an app of the
+// developer, and its failures and back-off. It holds the user lock, so a
+// verification in flight does not write back the lock it ends.
+func (this *DBEngine) UnlockUser(devname, appname, id string) error {
+	developer, err := GetDeveloperByName(devname)
+	if err != nil {
+		return err
+	}
+
+	app, err := developer.getOwnAppInfo(appname)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := LockUser(app.Token, id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	u, err := app.GetUserById(id, app.Token)
+	if err != nil {
+		return err
+	}
+
+	u.FailedVerifies, u.FailureStart, u.Lockouts, u.LockedUntil = 0, time.Time{}, 0, time.Time{}
+	if err = this.updateLockout(app, u); err != nil {
+		return err
+	}
+
+	log.Infof("用户账号[%s]: 开发者 %s 解除声纹锁定", id, devname)
+	return nil
+}
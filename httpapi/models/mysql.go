@@ -3,6 +3,8 @@ package models
 import (
 	"encoding/base64"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/astaxie/beego/orm"
 	_ "github.com/go-sql-driver/mysql"
@@ -11,14 +13,21 @@ import (
 
 const (
 	base64Table = "123QRSTUabcdVWXYZHijKLAWDCABDstEFGuvwxyzGHIJklmnopqr234560178912"
+	stdTable    = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
 )
 
-var (
-	baseCoder *base64.Encoding
-)
-
-func init() {
-	baseCoder = base64.NewEncoding(base64Table)
+// legacyEncode is base64 over base64Table, the encoding of the developer
+// passwords stored before bcrypt. base64.NewEncoding
+// refuses the table for its repeated symbols, so the standard encoding is
+// mapped onto it.
+func legacyEncode(data []byte) string {
+	s := []byte(base64.StdEncoding.EncodeToString(data))
+	for i, c := range s {
+		if c != '=' {
+			s[i] = base64Table[strings.IndexByte(stdTable, c)]
+		}
+	}
+	return string(s)
 }
 
 func InitMysql(user, pwd, addr, db string) error {
@@ -37,6 +46,21 @@ func InitMysql(user, pwd, addr, db string) error {
 	if err != nil {
 		return err
 	}
+	// syncdb adds missing columns only, a bcrypt hash is longer than the
+	// password column of older tables
+	o := orm.NewOrm()
+	var length int
+	err = o.Raw("SELECT character_maximum_length FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'developer' AND column_name = 'password'").QueryRow(&length)
+	if err != nil {
+		return err
+	}
+	if length < 100 {
+		log.Infof("Widen developer.password from varchar(%d) to varchar(100)", length)
+		if _, err = o.Raw("ALTER TABLE developer MODIFY password varchar(100) NOT NULL DEFAULT ''").Exec(); err != nil {
+			return err
+		}
+	}
+
 	log.Infof("Synchronize DataBase success ...")
 	return nil
 }
@@ -53,7 +77,10 @@ func NewDBEngine() *DBEngine {
 ///////////////////////////////////////////////////////////////////
 
 func (this *DBEngine) AddDeveloper(devname, password, email string) error {
-	dev := NewDeveloper(devname, password, email)
+	dev, err := NewDeveloper(devname, password, email)
+	if err != nil {
+		return err
+	}
 	return AddDeveloper(dev)
 }
 
@@ -78,12 +105,35 @@ func (this *DBEngine) DeleteDeveloperByName(devname string) error {
 }
 
 func (this *DBEngine) UpdateDeveloperPassword(devname, oldPassword, newPassword string) (bool, error) {
-	u, err := GetDeveloperByName(devname)
+	dev, err := authenticate(devname, oldPassword)
 	if err != nil {
 		return false, err
 	}
 
-	return u.updatePassword(oldPassword, newPassword)
+	if err = dev.setPassword(newPassword); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// NewPasswordResetToken returns a reset token for the developer of the name
+// and email, to be sent to the email.
+func (this *DBEngine) NewPasswordResetToken(devname, email string) (string, error) {
+	dev, err := GetDeveloperByName(devname)
+	if err != nil || !strings.EqualFold(dev.Email, email) {
+		return "", ErrBadCredentials
+	}
+	return dev.newResetToken()
+}
+
+// ResetDeveloperPassword sets the password of the developer with a token of
+// NewPasswordResetToken, which is used up.
+func (this *DBEngine) ResetDeveloperPassword(devname, token, newPassword string) error {
+	dev, err := GetDeveloperByName(devname)
+	if err != nil || !dev.checkResetToken(token) {
+		return ErrResetToken
+	}
+	return dev.setPassword(newPassword)
 }
 
 func (this *DBEngine) CheckEmailIsExist(email string) bool {
@@ -131,6 +181,78 @@ func (this *DBEngine) GetAppInfoByToken(devname, token string) (*AppInfo, error)
 	return app, nil
 }
 
+func (this *DBEngine) RotateAppKey(devname, appname string, grace time.Duration) (*AppInfo, error) {
+	developer, err := GetDeveloperByName(devname)
+	if err != nil {
+		return nil, err
+	}
+	return developer.RotateAppKey(appname, grace)
+}
+
+func (this *DBEngine) RevokeAppKeys(devname, appname string) error {
+	developer, err := GetDeveloperByName(devname)
+	if err != nil {
+		return err
+	}
+	return developer.RevokeAppKeys(appname)
+}
+
+func (this *DBEngine) SetAppQuota(devname, appname string, rate int, verify, train, sample int64) (*AppInfo, error) {
+	developer, err := GetDeveloperByName(devname)
+	if err != nil {
+		return nil, err
+	}
+	return developer.SetAppQuota(appname, rate, verify, train, sample)
+}
+
+func (this *DBEngine) GetAppUsage(devname, appname, from, to string) (*AppInfo, []*AppUsage, error) {
+	developer, err := GetDeveloperByName(devname)
+	if err != nil {
+		return nil, nil, err
+	}
+	return developer.GetAppUsage(appname, from, to)
+}
+
+func (this *DBEngine) SetPolicy(devname, appname, userid string, p *ThresholdPolicy) error {
+	developer, err := GetDeveloperByName(devname)
+	if err != nil {
+		return err
+	}
+	return developer.SetPolicy(appname, userid, p)
+}
+
+func (this *DBEngine) SetCalibration(devname, appname string, targets, nontargets []float64) (*Calibration, error) {
+	developer, err := GetDeveloperByName(devname)
+	if err != nil {
+		return nil, err
+	}
+	return developer.SetCalibration(appname, targets, nontargets)
+}
+
+func (this *DBEngine) SetRetention(devname, appname string, days int) (*AppInfo, error) {
+	developer, err := GetDeveloperByName(devname)
+	if err != nil {
+		return nil, err
+	}
+	return developer.SetRetention(appname, days)
+}
+
+func (this *DBEngine) QueryAudit(devname, appname string, q *AuditQuery) (*AppInfo, []*AuditEvent, int64, error) {
+	developer, err := GetDeveloperByName(devname)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return developer.QueryAudit(appname, q)
+}
+
+func (this *DBEngine) VerifyAudit(devname, appname string) (*AppInfo, int64, string, int64, error) {
+	developer, err := GetDeveloperByName(devname)
+	if err != nil {
+		return nil, 0, "", 0, err
+	}
+	return developer.VerifyAudit(appname)
+}
+
 func (this *DBEngine) UpdateAppInfoByName(devname string, app *AppInfo) error {
 	developer, err := GetDeveloperByName(devname)
 	if err != nil {
@@ -153,13 +275,16 @@ func (this *DBEngine) DeleteAppInfoByName(devname, appname string) error {
 //////////////////////////    User    ////////////////////////////
 //////////////////////////////////////////////////////////////////////
 
-func (this *DBEngine) AddUser(token, id string) error {
+// AddUser registers the user of gender, GENDER_MALE, GENDER_FEMALE or ""
+// if unknown
+func (this *DBEngine) AddUser(token, id, gender string) error {
 	app, err := GetAppInfoByToken(token)
 	if app == nil || err != nil {
 		return fmt.Errorf("token")
 	}
 
 	user := app.NewUser(app.Token, id)
+	user.Gender = gender
 	return app.AddUser(user)
 }
 
@@ -209,6 +334,28 @@ func (this *DBEngine) GetUserByIdForTrain(token, id string) (*User, error) {
 	return app.GetUserByIdForTrain(id, token)
 }
 
+// GetTrainedUsers returns the users of the app with a trained model, the
+// candidates of identification.
+func (this *DBEngine) GetTrainedUsers(token string) ([]*User, error) {
+	app, err := GetAppInfoByToken(token)
+	if app == nil || err != nil {
+		return nil, fmt.Errorf("token")
+	}
+
+	all, _, err := app.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*User, 0)
+	for _, u := range all {
+		if u.IsTrain && u.Token == token {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
 func (this *DBEngine) UpdateIsTrained(token, id string, isTrain bool) error {
 	app, err := GetAppInfoByToken(token)
 	if app == nil || err != nil {
@@ -224,7 +371,7 @@ func (this *DBEngine) UpdateIsTrained(token, id string, isTrain bool) error {
 
 	err = app.UpdateUser(user)
 	if err == nil {
-		UserCache.Modify(fmt.Sprintf("%s#%s", token, id), user)
+		UserCache.Remove(fmt.Sprintf("%s#%s", token, id))
 	}
 	return err
 }
@@ -262,7 +409,7 @@ func (this *DBEngine) ClearWavesAndContents(token, id string) error {
 			return fmt.Errorf("token")
 		}
 
-		user, err := app.GetUserById(id, token)
+		user, err = app.GetUserById(id, token)
 		if err != nil {
 			return err
 		} else {
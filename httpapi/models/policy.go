@@ -0,0 +1,208 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+	"github.com/liuxp0827/govpr/log"
+)
+
+// kinds of ThresholdPolicy
+const (
+	POLICY_FIXED  = "fixed"  // one threshold
+	POLICY_GENDER = "gender" // a threshold by gender of the user
+	POLICY_FAR    = "far"    // the threshold of a target false accept rate on the calibration of the app
+)
+
+// VerifyThreshold is the threshold of the apps without a policy
+var VerifyThreshold = beego.AppConfig.DefaultFloat("verify_threshold", 1.0)
+
+// genders of a user, empty if unknown
+const (
+	GENDER_MALE   = "m"
+	GENDER_FEMALE = "f"
+)
+
+func ValidGender(gender string) bool {
+	return gender == "" || gender == GENDER_MALE || gender == GENDER_FEMALE
+}
+
+// ThresholdPolicy decides the verifications of the users of an app, or of
+// one user. It is stored as json in AppInfo.Policy and User.Policy; a user
+// without one follows the app, an app without one VerifyThreshold.
+type ThresholdPolicy struct {
+	Kind      string   `json:"kind"`
+	Threshold float64  `json:"threshold"`        // fixed, and gender for users of unknown gender
+	Male      *float64 `json:"male,omitempty"`   // gender
+	Female    *float64 `json:"female,omitempty"` // gender
+	FAR       float64  `json:"far,omitempty"`    // far, in (0, 1)
+}
+
+// Validate checks the policy, against the calibration of the app for far
+func (this *ThresholdPolicy) Validate(c *Calibration) error {
+	switch this.Kind {
+	case POLICY_FIXED:
+		return nil
+	case POLICY_GENDER:
+		if this.Male == nil || this.Female == nil {
+			return fmt.Errorf("gender policy needs the male and female thresholds")
+		}
+		return nil
+	case POLICY_FAR:
+		if this.FAR <= 0 || this.FAR >= 1 {
+			return fmt.Errorf("far must be between 0 and 1")
+		}
+		if c == nil {
+			return fmt.Errorf("far policy needs a calibration of the app")
+		}
+		if _, n := c.Trials(); this.FAR*float64(n) < 1 {
+			return fmt.Errorf("far %g is below the resolution of %d non-target scores", this.FAR, n)
+		}
+		return nil
+	}
+	return fmt.Errorf("policy kind must be %s, %s or %s", POLICY_FIXED, POLICY_GENDER, POLICY_FAR)
+}
+
+func parsePolicy(s string) (*ThresholdPolicy, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var p ThresholdPolicy
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func formatPolicy(p *ThresholdPolicy) string {
+	if p == nil {
+		return ""
+	}
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// Decision of a verification
+type Decision struct {
+	Accept     bool
+	Threshold  float64
+	Policy     string   // kind of the policy applied, POLICY_FIXED for the default
+	Percentile *float64 // share of the non-target scores of the calibration under the score, nil without calibration
+}
+
+// Result is "accept" or "reject"
+func (this *Decision) Result() string {
+	if this.Accept {
+		return "accept"
+	}
+	return "reject"
+}
+
+// genderThreshold is the threshold t of a gender, 0 when missing from a
+// policy stored before Validate required it
+func genderThreshold(t *float64) float64 {
+	if t == nil {
+		return 0
+	}
+	return *t
+}
+
+// decide applies the policy of the user, else of the app, to score
+func decide(app *AppInfo, u *User, c *Calibration, score float64) (*Decision, error) {
+	p, err := parsePolicy(u.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("policy of userid %s is corrupt: %v", u.UserId, err)
+	}
+	if p == nil {
+		if p, err = parsePolicy(app.Policy); err != nil {
+			return nil, fmt.Errorf("policy of app %s is corrupt: %v", app.Name, err)
+		}
+	}
+	if p == nil {
+		p = &ThresholdPolicy{Kind: POLICY_FIXED, Threshold: VerifyThreshold}
+	}
+
+	d := &Decision{Policy: p.Kind, Threshold: p.Threshold}
+	switch p.Kind {
+	case POLICY_GENDER:
+		switch u.Gender {
+		case GENDER_MALE:
+			d.Threshold = genderThreshold(p.Male)
+		case GENDER_FEMALE:
+			d.Threshold = genderThreshold(p.Female)
+		}
+	case POLICY_FAR:
+		if c == nil {
+			// the calibration was deleted after the policy was set
+			log.Warnf("应用[%s]: 没有分数校准, 按默认阈值判决", app.AppId)
+			d.Policy, d.Threshold = POLICY_FIXED, VerifyThreshold
+			break
+		}
+		d.Threshold = c.ThresholdAt(p.FAR)
+	}
+
+	if c != nil {
+		percentile := c.Percentile(score)
+		d.Percentile = &percentile
+	}
+	d.Accept = score >= d.Threshold
+	return d, nil
+}
+
+// Decide decides the verification score of the user of the app of token
+func (this *DBEngine) Decide(token, id string, score float64) (*Decision, error) {
+	app, u, err := freshUser(token, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := GetCalibration(app.AppId)
+	if err == orm.ErrNoRows {
+		c, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decide(app, u, c, score)
+}
+
+// SetPolicy sets the threshold policy of the app, or of its user userid if
+// not empty. A nil policy removes it.
+func (this *Developer) SetPolicy(appname, userid string, p *ThresholdPolicy) error {
+	app, err := this.getOwnAppInfo(appname)
+	if err != nil {
+		return err
+	}
+
+	if p != nil {
+		c, err := GetCalibration(app.AppId)
+		if err != nil && err != orm.ErrNoRows {
+			return err
+		}
+		if err = p.Validate(c); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Developer %s set policy of app %s user %q: %s", this.DeveloperName, appname, userid, formatPolicy(p))
+
+	o := orm.NewOrm()
+	if userid == "" {
+		app.Policy = formatPolicy(p)
+		_, err = o.Update(app, "Policy")
+		return err
+	}
+
+	u, err := app.GetUserById(userid, app.Token)
+	if err != nil {
+		return err
+	}
+	u.Policy = formatPolicy(p)
+	if _, err = o.Update(u, "Policy"); err != nil {
+		return err
+	}
+	UserCache.Remove(fmt.Sprintf("%s#%s", u.Token, u.UserId))
+	return nil
+}
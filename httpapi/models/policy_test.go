@@ -0,0 +1,20 @@
+package models
+
+import "testing"
+
+func TestValidateGenderPolicy(t *testing.T) {
+	male, female := 1.5, 0.0
+	for _, c := range []struct {
+		policy ThresholdPolicy
+		valid  bool
+	}{
+		{ThresholdPolicy{Kind: POLICY_GENDER, Male: &male, Female: &female}, true},
+		{ThresholdPolicy{Kind: POLICY_GENDER, Male: &male}, false},
+		{ThresholdPolicy{Kind: POLICY_GENDER, Female: &female}, false},
+		{ThresholdPolicy{Kind: POLICY_GENDER, Threshold: 1}, false},
+	} {
+		if err := c.policy.Validate(nil); (err == nil) != c.valid {
+			t.Errorf("Validate(%s) = %v, want valid %t", formatPolicy(&c.policy), err, c.valid)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package models
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+	"github.com/liuxp0827/govpr/log"
+)
+
+func init() {
+	orm.RegisterModel(new(RetainedSample))
+}
+
+// longest retention of the verification audio, in days
+const MAX_RETAIN_DAYS = 365
+
+// most samples listed by GetRetained, and deleted by one batch of a purge
+const MAX_RETAINED_SAMPLES = 1000
+
+// RetainedSample 留存的验证语音 of an app opted in with AppInfo.RetainDays.
+// The audio is stored next to the train samples of the user, in their
+// directory "verify", until Expires; expired samples are not served and
+// are deleted by PurgeRetained.
+type RetainedSample struct {
+	Id       int64
+	AppId    string    `orm:"index;size(50)"`
+	Token    string    `orm:"size(100)"`
+	UserId   string    `orm:"size(32)"`
+	Content  string    `orm:"size(64)"` // 验证口令
+	Score    float64   // 验证得分
+	Decision string    `orm:"size(8)"` // accept 或 reject
+	Size     int64     // 语音字节数
+	Created  time.Time `orm:"type(datetime)"`
+	Expires  time.Time `orm:"index;type(datetime)"`
+}
+
+func retainedDir(token, userid string) string {
+	return beego.AppConfig.DefaultString("model_path", "mod/") + token + "_" + userid + "/verify"
+}
+
+func (this *RetainedSample) file() string {
+	return retainedDir(this.Token, this.UserId) + "/" + strconv.FormatInt(this.Id, 10)
+}
+
+// remove deletes the audio and the row of the sample
+func (this *RetainedSample) remove(o orm.Ormer) error {
+	if err := os.Remove(this.file()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	_, err := o.Delete(this)
+	return err
+}
+
+// RetainVerification stores the audio of a verification of the user with
+// its score and decision, for the retention period of its app. It returns
+// nil without error if the app has not opted in.
+func (this *DBEngine) RetainVerification(token, id string, data []byte, content string, score float64, decision string) (*RetainedSample, error) {
+	app, err := GetAppInfoByToken(token)
+	if app == nil || err != nil {
+		return nil, fmt.Errorf("token")
+	}
+	if app.RetainDays <= 0 {
+		return nil, nil
+	}
+
+	if r := []rune(content); len(r) > 64 {
+		content = string(r[:64])
+	}
+	now := time.Now().Truncate(time.Second)
+	s := &RetainedSample{AppId: app.AppId, Token: token, UserId: id, Content: content, Score: score, Decision: decision,
+		Size: int64(len(data)), Created: now, Expires: now.AddDate(0, 0, app.RetainDays)}
+
+	o := orm.NewOrm()
+	if _, err = o.Insert(s); err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(retainedDir(token, id), os.ModePerm); err == nil {
+		err = ioutil.WriteFile(s.file(), data, 0600)
+	}
+	if err != nil {
+		s.remove(o)
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetRetained lists the unexpired retained samples of the user, the latest
+// first
+func (this *DBEngine) GetRetained(token, id string) ([]*RetainedSample, error) {
+	var samples []*RetainedSample
+	_, err := orm.NewOrm().QueryTable("retained_sample").Filter("token", token).Filter("user_id", id).
+		Filter("expires__gt", time.Now()).OrderBy("-id").Limit(MAX_RETAINED_SAMPLES).All(&samples)
+	if err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+func getRetained(o orm.Ormer, token, id string, rid int64) (*RetainedSample, error) {
+	var s RetainedSample
+	err := o.QueryTable("retained_sample").Filter("id", rid).Filter("token", token).Filter("user_id", id).
+		Filter("expires__gt", time.Now()).One(&s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetRetainedAudio returns the retained sample rid of the user and its
+// audio, orm.ErrNoRows if there is none or it expired
+func (this *DBEngine) GetRetainedAudio(token, id string, rid int64) (*RetainedSample, []byte, error) {
+	s, err := getRetained(orm.NewOrm(), token, id, rid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := ioutil.ReadFile(s.file())
+	if os.IsNotExist(err) {
+		return nil, nil, orm.ErrNoRows
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, data, nil
+}
+
+// DeleteRetained deletes the retained sample rid of the user, orm.ErrNoRows
+// if there is none or it expired
+func (this *DBEngine) DeleteRetained(token, id string, rid int64) error {
+	o := orm.NewOrm()
+	s, err := getRetained(o, token, id, rid)
+	if err != nil {
+		return err
+	}
+	return s.remove(o)
+}
+
+// deleteRetained deletes the retained samples of the query in batches, and
+// returns how many
+func deleteRetained(qs func(orm.Ormer) orm.QuerySeter) (int64, error) {
+	o := orm.NewOrm()
+	var n int64
+	for {
+		var samples []*RetainedSample
+		if _, err := qs(o).OrderBy("id").Limit(MAX_RETAINED_SAMPLES).All(&samples); err != nil {
+			return n, err
+		}
+
+		for _, s := range samples {
+			if err := s.remove(o); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if len(samples) < MAX_RETAINED_SAMPLES {
+			return n, nil
+		}
+	}
+}
+
+// deleteUserRetained deletes all the retained samples of the user, and
+// returns how many
+func deleteUserRetained(token, id string) (int64, error) {
+	n, err := deleteRetained(func(o orm.Ormer) orm.QuerySeter {
+		return o.QueryTable("retained_sample").Filter("token", token).Filter("user_id", id)
+	})
+	if err == nil {
+		os.Remove(retainedDir(token, id))
+	}
+	return n, err
+}
+
+// PurgeRetained deletes the samples expired at now, and returns how many
+func PurgeRetained(now time.Time) (int64, error) {
+	return deleteRetained(func(o orm.Ormer) orm.QuerySeter {
+		return o.QueryTable("retained_sample").Filter("expires__lte", now)
+	})
+}
+
+// PurgeRetainedEvery runs PurgeRetained now and then every interval
+func PurgeRetainedEvery(interval time.Duration) {
+	for {
+		n, err := PurgeRetained(time.Now())
+		if err != nil {
+			log.Errorf("Purge expired retained samples failed: %v", err)
+		} else if n > 0 {
+			log.Infof("Purge expired retained samples: %d deleted", n)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// SetRetention sets the days the verification audio of the app is
+// retained, 0 to stop retaining it. The samples retained before expire
+// after the new period, or at once without retention.
+func (this *Developer) SetRetention(appname string, days int) (*AppInfo, error) {
+	if days < 0 || days > MAX_RETAIN_DAYS {
+		return nil, fmt.Errorf("retention must be 0 to %d days", MAX_RETAIN_DAYS)
+	}
+
+	app, err := this.getOwnAppInfo(appname)
+	if err != nil {
+		return nil, err
+	}
+
+	app.RetainDays = days
+	o := orm.NewOrm()
+	if _, err = o.Update(app, "RetainDays"); err != nil {
+		return nil, err
+	}
+
+	if days == 0 {
+		_, err = deleteRetained(func(o orm.Ormer) orm.QuerySeter {
+			return o.QueryTable("retained_sample").Filter("app_id", app.AppId)
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for offset := 0; ; offset += MAX_RETAINED_SAMPLES {
+			var samples []*RetainedSample
+			_, err = o.QueryTable("retained_sample").Filter("app_id", app.AppId).OrderBy("id").Limit(MAX_RETAINED_SAMPLES, offset).All(&samples)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range samples {
+				s.Expires = s.Created.AddDate(0, 0, days)
+				if _, err = o.Update(s, "Expires"); err != nil {
+					return nil, err
+				}
+			}
+			if len(samples) < MAX_RETAINED_SAMPLES {
+				break
+			}
+		}
+	}
+
+	log.Infof("Developer %s set retention of app %s: %d days", this.DeveloperName, appname, days)
+	return app, nil
+}
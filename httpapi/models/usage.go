@@ -0,0 +1,113 @@
+package models
+
+import (
+	"time"
+
+	"github.com/astaxie/beego/orm"
+)
+
+func init() {
+	orm.RegisterModel(new(AppUsage))
+}
+
+// usage columns, counted by CountUsage
+const (
+	USAGE_VERIFICATIONS = "verifications"
+	USAGE_TRAININGS     = "trainings"
+	USAGE_SAMPLES       = "samples"
+	USAGE_THROTTLED     = "throttled"
+)
+
+// DAY_LAYOUT is the layout of AppUsage.Day, days are of the local time
+const DAY_LAYOUT = "2006-01-02"
+
+// AppUsage 应用每日用量
+type AppUsage struct {
+	Id            int64
+	AppId         string `orm:"size(50)"`
+	Day           string `orm:"size(10)"` // 日期 2006-01-02
+	Requests      int64  // 通过限流的请求数
+	Verifications int64  // 成功的验证次数
+	Trainings     int64  // 成功的训练次数
+	Samples       int64  // 成功上传训练语音次数
+	Throttled     int64  // 被限流或超出配额拒绝的请求数
+}
+
+func (this *AppUsage) TableUnique() [][]string {
+	return [][]string{{"AppId", "Day"}}
+}
+
+// Today is the usage day of now
+func Today(now time.Time) string {
+	return now.Format(DAY_LAYOUT)
+}
+
+// usageRow makes sure the row of the app and day exists
+func usageRow(o orm.Ormer, appid, day string) error {
+	u := AppUsage{AppId: appid, Day: day}
+	_, _, err := o.ReadOrCreate(&u, "AppId", "Day")
+	if err != nil {
+		// created by a concurrent request between the read and the insert
+		u = AppUsage{AppId: appid, Day: day}
+		err = o.Read(&u, "AppId", "Day")
+	}
+	return err
+}
+
+// CountUsage adds a request to the usage of the app on day, and one to
+// column if it is not empty. With limit > 0 nothing is counted, and false
+// returned, once column reached limit that day.
+func CountUsage(appid, day, column string, limit int64) (bool, error) {
+	o := orm.NewOrm()
+	if err := usageRow(o, appid, day); err != nil {
+		return false, err
+	}
+
+	qs := o.QueryTable("app_usage").Filter("app_id", appid).Filter("day", day)
+	params := orm.Params{"requests": orm.ColValue(orm.ColAdd, 1)}
+	if column != "" {
+		params[column] = orm.ColValue(orm.ColAdd, 1)
+		if limit > 0 {
+			qs = qs.Filter(column+"__lt", limit)
+		}
+	}
+
+	n, err := qs.Update(params)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// RefundUsage takes back from column on day a request counted by
+// CountUsage that failed, it stays counted in the requests
+func RefundUsage(appid, day, column string) error {
+	_, err := orm.NewOrm().QueryTable("app_usage").Filter("app_id", appid).Filter("day", day).Filter(column+"__gt", 0).
+		Update(orm.Params{column: orm.ColValue(orm.ColMinus, 1)})
+	return err
+}
+
+// CountThrottled adds a rejected request to the usage of the app on day
+func CountThrottled(appid, day string) error {
+	o := orm.NewOrm()
+	if err := usageRow(o, appid, day); err != nil {
+		return err
+	}
+
+	_, err := o.QueryTable("app_usage").Filter("app_id", appid).Filter("day", day).
+		Update(orm.Params{USAGE_THROTTLED: orm.ColValue(orm.ColAdd, 1)})
+	return err
+}
+
+// GetUsage returns the usage of the app from day "from" to "to" included,
+// by day. Days without requests are left out.
+func GetUsage(appid, from, to string) ([]*AppUsage, error) {
+	var usage []*AppUsage
+	o := orm.NewOrm()
+	_, err := o.QueryTable("app_usage").Filter("app_id", appid).
+		Filter("day__gte", from).Filter("day__lte", to).OrderBy("day").All(&usage)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
@@ -2,12 +2,11 @@ package models
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
-	"strings"
+	"regexp"
 	"sync"
+	"time"
 
-	"github.com/astaxie/beego"
 	"github.com/astaxie/beego/orm"
 	"github.com/liuxp0827/govpr/log"
 )
@@ -25,7 +24,23 @@ type User struct {
 	Waves    [][]byte `orm:"-"`
 	Contents []string `orm:"-"` // 5条语音的文本内容
 	IsTrain  bool     // 是否已经训练模型
-	lock     *sync.Mutex
+	Gender   string   `orm:"size(1)"`   // 性别 m/f, 空为未知
+	Policy   string   `orm:"size(255)"` // 验证阈值策略 json, 空为按应用的策略
+
+	FailedVerifies int       // 时间窗内验证失败次数
+	FailureStart   time.Time `orm:"null;type(datetime)"` // 失败计数时间窗的起点
+	Lockouts       int       // 连续锁定次数, 锁定时长按它倍增
+	LockedUntil    time.Time `orm:"null;type(datetime)"` // 声纹锁定截止时间
+
+	lock *sync.Mutex
+}
+
+var useridPattern = regexp.MustCompile(`^[A-Za-z0-9_.@-]{1,32}$`)
+
+// ValidUserId tells if userid is 1 to 32 letters, digits or '_.@-'. It
+// names the directory of the files of the user, so it has no path.
+func ValidUserId(userid string) bool {
+	return useridPattern.MatchString(userid)
 }
 
 func (this *AppInfo) NewUser(token, userid string) *User {
@@ -43,6 +58,10 @@ func (this *AppInfo) NewUser(token, userid string) *User {
 }
 
 func (this *AppInfo) AddUser(user *User) error {
+	if !ValidUserId(user.UserId) {
+		return fmt.Errorf("AppInfo %s AddUser %s failed: userid is illegal", this.Name, user.UserId)
+	}
+
 	o := orm.NewOrm()
 	var u User
 	err := o.QueryTable("user").Filter("user_id", user.UserId).Filter("token", user.Token).One(&u)
@@ -70,17 +89,13 @@ func (this *AppInfo) DeleteUser(userid, token string) error {
 
 	log.Debugf("AppInfo %s DeleteUser %s successful, id %d", this.Name, userid, id)
 
-	train_data_path := beego.AppConfig.DefaultString("model_path", "mod/") + token + "_" + userid
-	fileInfos, err := ioutil.ReadDir(train_data_path)
-	if err != nil {
-		log.Errorf("AppInfo %s DeleteUser %s failed: %v", this.Name, userid, err)
-		return nil
+	if _, err = deleteUserRetained(token, userid); err != nil {
+		log.Errorf("AppInfo %s DeleteUser %s retained samples failed: %v", this.Name, userid, err)
 	}
 
-	for _, v := range fileInfos {
-		if !v.IsDir() && strings.HasPrefix(v.Name(), "_0") {
-			os.Remove(train_data_path + "/" + v.Name())
-		}
+	// the model and the train samples go with the user
+	if _, _, err = removeUserFiles(token, userid); err != nil {
+		log.Errorf("AppInfo %s DeleteUser %s failed: %v", this.Name, userid, err)
 	}
 
 	return nil
@@ -12,10 +12,12 @@ type CacheMem struct {
 	lru       *list.List
 }
 
-var UserCache *CacheMem
-
+// InitUserCache caches up to limits users in the memory of this server, and
+// locks them there
 func InitUserCache(limits int) {
 	UserCache = NewCacheMem(limits)
+	UserLocks = NewMemLocker(UserLockWait)
+	AuditLocks = NewMemLocker(0)
 }
 
 type entry struct {
@@ -32,8 +34,9 @@ func NewCacheMem(limits int) *CacheMem {
 }
 
 func (c *CacheMem) Get(key string) (*User, bool) {
-	c.RLock()
-	defer c.RUnlock()
+	// MoveToFront changes the list
+	c.Lock()
+	defer c.Unlock()
 
 	if ue, ok := c.cache[key]; ok {
 
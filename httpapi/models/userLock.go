@@ -0,0 +1,159 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/liuxp0827/govpr/httpapi/redis"
+	"github.com/liuxp0827/govpr/log"
+)
+
+// Per-user locks, of app.conf. A request changing the samples, the model
+// or the verification lockout of a user waits up to UserLockWait for the
+// request holding its lock. A
+// Redis lock expires after UserLockTTL, should its server die holding it.
+var (
+	UserLockWait = time.Duration(beego.AppConfig.DefaultInt("user_lock_wait", 10)) * time.Second
+	UserLockTTL  = time.Duration(beego.AppConfig.DefaultInt("user_lock_ttl", 300)) * time.Second
+)
+
+// ErrUserBusy is returned by LockUser when another request held the lock
+// of the user for all the wait
+var ErrUserBusy = errors.New("user is busy")
+
+// Locker locks keys, Lock returns the unlock of the key
+type Locker interface {
+	Lock(key string) (func(), error)
+}
+
+// UserLocks locks the users
+var UserLocks Locker
+
+// AuditLocks locks the audit chains of the apps, without a wait limit: an
+// append waits its turn rather than drop the event
+var AuditLocks Locker
+
+// LockUser locks the user of the app of token against the sample uploads,
+// trainings and verifications of the other requests, of all the servers
+// sharing UserLocks
+func LockUser(token, userid string) (func(), error) {
+	return UserLocks.Lock(fmt.Sprintf("%s#%s", token, userid))
+}
+
+// MemLocker locks keys within this server, a wait of 0 waits for the lock
+// however long it is held
+type MemLocker struct {
+	wait time.Duration
+
+	lock  sync.Mutex
+	locks map[string]*memLock
+}
+
+type memLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+func NewMemLocker(wait time.Duration) *MemLocker {
+	return &MemLocker{wait: wait, locks: make(map[string]*memLock)}
+}
+
+func (this *MemLocker) Lock(key string) (func(), error) {
+	this.lock.Lock()
+	l, ok := this.locks[key]
+	if !ok {
+		l = &memLock{ch: make(chan struct{}, 1)}
+		this.locks[key] = l
+	}
+	l.refs++
+	this.lock.Unlock()
+
+	unlock := func() {
+		<-l.ch
+		this.release(key, l)
+	}
+	if this.wait <= 0 {
+		l.ch <- struct{}{}
+		return unlock, nil
+	}
+
+	timer := time.NewTimer(this.wait)
+	defer timer.Stop()
+	select {
+	case l.ch <- struct{}{}:
+		return unlock, nil
+	case <-timer.C:
+		this.release(key, l)
+		return nil, ErrUserBusy
+	}
+}
+
+// release drops the lock of key once nobody holds or waits for it
+func (this *MemLocker) release(key string, l *memLock) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if l.refs--; l.refs == 0 {
+		delete(this.locks, key)
+	}
+}
+
+// prefix of the keys of the user locks
+const REDIS_LOCK_PREFIX = "govpr:lock:"
+
+// RedisLocker locks keys in Redis, across the servers sharing it. A lock
+// holds a random token, so only its owner releases it. A wait of 0 waits
+// for the lock until it is released or expires.
+type RedisLocker struct {
+	client *redis.Client
+	ttl    time.Duration
+	wait   time.Duration
+}
+
+// least ttl of a Redis lock
+const REDIS_LOCK_MIN_TTL = time.Second
+
+func NewRedisLocker(client *redis.Client, ttl, wait time.Duration) *RedisLocker {
+	if ttl < REDIS_LOCK_MIN_TTL {
+		log.Warnf("user lock ttl %v is below %v, using %v", ttl, REDIS_LOCK_MIN_TTL, REDIS_LOCK_MIN_TTL)
+		ttl = REDIS_LOCK_MIN_TTL
+	}
+	return &RedisLocker{client: client, ttl: ttl, wait: wait}
+}
+
+func (this *RedisLocker) Lock(key string) (func(), error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	key, token := REDIS_LOCK_PREFIX+key, hex.EncodeToString(b)
+
+	deadline := time.Now().Add(this.wait)
+	backoff := 10 * time.Millisecond
+	for {
+		ok, err := this.client.SetNX(key, token, this.ttl)
+		if err != nil {
+			return nil, fmt.Errorf("lock %s failed: %v", key, err)
+		}
+		if ok {
+			return func() {
+				if _, err := this.client.DelIfEqual(key, token); err != nil {
+					// it expires after the ttl
+					log.Errorf("unlock %s failed: %v", key, err)
+				}
+			}, nil
+		}
+
+		if this.wait > 0 && !time.Now().Add(backoff).Before(deadline) {
+			return nil, ErrUserBusy
+		}
+		time.Sleep(backoff)
+		if backoff < 200*time.Millisecond {
+			backoff *= 2
+		}
+	}
+}
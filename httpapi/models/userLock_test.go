@@ -0,0 +1,109 @@
+package models
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liuxp0827/govpr/httpapi/redis"
+)
+
+// testLocker checks that the lockers hold a key for one holder at a time,
+// and that busy gives up waiting for a held key
+func testLocker(t *testing.T, busy Locker, lockers ...Locker) {
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	held, max := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(l Locker) {
+			defer wg.Done()
+			unlock, err := l.Lock("tok#bob")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			lock.Lock()
+			if held++; held > max {
+				max = held
+			}
+			lock.Unlock()
+
+			time.Sleep(time.Millisecond)
+			lock.Lock()
+			held--
+			lock.Unlock()
+			unlock()
+		}(lockers[i%len(lockers)])
+	}
+	wg.Wait()
+	if max != 1 {
+		t.Fatalf("%d holders of the lock at once, want 1", max)
+	}
+
+	unlock, err := lockers[0].Lock("tok#bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	if _, err = busy.Lock("tok#bob"); err != ErrUserBusy {
+		t.Fatalf("Lock of a held key = %v, want ErrUserBusy", err)
+	}
+}
+
+func TestMemLocker(t *testing.T) {
+	l := NewMemLocker(500 * time.Millisecond)
+	testLocker(t, l, l)
+}
+
+func TestRedisLocker(t *testing.T) {
+	s := redis.NewStandin()
+	addr, err := s.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// two servers of a deployment sharing the redis
+	a, b := redis.NewClient(addr, "", 0), redis.NewClient(addr, "", 0)
+	defer a.Close()
+	defer b.Close()
+	testLocker(t, NewRedisLocker(b, time.Minute, 100*time.Millisecond),
+		NewRedisLocker(a, time.Minute, 10*time.Second), NewRedisLocker(b, time.Minute, 10*time.Second))
+}
+
+func TestRedisLockerTTL(t *testing.T) {
+	s := redis.NewStandin()
+	addr, err := s.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c := redis.NewClient(addr, "", 0)
+	defer c.Close()
+	unlock, err := NewRedisLocker(c, 0, time.Second).Lock("tok#bob")
+	if err != nil {
+		t.Fatalf("Lock with no ttl = %v, want the least ttl", err)
+	}
+	unlock()
+}
+
+func TestMemLockerNoWait(t *testing.T) {
+	l := NewMemLocker(0)
+	unlock, err := l.Lock("audit#app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		unlock()
+	}()
+
+	// a wait of 0 outwaits the holder
+	unlock, err = l.Lock("audit#app")
+	if err != nil {
+		t.Fatalf("Lock with no wait limit = %v, want the lock once released", err)
+	}
+	unlock()
+}
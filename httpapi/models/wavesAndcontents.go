@@ -34,6 +34,37 @@ func (this *User) GetAllWavesAndContents() error {
 	return nil
 }
 
+// Sample is a stored train wave of a user, without the audio
+type Sample struct {
+	Step    int
+	Content string
+	Size    int64
+}
+
+// GetSamples lists the stored train waves of the user by step, no
+// samples yet is not an error.
+func (this *User) GetSamples() ([]Sample, error) {
+	train_data_path := beego.AppConfig.DefaultString("model_path", "mod/") +
+		this.Token + "_" + this.UserId
+
+	samples := make([]Sample, 0)
+	fileInfos, err := ioutil.ReadDir(train_data_path)
+	if os.IsNotExist(err) {
+		return samples, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range fileInfos {
+		name := v.Name()
+		if !v.IsDir() && strings.HasPrefix(name, "_0") && len(name) >= 4 {
+			samples = append(samples, Sample{Step: int(name[2] - '0'), Content: name[4:], Size: v.Size()})
+		}
+	}
+	return samples, nil
+}
+
 func (this *User) addWavesAndContents(wave []byte, content string, step int) error {
 
 	if wave == nil || len(wave) <= 0 {
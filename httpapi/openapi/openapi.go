@@ -0,0 +1,230 @@
+// Package openapi builds an OpenAPI 3 document from the route table of an
+// API, so the published description cannot drift from the routes served.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const VERSION = "3.0.3"
+
+// Schema is a JSON schema object, as it appears in the document
+type Schema map[string]interface{}
+
+// Ref refers to the schema name of the components of the document
+func Ref(name string) Schema {
+	return Schema{"$ref": "#/components/schemas/" + name}
+}
+
+func String() Schema {
+	return Schema{"type": "string"}
+}
+
+func Integer(min, max int) Schema {
+	return Schema{"type": "integer", "minimum": min, "maximum": max}
+}
+
+func Array(items Schema) Schema {
+	return Schema{"type": "array", "items": items}
+}
+
+// Object is an object schema of the properties, required lists the
+// properties that must be present.
+func Object(properties map[string]Schema, required ...string) Schema {
+	s := Schema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// Param is a path, query or header parameter of an operation
+type Param struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	Schema      Schema
+}
+
+// Body is the request body of an operation by media type
+type Body struct {
+	Description string
+	Required    bool
+	Content     map[string]Schema
+}
+
+// Response is a response of an operation. Schema is served as
+// application/json, Content by media type; without either there is no body.
+type Response struct {
+	Description string
+	Schema      Schema
+	Content     map[string]Schema
+}
+
+// Operation is one route of the API. Path is in beego syntax, path
+// parameters are ":name" segments and are documented as required strings
+// unless Params describes them.
+type Operation struct {
+	Method    string
+	Path      string
+	Id        string
+	Summary   string
+	Tag       string
+	Params    []Param
+	Body      *Body
+	Responses map[int]Response
+	Security  []string
+}
+
+type Info struct {
+	Title       string
+	Version     string
+	Description string
+}
+
+// Document is an OpenAPI document, it marshals to the JSON form.
+type Document struct {
+	Info       Info
+	Servers    []string
+	Operations []Operation
+	Schemas    map[string]Schema
+	// security schemes by name
+	Security map[string]Schema
+}
+
+// Path converts a beego route to an OpenAPI path, "/users/:uid" is
+// "/users/{uid}".
+func Path(route string) string {
+	segs := strings.Split(route, "/")
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, ":") {
+			segs[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+func pathParams(route string) []string {
+	var names []string
+	for _, seg := range strings.Split(route, "/") {
+		if strings.HasPrefix(seg, ":") {
+			names = append(names, seg[1:])
+		}
+	}
+	return names
+}
+
+func (p Param) object() map[string]interface{} {
+	schema := p.Schema
+	if schema == nil {
+		schema = String()
+	}
+	o := map[string]interface{}{"name": p.Name, "in": p.In, "schema": schema}
+	if p.Description != "" {
+		o["description"] = p.Description
+	}
+	if p.Required || p.In == "path" {
+		o["required"] = true
+	}
+	return o
+}
+
+func (op Operation) object() map[string]interface{} {
+	params := make([]interface{}, 0)
+	declared := make(map[string]bool)
+	for _, p := range op.Params {
+		if p.In == "path" {
+			declared[p.Name] = true
+		}
+	}
+	for _, name := range pathParams(op.Path) {
+		if !declared[name] {
+			params = append(params, Param{Name: name, In: "path"}.object())
+		}
+	}
+	for _, p := range op.Params {
+		params = append(params, p.object())
+	}
+
+	responses := make(map[string]interface{})
+	for status, r := range op.Responses {
+		desc := r.Description
+		if desc == "" {
+			desc = http.StatusText(status)
+		}
+		o := map[string]interface{}{"description": desc}
+		content := make(map[string]interface{})
+		if r.Schema != nil {
+			content["application/json"] = map[string]interface{}{"schema": r.Schema}
+		}
+		for media, schema := range r.Content {
+			content[media] = map[string]interface{}{"schema": schema}
+		}
+		if len(content) > 0 {
+			o["content"] = content
+		}
+		responses[strconv.Itoa(status)] = o
+	}
+
+	o := map[string]interface{}{"operationId": op.Id, "responses": responses}
+	if op.Summary != "" {
+		o["summary"] = op.Summary
+	}
+	if op.Tag != "" {
+		o["tags"] = []string{op.Tag}
+	}
+	if len(params) > 0 {
+		o["parameters"] = params
+	}
+	if op.Body != nil {
+		content := make(map[string]interface{})
+		for media, schema := range op.Body.Content {
+			content[media] = map[string]interface{}{"schema": schema}
+		}
+		o["requestBody"] = map[string]interface{}{"description": op.Body.Description, "required": op.Body.Required, "content": content}
+	}
+
+	// an empty list documents an operation open to anyone
+	security := make([]interface{}, len(op.Security))
+	for i, name := range op.Security {
+		security[i] = map[string][]string{name: {}}
+	}
+	o["security"] = security
+	return o
+}
+
+func (d *Document) MarshalJSON() ([]byte, error) {
+	paths := make(map[string]map[string]interface{})
+	for _, op := range d.Operations {
+		p := Path(op.Path)
+		if paths[p] == nil {
+			paths[p] = make(map[string]interface{})
+		}
+		paths[p][strings.ToLower(op.Method)] = op.object()
+	}
+
+	info := map[string]interface{}{"title": d.Info.Title, "version": d.Info.Version}
+	if d.Info.Description != "" {
+		info["description"] = d.Info.Description
+	}
+
+	servers := make([]interface{}, len(d.Servers))
+	for i, url := range d.Servers {
+		servers[i] = map[string]string{"url": url}
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"openapi": VERSION,
+		"info":    info,
+		"servers": servers,
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas":         d.Schemas,
+			"securitySchemes": d.Security,
+		},
+	})
+}
@@ -0,0 +1,188 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// connections kept open for reuse by a Client
+const MAX_IDLE = 8
+
+// unlockScript deletes KEYS[1] if its value is ARGV[1], so a lock is only
+// released by its owner
+const unlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// Client sends commands to the server at Addr over a pool of connections.
+// It is safe for concurrent use.
+type Client struct {
+	Addr     string
+	Password string        // AUTH of the new connections, empty for none
+	DB       int           // SELECT of the new connections
+	Timeout  time.Duration // of dialing and of every command, 0 for none
+
+	lock sync.Mutex
+	idle []*conn
+}
+
+func NewClient(addr, password string, db int) *Client {
+	return &Client{Addr: addr, Password: password, DB: db, Timeout: 5 * time.Second}
+}
+
+func (this *Client) dial() (*conn, error) {
+	nc, err := net.DialTimeout("tcp", this.Addr, this.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if this.Password != "" {
+		if _, err = this.do(c, "AUTH", this.Password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if this.DB != 0 {
+		if _, err = this.do(c, "SELECT", strconv.Itoa(this.DB)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (this *Client) get() (*conn, error) {
+	this.lock.Lock()
+	if n := len(this.idle); n > 0 {
+		c := this.idle[n-1]
+		this.idle = this.idle[:n-1]
+		this.lock.Unlock()
+		return c, nil
+	}
+	this.lock.Unlock()
+	return this.dial()
+}
+
+func (this *Client) put(c *conn) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if len(this.idle) < MAX_IDLE {
+		this.idle = append(this.idle, c)
+		return
+	}
+	c.Close()
+}
+
+func (this *Client) do(c *conn, args ...string) (interface{}, error) {
+	if this.Timeout > 0 {
+		c.SetDeadline(time.Now().Add(this.Timeout))
+	}
+	if err := writeCommand(c.w, args); err != nil {
+		return nil, err
+	}
+	reply, err := readReply(c.r)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := reply.(Error); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+// Do sends the command args and returns its reply, see readReply. An
+// error reply is returned as an Error.
+func (this *Client) Do(args ...string) (interface{}, error) {
+	c, err := this.get()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := this.do(c, args...)
+	if _, ok := err.(Error); err != nil && !ok {
+		// the connection is out of step with the server
+		c.Close()
+		return nil, err
+	}
+	this.put(c)
+	return reply, err
+}
+
+// Close closes the idle connections
+func (this *Client) Close() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, c := range this.idle {
+		c.Close()
+	}
+	this.idle = nil
+	return nil
+}
+
+func (this *Client) Ping() error {
+	_, err := this.Do("PING")
+	return err
+}
+
+// Get returns the value of key, ErrNil if there is none
+func (this *Client) Get(key string) ([]byte, error) {
+	reply, err := this.Do("GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrNil
+	}
+	return reply.([]byte), nil
+}
+
+// Set sets key to value, expiring after ttl if not 0
+func (this *Client) Set(key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	}
+	_, err := this.Do(args...)
+	return err
+}
+
+// SetNX sets key to value expiring after ttl unless key exists, and tells
+// if it did. The ttl is at least a millisecond.
+func (this *Client) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	if ttl < time.Millisecond {
+		return false, fmt.Errorf("redis: set %s: ttl %v is below 1ms", key, ttl)
+	}
+	reply, err := this.Do("SET", key, value, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10), "NX")
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+// Del deletes the keys, and returns how many existed
+func (this *Client) Del(keys ...string) (int64, error) {
+	reply, err := this.Do(append([]string{"DEL"}, keys...)...)
+	if err != nil {
+		return 0, err
+	}
+	return reply.(int64), nil
+}
+
+// DelIfEqual deletes key if its value is value, and tells if it did
+func (this *Client) DelIfEqual(key, value string) (bool, error) {
+	reply, err := this.Do("EVAL", unlockScript, "1", key, value)
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n == 1, nil
+}
@@ -0,0 +1,96 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func standin(t *testing.T, password string) *Client {
+	s := NewStandin()
+	s.Password = password
+	addr, err := s.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(addr, password, 1)
+	t.Cleanup(func() {
+		c.Close()
+		s.Close()
+	})
+	return c
+}
+
+func TestGetSet(t *testing.T) {
+	c := standin(t, "")
+	if _, err := c.Get("k"); err != ErrNil {
+		t.Fatalf("Get of a missing key = %v, want ErrNil", err)
+	}
+	if err := c.Set("k", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get("k"); err != nil || string(v) != "v" {
+		t.Fatalf("Get = %q, %v, want \"v\"", v, err)
+	}
+
+	if err := c.Set("t", []byte("v"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err := c.Get("t"); err != ErrNil {
+		t.Fatalf("Get of an expired key = %v, want ErrNil", err)
+	}
+
+	if n, err := c.Del("k", "t"); err != nil || n != 1 {
+		t.Fatalf("Del = %d, %v, want 1", n, err)
+	}
+}
+
+func TestSetNX(t *testing.T) {
+	c := standin(t, "")
+	if ok, err := c.SetNX("k", "a", time.Second); err != nil || !ok {
+		t.Fatalf("SetNX = %t, %v, want true", ok, err)
+	}
+	if ok, err := c.SetNX("k", "b", time.Second); err != nil || ok {
+		t.Fatalf("SetNX of an existing key = %t, %v, want false", ok, err)
+	}
+	if _, err := c.SetNX("z", "a", 0); err == nil {
+		t.Fatal("SetNX with no ttl succeeded")
+	}
+
+	if ok, err := c.SetNX("e", "a", 20*time.Millisecond); err != nil || !ok {
+		t.Fatalf("SetNX = %t, %v, want true", ok, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if ok, err := c.SetNX("e", "b", time.Second); err != nil || !ok {
+		t.Fatalf("SetNX of an expired key = %t, %v, want true", ok, err)
+	}
+}
+
+func TestDelIfEqual(t *testing.T) {
+	c := standin(t, "")
+	if _, err := c.SetNX("k", "a", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.DelIfEqual("k", "b"); err != nil || ok {
+		t.Fatalf("DelIfEqual of another value = %t, %v, want false", ok, err)
+	}
+	if ok, err := c.DelIfEqual("k", "a"); err != nil || !ok {
+		t.Fatalf("DelIfEqual = %t, %v, want true", ok, err)
+	}
+	if _, err := c.Get("k"); err != ErrNil {
+		t.Fatalf("Get of a deleted key = %v, want ErrNil", err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	c := standin(t, "secret")
+	if err := c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	wrong := NewClient(c.Addr, "wrong", 0)
+	defer wrong.Close()
+	if err := wrong.Ping(); err == nil {
+		t.Fatal("Ping with a wrong password succeeded")
+	}
+}
@@ -0,0 +1,98 @@
+// Package redis is a small client of the Redis protocol (RESP), with the
+// commands of the shared user cache and the user locks of the servers of
+// a multi-node deployment, and Standin, an in-process server of the same
+// commands for development and tests.
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ErrNil is the nil reply, of GET of a missing key or of SET NX of an
+// existing one
+var ErrNil = errors.New("redis: nil reply")
+
+// Error is an error reply of the server
+type Error string
+
+func (this Error) Error() string {
+	return string(this)
+}
+
+// largest bulk string read, larger ones are a protocol error
+const MAX_BULK = 64 << 20
+
+// writeCommand writes args as an array of bulk strings
+func writeCommand(w *bufio.Writer, args []string) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(a), a)
+	}
+	return w.Flush()
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: bad line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// readReply reads a reply: a string for a simple string, Error for an
+// error, int64 for an integer, []byte or nil for a bulk string and
+// []interface{} or nil for an array
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > MAX_BULK {
+			return nil, fmt.Errorf("redis: bad bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+	return nil, fmt.Errorf("redis: bad reply %q", line)
+}
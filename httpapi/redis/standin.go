@@ -0,0 +1,262 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liuxp0827/govpr/log"
+)
+
+type item struct {
+	value   []byte
+	expires time.Time // zero for never
+}
+
+// Standin serves the commands of Client from memory: PING, AUTH, SELECT,
+// GET, SET with EX, PX, NX and XX, DEL, EXISTS, FLUSHDB, QUIT, and EVAL of
+// the script of DelIfEqual only. It stands in for a Redis server in
+// development and tests, every client sharing its keys as the servers of a
+// deployment share Redis.
+type Standin struct {
+	Password string // required by AUTH if not empty
+
+	lock sync.Mutex
+	dbs  map[int]map[string]item
+	ln   net.Listener
+}
+
+func NewStandin() *Standin {
+	return &Standin{dbs: make(map[int]map[string]item)}
+}
+
+// Listen serves on the tcp address addr in the background, and returns
+// the address listened on, of a free port for ":0"
+func (this *Standin) Listen(addr string) (string, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	this.ln = ln
+	go this.Serve(ln)
+	return ln.Addr().String(), nil
+}
+
+// Serve serves the connections of ln until it is closed
+func (this *Standin) Serve(ln net.Listener) error {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go this.serveConn(c)
+	}
+}
+
+// Close stops listening
+func (this *Standin) Close() error {
+	if this.ln == nil {
+		return nil
+	}
+	return this.ln.Close()
+}
+
+type session struct {
+	db     int
+	authed bool
+}
+
+func (this *Standin) serveConn(c net.Conn) {
+	defer c.Close()
+	r, w := bufio.NewReader(c), bufio.NewWriter(c)
+	s := &session{authed: this.Password == ""}
+
+	for {
+		req, err := readReply(r)
+		if err != nil {
+			return
+		}
+		a, ok := req.([]interface{})
+		if !ok || len(a) == 0 {
+			fmt.Fprintf(w, "-ERR protocol error\r\n")
+			w.Flush()
+			return
+		}
+		args := make([]string, len(a))
+		for i, v := range a {
+			b, _ := v.([]byte)
+			args[i] = string(b)
+		}
+
+		quit := strings.ToUpper(args[0]) == "QUIT"
+		writeValue(w, this.exec(s, args))
+		if err = w.Flush(); err != nil || quit {
+			return
+		}
+	}
+}
+
+// writeValue writes a reply of exec: string a simple string, Error an
+// error, int64 an integer, []byte or nil a bulk string
+func writeValue(w *bufio.Writer, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case Error:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	default:
+		fmt.Fprintf(w, "$-1\r\n")
+	}
+}
+
+func wrongArgs(cmd string) Error {
+	return Error("ERR wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+}
+
+func (this *Standin) keys(db int) map[string]item {
+	keys, ok := this.dbs[db]
+	if !ok {
+		keys = make(map[string]item)
+		this.dbs[db] = keys
+	}
+	return keys
+}
+
+// live returns the item of key unless it expired at now, dropping it then
+func live(keys map[string]item, key string, now time.Time) (item, bool) {
+	it, ok := keys[key]
+	if ok && !it.expires.IsZero() && !now.Before(it.expires) {
+		delete(keys, key)
+		return item{}, false
+	}
+	return it, ok
+}
+
+func (this *Standin) exec(s *session, args []string) interface{} {
+	cmd := strings.ToUpper(args[0])
+	switch cmd {
+	case "AUTH":
+		if len(args) != 2 {
+			return wrongArgs(cmd)
+		}
+		if this.Password == "" || args[1] != this.Password {
+			return Error("WRONGPASS invalid password")
+		}
+		s.authed = true
+		return "OK"
+	case "PING":
+		return "PONG"
+	case "QUIT":
+		return "OK"
+	}
+	if !s.authed {
+		return Error("NOAUTH Authentication required.")
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	now := time.Now()
+
+	switch cmd {
+	case "SELECT":
+		if len(args) != 2 {
+			return wrongArgs(cmd)
+		}
+		db, err := strconv.Atoi(args[1])
+		if err != nil || db < 0 {
+			return Error("ERR DB index is out of range")
+		}
+		s.db = db
+		return "OK"
+
+	case "GET":
+		if len(args) != 2 {
+			return wrongArgs(cmd)
+		}
+		if it, ok := live(this.keys(s.db), args[1], now); ok {
+			return it.value
+		}
+		return nil
+
+	case "SET":
+		if len(args) < 3 {
+			return wrongArgs(cmd)
+		}
+		it := item{value: []byte(args[2])}
+		var nx, xx bool
+		for i := 3; i < len(args); i++ {
+			switch opt := strings.ToUpper(args[i]); opt {
+			case "NX":
+				nx = true
+			case "XX":
+				xx = true
+			case "EX", "PX":
+				if i+1 >= len(args) {
+					return Error("ERR syntax error")
+				}
+				i++
+				n, err := strconv.ParseInt(args[i], 10, 64)
+				if err != nil || n <= 0 {
+					return Error("ERR invalid expire time in 'set' command")
+				}
+				unit := time.Second
+				if opt == "PX" {
+					unit = time.Millisecond
+				}
+				it.expires = now.Add(time.Duration(n) * unit)
+			default:
+				return Error("ERR syntax error")
+			}
+		}
+
+		keys := this.keys(s.db)
+		_, exists := live(keys, args[1], now)
+		if (nx && exists) || (xx && !exists) {
+			return nil
+		}
+		keys[args[1]] = it
+		return "OK"
+
+	case "DEL", "EXISTS":
+		if len(args) < 2 {
+			return wrongArgs(cmd)
+		}
+		keys := this.keys(s.db)
+		var n int64
+		for _, k := range args[1:] {
+			if _, ok := live(keys, k, now); ok {
+				n++
+				if cmd == "DEL" {
+					delete(keys, k)
+				}
+			}
+		}
+		return n
+
+	case "FLUSHDB":
+		delete(this.dbs, s.db)
+		return "OK"
+
+	case "EVAL":
+		if len(args) != 5 || args[1] != unlockScript || args[2] != "1" {
+			return Error("ERR the stand-in only evaluates the script of DelIfEqual")
+		}
+		keys := this.keys(s.db)
+		if it, ok := live(keys, args[3], now); ok && string(it.value) == args[4] {
+			delete(keys, args[3])
+			return int64(1)
+		}
+		return int64(0)
+	}
+
+	log.Debugf("redis stand-in: unknown command %s", cmd)
+	return Error("ERR unknown command '" + args[0] + "'")
+}
@@ -2,10 +2,34 @@ package routers
 
 import (
 	"github.com/astaxie/beego"
+	"github.com/liuxp0827/govpr/httpapi/audit"
+	"github.com/liuxp0827/govpr/httpapi/auth"
 	"github.com/liuxp0827/govpr/httpapi/controllers"
+	"github.com/liuxp0827/govpr/httpapi/limit"
 )
 
 func init() {
+	// the user and model routes take signed requests of an app, throttled,
+	// counted in its usage and audited
+	for _, pattern := range []string{"/trainmodel", "/verifymodel", "/deletemodel", "/registeruser", "/deleteuser",
+		"/detectquery", "/addsample", "/clearsamples", "/detectregister", "/v2/apps/*"} {
+		beego.InsertFilter(pattern, beego.BeforeExec, audit.Start)
+		beego.InsertFilter(pattern, beego.BeforeExec, auth.Filter)
+		beego.InsertFilter(pattern, beego.BeforeExec, limit.Filter)
+		beego.InsertFilter(pattern, beego.FinishRouter, audit.Filter, false)
+		beego.InsertFilter(pattern, beego.FinishRouter, limit.Settle, false)
+	}
+	limit.Count("post", "/verifymodel", limit.VERIFY)
+	limit.Count("post", "/trainmodel", limit.TRAIN)
+	limit.Count("post", "/addsample", limit.SAMPLE)
+
+	audit.Audit("post", "/addsample", audit.OP_ADD_SAMPLE)
+	audit.Audit("post", "/trainmodel", audit.OP_TRAIN_MODEL)
+	audit.Audit("post", "/verifymodel", audit.OP_VERIFY_MODEL)
+	audit.Audit("post", "/deletemodel", audit.OP_DELETE_MODEL)
+	audit.Audit("post", "/deleteuser", audit.OP_DELETE_USER)
+	audit.Audit("post", "/clearsamples", audit.OP_CLEAR_SAMPLES)
+
 	beego.Router("/trainmodel", &controllers.ModelController{}, "post:TrainModel")
 	beego.Router("/verifymodel", &controllers.ModelController{}, "post:VerifyModel")
 	beego.Router("/deletemodel", &controllers.ModelController{}, "post:DeleteModel")
@@ -17,10 +41,23 @@ func init() {
 	beego.Router("/clearsamples", &controllers.UserController{}, "post:ClearSamples")
 	beego.Router("/detectregister", &controllers.UserController{}, "post:DetectRegister")
 
-	beego.Router("/registerdeveloper", &controllers.DeveloperController{}, "get,post:RegisterDeveloper")
-	beego.Router("/deletedeveloper", &controllers.DeveloperController{}, "get,post:DeleteDeveloper")
+	beego.Router("/registerdeveloper", &controllers.DeveloperController{}, "post:RegisterDeveloper")
+	beego.Router("/deletedeveloper", &controllers.DeveloperController{}, "post:DeleteDeveloper")
+	beego.Router("/changepassword", &controllers.DeveloperController{}, "post:ChangePassword")
+	beego.Router("/forgotpassword", &controllers.DeveloperController{}, "post:ForgotPassword")
+	beego.Router("/resetpassword", &controllers.DeveloperController{}, "post:ResetPassword")
 
-	beego.Router("/registerapp", &controllers.AppInfoController{}, "get,post:RegisterApp")
-	beego.Router("/deleteapp", &controllers.AppInfoController{}, "get,post:DeleteApp")
-	beego.Router("/appinfo", &controllers.AppInfoController{}, "get,post:GetAppInfo")
+	beego.Router("/registerapp", &controllers.AppInfoController{}, "post:RegisterApp")
+	beego.Router("/deleteapp", &controllers.AppInfoController{}, "post:DeleteApp")
+	beego.Router("/appinfo", &controllers.AppInfoController{}, "post:GetAppInfo")
+	beego.Router("/rotatekey", &controllers.AppInfoController{}, "post:RotateKey")
+	beego.Router("/revokekey", &controllers.AppInfoController{}, "post:RevokeKey")
+	beego.Router("/setquota", &controllers.AppInfoController{}, "post:SetQuota")
+	beego.Router("/usage", &controllers.AppInfoController{}, "post:GetUsage")
+	beego.Router("/unlockuser", &controllers.AppInfoController{}, "post:UnlockUser")
+	beego.Router("/setretention", &controllers.AppInfoController{}, "post:SetRetention")
+	beego.Router("/setpolicy", &controllers.AppInfoController{}, "post:SetPolicy")
+	beego.Router("/calibrate", &controllers.AppInfoController{}, "post:Calibrate")
+	beego.Router("/audit", &controllers.AppInfoController{}, "post:GetAudit")
+	beego.Router("/auditverify", &controllers.AppInfoController{}, "post:VerifyAudit")
 }
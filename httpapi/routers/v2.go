@@ -0,0 +1,348 @@
+package routers
+
+import (
+	"net/http"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
+	"github.com/liuxp0827/govpr/httpapi/audit"
+	"github.com/liuxp0827/govpr/httpapi/auth"
+	"github.com/liuxp0827/govpr/httpapi/controllers"
+	"github.com/liuxp0827/govpr/httpapi/limit"
+	"github.com/liuxp0827/govpr/httpapi/openapi"
+)
+
+type v2Route struct {
+	openapi.Operation
+	controller beego.ControllerInterface
+	handler    string
+}
+
+var (
+	userid = openapi.Schema{"type": "string", "pattern": "^[A-Za-z0-9_.@-]{1,32}$"}
+
+	gender = openapi.Schema{"type": "string", "enum": []string{"m", "f"}, "description": "for the gender threshold policy, omitted if unknown"}
+
+	content = openapi.Param{Name: "content", In: "query", Description: "text spoken in the audio, at most 32 characters",
+		Schema: openapi.Schema{"type": "string", "maxLength": 32}}
+
+	audio = &openapi.Body{
+		Description: "WAV, FLAC, Ogg Vorbis, Ogg Opus, MP3 or raw 16 bit PCM, at most 32 MiB",
+		Required:    true,
+		Content: map[string]openapi.Schema{
+			"application/octet-stream": {"type": "string", "format": "binary"},
+			"audio/*":                  {"type": "string", "format": "binary"},
+			"multipart/form-data": openapi.Object(map[string]openapi.Schema{
+				"file":    {"type": "string", "format": "binary"},
+				"content": openapi.String(),
+			}, "file"),
+		},
+	}
+
+	verificationId = openapi.Param{Name: "vid", In: "path", Description: "id of the retained verification",
+		Schema: openapi.Schema{"type": "integer", "minimum": 1}}
+
+	errorResponse = openapi.Response{Schema: openapi.Ref("Error")}
+)
+
+// errorResponses returns the error responses of the statuses, with the ones of
+// every /v2 route
+func errorResponses(statuses ...int) map[int]openapi.Response {
+	responses := map[int]openapi.Response{
+		http.StatusUnauthorized:        {Description: "unsigned, stale, replayed or badly signed request", Schema: openapi.Ref("Error")},
+		http.StatusForbidden:           {Description: "the credentials are of another app", Schema: openapi.Ref("Error")},
+		http.StatusTooManyRequests:     {Description: "request rate or daily quota exceeded, see the Retry-After header", Schema: openapi.Ref("Error")},
+		http.StatusInternalServerError: errorResponse,
+	}
+	for _, status := range statuses {
+		responses[status] = errorResponse
+	}
+	return responses
+}
+
+func with(responses map[int]openapi.Response, status int, r openapi.Response) map[int]openapi.Response {
+	responses[status] = r
+	return responses
+}
+
+var v2Routes = []v2Route{
+	{openapi.Operation{Method: "get", Path: "/v2/apps/:id/usage", Id: "getUsage", Tag: "apps",
+		Summary: "Get the quotas of the app and its usage by day",
+		Params: []openapi.Param{
+			{Name: "from", In: "query", Description: "first day, defaults to to", Schema: openapi.Schema{"type": "string", "format": "date"}},
+			{Name: "to", In: "query", Description: "last day, defaults to today", Schema: openapi.Schema{"type": "string", "format": "date"}}},
+		Responses: with(errorResponses(http.StatusBadRequest), http.StatusOK, openapi.Response{Schema: openapi.Ref("Usage")})},
+		&controllers.V2AppController{}, "GetUsage"},
+
+	{openapi.Operation{Method: "get", Path: "/v2/apps/:id/users", Id: "listUsers", Tag: "users",
+		Summary:   "List the users of the app",
+		Responses: with(errorResponses(), http.StatusOK, openapi.Response{Schema: openapi.Object(map[string]openapi.Schema{"users": openapi.Array(openapi.Ref("User"))})})},
+		&controllers.V2UserController{}, "ListUsers"},
+
+	{openapi.Operation{Method: "post", Path: "/v2/apps/:id/users", Id: "createUser", Tag: "users",
+		Summary: "Register a user",
+		Body: &openapi.Body{Required: true, Content: map[string]openapi.Schema{
+			"application/json": openapi.Object(map[string]openapi.Schema{"userid": userid, "gender": gender}, "userid")}},
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusConflict, http.StatusUnsupportedMediaType),
+			http.StatusCreated, openapi.Response{Schema: openapi.Ref("User")})},
+		&controllers.V2UserController{}, "CreateUser"},
+
+	{openapi.Operation{Method: "get", Path: "/v2/apps/:id/users/:uid", Id: "getUser", Tag: "users",
+		Summary:   "Get a user with its stored samples",
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound), http.StatusOK, openapi.Response{Schema: openapi.Ref("User")})},
+		&controllers.V2UserController{}, "GetUser"},
+
+	{openapi.Operation{Method: "delete", Path: "/v2/apps/:id/users/:uid", Id: "deleteUser", Tag: "users",
+		Summary:   "Delete a user with its model, samples and retained verifications",
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound), http.StatusNoContent, openapi.Response{})},
+		&controllers.V2UserController{}, "DeleteUser"},
+
+	{openapi.Operation{Method: "get", Path: "/v2/apps/:id/users/:uid/samples", Id: "listSamples", Tag: "samples",
+		Summary:   "List the train samples of a user",
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound), http.StatusOK, openapi.Response{Schema: openapi.Object(map[string]openapi.Schema{"samples": openapi.Array(openapi.Ref("Sample"))})})},
+		&controllers.V2UserController{}, "ListSamples"},
+
+	{openapi.Operation{Method: "put", Path: "/v2/apps/:id/users/:uid/samples/:step", Id: "putSample", Tag: "samples",
+		Summary: "Store the train sample of a step, replacing the one before",
+		Params: []openapi.Param{{Name: "step", In: "path", Schema: openapi.Integer(1, 5)},
+			{Name: "content", In: "query", Required: true, Description: content.Description, Schema: content.Schema}},
+		Body: audio,
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity),
+			http.StatusCreated, openapi.Response{Schema: openapi.Ref("Sample")})},
+		&controllers.V2UserController{}, "PutSample"},
+
+	{openapi.Operation{Method: "delete", Path: "/v2/apps/:id/users/:uid/samples", Id: "deleteSamples", Tag: "samples",
+		Summary:   "Delete the train samples of a user",
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict), http.StatusNoContent, openapi.Response{})},
+		&controllers.V2UserController{}, "DeleteSamples"},
+
+	{openapi.Operation{Method: "post", Path: "/v2/apps/:id/users/:uid/models", Id: "trainModel", Tag: "models",
+		Summary: "Train the model of a user from its 5 samples",
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity),
+			http.StatusCreated, openapi.Response{Schema: openapi.Ref("Model")})},
+		&controllers.V2ModelController{}, "TrainModel"},
+
+	{openapi.Operation{Method: "get", Path: "/v2/apps/:id/users/:uid/models", Id: "getModel", Tag: "models",
+		Summary:   "Get the model of a user",
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound), http.StatusOK, openapi.Response{Schema: openapi.Ref("Model")})},
+		&controllers.V2ModelController{}, "GetModel"},
+
+	{openapi.Operation{Method: "delete", Path: "/v2/apps/:id/users/:uid/models", Id: "deleteModel", Tag: "models",
+		Summary:   "Delete the model of a user",
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound), http.StatusNoContent, openapi.Response{})},
+		&controllers.V2ModelController{}, "DeleteModel"},
+
+	{openapi.Operation{Method: "post", Path: "/v2/apps/:id/users/:uid/verifications", Id: "verify", Tag: "verifications",
+		Summary: "Score audio against the model of a user",
+		Params:  []openapi.Param{content},
+		Body:    audio,
+		Responses: with(with(errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity),
+			http.StatusLocked, openapi.Response{Description: "the voiceprint is locked after repeated failed verifications, see the Retry-After header", Schema: openapi.Ref("Error")}),
+			http.StatusOK, openapi.Response{Schema: openapi.Ref("Verification")})},
+		&controllers.V2ModelController{}, "Verify"},
+
+	{openapi.Operation{Method: "get", Path: "/v2/apps/:id/users/:uid/verifications", Id: "listVerifications", Tag: "verifications",
+		Summary: "List the verifications of a user retained by the retention policy of the app, the latest first",
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound), http.StatusOK, openapi.Response{Schema: openapi.Object(map[string]openapi.Schema{
+			"retaindays":    {"type": "integer", "description": "days the verification audio is retained, 0 if the app does not retain it"},
+			"verifications": openapi.Array(openapi.Ref("RetainedVerification")),
+		})})},
+		&controllers.V2ModelController{}, "ListVerifications"},
+
+	{openapi.Operation{Method: "get", Path: "/v2/apps/:id/users/:uid/verifications/:vid/audio", Id: "getVerificationAudio", Tag: "verifications",
+		Summary: "Download the retained audio of a verification",
+		Params:  []openapi.Param{verificationId},
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound), http.StatusOK, openapi.Response{
+			Description: "the audio as uploaded, of the media type sniffed from it",
+			Content: map[string]openapi.Schema{
+				"audio/*":                  {"type": "string", "format": "binary"},
+				"application/octet-stream": {"type": "string", "format": "binary"},
+			}})},
+		&controllers.V2ModelController{}, "GetVerificationAudio"},
+
+	{openapi.Operation{Method: "delete", Path: "/v2/apps/:id/users/:uid/verifications/:vid", Id: "deleteVerification", Tag: "verifications",
+		Summary:   "Delete the retained audio of a verification",
+		Params:    []openapi.Param{verificationId},
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound), http.StatusNoContent, openapi.Response{})},
+		&controllers.V2ModelController{}, "DeleteVerification"},
+
+	{openapi.Operation{Method: "get", Path: "/v2/apps/:id/users/:uid/export", Id: "exportUser", Tag: "privacy",
+		Summary: "Export everything stored about a user",
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound), http.StatusOK, openapi.Response{
+			Description: "zip archive of user.json, the samples/, model/ and retained/ audio, retained.json and audit.json",
+			Content:     map[string]openapi.Schema{"application/zip": {"type": "string", "format": "binary"}}})},
+		&controllers.V2UserController{}, "Export"},
+
+	{openapi.Operation{Method: "post", Path: "/v2/apps/:id/erasures", Id: "eraseUser", Tag: "privacy",
+		Summary: "Erase everything stored about a user, registered or not: the user, its model, samples and retained audio, " +
+			"and what identifies it in the audit trail",
+		Body: &openapi.Body{Required: true, Content: map[string]openapi.Schema{
+			"application/json": openapi.Object(map[string]openapi.Schema{"userid": userid}, "userid")}},
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusUnsupportedMediaType),
+			http.StatusCreated, openapi.Response{Schema: openapi.Ref("Erasure")})},
+		&controllers.V2ErasureController{}, "Erase"},
+
+	{openapi.Operation{Method: "get", Path: "/v2/apps/:id/erasures/:rid", Id: "getErasure", Tag: "privacy",
+		Summary: "Get and verify the receipt of an erasure",
+		Params: []openapi.Param{{Name: "rid", In: "path", Description: "id of the receipt", Schema: openapi.Schema{"type": "integer", "minimum": 1}},
+			{Name: "userid", In: "query", Description: "also check the receipt is of this user and nothing is stored about it", Schema: userid}},
+		Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound), http.StatusOK, openapi.Response{Schema: openapi.Ref("Erasure")})},
+		&controllers.V2ErasureController{}, "GetErasure"},
+}
+
+var v2Schemas = map[string]openapi.Schema{
+	"Error": openapi.Object(map[string]openapi.Schema{
+		"error": openapi.Object(map[string]openapi.Schema{
+			"status":  openapi.Schema{"type": "integer", "description": "HTTP status"},
+			"code":    openapi.Schema{"type": "integer", "description": "errCode of the v1 API"},
+			"message": openapi.String(),
+		}, "status", "code", "message"),
+	}, "error"),
+	"User": openapi.Object(map[string]openapi.Schema{
+		"userid":  userid,
+		"gender":  gender,
+		"trained": openapi.Schema{"type": "boolean"},
+		"samples": openapi.Array(openapi.Ref("Sample")),
+	}, "userid", "trained"),
+	"Sample": openapi.Object(map[string]openapi.Schema{
+		"step":    openapi.Integer(1, 5),
+		"content": openapi.String(),
+		"size":    openapi.Schema{"type": "integer", "description": "bytes of the stored audio"},
+	}, "step", "content", "size"),
+	"Model": openapi.Object(map[string]openapi.Schema{
+		"userid":  userid,
+		"trained": openapi.Schema{"type": "boolean"},
+	}, "userid", "trained"),
+	"Verification": openapi.Object(map[string]openapi.Schema{
+		"id":        openapi.Schema{"type": "integer", "description": "id of the retained audio, set if the app retains verifications"},
+		"userid":    userid,
+		"content":   openapi.String(),
+		"score":     openapi.Schema{"type": "number", "description": "log likelihood ratio of the user model over the ubm"},
+		"decision":  openapi.Schema{"type": "string", "enum": []string{"accept", "reject"}},
+		"pass":      openapi.Schema{"type": "boolean", "description": "the decision is accept"},
+		"threshold": openapi.Schema{"type": "number", "description": "threshold of the policy of the user, else of the app"},
+		"policy":    openapi.Schema{"type": "string", "enum": []string{"fixed", "gender", "far"}},
+		"percentile": openapi.Schema{"type": "number", "minimum": 0, "maximum": 1,
+			"description": "percentile rank of the score among the non-target scores of the app calibration, not a probability, omitted without calibration"},
+		"llr": openapi.Schema{"type": "number",
+			"description": "log likelihood ratio of the score calibrated by the ubm calibration, omitted without one"},
+		"posterior": openapi.Schema{"type": "number", "minimum": 0, "maximum": 1,
+			"description": "probability that the speaker is the user at the prior verify_prior, omitted without a ubm calibration"},
+		"lockeduntil": openapi.Schema{"type": "string", "format": "date-time",
+			"description": "set when this failed verification locked the voiceprint"},
+	}, "userid", "content", "score", "decision", "pass", "threshold", "policy"),
+	"RetainedVerification": openapi.Object(map[string]openapi.Schema{
+		"id":       openapi.Schema{"type": "integer"},
+		"content":  openapi.String(),
+		"score":    openapi.Schema{"type": "number"},
+		"decision": openapi.Schema{"type": "string", "enum": []string{"accept", "reject"}},
+		"size":     openapi.Schema{"type": "integer", "description": "bytes of the retained audio"},
+		"created":  openapi.Schema{"type": "string", "format": "date-time"},
+		"expires":  openapi.Schema{"type": "string", "format": "date-time", "description": "the audio is purged after it"},
+	}, "id", "content", "score", "decision", "size", "created", "expires"),
+	"Erasure": openapi.Object(map[string]openapi.Schema{
+		"id":          openapi.Schema{"type": "integer"},
+		"appid":       openapi.String(),
+		"subject":     openapi.Schema{"type": "string", "description": "hex SHA256 of appid, '#' and userid"},
+		"time":        openapi.Schema{"type": "string", "format": "date-time"},
+		"user":        openapi.Schema{"type": "boolean", "description": "the user was registered"},
+		"models":      openapi.Schema{"type": "integer", "description": "model files deleted"},
+		"samples":     openapi.Schema{"type": "integer", "description": "train samples deleted"},
+		"retained":    openapi.Schema{"type": "integer", "description": "retained verifications deleted"},
+		"auditevents": openapi.Schema{"type": "integer", "description": "audit events whose userid, ip and audio hash were erased"},
+		"auditlines":  openapi.Schema{"type": "integer", "description": "lines of the audit file erased likewise"},
+		"digest": openapi.Schema{"type": "string",
+			"description": "hex SHA256 of appid, subject, unix time, user, models, samples, retained, auditevents and auditlines joined by '|'"},
+		"audithash": openapi.Schema{"type": "string", "description": "hash of the audit event of the erasure, whose audiohash is the digest"},
+		"valid":     openapi.Schema{"type": "boolean", "description": "the receipt matches its digest and the intact audit chain, set by getErasure"},
+		"reason":    openapi.Schema{"type": "string", "description": "why the receipt is not valid"},
+		"erased":    openapi.Schema{"type": "boolean", "description": "nothing is stored about the userid of the query"},
+		"left":      openapi.Schema{"type": "string", "description": "what is stored about the userid of the query"},
+	}, "id", "appid", "subject", "time", "user", "models", "samples", "retained", "auditevents", "auditlines", "digest", "audithash"),
+	"Usage": openapi.Object(map[string]openapi.Schema{
+		"appid": openapi.String(),
+		"quota": openapi.Object(map[string]openapi.Schema{
+			"ratelimit":     {"type": "number", "description": "requests per second"},
+			"verifications": {"type": "integer", "description": "per day, 0 for no quota"},
+			"trainings":     {"type": "integer", "description": "per day, 0 for no quota"},
+			"samples":       {"type": "integer", "description": "per day, 0 for no quota"},
+		}),
+		"usage": openapi.Array(openapi.Object(map[string]openapi.Schema{
+			"day":           {"type": "string", "format": "date"},
+			"requests":      {"type": "integer", "description": "requests admitted"},
+			"verifications": openapi.Schema{"type": "integer"},
+			"trainings":     openapi.Schema{"type": "integer"},
+			"samples":       openapi.Schema{"type": "integer"},
+			"throttled":     {"type": "integer", "description": "requests rejected by the rate limits or quotas"},
+		})),
+	}, "appid", "quota", "usage"),
+}
+
+// V2Document is the OpenAPI document of the /v2 routes, served at
+// /v2/openapi.json
+func V2Document() *openapi.Document {
+	doc := &openapi.Document{
+		Info: openapi.Info{
+			Title:   "govpr",
+			Version: "2.0",
+			Description: "Text dependent speaker verification. Requests are signed with the app key: " +
+				"X-Vpr-Signature is the hex HMAC-SHA256 of METHOD, PATH, the sorted url encoded query, X-Vpr-Timestamp, " +
+				"X-Vpr-Nonce and the hex SHA256 of the body (of the file part of a multipart form), joined by newlines. " +
+				"Requests are throttled per app and per user, and verifications, trainings and samples count against daily quotas.",
+		},
+		Servers: []string{"/"},
+		Schemas: v2Schemas,
+		Security: map[string]openapi.Schema{
+			"signedRequest": {"type": "apiKey", "in": "header", "name": auth.HEADER_SIGNATURE,
+				"description": "with the " + auth.HEADER_APPID + ", " + auth.HEADER_TIMESTAMP + " and " + auth.HEADER_NONCE + " headers"},
+			"appToken": {"type": "http", "scheme": "bearer", "description": "static app token, only if the server sets auth_legacy_token"},
+		},
+	}
+
+	for _, r := range v2Routes {
+		op := r.Operation
+		op.Security = []string{"signedRequest", "appToken"}
+		doc.Operations = append(doc.Operations, op)
+	}
+	doc.Operations = append(doc.Operations, openapi.Operation{Method: "get", Path: "/v2/openapi.json", Id: "openapi", Tag: "meta",
+		Summary:   "This document",
+		Responses: map[int]openapi.Response{http.StatusOK: {Schema: openapi.Schema{"type": "object"}}}})
+	return doc
+}
+
+// kinds of the routes counted in the usage of the app
+var v2Kinds = map[string]limit.Kind{
+	"putSample":  limit.SAMPLE,
+	"trainModel": limit.TRAIN,
+	"verify":     limit.VERIFY,
+}
+
+// operations of the audited routes
+var v2Ops = map[string]string{
+	"putSample":     audit.OP_ADD_SAMPLE,
+	"trainModel":    audit.OP_TRAIN_MODEL,
+	"verify":        audit.OP_VERIFY_MODEL,
+	"deleteModel":   audit.OP_DELETE_MODEL,
+	"deleteUser":    audit.OP_DELETE_USER,
+	"deleteSamples": audit.OP_CLEAR_SAMPLES,
+
+	"deleteVerification": audit.OP_DELETE_RETAINED,
+	"exportUser":         audit.OP_EXPORT_USER,
+}
+
+func init() {
+	for _, r := range v2Routes {
+		beego.Router(r.Path, r.controller, r.Method+":"+r.handler)
+		if kind, ok := v2Kinds[r.Id]; ok {
+			limit.Count(r.Method, r.Path, kind)
+		}
+		if op, ok := v2Ops[r.Id]; ok {
+			audit.Audit(r.Method, r.Path, op)
+		}
+	}
+
+	doc := V2Document()
+	beego.Get("/v2/openapi.json", func(ctx *context.Context) {
+		ctx.Output.JSON(doc, false, false)
+	})
+}
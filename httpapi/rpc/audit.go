@@ -0,0 +1,127 @@
+package rpc
+
+import (
+	"context"
+	"net"
+
+	"github.com/liuxp0827/govpr/httpapi/audit"
+	"github.com/liuxp0827/govpr/httpapi/rpc/vprpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// operations of the audited methods, as the HTTP routes
+var ops = map[string]string{
+	vprpb.VPR_AddSample_FullMethodName:    audit.OP_ADD_SAMPLE,
+	vprpb.VPR_TrainModel_FullMethodName:   audit.OP_TRAIN_MODEL,
+	vprpb.VPR_VerifyModel_FullMethodName:  audit.OP_VERIFY_MODEL,
+	vprpb.VPR_Identify_FullMethodName:     audit.OP_IDENTIFY,
+	vprpb.VPR_DeleteModel_FullMethodName:  audit.OP_DELETE_MODEL,
+	vprpb.VPR_DeleteUser_FullMethodName:   audit.OP_DELETE_USER,
+	vprpb.VPR_ClearSamples_FullMethodName: audit.OP_CLEAR_SAMPLES,
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// replyCode is the errCode of a reply, 0 for other messages
+func replyCode(msg interface{}) int {
+	switch r := msg.(type) {
+	case *vprpb.Reply:
+		return int(r.ErrCode)
+	case *vprpb.VerifyReply:
+		return int(r.ErrCode)
+	case *vprpb.IdentifyReply:
+		return int(r.ErrCode)
+	}
+	return 0
+}
+
+// unaryAudit records the audited calls, before unaryAuth which sets the
+// app of the trail
+func (this *Server) unaryAudit(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	op, ok := ops[info.FullMethod]
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	ctx, trail := audit.NewContext(ctx, op)
+	resp, err := handler(ctx, req)
+
+	var userid string
+	if r, ok := req.(*vprpb.UserRequest); ok {
+		userid = r.Userid
+	}
+	code := 0
+	if err == nil {
+		code = replyCode(resp)
+	}
+	trail.Record(userid, peerIP(ctx), code)
+	return resp, err
+}
+
+// auditStream hashes the audio of the messages received and keeps the
+// errCode of the reply
+type auditStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	trail  *audit.Trail
+	userid string
+	code   int
+}
+
+func (s *auditStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *auditStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	switch c := m.(type) {
+	case *vprpb.SampleChunk:
+		if s.userid == "" {
+			s.userid = c.Userid
+		}
+		s.trail.Audio(c.Audio)
+	case *vprpb.VerifyChunk:
+		if s.userid == "" {
+			s.userid = c.Userid
+		}
+		s.trail.Audio(c.Audio)
+	case *vprpb.IdentifyChunk:
+		s.trail.Audio(c.Audio)
+	}
+	return nil
+}
+
+func (s *auditStream) SendMsg(m interface{}) error {
+	s.code = replyCode(m)
+	return s.ServerStream.SendMsg(m)
+}
+
+func (this *Server) streamAudit(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	op, ok := ops[info.FullMethod]
+	if !ok {
+		return handler(srv, ss)
+	}
+
+	ctx, trail := audit.NewContext(ss.Context(), op)
+	s := &auditStream{ServerStream: ss, ctx: ctx, trail: trail}
+	err := handler(srv, s)
+	if err != nil {
+		s.code = 0
+	}
+	trail.Record(s.userid, peerIP(ctx), s.code)
+	return err
+}
@@ -0,0 +1,291 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/liuxp0827/govpr/httpapi/audit"
+	"github.com/liuxp0827/govpr/httpapi/auth"
+	"github.com/liuxp0827/govpr/httpapi/limit"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/httpapi/rpc/vprpb"
+	"github.com/liuxp0827/govpr/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Calls are signed as the HTTP requests of package auth, in the lower case
+// X-Vpr-* metadata. The method is POST, the path the full gRPC method and
+// there are no params; the payload is the deterministic protobuf encoding of
+// the request of a unary call, of the first message of a stream, empty for
+// a stream closed without any. The later messages of a stream are only
+// protected by the transport, see grpc_tls_cert. The token of every message
+// is replaced by the one of the app.
+
+// payload is the signed encoding of msg
+func payload(msg interface{}) ([]byte, error) {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return nil, nil
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(m)
+}
+
+func incoming(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(strings.ToLower(key)); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// authenticate returns the app of a call signed with msg, nil for an
+// unsigned one allowed by auth.LegacyToken
+func (this *Server) authenticate(ctx context.Context, method string, msg interface{}) (*models.AppInfo, error) {
+	body, err := payload(msg)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	r := &auth.Request{
+		AppId:     incoming(ctx, auth.HEADER_APPID),
+		Timestamp: incoming(ctx, auth.HEADER_TIMESTAMP),
+		Nonce:     incoming(ctx, auth.HEADER_NONCE),
+		Signature: incoming(ctx, auth.HEADER_SIGNATURE),
+		Method:    "POST",
+		Path:      method,
+		Payload:   body,
+	}
+
+	if r.AppId == "" && auth.LegacyToken {
+		return nil, nil
+	}
+
+	app, err := this.verifier.Verify(r)
+	if err != nil {
+		log.Warnf("应用[%s]: %s 认证失败, %v", r.AppId, method, err)
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return app, nil
+}
+
+// authorize pins the token of msg to app, or for an unsigned call checks
+// that its static token is of an app not revoked. It returns the app of the
+// message, nil for the messages without a token.
+func authorize(msg interface{}, app *models.AppInfo) (*models.AppInfo, error) {
+	var token *string
+	switch m := msg.(type) {
+	case *vprpb.UserRequest:
+		token = &m.Token
+	case *vprpb.SampleChunk:
+		token = &m.Token
+	case *vprpb.VerifyChunk:
+		token = &m.Token
+	case *vprpb.IdentifyChunk:
+		token = &m.Token
+	default:
+		return nil, nil
+	}
+
+	if app != nil {
+		*token = app.Token
+		return app, nil
+	}
+
+	legacy, err := models.GetAppInfoByToken(*token)
+	if err == orm.ErrNoRows || (err == nil && legacy.KeyRevoked) {
+		return nil, status.Error(codes.Unauthenticated, "app token error")
+	}
+	return legacy, err
+}
+
+func (this *Server) unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	app, err := this.authenticate(ctx, info.FullMethod, req)
+	if err != nil {
+		return nil, err
+	}
+	if app, err = authorize(req, app); err != nil {
+		return nil, err
+	}
+	audit.FromContext(ctx).SetApp(app)
+	charge, err := this.admit(app, info.FullMethod, req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	settle(charge, replyCode(resp), err)
+	return resp, err
+}
+
+// authStream authenticates a client stream with its first message, then
+// authorizes its messages. The first one is admitted by the limiter.
+type authStream struct {
+	grpc.ServerStream
+	srv           *Server
+	method        string
+	app           *models.AppInfo
+	authenticated bool
+	admitted      bool
+	charge        *limit.Charge
+	code          int // errCode of the reply
+}
+
+func (s *authStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if !s.authenticated {
+		var msg interface{}
+		if err == nil {
+			msg = m
+		}
+		app, aerr := s.srv.authenticate(s.Context(), s.method, msg)
+		if aerr != nil {
+			return aerr
+		}
+		s.app, s.authenticated = app, true
+	}
+	if err != nil {
+		return err
+	}
+
+	app, err := authorize(m, s.app)
+	if err != nil {
+		return err
+	}
+	audit.FromContext(s.Context()).SetApp(app)
+	if !s.admitted {
+		if s.charge, err = s.srv.admit(app, s.method, m); err != nil {
+			return err
+		}
+		s.admitted = true
+	}
+	return nil
+}
+
+func (s *authStream) SendMsg(m interface{}) error {
+	s.code = replyCode(m)
+	return s.ServerStream.SendMsg(m)
+}
+
+func (this *Server) streamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	s := &authStream{ServerStream: ss, srv: this, method: info.FullMethod}
+	err := handler(srv, s)
+	settle(s.charge, s.code, err)
+	return err
+}
+
+func signed(ctx context.Context, appid, key, method string, msg interface{}) (context.Context, error) {
+	body, err := payload(msg)
+	if err != nil {
+		return nil, err
+	}
+	r := &auth.Request{Method: "POST", Path: method, Payload: body}
+	auth.SignNow(appid, key, r)
+	return metadata.AppendToOutgoingContext(ctx,
+		strings.ToLower(auth.HEADER_APPID), r.AppId,
+		strings.ToLower(auth.HEADER_TIMESTAMP), r.Timestamp,
+		strings.ToLower(auth.HEADER_NONCE), r.Nonce,
+		strings.ToLower(auth.HEADER_SIGNATURE), r.Signature), nil
+}
+
+// signedStream opens its stream at the first message sent, to sign the
+// call with it: the metadata goes out before any message.
+type signedStream struct {
+	grpc.ClientStream // nil until opened
+
+	ctx  context.Context
+	open func(msg interface{}) (grpc.ClientStream, error)
+	lock sync.Mutex
+	err  error
+}
+
+// stream opens the stream signed with msg, once
+func (s *signedStream) stream(msg interface{}) (grpc.ClientStream, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ClientStream == nil && s.err == nil {
+		s.ClientStream, s.err = s.open(msg)
+	}
+	return s.ClientStream, s.err
+}
+
+func (s *signedStream) SendMsg(m interface{}) error {
+	cs, err := s.stream(m)
+	if err != nil {
+		return err
+	}
+	return cs.SendMsg(m)
+}
+
+func (s *signedStream) RecvMsg(m interface{}) error {
+	cs, err := s.stream(nil)
+	if err != nil {
+		return err
+	}
+	return cs.RecvMsg(m)
+}
+
+func (s *signedStream) CloseSend() error {
+	cs, err := s.stream(nil)
+	if err != nil {
+		return err
+	}
+	return cs.CloseSend()
+}
+
+func (s *signedStream) Header() (metadata.MD, error) {
+	cs, err := s.stream(nil)
+	if err != nil {
+		return nil, err
+	}
+	return cs.Header()
+}
+
+func (s *signedStream) Trailer() metadata.MD {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ClientStream == nil {
+		return nil
+	}
+	return s.ClientStream.Trailer()
+}
+
+func (s *signedStream) Context() context.Context {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ClientStream == nil {
+		return s.ctx
+	}
+	return s.ClientStream.Context()
+}
+
+// Credentials returns the dial options signing every call with the key of
+// the app. A stream is opened at its first message, the one it is signed
+// with.
+func Credentials(appid, key string) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			ctx, err := signed(ctx, appid, key, method, req)
+			if err != nil {
+				return err
+			}
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &signedStream{ctx: ctx, open: func(msg interface{}) (grpc.ClientStream, error) {
+				ctx, err := signed(ctx, appid, key, method, msg)
+				if err != nil {
+					return nil, err
+				}
+				return streamer(ctx, desc, cc, method, opts...)
+			}}, nil
+		}),
+	}
+}
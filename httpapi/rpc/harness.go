@@ -0,0 +1,45 @@
+package rpc
+
+import (
+	"context"
+	"github.com/liuxp0827/govpr/httpapi/rpc/vprpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+)
+
+// Harness runs a Server in process on an in-memory listener, for driving
+// the service from tests and tools without opening a port.
+type Harness struct {
+	Client vprpb.VPRClient
+
+	server *grpc.Server
+	conn   *grpc.ClientConn
+}
+
+// NewHarness dials srv with opts, Credentials to sign the calls.
+func NewHarness(srv *Server, opts ...grpc.DialOption) (*Harness, error) {
+	lis := bufconn.Listen(MAX_MSG_SIZE)
+	server := srv.NewGRPCServer()
+	go server.Serve(lis)
+
+	opts = append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+	conn, err := grpc.NewClient("passthrough:///bufconn", opts...)
+	if err != nil {
+		server.Stop()
+		return nil, err
+	}
+
+	return &Harness{Client: vprpb.NewVPRClient(conn), server: server, conn: conn}, nil
+}
+
+func (h *Harness) Close() {
+	h.conn.Close()
+	h.server.Stop()
+}
@@ -0,0 +1,64 @@
+package rpc
+
+import (
+	"github.com/liuxp0827/govpr/httpapi/limit"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/httpapi/rpc/vprpb"
+	"github.com/liuxp0827/govpr/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// kinds of the methods counted in the usage of the app, as the HTTP routes
+var kinds = map[string]limit.Kind{
+	vprpb.VPR_AddSample_FullMethodName:   limit.SAMPLE,
+	vprpb.VPR_TrainModel_FullMethodName:  limit.TRAIN,
+	vprpb.VPR_VerifyModel_FullMethodName: limit.VERIFY,
+	vprpb.VPR_Identify_FullMethodName:    limit.VERIFY,
+}
+
+// admit throttles the call of method by app with the first message msg,
+// and returns the charge to settle once it is answered. A rejection is
+// ResourceExhausted, with the delay in an errdetails.RetryInfo.
+func (this *Server) admit(app *models.AppInfo, method string, msg interface{}) (*limit.Charge, error) {
+	if app == nil {
+		return nil, nil
+	}
+
+	var userid string
+	switch m := msg.(type) {
+	case *vprpb.UserRequest:
+		userid = m.Userid
+	case *vprpb.SampleChunk:
+		userid = m.Userid
+	case *vprpb.VerifyChunk:
+		userid = m.Userid
+	}
+
+	charge, err := this.limiter.Admit(app, userid, kinds[method])
+	if err == nil {
+		return charge, nil
+	}
+
+	r, ok := err.(*limit.Rejection)
+	if !ok {
+		log.Errorf("应用[%s]: 记录用量失败, %v", app.AppId, err)
+		return nil, status.Error(codes.Internal, "count usage failed")
+	}
+
+	st, err := status.New(codes.ResourceExhausted, r.Msg).WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(r.RetryAfter)})
+	if err != nil {
+		return nil, status.Error(codes.ResourceExhausted, r.Msg)
+	}
+	return nil, st.Err()
+}
+
+// settle refunds the charge of a call that failed with err or the errCode
+// code of its reply
+func settle(charge *limit.Charge, code int, err error) {
+	if charge != nil && (err != nil || !charge.Kind.Success(code)) {
+		charge.Refund()
+	}
+}
@@ -0,0 +1,247 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"github.com/liuxp0827/govpr/httpapi/audit"
+	"github.com/liuxp0827/govpr/httpapi/constants"
+	"github.com/liuxp0827/govpr/httpapi/engine"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/httpapi/rpc/vprpb"
+	"github.com/liuxp0827/govpr/log"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+func (this *Server) TrainModel(ctx context.Context, req *vprpb.UserRequest) (*vprpb.Reply, error) {
+	userid := req.Userid
+	if userid == "" {
+		return reply(constants.FAILED_TRAIN_MODEL, constants.ERROR_USER_ILLEGAL, "userid is illegal"), nil
+	}
+
+	unlock, err := models.LockUser(req.Token, userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 训练自适应模型失败, %v", userid, err)
+		return reply(constants.FAILED_TRAIN_MODEL, lockErrCode(err, constants.ERROR_TRAIN_MODEL_FAILED), "userid "+userid+" train model failed, "+err.Error()), nil
+	}
+	defer unlock()
+
+	usr, err := this.db.GetUserByIdForTrain(req.Token, userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 训练自适应模型失败, %v", userid, err)
+		return reply(constants.FAILED_TRAIN_MODEL, userErrCode(err), "train model failed, get userid "+userid+" failed, "+err.Error()), nil
+	}
+
+	if usr.IsTrain {
+		log.Warnf("用户账号[%s]: 训练自适应模型失败, 模型已存在", userid)
+		return reply(constants.FAILED_TRAIN_MODEL, constants.ERROR_MODEL_EXISTENT, "train model failed, the model has existed."), nil
+	}
+
+	if len(usr.Waves) < 5 {
+		log.Errorf("用户账号[%s]: 训练自适应模型失败, 训练数据不足", userid)
+		return reply(constants.FAILED_TRAIN_MODEL, constants.ERROR_SAMPLES_NOT_ENOUGH, "count of train data is not enough, count must be greater than 5."), nil
+	}
+
+	for i, wave := range usr.Waves {
+		if len(wave) <= 5000 {
+			log.Errorf("用户账号[%s]: 训练自适应模型失败, 第%d条训练数据不足", userid, i+1)
+			return reply(constants.FAILED_TRAIN_MODEL, constants.ERROR_SAMPLES_NOT_ENOUGH, fmt.Sprintf("train data[%d] is not enough.", i+1)), nil
+		}
+	}
+
+	audit.FromContext(ctx).Audio(usr.Waves...)
+	x, err := engine.NewEngine(16000, 50, this.modelFile(req.Token, userid))
+	if err == nil {
+		err = x.TrainSpeech(len(usr.Waves), usr.Waves, usr.Contents, usr.UserId, usr.Token)
+		x.DestroyEngine()
+	}
+	if err != nil {
+		log.Errorf("用户账号[%s]: 训练自适应模型失败, 训练过程有误, %v", userid, err)
+		return reply(constants.FAILED_TRAIN_MODEL, constants.ERROR_TRAIN_MODEL_FAILED, fmt.Sprintf("train userid %s model failed: %v", userid, err)), nil
+	}
+
+	if err = this.db.UpdateIsTrained(req.Token, userid, true); err != nil {
+		log.Errorf("用户账号[%s]: 训练自适应模型失败,更新数据库失败", userid)
+		return reply(constants.FAILED_TRAIN_MODEL, constants.ERROR_TRAIN_MODEL_FAILED, "update database failed, "+err.Error()), nil
+	}
+
+	log.Infof("用户账号[%s]: 训练自适应模型成功", userid)
+	return reply(constants.SUCCESS_TRAIN_MODEL, constants.SUCCESS_TRAIN_MODEL, "userid "+userid+" train model success."), nil
+}
+
+func (this *Server) DeleteModel(ctx context.Context, req *vprpb.UserRequest) (*vprpb.Reply, error) {
+	if req.Userid == "" {
+		return reply(constants.FAILED_DELETE_MODEL, constants.ERROR_USER_ILLEGAL, "userid is illegal"), nil
+	}
+
+	unlock, err := models.LockUser(req.Token, req.Userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 删除自适应模型失败, %v", req.Userid, err)
+		return reply(constants.FAILED_DELETE_MODEL, lockErrCode(err, constants.ERROR_MODEL_NONEXISTENT), "userid "+req.Userid+" delete model failed, "+err.Error()), nil
+	}
+	defer unlock()
+
+	if _, err := this.db.GetUserById(req.Token, req.Userid); err != nil {
+		log.Warnf("用户账号[%s]: 删除自适应模型失败, %v", req.Userid, err)
+		return reply(constants.FAILED_DELETE_MODEL, userErrCode(err), "get userid "+req.Userid+" failed, "+err.Error()), nil
+	}
+
+	this.db.UpdateIsTrained(req.Token, req.Userid, false)
+	if err := os.Remove(this.modelFile(req.Token, req.Userid)); err != nil && !os.IsNotExist(err) {
+		log.Errorf("用户账号[%s]: 删除模型文件失败, %v", req.Userid, err)
+	}
+	log.Infof("用户账号[%s]: 删除自适应模型成功", req.Userid)
+	return reply(constants.SUCCESS_DELETE_MODEL, constants.SUCCESS_DELETE_MODEL, "userid "+req.Userid+" delete model success."), nil
+}
+
+func verifyReply(ret, errCode int, msg string) *vprpb.VerifyReply {
+	return &vprpb.VerifyReply{Ret: int32(ret), ErrCode: int32(errCode), Msg: msg}
+}
+
+func (this *Server) VerifyModel(stream vprpb.VPR_VerifyModelServer) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return stream.SendAndClose(verifyReply(constants.FAILED_VERIFY_MODEL, constants.ERROR_SAMPLE_IS_NULL, "upload sample is null, please reupload."))
+	}
+	if err != nil {
+		return err
+	}
+
+	userid := first.Userid
+	if userid == "" {
+		return stream.SendAndClose(verifyReply(constants.FAILED_VERIFY_MODEL, constants.ERROR_USER_ILLEGAL, "userid is illegal"))
+	}
+
+	u, err := this.db.GetUserById(first.Token, userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 验证语音数据失败, %v", userid, err)
+		return stream.SendAndClose(verifyReply(constants.FAILED_VERIFY_MODEL, userErrCode(err), "get userid "+userid+" failed, "+err.Error()))
+	}
+
+	if !u.IsTrain {
+		log.Warnf("用户账号[%s]: 验证语音数据失败, 模型不存在", userid)
+		return stream.SendAndClose(verifyReply(constants.FAILED_VERIFY_MODEL, constants.ERROR_MODEL_NONEXISTENT, "model of userid "+userid+" is not exist"))
+	}
+
+	data, err := readAudio(first.Audio, func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return chunk.Audio, nil
+	})
+	if err == errAudioTooLarge {
+		return stream.SendAndClose(verifyReply(constants.FAILED_VERIFY_MODEL, constants.ERROR_SAMPLE_TOO_LARGE, err.Error()))
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		log.Errorf("用户账号[%s]: 验证语音数据失败, 语音数据为空", userid)
+		return stream.SendAndClose(verifyReply(constants.FAILED_VERIFY_MODEL, constants.ERROR_SAMPLE_IS_NULL, "upload sample is null, please reupload."))
+	}
+
+	v, err := engine.Verify(this.db, first.Token, userid, this.modelFile(first.Token, userid), data, first.Content)
+	if err == engine.ErrLocked {
+		return stream.SendAndClose(verifyReply(constants.FAILED_VERIFY_MODEL, constants.ERROR_USER_LOCKED,
+			"userid "+userid+" is locked after repeated failed verifications until "+v.LockedUntil.Format(time.RFC3339)))
+	}
+	if err != nil {
+		return stream.SendAndClose(verifyReply(constants.FAILED_VERIFY_MODEL, lockErrCode(err, constants.ERROR_VERIFY_MODEL_FAILED), fmt.Sprintf("verify userid %s failed: %v", userid, err)))
+	}
+
+	d := v.Decision
+	audit.FromContext(stream.Context()).Decide(v.Score, d.Result())
+	r := verifyReply(constants.SUCCESS_VERIFY_MODEL, constants.SUCCESS_VERIFY_MODEL, "verify userid "+userid+" success.")
+	r.Score = v.Score
+	if v.Calibrated {
+		r.Llr, r.Posterior = &v.LLR, &v.Posterior
+	}
+	r.Msg += fmt.Sprintf(" %s at threshold %g of the %s policy.", d.Result(), d.Threshold, d.Policy)
+	if !v.LockedUntil.IsZero() {
+		r.Msg += " userid is locked after repeated failed verifications until " + v.LockedUntil.Format(time.RFC3339)
+	}
+	if v.Retained != nil {
+		r.Msg += fmt.Sprintf(" audio retained as verification %d.", v.Retained.Id)
+	}
+	return stream.SendAndClose(r)
+}
+
+func identifyReply(ret, errCode int, msg string) *vprpb.IdentifyReply {
+	return &vprpb.IdentifyReply{Ret: int32(ret), ErrCode: int32(errCode), Msg: msg}
+}
+
+// Identify scores the audio against the model of every trained user of the
+// app of the token, the candidates are sorted by score.
+func (this *Server) Identify(stream vprpb.VPR_IdentifyServer) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return stream.SendAndClose(identifyReply(constants.FAILED_IDENTIFY, constants.ERROR_SAMPLE_IS_NULL, "upload sample is null, please reupload."))
+	}
+	if err != nil {
+		return err
+	}
+
+	users, err := this.db.GetTrainedUsers(first.Token)
+	if err != nil {
+		log.Warnf("辨认失败, 没有应用权限: %v", err)
+		return stream.SendAndClose(identifyReply(constants.FAILED_IDENTIFY, constants.ERROR_APP_TOKEN, "app token error"))
+	}
+
+	if len(users) == 0 {
+		return stream.SendAndClose(identifyReply(constants.FAILED_IDENTIFY, constants.ERROR_MODEL_NONEXISTENT, "no user of the app has a model"))
+	}
+
+	data, err := readAudio(first.Audio, func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return chunk.Audio, nil
+	})
+	if err == errAudioTooLarge {
+		return stream.SendAndClose(identifyReply(constants.FAILED_IDENTIFY, constants.ERROR_SAMPLE_TOO_LARGE, err.Error()))
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		return stream.SendAndClose(identifyReply(constants.FAILED_IDENTIFY, constants.ERROR_SAMPLE_IS_NULL, "upload sample is null, please reupload."))
+	}
+
+	files := make([]string, len(users))
+	for i, u := range users {
+		files[i] = this.modelFile(first.Token, u.UserId)
+	}
+
+	x, err := engine.NewEngine(16000, 50, "")
+	var scores []float64
+	if err == nil {
+		scores, err = x.IdentifySpeech(data, files)
+		x.DestroyEngine()
+	}
+	if err != nil {
+		log.Errorf("辨认失败, 辨认过程有误, %v", err)
+		return stream.SendAndClose(identifyReply(constants.FAILED_IDENTIFY, constants.ERROR_IDENTIFY_FAILED, fmt.Sprintf("identify failed: %v", err)))
+	}
+
+	candidates := make([]*vprpb.Candidate, len(users))
+	for i, u := range users {
+		candidates[i] = &vprpb.Candidate{Userid: u.UserId, Score: scores[i]}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	if first.Top > 0 && int(first.Top) < len(candidates) {
+		candidates = candidates[:first.Top]
+	}
+
+	log.Infof("辨认成功, 候选用户%d个, 最佳用户[%s] 得分: %f", len(users), candidates[0].Userid, candidates[0].Score)
+	r := identifyReply(constants.SUCCESS_IDENTIFY, constants.SUCCESS_IDENTIFY, "identify success.")
+	r.Candidates = candidates
+	return stream.SendAndClose(r)
+}
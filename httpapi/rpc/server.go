@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"fmt"
+	"github.com/liuxp0827/govpr/httpapi/auth"
+	"github.com/liuxp0827/govpr/httpapi/limit"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/httpapi/rpc/vprpb"
+	"github.com/liuxp0827/govpr/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"io"
+	"net"
+)
+
+// largest audio accepted over one stream, in bytes
+const MAX_AUDIO_SIZE = 32 << 20
+
+// largest single message, a stream may carry any number of them
+const MAX_MSG_SIZE = 4 << 20
+
+// Server implements vprpb.VPRServer on the same models.DBEngine and
+// engine package as the beego controllers, so users, samples and models
+// are shared by both APIs.
+type Server struct {
+	vprpb.UnimplementedVPRServer
+
+	db       *models.DBEngine
+	modelDir string
+	verifier *auth.Verifier
+	limiter  *limit.Limiter
+}
+
+// NewServer returns a server keeping the user models under modelDir, the
+// "model_dir" of app.conf. Calls are authenticated, throttled and audited
+// as the HTTP routes.
+func NewServer(db *models.DBEngine, modelDir string) *Server {
+	return &Server{db: db, modelDir: modelDir, verifier: auth.DefaultVerifier, limiter: limit.DefaultLimiter}
+}
+
+// NewGRPCServer returns a grpc.Server with this service registered.
+func (this *Server) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append([]grpc.ServerOption{
+		grpc.MaxRecvMsgSize(MAX_MSG_SIZE),
+		grpc.ChainUnaryInterceptor(this.unaryAudit, this.unaryAuth),
+		grpc.ChainStreamInterceptor(this.streamAudit, this.streamAuth),
+	}, opts...)
+	s := grpc.NewServer(opts...)
+	vprpb.RegisterVPRServer(s, this)
+	return s
+}
+
+// ListenAndServe serves the service on the tcp address addr, over TLS if
+// certFile and keyFile are set. Only the first message of a stream is
+// signed, TLS also protects the others.
+func (this *Server) ListenAndServe(addr, certFile, keyFile string) error {
+	var opts []grpc.ServerOption
+	if certFile != "" || keyFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	} else {
+		log.Warnf("gRPC server on %s without TLS, the messages after the first of a stream are not protected", addr)
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("gRPC server listen on %s", addr)
+	return this.NewGRPCServer(opts...).Serve(lis)
+}
+
+func (this *Server) modelFile(token, userid string) string {
+	return this.modelDir + token + "_" + userid + "/" + userid + ".dat"
+}
+
+func reply(ret, errCode int, msg string) *vprpb.Reply {
+	return &vprpb.Reply{Ret: int32(ret), ErrCode: int32(errCode), Msg: msg}
+}
+
+var errAudioTooLarge = fmt.Errorf("audio larger than %d bytes", MAX_AUDIO_SIZE)
+
+// readAudio appends the audio of the remaining messages of a client
+// stream to first, next returns io.EOF after the last message.
+func readAudio(first []byte, next func() ([]byte, error)) ([]byte, error) {
+	data := append([]byte(nil), first...)
+	for {
+		audio, err := next()
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data)+len(audio) > MAX_AUDIO_SIZE {
+			return nil, errAudioTooLarge
+		}
+		data = append(data, audio...)
+	}
+}
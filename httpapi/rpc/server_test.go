@@ -0,0 +1,302 @@
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/liuxp0827/govpr/httpapi/constants"
+	"github.com/liuxp0827/govpr/httpapi/limit"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/httpapi/rpc/vprpb"
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// the app the tests call as
+var testApp *models.AppInfo
+
+// TestMain runs the tests in a scratch directory with a sqlite database,
+// the ubm of the repository and the example recordings
+func TestMain(m *testing.M) {
+	repo, err := filepath.Abs("../..")
+	if err != nil {
+		panic(err)
+	}
+	dir, err := ioutil.TempDir("", "govpr-rpc")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	os.MkdirAll("vpr", 0755)
+	if err = os.Symlink(filepath.Join(repo, "ubm", "ubm"), "vpr/ubm"); err != nil {
+		panic(err)
+	}
+	os.Symlink(filepath.Join(repo, "example", "wav"), "wav")
+
+	orm.RegisterDriver("sqlite3", orm.DRSqlite)
+	if err = orm.RegisterDataBase("default", "sqlite3", filepath.Join(dir, "db.sqlite")+"?_busy_timeout=10000"); err != nil {
+		panic(err)
+	}
+	if err = orm.RunSyncdb("default", false, false); err != nil {
+		panic(err)
+	}
+	models.InitUserCache(10)
+	limit.UserRate, limit.AppRate = 0, 0
+
+	db := models.NewDBEngine()
+	if err = db.AddDeveloper("dev", "password1", "dev@example.com"); err != nil {
+		panic(err)
+	}
+	if err = db.AddAppInfo("dev", "app"); err != nil {
+		panic(err)
+	}
+	if testApp, err = db.GetAppInfoByName("dev", "app"); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func newTestHarness(t *testing.T, appid, key string) *Harness {
+	h, err := NewHarness(NewServer(models.NewDBEngine(), "mod/"), Credentials(appid, key)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+	return h
+}
+
+func readWav(t *testing.T, name string) []byte {
+	b, err := ioutil.ReadFile(filepath.Join("wav", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// addSample streams the audio of a sample in chunks of 16 KiB
+func addSample(t *testing.T, h *Harness, userid, content string, step int, audio []byte) *vprpb.Reply {
+	stream, err := h.Client.AddSample(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := &vprpb.SampleChunk{Userid: userid, Content: content, Step: int32(step)}
+	for len(audio) > 0 {
+		n := 16 << 10
+		if n > len(audio) {
+			n = len(audio)
+		}
+		chunk.Audio, audio = audio[:n], audio[n:]
+		if err = stream.Send(chunk); err != nil {
+			t.Fatal(err)
+		}
+		chunk = &vprpb.SampleChunk{}
+	}
+	r, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func verify(t *testing.T, h *Harness, userid, content string, audio []byte) *vprpb.VerifyReply {
+	stream, err := h.Client.VerifyModel(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.Send(&vprpb.VerifyChunk{Userid: userid, Content: content, Audio: audio}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestUnauthenticated(t *testing.T) {
+	h, err := NewHarness(NewServer(models.NewDBEngine(), "mod/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	_, err = h.Client.RegisterUser(context.Background(), &vprpb.UserRequest{Token: testApp.Token, Userid: "bob"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("unsigned call: %v, want Unauthenticated", err)
+	}
+
+	wrong := newTestHarness(t, testApp.AppId, "wrong key")
+	_, err = wrong.Client.RegisterUser(context.Background(), &vprpb.UserRequest{Userid: "bob"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("call signed with a wrong key: %v, want Unauthenticated", err)
+	}
+
+	// the messages are changed once signed
+	opts := append(Credentials(testApp.AppId, testApp.Key),
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			req.(*vprpb.UserRequest).Userid = "mallory"
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			cs, err := streamer(ctx, desc, cc, method, opts...)
+			return &tamperedStream{cs}, err
+		}))
+	tampered, err := NewHarness(NewServer(models.NewDBEngine(), "mod/"), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tampered.Close()
+
+	_, err = tampered.Client.RegisterUser(context.Background(), &vprpb.UserRequest{Userid: "bob"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("call changed after its signature: %v, want Unauthenticated", err)
+	}
+	stream, err := tampered.Client.VerifyModel(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.Send(&vprpb.VerifyChunk{Userid: "bob", Audio: []byte("audio")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stream.CloseAndRecv(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("stream changed after its signature: %v, want Unauthenticated", err)
+	}
+}
+
+// tamperedStream changes the user of the messages it sends
+type tamperedStream struct {
+	grpc.ClientStream
+}
+
+func (s *tamperedStream) SendMsg(m interface{}) error {
+	if c, ok := m.(*vprpb.VerifyChunk); ok {
+		c.Userid = "mallory"
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func TestRegisterUser(t *testing.T) {
+	h := newTestHarness(t, testApp.AppId, testApp.Key)
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		userid string
+		code   int
+	}{
+		{"carol", constants.SUCCESS_REGISTER_USER},
+		{"carol", constants.ERROR_USER_EXISTENT},
+		{"../../vpr", constants.ERROR_USER_ILLEGAL},
+	} {
+		r, err := h.Client.RegisterUser(ctx, &vprpb.UserRequest{Userid: c.userid})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(r.ErrCode) != c.code {
+			t.Errorf("RegisterUser(%q) = %d %s, want %d", c.userid, r.ErrCode, r.Msg, c.code)
+		}
+	}
+
+	r, err := h.Client.DeleteUser(ctx, &vprpb.UserRequest{Userid: "carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ErrCode != constants.SUCCESS_DELETE_USER {
+		t.Errorf("DeleteUser = %d %s, want %d", r.ErrCode, r.Msg, constants.SUCCESS_DELETE_USER)
+	}
+}
+
+func TestEnrolAndVerify(t *testing.T) {
+	if testing.Short() {
+		t.Skip("trains a model")
+	}
+	h := newTestHarness(t, testApp.AppId, testApp.Key)
+	ctx := context.Background()
+
+	r, err := h.Client.RegisterUser(ctx, &vprpb.UserRequest{Userid: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ErrCode != constants.SUCCESS_REGISTER_USER {
+		t.Fatalf("RegisterUser = %d %s", r.ErrCode, r.Msg)
+	}
+
+	for i, name := range []string{"01_32468975", "02_58769423", "03_59682734", "04_64958273", "05_65432978"} {
+		r = addSample(t, h, "alice", name[3:], i+1, readWav(t, "train/"+name+".wav"))
+		if r.ErrCode != constants.SUCCESS_ADDSAMPLE {
+			t.Fatalf("AddSample step %d = %d %s", i+1, r.ErrCode, r.Msg)
+		}
+	}
+
+	if r, err = h.Client.TrainModel(ctx, &vprpb.UserRequest{Userid: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if r.ErrCode != constants.SUCCESS_TRAIN_MODEL {
+		t.Fatalf("TrainModel = %d %s", r.ErrCode, r.Msg)
+	}
+
+	self := verify(t, h, "alice", "34986527", readWav(t, "verify/self_34986527.wav"))
+	if self.ErrCode != constants.SUCCESS_VERIFY_MODEL {
+		t.Fatalf("VerifyModel of the speaker = %d %s", self.ErrCode, self.Msg)
+	}
+	other := verify(t, h, "alice", "38974652", readWav(t, "verify/other_38974652.wav"))
+	if other.ErrCode != constants.SUCCESS_VERIFY_MODEL {
+		t.Fatalf("VerifyModel of another speaker = %d %s", other.ErrCode, other.Msg)
+	}
+	if self.Score <= other.Score {
+		t.Errorf("the speaker scores %g, another speaker %g", self.Score, other.Score)
+	}
+
+	v := verify(t, h, "nobody", "34986527", readWav(t, "verify/self_34986527.wav"))
+	if v.ErrCode != constants.ERROR_USER_NONEXISTENT {
+		t.Errorf("VerifyModel of an unknown user = %d %s, want %d", v.ErrCode, v.Msg, constants.ERROR_USER_NONEXISTENT)
+	}
+}
+
+// verifications returns the verifications of the test app today
+func verifications(t *testing.T) int64 {
+	today := models.Today(time.Now())
+	usage, err := models.GetUsage(testApp.AppId, today, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) == 0 {
+		return 0
+	}
+	return usage[0].Verifications
+}
+
+func TestQuotaRefund(t *testing.T) {
+	h := newTestHarness(t, testApp.AppId, testApp.Key)
+	used := verifications(t)
+	o := orm.NewOrm()
+	if _, err := o.QueryTable("app_info").Filter("app_id", testApp.AppId).Update(orm.Params{"daily_verify_quota": used + 1}); err != nil {
+		t.Fatal(err)
+	}
+	defer o.QueryTable("app_info").Filter("app_id", testApp.AppId).Update(orm.Params{"daily_verify_quota": 0})
+
+	// the failed verifications leave the last verification of the quota to
+	// the next
+	for i := 0; i < 3; i++ {
+		r := verify(t, h, "nobody", "", []byte("audio"))
+		if r.ErrCode == constants.SUCCESS_VERIFY_MODEL {
+			t.Fatalf("verification of an unknown user = %d %s", r.ErrCode, r.Msg)
+		}
+	}
+	if n := verifications(t); n != used {
+		t.Errorf("%d verifications after failed ones, want %d", n, used)
+	}
+}
@@ -0,0 +1,215 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"github.com/liuxp0827/govpr/httpapi/constants"
+	"github.com/liuxp0827/govpr/httpapi/models"
+	"github.com/liuxp0827/govpr/httpapi/rpc/vprpb"
+	"github.com/liuxp0827/govpr/log"
+	"io"
+)
+
+// userErrCode is the error code of a failed DBEngine user lookup, which
+// reports a bad app token as the error "token"
+func userErrCode(err error) int {
+	if err.Error() == "token" {
+		return constants.ERROR_APP_TOKEN
+	}
+	return constants.ERROR_USER_NONEXISTENT
+}
+
+// lockErrCode is the error code of a failed models.LockUser, code unless
+// another request held the user
+func lockErrCode(err error, code int) int {
+	if err == models.ErrUserBusy {
+		return constants.ERROR_USER_BUSY
+	}
+	return code
+}
+
+func (this *Server) RegisterUser(ctx context.Context, req *vprpb.UserRequest) (*vprpb.Reply, error) {
+	if !models.ValidUserId(req.Userid) {
+		return reply(constants.FAILED_REGISTER_USER, constants.ERROR_USER_ILLEGAL, "userid must be 1 to 32 letters, digits or '_.@-'"), nil
+	}
+
+	if err := this.db.AddUser(req.Token, req.Userid, ""); err != nil {
+		if err.Error() == "token" {
+			log.Warnf("用户账号[%s]: 添加用户失败, 没有应用权限", req.Userid)
+			return reply(constants.FAILED_REGISTER_USER, constants.ERROR_APP_TOKEN, "app token error"), nil
+		}
+		log.Warnf("用户账号[%s]: 添加用户失败, 用户已存在", req.Userid)
+		return reply(constants.FAILED_REGISTER_USER, constants.ERROR_USER_EXISTENT, "register userid "+req.Userid+" failed, "+err.Error()), nil
+	}
+
+	log.Infof("用户账号[%s]: 添加用户成功", req.Userid)
+	return reply(constants.SUCCESS_REGISTER_USER, constants.SUCCESS_REGISTER_USER, "register userid "+req.Userid+" success"), nil
+}
+
+func (this *Server) DeleteUser(ctx context.Context, req *vprpb.UserRequest) (*vprpb.Reply, error) {
+	if req.Userid == "" {
+		return reply(constants.FAILED_DELETE_USER, constants.ERROR_USER_ILLEGAL, "userid is illegal"), nil
+	}
+
+	unlock, err := models.LockUser(req.Token, req.Userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 删除用户失败, %v", req.Userid, err)
+		return reply(constants.FAILED_DELETE_USER, lockErrCode(err, constants.ERROR_USER_NONEXISTENT), "delete userid "+req.Userid+" failed, "+err.Error()), nil
+	}
+	defer unlock()
+
+	if err := this.db.DeleteUser(req.Token, req.Userid); err != nil {
+		log.Warnf("用户账号[%s]: 删除用户失败, %v", req.Userid, err)
+		return reply(constants.FAILED_DELETE_USER, userErrCode(err), "delete userid "+req.Userid+" failed, "+err.Error()), nil
+	}
+
+	log.Infof("用户账号[%s]: 删除用户成功", req.Userid)
+	return reply(constants.SUCCESS_DELETE_USER, constants.SUCCESS_DELETE_USER, "delete userid "+req.Userid+" success"), nil
+}
+
+// DetectRegister registers unknown users, as the /detectregister route.
+func (this *Server) DetectRegister(ctx context.Context, req *vprpb.UserRequest) (*vprpb.Reply, error) {
+	if !models.ValidUserId(req.Userid) {
+		return reply(constants.FAILED_DETECT_REGISTER, constants.ERROR_USER_ILLEGAL, "userid must be 1 to 32 letters, digits or '_.@-'"), nil
+	}
+
+	u, err := this.db.GetUserById(req.Token, req.Userid)
+	if err != nil {
+		if err.Error() == "token" {
+			log.Warnf("用户账号[%s]: 登记检测失败, 没有应用权限", req.Userid)
+			return reply(constants.FAILED_DETECT_REGISTER, constants.ERROR_APP_TOKEN, "app token error"), nil
+		}
+
+		if err = this.db.AddUser(req.Token, req.Userid, ""); err != nil {
+			log.Warnf("用户账号[%s]: 添加用户失败, %v", req.Userid, err)
+			return reply(constants.FAILED_REGISTER_USER, userErrCode(err), "register userid "+req.Userid+" failed, "+err.Error()), nil
+		}
+
+		log.Infof("用户账号[%s]: 添加用户成功", req.Userid)
+		return reply(constants.SUCCESS_DETECT_REGISTER, constants.SUCCESS_REGISTER_USER, "register userid "+req.Userid+" success"), nil
+	}
+
+	if u.IsTrain {
+		log.Warnf("用户账号[%s]: 登记检测失败, 模型已训练", req.Userid)
+		return reply(constants.FAILED_DETECT_REGISTER, constants.ERROR_MODEL_EXISTENT, "detect register userid "+req.Userid+" failed, model is exist"), nil
+	}
+
+	log.Infof("用户账号[%s]: 登记检测通过", req.Userid)
+	return reply(constants.SUCCESS_DETECT_REGISTER, constants.SUCCESS_DETECT_REGISTER, "detect register userid "+req.Userid+" success"), nil
+}
+
+func (this *Server) DetectQuery(ctx context.Context, req *vprpb.UserRequest) (*vprpb.Reply, error) {
+	if req.Userid == "" {
+		return reply(constants.FAILED_DETECT_QUERY, constants.ERROR_USER_ILLEGAL, "userid is illegal"), nil
+	}
+
+	u, err := this.db.GetUserById(req.Token, req.Userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 验证检测失败, %v", req.Userid, err)
+		return reply(constants.FAILED_DETECT_QUERY, userErrCode(err), "detect verify userid "+req.Userid+" failed, "+err.Error()), nil
+	}
+
+	if !u.IsTrain {
+		log.Warnf("用户账号[%s]: 验证检测失败, 模型不存在", req.Userid)
+		return reply(constants.FAILED_DETECT_QUERY, constants.ERROR_MODEL_NONEXISTENT, "detect verify userid "+req.Userid+" failed, model is not exist"), nil
+	}
+
+	log.Infof("用户账号[%s]: 验证检测通过", req.Userid)
+	return reply(constants.SUCCESS_DETECT_QUERY, constants.SUCCESS_DETECT_QUERY, "detect verify userid "+req.Userid+" success"), nil
+}
+
+func (this *Server) AddSample(stream vprpb.VPR_AddSampleServer) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return stream.SendAndClose(reply(constants.FAILED_ADDSAMPLE, constants.ERROR_SAMPLE_IS_NULL, "upload sample is null, please reupload."))
+	}
+	if err != nil {
+		return err
+	}
+
+	userid, step := first.Userid, int(first.Step)
+	if userid == "" {
+		return stream.SendAndClose(reply(constants.FAILED_ADDSAMPLE, constants.ERROR_USER_ILLEGAL, "userid is illegal"))
+	}
+
+	if step > 5 || step < 1 {
+		return stream.SendAndClose(reply(constants.FAILED_ADDSAMPLE, constants.ERROR_URL_PARAM_ILLEGAL, "step must between 1 and 5"))
+	}
+
+	unlock, err := models.LockUser(first.Token, userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 添加语音数据失败, %v", userid, err)
+		return stream.SendAndClose(reply(constants.FAILED_ADDSAMPLE, lockErrCode(err, constants.ERROR_ADDSAMPLE_FAILED), "userid "+userid+" add sample failed, "+err.Error()))
+	}
+	defer unlock()
+
+	u, err := this.db.GetUserById(first.Token, userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 添加语音数据失败, %v", userid, err)
+		return stream.SendAndClose(reply(constants.FAILED_ADDSAMPLE, userErrCode(err), "get userid "+userid+" failed, "+err.Error()))
+	}
+
+	if u.IsTrain {
+		log.Warnf("用户账号[%s]: 添加语音数据失败, 模型已存在", userid)
+		return stream.SendAndClose(reply(constants.FAILED_ADDSAMPLE, constants.ERROR_MODEL_EXISTENT, "the model of userid "+userid+" is existed."))
+	}
+
+	data, err := readAudio(first.Audio, func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return chunk.Audio, nil
+	})
+	if err == errAudioTooLarge {
+		return stream.SendAndClose(reply(constants.FAILED_ADDSAMPLE, constants.ERROR_SAMPLE_TOO_LARGE, err.Error()))
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(data) <= 10000 {
+		log.Errorf("用户账号[%s]: 添加语音数据失败, 语音数据为空", userid)
+		return stream.SendAndClose(reply(constants.FAILED_ADDSAMPLE, constants.ERROR_SAMPLE_IS_NULL, "upload sample is null, please reupload."))
+	}
+
+	if err = this.db.AddWavesAndContents(first.Token, userid, data, first.Content, step); err != nil {
+		if err.Error() == "token" {
+			return stream.SendAndClose(reply(constants.FAILED_ADDSAMPLE, constants.ERROR_APP_TOKEN, "app token error"))
+		}
+		log.Errorf("用户账号[%s]: 添加语音数据失败, 添加语音数据到数据库有误", userid)
+		return stream.SendAndClose(reply(constants.FAILED_ADDSAMPLE, constants.ERROR_ADDSAMPLE_FAILED, "userid "+userid+" add sample failed, "+err.Error()))
+	}
+
+	log.Infof("用户账号[%s]: 训练文本内容: %s, 当前训练步骤: %d, 添加语音数据成功, 语音长度为: %d", userid, first.Content, step, len(data))
+	return stream.SendAndClose(reply(constants.SUCCESS_ADDSAMPLE, constants.SUCCESS_ADDSAMPLE, fmt.Sprintf("step %d: wav upload success", step)))
+}
+
+func (this *Server) ClearSamples(ctx context.Context, req *vprpb.UserRequest) (*vprpb.Reply, error) {
+	if req.Userid == "" {
+		return reply(constants.FAILED_CLEAR_SAMPLES, constants.ERROR_USER_ILLEGAL, "userid is illegal"), nil
+	}
+
+	unlock, err := models.LockUser(req.Token, req.Userid)
+	if err != nil {
+		log.Warnf("用户账号[%s]: 删除用户语音数据失败, %v", req.Userid, err)
+		return reply(constants.FAILED_CLEAR_SAMPLES, lockErrCode(err, constants.ERROR_CLEAR_SAMPLES_FAILED), "userid "+req.Userid+" clear samples failed, "+err.Error()), nil
+	}
+	defer unlock()
+
+	if _, err := this.db.GetUserById(req.Token, req.Userid); err != nil {
+		log.Warnf("用户账号[%s]: 删除用户语音数据失败, %v", req.Userid, err)
+		return reply(constants.FAILED_CLEAR_SAMPLES, userErrCode(err), "get userid "+req.Userid+" failed"), nil
+	}
+
+	if err := this.db.ClearWavesAndContents(req.Token, req.Userid); err != nil {
+		if err.Error() == "token" {
+			return reply(constants.FAILED_CLEAR_SAMPLES, constants.ERROR_APP_TOKEN, "app token error"), nil
+		}
+		log.Errorf("用户账号[%s]: 删除用户语音数据失败, 删除语音数据有误", req.Userid)
+		return reply(constants.FAILED_CLEAR_SAMPLES, constants.ERROR_CLEAR_SAMPLES_FAILED, "clear userid "+req.Userid+" waves and contents failed"), nil
+	}
+
+	log.Infof("用户账号[%s]: 删除用户语音数据成功", req.Userid)
+	return reply(constants.SUCCESS_CLEAR_SAMPLES, constants.SUCCESS_CLEAR_SAMPLES, "clear userid "+req.Userid+" success"), nil
+}
@@ -0,0 +1,5 @@
+// Package vprpb holds the protobuf messages and the gRPC service of
+// vpr.proto.
+package vprpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative vpr.proto
@@ -0,0 +1,687 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: vpr.proto
+
+package vprpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type UserRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Userid        string                 `protobuf:"bytes,2,opt,name=userid,proto3" json:"userid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserRequest) Reset() {
+	*x = UserRequest{}
+	mi := &file_vpr_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserRequest) ProtoMessage() {}
+
+func (x *UserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_vpr_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserRequest.ProtoReflect.Descriptor instead.
+func (*UserRequest) Descriptor() ([]byte, []int) {
+	return file_vpr_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *UserRequest) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *UserRequest) GetUserid() string {
+	if x != nil {
+		return x.Userid
+	}
+	return ""
+}
+
+type Reply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ret           int32                  `protobuf:"varint,1,opt,name=ret,proto3" json:"ret,omitempty"`
+	ErrCode       int32                  `protobuf:"varint,2,opt,name=err_code,json=errCode,proto3" json:"err_code,omitempty"`
+	Msg           string                 `protobuf:"bytes,3,opt,name=msg,proto3" json:"msg,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Reply) Reset() {
+	*x = Reply{}
+	mi := &file_vpr_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Reply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Reply) ProtoMessage() {}
+
+func (x *Reply) ProtoReflect() protoreflect.Message {
+	mi := &file_vpr_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Reply.ProtoReflect.Descriptor instead.
+func (*Reply) Descriptor() ([]byte, []int) {
+	return file_vpr_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Reply) GetRet() int32 {
+	if x != nil {
+		return x.Ret
+	}
+	return 0
+}
+
+func (x *Reply) GetErrCode() int32 {
+	if x != nil {
+		return x.ErrCode
+	}
+	return 0
+}
+
+func (x *Reply) GetMsg() string {
+	if x != nil {
+		return x.Msg
+	}
+	return ""
+}
+
+// Only the first message of a stream needs the fields other than audio,
+// they are ignored in the later messages. The audio is in any format of
+// waveIO.Decode or raw 16 bit PCM.
+type SampleChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Userid        string                 `protobuf:"bytes,2,opt,name=userid,proto3" json:"userid,omitempty"`
+	Content       string                 `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`
+	Step          int32                  `protobuf:"varint,4,opt,name=step,proto3" json:"step,omitempty"` // 1 to 5
+	Audio         []byte                 `protobuf:"bytes,5,opt,name=audio,proto3" json:"audio,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SampleChunk) Reset() {
+	*x = SampleChunk{}
+	mi := &file_vpr_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SampleChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SampleChunk) ProtoMessage() {}
+
+func (x *SampleChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_vpr_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SampleChunk.ProtoReflect.Descriptor instead.
+func (*SampleChunk) Descriptor() ([]byte, []int) {
+	return file_vpr_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SampleChunk) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *SampleChunk) GetUserid() string {
+	if x != nil {
+		return x.Userid
+	}
+	return ""
+}
+
+func (x *SampleChunk) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *SampleChunk) GetStep() int32 {
+	if x != nil {
+		return x.Step
+	}
+	return 0
+}
+
+func (x *SampleChunk) GetAudio() []byte {
+	if x != nil {
+		return x.Audio
+	}
+	return nil
+}
+
+// See SampleChunk.
+type VerifyChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Userid        string                 `protobuf:"bytes,2,opt,name=userid,proto3" json:"userid,omitempty"`
+	Content       string                 `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`
+	Audio         []byte                 `protobuf:"bytes,4,opt,name=audio,proto3" json:"audio,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VerifyChunk) Reset() {
+	*x = VerifyChunk{}
+	mi := &file_vpr_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyChunk) ProtoMessage() {}
+
+func (x *VerifyChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_vpr_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyChunk.ProtoReflect.Descriptor instead.
+func (*VerifyChunk) Descriptor() ([]byte, []int) {
+	return file_vpr_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *VerifyChunk) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *VerifyChunk) GetUserid() string {
+	if x != nil {
+		return x.Userid
+	}
+	return ""
+}
+
+func (x *VerifyChunk) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *VerifyChunk) GetAudio() []byte {
+	if x != nil {
+		return x.Audio
+	}
+	return nil
+}
+
+type VerifyReply struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Ret     int32                  `protobuf:"varint,1,opt,name=ret,proto3" json:"ret,omitempty"`
+	ErrCode int32                  `protobuf:"varint,2,opt,name=err_code,json=errCode,proto3" json:"err_code,omitempty"`
+	Msg     string                 `protobuf:"bytes,3,opt,name=msg,proto3" json:"msg,omitempty"`
+	Score   float64                `protobuf:"fixed64,4,opt,name=score,proto3" json:"score,omitempty"`
+	// calibrated log-likelihood ratio of the score and posterior probability
+	// of the user at verify_prior, unset if the ubm has no calibration
+	Llr           *float64 `protobuf:"fixed64,5,opt,name=llr,proto3,oneof" json:"llr,omitempty"`
+	Posterior     *float64 `protobuf:"fixed64,6,opt,name=posterior,proto3,oneof" json:"posterior,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VerifyReply) Reset() {
+	*x = VerifyReply{}
+	mi := &file_vpr_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyReply) ProtoMessage() {}
+
+func (x *VerifyReply) ProtoReflect() protoreflect.Message {
+	mi := &file_vpr_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyReply.ProtoReflect.Descriptor instead.
+func (*VerifyReply) Descriptor() ([]byte, []int) {
+	return file_vpr_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *VerifyReply) GetRet() int32 {
+	if x != nil {
+		return x.Ret
+	}
+	return 0
+}
+
+func (x *VerifyReply) GetErrCode() int32 {
+	if x != nil {
+		return x.ErrCode
+	}
+	return 0
+}
+
+func (x *VerifyReply) GetMsg() string {
+	if x != nil {
+		return x.Msg
+	}
+	return ""
+}
+
+func (x *VerifyReply) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *VerifyReply) GetLlr() float64 {
+	if x != nil && x.Llr != nil {
+		return *x.Llr
+	}
+	return 0
+}
+
+func (x *VerifyReply) GetPosterior() float64 {
+	if x != nil && x.Posterior != nil {
+		return *x.Posterior
+	}
+	return 0
+}
+
+// See SampleChunk.
+type IdentifyChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Top           int32                  `protobuf:"varint,2,opt,name=top,proto3" json:"top,omitempty"` // number of candidates to return, 0 returns all
+	Audio         []byte                 `protobuf:"bytes,3,opt,name=audio,proto3" json:"audio,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IdentifyChunk) Reset() {
+	*x = IdentifyChunk{}
+	mi := &file_vpr_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IdentifyChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IdentifyChunk) ProtoMessage() {}
+
+func (x *IdentifyChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_vpr_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IdentifyChunk.ProtoReflect.Descriptor instead.
+func (*IdentifyChunk) Descriptor() ([]byte, []int) {
+	return file_vpr_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *IdentifyChunk) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *IdentifyChunk) GetTop() int32 {
+	if x != nil {
+		return x.Top
+	}
+	return 0
+}
+
+func (x *IdentifyChunk) GetAudio() []byte {
+	if x != nil {
+		return x.Audio
+	}
+	return nil
+}
+
+type Candidate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Userid        string                 `protobuf:"bytes,1,opt,name=userid,proto3" json:"userid,omitempty"`
+	Score         float64                `protobuf:"fixed64,2,opt,name=score,proto3" json:"score,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Candidate) Reset() {
+	*x = Candidate{}
+	mi := &file_vpr_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Candidate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Candidate) ProtoMessage() {}
+
+func (x *Candidate) ProtoReflect() protoreflect.Message {
+	mi := &file_vpr_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Candidate.ProtoReflect.Descriptor instead.
+func (*Candidate) Descriptor() ([]byte, []int) {
+	return file_vpr_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Candidate) GetUserid() string {
+	if x != nil {
+		return x.Userid
+	}
+	return ""
+}
+
+func (x *Candidate) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+type IdentifyReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ret           int32                  `protobuf:"varint,1,opt,name=ret,proto3" json:"ret,omitempty"`
+	ErrCode       int32                  `protobuf:"varint,2,opt,name=err_code,json=errCode,proto3" json:"err_code,omitempty"`
+	Msg           string                 `protobuf:"bytes,3,opt,name=msg,proto3" json:"msg,omitempty"`
+	Candidates    []*Candidate           `protobuf:"bytes,4,rep,name=candidates,proto3" json:"candidates,omitempty"` // best first
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IdentifyReply) Reset() {
+	*x = IdentifyReply{}
+	mi := &file_vpr_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IdentifyReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IdentifyReply) ProtoMessage() {}
+
+func (x *IdentifyReply) ProtoReflect() protoreflect.Message {
+	mi := &file_vpr_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IdentifyReply.ProtoReflect.Descriptor instead.
+func (*IdentifyReply) Descriptor() ([]byte, []int) {
+	return file_vpr_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *IdentifyReply) GetRet() int32 {
+	if x != nil {
+		return x.Ret
+	}
+	return 0
+}
+
+func (x *IdentifyReply) GetErrCode() int32 {
+	if x != nil {
+		return x.ErrCode
+	}
+	return 0
+}
+
+func (x *IdentifyReply) GetMsg() string {
+	if x != nil {
+		return x.Msg
+	}
+	return ""
+}
+
+func (x *IdentifyReply) GetCandidates() []*Candidate {
+	if x != nil {
+		return x.Candidates
+	}
+	return nil
+}
+
+var File_vpr_proto protoreflect.FileDescriptor
+
+const file_vpr_proto_rawDesc = "" +
+	"\n" +
+	"\tvpr.proto\x12\x05govpr\";\n" +
+	"\vUserRequest\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x12\x16\n" +
+	"\x06userid\x18\x02 \x01(\tR\x06userid\"F\n" +
+	"\x05Reply\x12\x10\n" +
+	"\x03ret\x18\x01 \x01(\x05R\x03ret\x12\x19\n" +
+	"\berr_code\x18\x02 \x01(\x05R\aerrCode\x12\x10\n" +
+	"\x03msg\x18\x03 \x01(\tR\x03msg\"\x7f\n" +
+	"\vSampleChunk\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x12\x16\n" +
+	"\x06userid\x18\x02 \x01(\tR\x06userid\x12\x18\n" +
+	"\acontent\x18\x03 \x01(\tR\acontent\x12\x12\n" +
+	"\x04step\x18\x04 \x01(\x05R\x04step\x12\x14\n" +
+	"\x05audio\x18\x05 \x01(\fR\x05audio\"k\n" +
+	"\vVerifyChunk\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x12\x16\n" +
+	"\x06userid\x18\x02 \x01(\tR\x06userid\x12\x18\n" +
+	"\acontent\x18\x03 \x01(\tR\acontent\x12\x14\n" +
+	"\x05audio\x18\x04 \x01(\fR\x05audio\"\xb2\x01\n" +
+	"\vVerifyReply\x12\x10\n" +
+	"\x03ret\x18\x01 \x01(\x05R\x03ret\x12\x19\n" +
+	"\berr_code\x18\x02 \x01(\x05R\aerrCode\x12\x10\n" +
+	"\x03msg\x18\x03 \x01(\tR\x03msg\x12\x14\n" +
+	"\x05score\x18\x04 \x01(\x01R\x05score\x12\x15\n" +
+	"\x03llr\x18\x05 \x01(\x01H\x00R\x03llr\x88\x01\x01\x12!\n" +
+	"\tposterior\x18\x06 \x01(\x01H\x01R\tposterior\x88\x01\x01B\x06\n" +
+	"\x04_llrB\f\n" +
+	"\n" +
+	"_posterior\"M\n" +
+	"\rIdentifyChunk\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x12\x10\n" +
+	"\x03top\x18\x02 \x01(\x05R\x03top\x12\x14\n" +
+	"\x05audio\x18\x03 \x01(\fR\x05audio\"9\n" +
+	"\tCandidate\x12\x16\n" +
+	"\x06userid\x18\x01 \x01(\tR\x06userid\x12\x14\n" +
+	"\x05score\x18\x02 \x01(\x01R\x05score\"\x80\x01\n" +
+	"\rIdentifyReply\x12\x10\n" +
+	"\x03ret\x18\x01 \x01(\x05R\x03ret\x12\x19\n" +
+	"\berr_code\x18\x02 \x01(\x05R\aerrCode\x12\x10\n" +
+	"\x03msg\x18\x03 \x01(\tR\x03msg\x120\n" +
+	"\n" +
+	"candidates\x18\x04 \x03(\v2\x10.govpr.CandidateR\n" +
+	"candidates2\x83\x04\n" +
+	"\x03VPR\x120\n" +
+	"\fRegisterUser\x12\x12.govpr.UserRequest\x1a\f.govpr.Reply\x12.\n" +
+	"\n" +
+	"DeleteUser\x12\x12.govpr.UserRequest\x1a\f.govpr.Reply\x122\n" +
+	"\x0eDetectRegister\x12\x12.govpr.UserRequest\x1a\f.govpr.Reply\x12/\n" +
+	"\vDetectQuery\x12\x12.govpr.UserRequest\x1a\f.govpr.Reply\x12/\n" +
+	"\tAddSample\x12\x12.govpr.SampleChunk\x1a\f.govpr.Reply(\x01\x120\n" +
+	"\fClearSamples\x12\x12.govpr.UserRequest\x1a\f.govpr.Reply\x12.\n" +
+	"\n" +
+	"TrainModel\x12\x12.govpr.UserRequest\x1a\f.govpr.Reply\x12/\n" +
+	"\vDeleteModel\x12\x12.govpr.UserRequest\x1a\f.govpr.Reply\x127\n" +
+	"\vVerifyModel\x12\x12.govpr.VerifyChunk\x1a\x12.govpr.VerifyReply(\x01\x128\n" +
+	"\bIdentify\x12\x14.govpr.IdentifyChunk\x1a\x14.govpr.IdentifyReply(\x01B.Z,github.com/liuxp0827/govpr/httpapi/rpc/vprpbb\x06proto3"
+
+var (
+	file_vpr_proto_rawDescOnce sync.Once
+	file_vpr_proto_rawDescData []byte
+)
+
+func file_vpr_proto_rawDescGZIP() []byte {
+	file_vpr_proto_rawDescOnce.Do(func() {
+		file_vpr_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_vpr_proto_rawDesc), len(file_vpr_proto_rawDesc)))
+	})
+	return file_vpr_proto_rawDescData
+}
+
+var file_vpr_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_vpr_proto_goTypes = []any{
+	(*UserRequest)(nil),   // 0: govpr.UserRequest
+	(*Reply)(nil),         // 1: govpr.Reply
+	(*SampleChunk)(nil),   // 2: govpr.SampleChunk
+	(*VerifyChunk)(nil),   // 3: govpr.VerifyChunk
+	(*VerifyReply)(nil),   // 4: govpr.VerifyReply
+	(*IdentifyChunk)(nil), // 5: govpr.IdentifyChunk
+	(*Candidate)(nil),     // 6: govpr.Candidate
+	(*IdentifyReply)(nil), // 7: govpr.IdentifyReply
+}
+var file_vpr_proto_depIdxs = []int32{
+	6,  // 0: govpr.IdentifyReply.candidates:type_name -> govpr.Candidate
+	0,  // 1: govpr.VPR.RegisterUser:input_type -> govpr.UserRequest
+	0,  // 2: govpr.VPR.DeleteUser:input_type -> govpr.UserRequest
+	0,  // 3: govpr.VPR.DetectRegister:input_type -> govpr.UserRequest
+	0,  // 4: govpr.VPR.DetectQuery:input_type -> govpr.UserRequest
+	2,  // 5: govpr.VPR.AddSample:input_type -> govpr.SampleChunk
+	0,  // 6: govpr.VPR.ClearSamples:input_type -> govpr.UserRequest
+	0,  // 7: govpr.VPR.TrainModel:input_type -> govpr.UserRequest
+	0,  // 8: govpr.VPR.DeleteModel:input_type -> govpr.UserRequest
+	3,  // 9: govpr.VPR.VerifyModel:input_type -> govpr.VerifyChunk
+	5,  // 10: govpr.VPR.Identify:input_type -> govpr.IdentifyChunk
+	1,  // 11: govpr.VPR.RegisterUser:output_type -> govpr.Reply
+	1,  // 12: govpr.VPR.DeleteUser:output_type -> govpr.Reply
+	1,  // 13: govpr.VPR.DetectRegister:output_type -> govpr.Reply
+	1,  // 14: govpr.VPR.DetectQuery:output_type -> govpr.Reply
+	1,  // 15: govpr.VPR.AddSample:output_type -> govpr.Reply
+	1,  // 16: govpr.VPR.ClearSamples:output_type -> govpr.Reply
+	1,  // 17: govpr.VPR.TrainModel:output_type -> govpr.Reply
+	1,  // 18: govpr.VPR.DeleteModel:output_type -> govpr.Reply
+	4,  // 19: govpr.VPR.VerifyModel:output_type -> govpr.VerifyReply
+	7,  // 20: govpr.VPR.Identify:output_type -> govpr.IdentifyReply
+	11, // [11:21] is the sub-list for method output_type
+	1,  // [1:11] is the sub-list for method input_type
+	1,  // [1:1] is the sub-list for extension type_name
+	1,  // [1:1] is the sub-list for extension extendee
+	0,  // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_vpr_proto_init() }
+func file_vpr_proto_init() {
+	if File_vpr_proto != nil {
+		return
+	}
+	file_vpr_proto_msgTypes[4].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_vpr_proto_rawDesc), len(file_vpr_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_vpr_proto_goTypes,
+		DependencyIndexes: file_vpr_proto_depIdxs,
+		MessageInfos:      file_vpr_proto_msgTypes,
+	}.Build()
+	File_vpr_proto = out.File
+	file_vpr_proto_goTypes = nil
+	file_vpr_proto_depIdxs = nil
+}
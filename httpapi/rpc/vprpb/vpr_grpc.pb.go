@@ -0,0 +1,461 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: vpr.proto
+
+package vprpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	VPR_RegisterUser_FullMethodName   = "/govpr.VPR/RegisterUser"
+	VPR_DeleteUser_FullMethodName     = "/govpr.VPR/DeleteUser"
+	VPR_DetectRegister_FullMethodName = "/govpr.VPR/DetectRegister"
+	VPR_DetectQuery_FullMethodName    = "/govpr.VPR/DetectQuery"
+	VPR_AddSample_FullMethodName      = "/govpr.VPR/AddSample"
+	VPR_ClearSamples_FullMethodName   = "/govpr.VPR/ClearSamples"
+	VPR_TrainModel_FullMethodName     = "/govpr.VPR/TrainModel"
+	VPR_DeleteModel_FullMethodName    = "/govpr.VPR/DeleteModel"
+	VPR_VerifyModel_FullMethodName    = "/govpr.VPR/VerifyModel"
+	VPR_Identify_FullMethodName       = "/govpr.VPR/Identify"
+)
+
+// VPRClient is the client API for VPR service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// VPR is the gRPC counterpart of the beego routes in httpapi/routers. The
+// ret and err_code fields of the replies carry the codes of
+// httpapi/constants, the same as the "ret" and "errCode" of the JSON
+// replies.
+type VPRClient interface {
+	RegisterUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Reply, error)
+	DeleteUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Reply, error)
+	DetectRegister(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Reply, error)
+	DetectQuery(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Reply, error)
+	// The audio of one training sample, split over any number of messages.
+	AddSample(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SampleChunk, Reply], error)
+	ClearSamples(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Reply, error)
+	TrainModel(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Reply, error)
+	DeleteModel(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Reply, error)
+	// Scores streamed audio against the model of one user.
+	VerifyModel(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[VerifyChunk, VerifyReply], error)
+	// Scores streamed audio against the models of every trained user of
+	// the app and ranks them.
+	Identify(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[IdentifyChunk, IdentifyReply], error)
+}
+
+type vPRClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewVPRClient(cc grpc.ClientConnInterface) VPRClient {
+	return &vPRClient{cc}
+}
+
+func (c *vPRClient) RegisterUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Reply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Reply)
+	err := c.cc.Invoke(ctx, VPR_RegisterUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *vPRClient) DeleteUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Reply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Reply)
+	err := c.cc.Invoke(ctx, VPR_DeleteUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *vPRClient) DetectRegister(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Reply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Reply)
+	err := c.cc.Invoke(ctx, VPR_DetectRegister_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *vPRClient) DetectQuery(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Reply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Reply)
+	err := c.cc.Invoke(ctx, VPR_DetectQuery_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *vPRClient) AddSample(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SampleChunk, Reply], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &VPR_ServiceDesc.Streams[0], VPR_AddSample_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SampleChunk, Reply]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VPR_AddSampleClient = grpc.ClientStreamingClient[SampleChunk, Reply]
+
+func (c *vPRClient) ClearSamples(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Reply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Reply)
+	err := c.cc.Invoke(ctx, VPR_ClearSamples_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *vPRClient) TrainModel(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Reply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Reply)
+	err := c.cc.Invoke(ctx, VPR_TrainModel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *vPRClient) DeleteModel(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Reply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Reply)
+	err := c.cc.Invoke(ctx, VPR_DeleteModel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *vPRClient) VerifyModel(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[VerifyChunk, VerifyReply], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &VPR_ServiceDesc.Streams[1], VPR_VerifyModel_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[VerifyChunk, VerifyReply]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VPR_VerifyModelClient = grpc.ClientStreamingClient[VerifyChunk, VerifyReply]
+
+func (c *vPRClient) Identify(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[IdentifyChunk, IdentifyReply], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &VPR_ServiceDesc.Streams[2], VPR_Identify_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[IdentifyChunk, IdentifyReply]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VPR_IdentifyClient = grpc.ClientStreamingClient[IdentifyChunk, IdentifyReply]
+
+// VPRServer is the server API for VPR service.
+// All implementations must embed UnimplementedVPRServer
+// for forward compatibility.
+//
+// VPR is the gRPC counterpart of the beego routes in httpapi/routers. The
+// ret and err_code fields of the replies carry the codes of
+// httpapi/constants, the same as the "ret" and "errCode" of the JSON
+// replies.
+type VPRServer interface {
+	RegisterUser(context.Context, *UserRequest) (*Reply, error)
+	DeleteUser(context.Context, *UserRequest) (*Reply, error)
+	DetectRegister(context.Context, *UserRequest) (*Reply, error)
+	DetectQuery(context.Context, *UserRequest) (*Reply, error)
+	// The audio of one training sample, split over any number of messages.
+	AddSample(grpc.ClientStreamingServer[SampleChunk, Reply]) error
+	ClearSamples(context.Context, *UserRequest) (*Reply, error)
+	TrainModel(context.Context, *UserRequest) (*Reply, error)
+	DeleteModel(context.Context, *UserRequest) (*Reply, error)
+	// Scores streamed audio against the model of one user.
+	VerifyModel(grpc.ClientStreamingServer[VerifyChunk, VerifyReply]) error
+	// Scores streamed audio against the models of every trained user of
+	// the app and ranks them.
+	Identify(grpc.ClientStreamingServer[IdentifyChunk, IdentifyReply]) error
+	mustEmbedUnimplementedVPRServer()
+}
+
+// UnimplementedVPRServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedVPRServer struct{}
+
+func (UnimplementedVPRServer) RegisterUser(context.Context, *UserRequest) (*Reply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterUser not implemented")
+}
+func (UnimplementedVPRServer) DeleteUser(context.Context, *UserRequest) (*Reply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteUser not implemented")
+}
+func (UnimplementedVPRServer) DetectRegister(context.Context, *UserRequest) (*Reply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DetectRegister not implemented")
+}
+func (UnimplementedVPRServer) DetectQuery(context.Context, *UserRequest) (*Reply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DetectQuery not implemented")
+}
+func (UnimplementedVPRServer) AddSample(grpc.ClientStreamingServer[SampleChunk, Reply]) error {
+	return status.Errorf(codes.Unimplemented, "method AddSample not implemented")
+}
+func (UnimplementedVPRServer) ClearSamples(context.Context, *UserRequest) (*Reply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClearSamples not implemented")
+}
+func (UnimplementedVPRServer) TrainModel(context.Context, *UserRequest) (*Reply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TrainModel not implemented")
+}
+func (UnimplementedVPRServer) DeleteModel(context.Context, *UserRequest) (*Reply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteModel not implemented")
+}
+func (UnimplementedVPRServer) VerifyModel(grpc.ClientStreamingServer[VerifyChunk, VerifyReply]) error {
+	return status.Errorf(codes.Unimplemented, "method VerifyModel not implemented")
+}
+func (UnimplementedVPRServer) Identify(grpc.ClientStreamingServer[IdentifyChunk, IdentifyReply]) error {
+	return status.Errorf(codes.Unimplemented, "method Identify not implemented")
+}
+func (UnimplementedVPRServer) mustEmbedUnimplementedVPRServer() {}
+func (UnimplementedVPRServer) testEmbeddedByValue()             {}
+
+// UnsafeVPRServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to VPRServer will
+// result in compilation errors.
+type UnsafeVPRServer interface {
+	mustEmbedUnimplementedVPRServer()
+}
+
+func RegisterVPRServer(s grpc.ServiceRegistrar, srv VPRServer) {
+	// If the following call pancis, it indicates UnimplementedVPRServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&VPR_ServiceDesc, srv)
+}
+
+func _VPR_RegisterUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VPRServer).RegisterUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VPR_RegisterUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VPRServer).RegisterUser(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VPR_DeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VPRServer).DeleteUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VPR_DeleteUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VPRServer).DeleteUser(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VPR_DetectRegister_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VPRServer).DetectRegister(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VPR_DetectRegister_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VPRServer).DetectRegister(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VPR_DetectQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VPRServer).DetectQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VPR_DetectQuery_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VPRServer).DetectQuery(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VPR_AddSample_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(VPRServer).AddSample(&grpc.GenericServerStream[SampleChunk, Reply]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VPR_AddSampleServer = grpc.ClientStreamingServer[SampleChunk, Reply]
+
+func _VPR_ClearSamples_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VPRServer).ClearSamples(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VPR_ClearSamples_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VPRServer).ClearSamples(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VPR_TrainModel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VPRServer).TrainModel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VPR_TrainModel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VPRServer).TrainModel(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VPR_DeleteModel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VPRServer).DeleteModel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VPR_DeleteModel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VPRServer).DeleteModel(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VPR_VerifyModel_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(VPRServer).VerifyModel(&grpc.GenericServerStream[VerifyChunk, VerifyReply]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VPR_VerifyModelServer = grpc.ClientStreamingServer[VerifyChunk, VerifyReply]
+
+func _VPR_Identify_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(VPRServer).Identify(&grpc.GenericServerStream[IdentifyChunk, IdentifyReply]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VPR_IdentifyServer = grpc.ClientStreamingServer[IdentifyChunk, IdentifyReply]
+
+// VPR_ServiceDesc is the grpc.ServiceDesc for VPR service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var VPR_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "govpr.VPR",
+	HandlerType: (*VPRServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RegisterUser",
+			Handler:    _VPR_RegisterUser_Handler,
+		},
+		{
+			MethodName: "DeleteUser",
+			Handler:    _VPR_DeleteUser_Handler,
+		},
+		{
+			MethodName: "DetectRegister",
+			Handler:    _VPR_DetectRegister_Handler,
+		},
+		{
+			MethodName: "DetectQuery",
+			Handler:    _VPR_DetectQuery_Handler,
+		},
+		{
+			MethodName: "ClearSamples",
+			Handler:    _VPR_ClearSamples_Handler,
+		},
+		{
+			MethodName: "TrainModel",
+			Handler:    _VPR_TrainModel_Handler,
+		},
+		{
+			MethodName: "DeleteModel",
+			Handler:    _VPR_DeleteModel_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "AddSample",
+			Handler:       _VPR_AddSample_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "VerifyModel",
+			Handler:       _VPR_VerifyModel_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Identify",
+			Handler:       _VPR_Identify_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "vpr.proto",
+}
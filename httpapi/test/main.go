@@ -2,12 +2,10 @@ package main
 
 import (
 	"bytes"
-	"crypto/md5"
-	"encoding/hex"
 	"flag"
-	"fmt"
+	"github.com/liuxp0827/govpr/httpapi/auth"
 	"github.com/liuxp0827/govpr/log"
-	"io"
+	"github.com/liuxp0827/govpr/waveIO"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
@@ -29,21 +27,35 @@ func init() {
 	flag.StringVar(&userid, "u", "test123", "userid")
 	flag.IntVar(&step, "step", -1, "train step 1~5, effective in 'addsample' operation")
 	flag.StringVar(&ops, "op", "", "operation [ registeruser | deleteuser | detectquery | detectregister | addsample | trainmodel | verifymodel | deletemodel ]")
-	flag.StringVar(&waveFile, "wav", "", "wave file")
+	flag.StringVar(&waveFile, "wav", "", "wave, flac, ogg, opus or mp3 file")
 	flag.StringVar(&content, "ct", "", "content, effective in 'addsample' and 'verifymodel' operation")
 	flag.BoolVar(&help, "h", false, "help bool default false")
 }
 
+// the server decodes the formats of waveIO.Decode
+func audioFile(name string) bool {
+	for _, ext := range waveIO.Extensions {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			return true
+		}
+	}
+	return false
+}
+
 func usage() {
 	flag.PrintDefaults()
 	os.Exit(0)
 }
 
-func token() string {
-	str := fmt.Sprintf("%s&%s", appid, appkey)
-	h := md5.New()
-	h.Write([]byte(str))
-	return hex.EncodeToString(h.Sum(nil))
+// sign signs req with appkey, payload is the body or the file of a
+// multipart body
+func sign(req *http.Request, payload []byte) {
+	r := &auth.Request{Method: req.Method, Path: req.URL.Path, Params: req.URL.Query(), Payload: payload}
+	auth.SignNow(appid, appkey, r)
+	req.Header.Set(auth.HEADER_APPID, r.AppId)
+	req.Header.Set(auth.HEADER_TIMESTAMP, r.Timestamp)
+	req.Header.Set(auth.HEADER_NONCE, r.Nonce)
+	req.Header.Set(auth.HEADER_SIGNATURE, r.Signature)
 }
 
 func main() {
@@ -62,23 +74,21 @@ func main() {
 	var err error
 	var req *http.Request
 
-	log.Infof("token: %s", token())
-
 	switch ops {
 	case "registeruser":
-		req, err = registerUser(userid, token())
+		req, err = registerUser(userid)
 
 	case "deleteuser":
-		req, err = deteleUser(userid, token())
+		req, err = deteleUser(userid)
 
 	case "detectquery":
-		req, err = detectquery(userid, token())
+		req, err = detectquery(userid)
 
 	case "detectregister":
-		req, err = detectregister(userid, token())
+		req, err = detectregister(userid)
 
 	case "addsample":
-		if waveFile == "" || !strings.HasSuffix(waveFile, ".wav") {
+		if waveFile == "" || !audioFile(waveFile) {
 			log.Fatalf("wave file %s invalid", waveFile)
 		}
 		if len(content) != 8 {
@@ -88,24 +98,24 @@ func main() {
 			log.Fatalf("step %d invalid", step)
 		}
 
-		req, err = addsample(userid, token(), waveFile, content, strconv.Itoa(step))
+		req, err = addsample(userid, waveFile, content, strconv.Itoa(step))
 
 	case "trainmodel":
-		req, err = trainmodel(userid, token())
+		req, err = trainmodel(userid)
 
 	case "deletemodel":
-		req, err = deletemodel(userid, token())
+		req, err = deletemodel(userid)
 
 	case "verifymodel":
 
-		if waveFile == "" || !strings.HasSuffix(waveFile, ".wav") {
+		if waveFile == "" || !audioFile(waveFile) {
 			log.Fatalf("wave file %s invalid", waveFile)
 		}
 		if len(content) != 8 {
 			log.Fatalf("content %s invalid", content)
 		}
 
-		req, err = verifymodel(userid, token(), waveFile, content)
+		req, err = verifymodel(userid, waveFile, content)
 
 	default:
 		log.Fatalf("ops %s invalid", ops)
@@ -127,7 +137,7 @@ func main() {
 	log.Info(string(data))
 }
 
-func registerUser(userid, token string) (*http.Request, error) {
+func registerUser(userid string) (*http.Request, error) {
 	req, err := http.NewRequest("POST", host+"/registeruser", nil)
 	if err != nil {
 		return nil, err
@@ -135,14 +145,14 @@ func registerUser(userid, token string) (*http.Request, error) {
 
 	query := req.URL.Query()
 	query.Add("userid", userid)
-	query.Add("token", token)
 
 	req.URL.RawQuery = query.Encode()
+	sign(req, nil)
 
 	return req, nil
 }
 
-func deteleUser(userid, token string) (*http.Request, error) {
+func deteleUser(userid string) (*http.Request, error) {
 	req, err := http.NewRequest("POST", host+"/deleteuser", nil)
 	if err != nil {
 		return nil, err
@@ -150,14 +160,14 @@ func deteleUser(userid, token string) (*http.Request, error) {
 
 	query := req.URL.Query()
 	query.Add("userid", userid)
-	query.Add("token", token)
 
 	req.URL.RawQuery = query.Encode()
+	sign(req, nil)
 
 	return req, nil
 }
 
-func detectquery(userid, token string) (*http.Request, error) {
+func detectquery(userid string) (*http.Request, error) {
 	req, err := http.NewRequest("POST", host+"/detectquery", nil)
 	if err != nil {
 		return nil, err
@@ -165,14 +175,14 @@ func detectquery(userid, token string) (*http.Request, error) {
 
 	query := req.URL.Query()
 	query.Add("userid", userid)
-	query.Add("token", token)
 
 	req.URL.RawQuery = query.Encode()
+	sign(req, nil)
 
 	return req, nil
 }
 
-func detectregister(userid, token string) (*http.Request, error) {
+func detectregister(userid string) (*http.Request, error) {
 	req, err := http.NewRequest("POST", host+"/detectregister", nil)
 	if err != nil {
 		return nil, err
@@ -180,14 +190,14 @@ func detectregister(userid, token string) (*http.Request, error) {
 
 	query := req.URL.Query()
 	query.Add("userid", userid)
-	query.Add("token", token)
 
 	req.URL.RawQuery = query.Encode()
+	sign(req, nil)
 
 	return req, nil
 }
 
-func trainmodel(userid, token string) (*http.Request, error) {
+func trainmodel(userid string) (*http.Request, error) {
 	req, err := http.NewRequest("POST", host+"/trainmodel", nil)
 	if err != nil {
 		return nil, err
@@ -195,14 +205,14 @@ func trainmodel(userid, token string) (*http.Request, error) {
 
 	query := req.URL.Query()
 	query.Add("userid", userid)
-	query.Add("token", token)
 
 	req.URL.RawQuery = query.Encode()
+	sign(req, nil)
 
 	return req, nil
 }
 
-func deletemodel(userid, token string) (*http.Request, error) {
+func deletemodel(userid string) (*http.Request, error) {
 	req, err := http.NewRequest("POST", host+"/deletemodel", nil)
 	if err != nil {
 		return nil, err
@@ -210,14 +220,14 @@ func deletemodel(userid, token string) (*http.Request, error) {
 
 	query := req.URL.Query()
 	query.Add("userid", userid)
-	query.Add("token", token)
 
 	req.URL.RawQuery = query.Encode()
+	sign(req, nil)
 
 	return req, nil
 }
 
-func benchverifymodel(userid, token, path, content string) error {
+func benchverifymodel(userid, path, content string) error {
 	file, err := os.Open(path)
 	if err != nil {
 		log.Error(err)
@@ -232,7 +242,12 @@ func benchverifymodel(userid, token, path, content string) error {
 		log.Error(err)
 		return err
 	}
-	_, err = io.Copy(part, file)
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	part.Write(data)
 
 	err = writer.Close()
 	if err != nil {
@@ -243,10 +258,10 @@ func benchverifymodel(userid, token, path, content string) error {
 
 	query := req.URL.Query()
 	query.Add("userid", userid)
-	query.Add("token", token)
 	query.Add("content", content)
 
 	req.URL.RawQuery = query.Encode()
+	sign(req, data)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	client := &http.Client{}
@@ -257,17 +272,17 @@ func benchverifymodel(userid, token, path, content string) error {
 		return err
 	}
 	defer resp.Body.Close()
-	data, err := ioutil.ReadAll(resp.Body)
+	reply, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
-	log.Info(string(data))
+	log.Info(string(reply))
 
 	return err
 }
 
-func verifymodel(userid, token, path, content string) (*http.Request, error) {
+func verifymodel(userid, path, content string) (*http.Request, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -280,7 +295,11 @@ func verifymodel(userid, token, path, content string) (*http.Request, error) {
 	if err != nil {
 		return nil, err
 	}
-	_, err = io.Copy(part, file)
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	part.Write(data)
 
 	err = writer.Close()
 	if err != nil {
@@ -290,16 +309,16 @@ func verifymodel(userid, token, path, content string) (*http.Request, error) {
 
 	query := req.URL.Query()
 	query.Add("userid", userid)
-	query.Add("token", token)
 	query.Add("content", content)
 
 	req.URL.RawQuery = query.Encode()
+	sign(req, data)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	return req, err
 }
 
-func addsample(userid, token, path, content, step string) (*http.Request, error) {
+func addsample(userid, path, content, step string) (*http.Request, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -312,7 +331,11 @@ func addsample(userid, token, path, content, step string) (*http.Request, error)
 	if err != nil {
 		return nil, err
 	}
-	_, err = io.Copy(part, file)
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	part.Write(data)
 
 	err = writer.Close()
 	if err != nil {
@@ -322,10 +345,10 @@ func addsample(userid, token, path, content, step string) (*http.Request, error)
 
 	query := req.URL.Query()
 	query.Add("userid", userid)
-	query.Add("token", token)
 	query.Add("content", content)
 	query.Add("step", step)
 	req.URL.RawQuery = query.Encode()
+	sign(req, data)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 	return req, err
 }
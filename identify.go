@@ -0,0 +1,44 @@
+package govpr
+
+import (
+	"github.com/liuxp0827/govpr/gmm"
+	"github.com/liuxp0827/govpr/log"
+)
+
+// ScoreModels scores the verify data against every user model in files,
+// for identification among enrolled speakers. The ubm log likelihood is
+// computed once for all of them. The scores are in the order of files.
+func (this *VPREngine) ScoreModels(files []string) ([]float64, error) {
+	if (this.verifyBuf == nil || len(this.verifyBuf) <= 0) && len(this.verifyFeatures) == 0 {
+		return nil, LSV_ERR_NO_AVAILABLE_DATA
+	}
+
+	if len(this.verifyFeatures) == 0 && int64(len(this.verifyBuf)) < this._minVerLen {
+		return nil, LSV_ERR_NEED_MORE_SAMPLE
+	}
+
+	features, err := this.features(this.verifyBuf, this.verifyFeatures)
+	if err != nil {
+		log.Error(err)
+		return nil, NewError(LSV_ERR_MEM_INSUFFICIENT, err.Error())
+	}
+
+	if len(features) == 0 || (len(this.verifyFeatures) > 0 && len(features) < this._minVerFrames) {
+		return nil, LSV_ERR_NEED_MORE_SAMPLE
+	}
+
+	frames := int64(len(features))
+	logWorld := this.ubm.LProb(features, 0, frames)
+
+	scores := make([]float64, len(files))
+	for i, file := range files {
+		client := gmm.NewGMM()
+		if err := client.LoadModel(file); err != nil {
+			log.Error(err)
+			return nil, NewError(LSV_ERR_MODEL_LOAD_FAILED, err.Error())
+		}
+
+		scores[i] = (client.LProb(features, 0, frames) - logWorld) / float64(frames)
+	}
+	return scores, nil
+}
@@ -0,0 +1,431 @@
+package math
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/liuxp0827/govpr/constant"
+)
+
+// FFTPlan holds the precomputed tables of a complex transform of one length.
+// Power of two lengths use the in-place radix-2 transform, any other length
+// goes through Bluestein's chirp-z algorithm on a power of two sub plan.
+// A plan is read-only after creation and can be shared between goroutines.
+type FFTPlan struct {
+	n int
+
+	// radix-2
+	rev      []int     // bit reversed index
+	cos, sin []float64 // cos/sin of 2*PI*i/n
+
+	// Bluestein
+	sub            *FFTPlan  // power of two plan of length >= 2n-1
+	chirpRe        []float64 // exp(-i*PI*k*k/n), real part
+	chirpIm        []float64 // exp(-i*PI*k*k/n), imaginary part
+	kernRe, kernIm []float64 // FFT of the conjugate chirp, length sub.n
+	scratch        sync.Pool // *[2][]float64 of length sub.n
+}
+
+var fftPlans sync.Map     // int -> *FFTPlan
+var realFFTPlans sync.Map // int -> *RealFFTPlan
+
+// Plan returns the cached plan for length n.
+func Plan(n int) (*FFTPlan, error) {
+	if p, ok := fftPlans.Load(n); ok {
+		return p.(*FFTPlan), nil
+	}
+
+	p, err := NewFFTPlan(n)
+	if err != nil {
+		return nil, err
+	}
+
+	v, _ := fftPlans.LoadOrStore(n, p)
+	return v.(*FFTPlan), nil
+}
+
+func NewFFTPlan(n int) (*FFTPlan, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid length")
+	}
+
+	p := &FFTPlan{n: n}
+	if n&(n-1) == 0 {
+		p.initRadix2()
+		return p, nil
+	}
+
+	m := 1
+	for m < 2*n-1 {
+		m <<= 1
+	}
+
+	sub, err := Plan(m)
+	if err != nil {
+		return nil, err
+	}
+
+	p.sub = sub
+	p.chirpRe = make([]float64, n)
+	p.chirpIm = make([]float64, n)
+	p.kernRe = make([]float64, m)
+	p.kernIm = make([]float64, m)
+	for k := 0; k < n; k++ {
+		// k*k mod 2n keeps the angle small for long transforms
+		a := constant.PI * float64((k*k)%(2*n)) / float64(n)
+		p.chirpRe[k] = math.Cos(a)
+		p.chirpIm[k] = -math.Sin(a)
+
+		p.kernRe[k] = p.chirpRe[k]
+		p.kernIm[k] = -p.chirpIm[k]
+		if k > 0 {
+			p.kernRe[m-k] = p.chirpRe[k]
+			p.kernIm[m-k] = -p.chirpIm[k]
+		}
+	}
+	sub.Forward(p.kernRe, p.kernIm)
+
+	p.scratch.New = func() interface{} {
+		return &[2][]float64{make([]float64, m), make([]float64, m)}
+	}
+	return p, nil
+}
+
+func (p *FFTPlan) Len() int {
+	return p.n
+}
+
+// Forward transform of (re, im) in place, X[k] = sum x[j]*exp(-2*PI*i*j*k/n).
+func (p *FFTPlan) Forward(re, im []float64) {
+	if p.sub != nil {
+		p.bluestein(re, im)
+	} else {
+		p.radix2(re, im)
+	}
+}
+
+// Inverse transform of (re, im) in place, scaled by 1/n so that
+// Inverse(Forward(x)) == x.
+func (p *FFTPlan) Inverse(re, im []float64) {
+	// ifft(x) = conj(fft(conj(x))) / n
+	for i := 0; i < p.n; i++ {
+		im[i] = -im[i]
+	}
+
+	p.Forward(re, im)
+
+	scale := 1.0 / float64(p.n)
+	for i := 0; i < p.n; i++ {
+		re[i] *= scale
+		im[i] = -im[i] * scale
+	}
+}
+
+func (p *FFTPlan) initRadix2() {
+	n := p.n
+	p.rev = make([]int, n)
+	p.cos = make([]float64, n)
+	p.sin = make([]float64, n)
+
+	bits := 0
+	for 1<<uint(bits) < n {
+		bits++
+	}
+
+	temr := 2 * constant.PI / float64(n)
+	for i := 0; i < n; i++ {
+		r := 0
+		for b := 0; b < bits; b++ {
+			if i&(1<<uint(b)) != 0 {
+				r |= 1 << uint(bits-1-b)
+			}
+		}
+		p.rev[i] = r
+		p.sin[i] = math.Sin(temr * float64(i))
+		p.cos[i] = math.Cos(temr * float64(i))
+	}
+}
+
+func (p *FFTPlan) radix2(ar, ai []float64) {
+	n := p.n
+	for i, j := range p.rev {
+		if i < j {
+			ar[i], ar[j] = ar[j], ar[i]
+			ai[i], ai[j] = ai[j], ai[i]
+		}
+	}
+
+	var temr, temi, x, y float64
+	for b, step := 1, n>>1; b < n; b, step = b<<1, step>>1 {
+		for j := 0; j < b; j++ {
+			x = p.cos[step*j]
+			y = -p.sin[step*j]
+			for k := j; k < n; k += b << 1 {
+				temr = ar[k+b]*x - ai[k+b]*y
+				temi = ar[k+b]*y + ai[k+b]*x
+				ar[k+b] = ar[k] - temr
+				ai[k+b] = ai[k] - temi
+				ar[k] += temr
+				ai[k] += temi
+			}
+		}
+	}
+}
+
+// X[k] = chirp[k] * sum (x[j]*chirp[j]) * conj(chirp[k-j]), the sum is a
+// convolution done with the power of two sub plan.
+func (p *FFTPlan) bluestein(re, im []float64) {
+	buf := p.scratch.Get().(*[2][]float64)
+	defer p.scratch.Put(buf)
+
+	ar, ai := buf[0], buf[1]
+	for i := range ar {
+		ar[i], ai[i] = 0, 0
+	}
+
+	for k := 0; k < p.n; k++ {
+		ar[k] = re[k]*p.chirpRe[k] - im[k]*p.chirpIm[k]
+		ai[k] = re[k]*p.chirpIm[k] + im[k]*p.chirpRe[k]
+	}
+
+	p.sub.Forward(ar, ai)
+	for k := range ar {
+		r := ar[k]*p.kernRe[k] - ai[k]*p.kernIm[k]
+		ai[k] = ar[k]*p.kernIm[k] + ai[k]*p.kernRe[k]
+		ar[k] = r
+	}
+	p.sub.Inverse(ar, ai)
+
+	for k := 0; k < p.n; k++ {
+		re[k] = ar[k]*p.chirpRe[k] - ai[k]*p.chirpIm[k]
+		im[k] = ar[k]*p.chirpIm[k] + ai[k]*p.chirpRe[k]
+	}
+}
+
+// RealFFTPlan transforms real sequences of length n. Even lengths are
+// packed into a complex transform of n/2 points, which is about half the
+// work of the complex transform with a zero imaginary part.
+type RealFFTPlan struct {
+	n      int
+	half   *FFTPlan  // even n: complex plan of n/2
+	full   *FFTPlan  // odd n: complex plan of n
+	wr, wi []float64 // exp(-2*PI*i*k/n) for k in [0, n/2]
+	buf    sync.Pool // *[2][]float64 scratch
+}
+
+// RealPlan returns the cached real plan for length n.
+func RealPlan(n int) (*RealFFTPlan, error) {
+	if p, ok := realFFTPlans.Load(n); ok {
+		return p.(*RealFFTPlan), nil
+	}
+
+	p, err := NewRealFFTPlan(n)
+	if err != nil {
+		return nil, err
+	}
+
+	v, _ := realFFTPlans.LoadOrStore(n, p)
+	return v.(*RealFFTPlan), nil
+}
+
+func NewRealFFTPlan(n int) (*RealFFTPlan, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid length")
+	}
+
+	var err error
+	p := &RealFFTPlan{n: n}
+	size := n
+	if n%2 == 0 && n > 2 {
+		size = n / 2
+		p.half, err = Plan(size)
+		p.wr = make([]float64, size+1)
+		p.wi = make([]float64, size+1)
+		for k := 0; k <= size; k++ {
+			a := 2 * constant.PI * float64(k) / float64(n)
+			p.wr[k] = math.Cos(a)
+			p.wi[k] = -math.Sin(a)
+		}
+	} else {
+		p.full, err = Plan(n)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.buf.New = func() interface{} {
+		return &[2][]float64{make([]float64, size), make([]float64, size)}
+	}
+	return p, nil
+}
+
+func (p *RealFFTPlan) Len() int {
+	return p.n
+}
+
+// Forward transform of the real sequence x (length n). The non-redundant
+// half spectrum, bins 0..n/2, is written to re and im. re may be the same
+// slice as x.
+func (p *RealFFTPlan) Forward(x, re, im []float64) {
+	buf := p.buf.Get().(*[2][]float64)
+	defer p.buf.Put(buf)
+	zr, zi := buf[0], buf[1]
+
+	if p.full != nil {
+		copy(zr, x[:p.n])
+		for i := range zi {
+			zi[i] = 0
+		}
+		p.full.Forward(zr, zi)
+		copy(re[:p.n/2+1], zr)
+		copy(im[:p.n/2+1], zi)
+		return
+	}
+
+	h := p.n / 2
+	for k := 0; k < h; k++ {
+		zr[k] = x[2*k]
+		zi[k] = x[2*k+1]
+	}
+	p.half.Forward(zr, zi)
+
+	for k := 0; k <= h; k++ {
+		ar, ai := zr[k%h], zi[k%h]
+		br, bi := zr[(h-k)%h], -zi[(h-k)%h]
+
+		// even and odd sample spectra
+		er, ei := (ar+br)/2, (ai+bi)/2
+		or, oi := (ai-bi)/2, -(ar-br)/2
+
+		re[k] = er + or*p.wr[k] - oi*p.wi[k]
+		im[k] = ei + or*p.wi[k] + oi*p.wr[k]
+	}
+}
+
+// Inverse of Forward, re and im hold bins 0..n/2 and x receives the n
+// real samples.
+func (p *RealFFTPlan) Inverse(re, im, x []float64) {
+	buf := p.buf.Get().(*[2][]float64)
+	defer p.buf.Put(buf)
+	zr, zi := buf[0], buf[1]
+
+	if p.full != nil {
+		for k := 0; k < p.n; k++ {
+			if k <= p.n/2 {
+				zr[k], zi[k] = re[k], im[k]
+			} else {
+				zr[k], zi[k] = re[p.n-k], -im[p.n-k]
+			}
+		}
+		p.full.Inverse(zr, zi)
+		copy(x[:p.n], zr)
+		return
+	}
+
+	h := p.n / 2
+	for k := 0; k < h; k++ {
+		ar, ai := re[k], im[k]
+		br, bi := re[h-k], -im[h-k]
+
+		er, ei := (ar+br)/2, (ai+bi)/2
+		dr, di := (ar-br)/2, (ai-bi)/2
+
+		// odd spectrum = d * conj(w)
+		or := dr*p.wr[k] + di*p.wi[k]
+		oi := di*p.wr[k] - dr*p.wi[k]
+
+		// z = even + i*odd
+		zr[k] = er - oi
+		zi[k] = ei + or
+	}
+	p.half.Inverse(zr, zi)
+
+	for k := 0; k < h; k++ {
+		x[2*k] = zr[k]
+		x[2*k+1] = zi[k]
+	}
+}
+
+// DCTPlan is the orthonormal DCT-II of the given length restricted to the
+// first width outputs, stored as a [width][length] matrix.
+type DCTPlan struct {
+	length int
+	width  int
+	matrix []float64
+	buf    sync.Pool
+}
+
+var dctPlans sync.Map // [2]int -> *DCTPlan
+
+// DCTPlanFor returns the cached DCT plan for (length, width), width <= 0
+// means all coefficients.
+func DCTPlanFor(length, width int) (*DCTPlan, error) {
+	if width <= 0 || width > length {
+		width = length
+	}
+
+	key := [2]int{length, width}
+	if p, ok := dctPlans.Load(key); ok {
+		return p.(*DCTPlan), nil
+	}
+
+	p, err := NewDCTPlan(length, width)
+	if err != nil {
+		return nil, err
+	}
+
+	v, _ := dctPlans.LoadOrStore(key, p)
+	return v.(*DCTPlan), nil
+}
+
+func NewDCTPlan(length, width int) (*DCTPlan, error) {
+	if length <= 0 {
+		return nil, fmt.Errorf("invalid length")
+	}
+
+	if width <= 0 || width > length {
+		width = length
+	}
+
+	p := &DCTPlan{
+		length: length,
+		width:  width,
+		matrix: make([]float64, width*length),
+	}
+
+	dfactor, dc0 := math.Sqrt(2.0/float64(length)), 1.0/math.Sqrt(2.0)
+	for k := 0; k < width; k++ {
+		for n := 0; n < length; n++ {
+			c := dfactor * math.Cos(constant.PI*float64((2*n+1)*k)/float64(2*length))
+			if k == 0 {
+				c *= dc0
+			}
+			p.matrix[k*length+n] = c
+		}
+	}
+
+	p.buf.New = func() interface{} {
+		b := make([]float64, length)
+		return &b
+	}
+	return p, nil
+}
+
+// Transform data in place, only the first width elements are replaced.
+func (p *DCTPlan) Transform(data []float64) {
+	buf := p.buf.Get().(*[]float64)
+	defer p.buf.Put(buf)
+
+	src := *buf
+	copy(src, data[:p.length])
+	for k := 0; k < p.width; k++ {
+		row := p.matrix[k*p.length : (k+1)*p.length]
+		var sum float64
+		for n, v := range src {
+			sum += row[n] * v
+		}
+		data[k] = sum
+	}
+}
@@ -0,0 +1,180 @@
+package math
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+const tolerance = 1e-9
+
+// dft is the direct O(n^2) transform the plans are checked against
+func dft(re, im []float64) ([]float64, []float64) {
+	n := len(re)
+	outRe, outIm := make([]float64, n), make([]float64, n)
+	for k := 0; k < n; k++ {
+		for j := 0; j < n; j++ {
+			a := -2 * math.Pi * float64(j*k%n) / float64(n)
+			c, s := math.Cos(a), math.Sin(a)
+			outRe[k] += re[j]*c - im[j]*s
+			outIm[k] += re[j]*s + im[j]*c
+		}
+	}
+	return outRe, outIm
+}
+
+func randomSignal(rng *rand.Rand, n int) []float64 {
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = rng.NormFloat64()
+	}
+	return x
+}
+
+func checkClose(t *testing.T, name string, got, want []float64) {
+	t.Helper()
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > tolerance*(1+math.Abs(want[i])) {
+			t.Errorf("%s[%d] = %v, want %v", name, i, got[i], want[i])
+			return
+		}
+	}
+}
+
+func TestFFTKnownValues(t *testing.T) {
+	// X = [10, -2+2i, -2, -2-2i]
+	re, im := []float64{1, 2, 3, 4}, make([]float64, 4)
+	if err := FFT(re, im, 4); err != nil {
+		t.Fatal(err)
+	}
+	checkClose(t, "re", re, []float64{10, -2, -2, -2})
+	checkClose(t, "im", im, []float64{0, 2, 0, -2})
+
+	// an impulse has a flat spectrum, a constant one only a DC bin, also
+	// through Bluestein
+	re, im = []float64{1, 0, 0, 0, 0}, make([]float64, 5)
+	if err := FFT(re, im, 5); err != nil {
+		t.Fatal(err)
+	}
+	checkClose(t, "re", re, []float64{1, 1, 1, 1, 1})
+	checkClose(t, "im", im, []float64{0, 0, 0, 0, 0})
+
+	re, im = []float64{1, 1, 1, 1, 1, 1}, make([]float64, 6)
+	if err := FFT(re, im, 6); err != nil {
+		t.Fatal(err)
+	}
+	checkClose(t, "re", re, []float64{6, 0, 0, 0, 0, 0})
+	checkClose(t, "im", im, []float64{0, 0, 0, 0, 0, 0})
+}
+
+func TestFFTPlan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 2, 3, 8, 12, 100, 256, 400, 509} {
+		re, im := randomSignal(rng, n), randomSignal(rng, n)
+		wantRe, wantIm := dft(re, im)
+
+		p, err := NewFFTPlan(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotRe, gotIm := append([]float64(nil), re...), append([]float64(nil), im...)
+		p.Forward(gotRe, gotIm)
+		checkClose(t, "Forward re", gotRe, wantRe)
+		checkClose(t, "Forward im", gotIm, wantIm)
+
+		p.Inverse(gotRe, gotIm)
+		checkClose(t, "Inverse re", gotRe, re)
+		checkClose(t, "Inverse im", gotIm, im)
+	}
+}
+
+func TestRealFFTPlan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 2, 5, 8, 10, 400, 512} {
+		x := randomSignal(rng, n)
+		wantRe, wantIm := dft(x, make([]float64, n))
+
+		p, err := RealPlan(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		re, im := make([]float64, n/2+1), make([]float64, n/2+1)
+		p.Forward(x, re, im)
+		checkClose(t, "Forward re", re, wantRe[:n/2+1])
+		checkClose(t, "Forward im", im, wantIm[:n/2+1])
+
+		got := make([]float64, n)
+		p.Inverse(re, im, got)
+		checkClose(t, "Inverse", got, x)
+	}
+}
+
+func TestDCT(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 4, 24, 40} {
+		x := randomSignal(rng, n)
+
+		// orthonormal DCT-II
+		want := make([]float64, n)
+		for k := range want {
+			for j, v := range x {
+				want[k] += v * math.Cos(math.Pi*float64((2*j+1)*k)/float64(2*n))
+			}
+			if k == 0 {
+				want[k] *= math.Sqrt(1 / float64(n))
+			} else {
+				want[k] *= math.Sqrt(2 / float64(n))
+			}
+		}
+
+		got := append([]float64(nil), x...)
+		width := 0
+		if err := DCT(got, &width); err != nil {
+			t.Fatal(err)
+		}
+		if width != n {
+			t.Errorf("DCT width = %d, want %d", width, n)
+		}
+		checkClose(t, "DCT", got, want)
+
+		got = append([]float64(nil), x...)
+		width = (n + 1) / 2
+		if err := DCT(got, &width); err != nil {
+			t.Fatal(err)
+		}
+		checkClose(t, "DCT", got[:width], want[:width])
+		checkClose(t, "DCT tail", got[width:], x[width:])
+	}
+}
+
+func benchmarkFFT(b *testing.B, n int) {
+	rng := rand.New(rand.NewSource(1))
+	re, im := randomSignal(rng, n), randomSignal(rng, n)
+	p, err := Plan(n)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Forward(re, im)
+	}
+}
+
+func BenchmarkFFT512(b *testing.B)          { benchmarkFFT(b, 512) }
+func BenchmarkFFT400Bluestein(b *testing.B) { benchmarkFFT(b, 400) }
+
+func BenchmarkRealFFT512(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	x := randomSignal(rng, 512)
+	re, im := make([]float64, 257), make([]float64, 257)
+	p, err := RealPlan(512)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Forward(x, re, im)
+	}
+}
@@ -19,6 +19,7 @@ var (
 	LSV_ERR_CONF_PARAM           error = fmt.Errorf("conf param error")
 	LSV_ERR_NO_ACTIVE_SPEECH     error = fmt.Errorf("no active speech")
 	LSV_ERR_INVALID_PARAM        error = fmt.Errorf("invalid param")
+	LSV_ERR_NOT_CALIBRATED       error = fmt.Errorf("not calibrated")
 )
 
 func NewError(err error, e string) error {
@@ -12,21 +12,56 @@ type CParam struct {
 	filterBank       *FilterBank
 	mfcc             *Mfcc
 	cepLifterWinSize []float32
-	hammingWinSize   []float64 // vector of the hamming window
-	warpWinLength    int       // warping window size
-	warpTable        []float32 // warping probability table
+	hammingWinSize   []float64      // vector of the hamming window
+	exactFFT         bool           // fft over exactly one frame instead of the next 2^N
+	frontEnd         FrontEnd       // parameters computed per frame
+	noiseReduction   NoiseReduction // noise reduction of the power spectrum
 }
 
 func NewCParam() *CParam {
-	return &CParam{
-		warpWinLength: 300,
-	}
+	return &CParam{}
 }
 
 func (cp *CParam) GetMfcc() *Mfcc {
 	return cp.mfcc
 }
 
+// Clone returns a CParam with the same settings that can be used from
+// another goroutine. The filter bank tables and windows are shared read-only,
+// only the per-frame working buffers are allocated again.
+func (cp *CParam) Clone() *CParam {
+	c := &CParam{
+		cepLifterWinSize: cp.cepLifterWinSize,
+		hammingWinSize:   cp.hammingWinSize,
+		exactFFT:         cp.exactFFT,
+		frontEnd:         cp.frontEnd,
+		noiseReduction:   cp.noiseReduction,
+	}
+
+	if cp.filterBank != nil {
+		fb := *cp.filterBank
+		fb.fftRealValue = make([]float64, fb.fttSize, fb.fttSize)
+		fb.fftComplexValue = make([]float64, fb.fttSize, fb.fttSize)
+		fb.fbankValue = make([]float64, fb.filterBankSize, fb.filterBankSize)
+		fb.workValue = make([]float64, len(fb.workValue), len(fb.workValue))
+		fb.yinValue = make([]float64, len(fb.yinValue), len(fb.yinValue))
+		c.filterBank = &fb
+	}
+
+	if cp.mfcc != nil {
+		mfcc := *cp.mfcc
+		c.mfcc = &mfcc
+	}
+	return c
+}
+
+// Use an fft of exactly the frame size (any length) rather than zero
+// padding the frame to the next power of two. Must be called before
+// InitFBank/InitFBank2.
+func (cp *CParam) SetExactFFT(exact bool) {
+	cp.exactFFT = exact
+}
+
 // Initialize the filter bank info struct. User should
 //  call this function before calling wav2MFCC().
 // - Arguments -
@@ -61,9 +96,19 @@ func (cp *CParam) InitFBank2(sampleRate, frameRate int, filterBankSize, lowCutFr
 	cp.filterBank.filterBankSize = filterBankSize
 
 	// calculated from arguments
-	cp.filterBank.fttSize = 2
-	for cp.filterBank.frameSize > cp.filterBank.fttSize {
-		cp.filterBank.fttSize <<= 1
+	if cp.exactFFT {
+		cp.filterBank.fttSize = cp.filterBank.frameSize
+	} else {
+		cp.filterBank.fttSize = 2
+		for cp.filterBank.frameSize > cp.filterBank.fttSize {
+			cp.filterBank.fttSize <<= 1
+		}
+	}
+
+	var err error
+	cp.filterBank.fftPlan, err = gomath.RealPlan(cp.filterBank.fttSize)
+	if err != nil {
+		return err
 	}
 
 	fttIndex := cp.filterBank.fttSize >> 1
@@ -96,14 +141,14 @@ func (cp *CParam) InitFBank2(sampleRate, frameRate int, filterBankSize, lowCutFr
 	// the center frequencies
 	cp.filterBank.centerFreqs = make([]float32, filterBankSize + 1, filterBankSize + 1)
 
-	melLowCutFreq = cp.mel(float32(lowCutFreq))
-	melHighCutFreq = cp.mel(float32(highCutFreq))
+	melLowCutFreq = cp.scale(float32(lowCutFreq))
+	melHighCutFreq = cp.scale(float32(highCutFreq))
 	melStep = (melHighCutFreq - melLowCutFreq) / float32(filterBankSize + 1)
 	cp.filterBank.centerFreqs[0] = float32(lowCutFreq) // the zero index is the low cut-off
 
 	for i := 1; i <= filterBankSize; i++ {
 		cp.filterBank.centerFreqs[i] = melLowCutFreq + melStep * float32(i)
-		cp.filterBank.centerFreqs[i] = cp.freq(cp.filterBank.centerFreqs[i])
+		cp.filterBank.centerFreqs[i] = cp.unscale(cp.filterBank.centerFreqs[i])
 	}
 
 	// lower channel indices
@@ -143,12 +188,25 @@ func (cp *CParam) InitFBank2(sampleRate, frameRate int, filterBankSize, lowCutFr
 	// alloc memory for data buffer
 	cp.filterBank.fftRealValue = make([]float64, cp.filterBank.fttSize, cp.filterBank.fttSize)
 	cp.filterBank.fftComplexValue = make([]float64, cp.filterBank.fttSize, cp.filterBank.fttSize)
+	cp.filterBank.fbankValue = make([]float64, filterBankSize, filterBankSize)
+	cp.filterBank.workValue = make([]float64, 4 * (filterBankSize + 2), 4 * (filterBankSize + 2))
+	cp.filterBank.yinValue = make([]float64, sampleRate / constant.MIN_F0 + 1, sampleRate / constant.MIN_F0 + 1)
+
+	// the window only depends on the frame size, build it once here so
+	// clones can share it
+	cp.initHamming(cp.filterBank.frameSize)
 
 	// the defaults
 	cp.filterBank.isLogFBChannels = true
 	cp.filterBank.isUsePower = false
 	cp.filterBank.isPreEmphasize = true
 	cp.filterBank.isUseHamming = true
+
+	// PLP works on the power spectrum
+	if cp.frontEnd == FrontEndPLP || cp.frontEnd == FrontEndRastaPLP {
+		cp.filterBank.isUsePower = true
+		cp.initPLP()
+	}
 	return nil
 }
 
@@ -211,6 +269,8 @@ func (cp *CParam) Wav2Mfcc(data []float32, wavinfo waveIO.WavInfo, fParam *[]flo
 	var fttIndex int = cp.filterBank.fttSize >> 1
 	var melfloor float32 = float32(1.0)
 	var fstatic []float32
+	var rasta *rastaFilter
+	var noise *denoiser
 	var err error
 
 	// calculate number of rows (frames)
@@ -223,41 +283,35 @@ func (cp *CParam) Wav2Mfcc(data []float32, wavinfo waveIO.WavInfo, fParam *[]flo
 	*row = int((wavinfo.Length - int64(cp.filterBank.frameSize - iFrameRate)) / int64(iFrameRate))
 
 	// buffer for raw static params (include the 0th coef)
-	width = cp.mfcc.mfccOrder + 1
+	width = cp.staticWidth()
+
+	if cp.frontEnd == FrontEndRastaPLP {
+		rasta = newRastaFilter(cp.filterBank.filterBankSize, cp.mfcc.RastaCoff)
+	}
+
+	if cp.noiseReduction != NoiseReductionNone && cp.frontEnd != FrontEndProsody {
+		noise = cp.newDenoiser(data, *row, iFrameRate)
+	}
 
 	fstatic = make([]float32, (*row) * width, (*row) * width)
 
 	// buffer for filter banks
 
 	for i := 0; i < *row; i++ {
-		cp.filterBank.fftRealValue = make([]float64, cp.filterBank.fttSize, cp.filterBank.fttSize)
-		cp.filterBank.fftComplexValue = make([]float64, cp.filterBank.fttSize, cp.filterBank.fttSize)
-
-		for j := 0; j < cp.filterBank.frameSize; j++ {
-			cp.filterBank.fftRealValue[j] = float64(data[i * iFrameRate + j])
-		}
-
-		// Do pre-emphasis
-		if cp.filterBank.isPreEmphasize {
-			cp.preEmphasise(cp.filterBank.fftRealValue, cp.filterBank.frameSize)
+		if cp.frontEnd == FrontEndProsody {
+			cp.prosody(data, wavinfo.Length, i * iFrameRate, fstatic[i * width:(i + 1) * width])
+			continue
 		}
 
-		// Do hamming
-		if cp.filterBank.isUseHamming {
-			cp.doHamming(cp.filterBank.fftRealValue, cp.filterBank.frameSize)
-		}
+		cp.powerSpectrum(data, i * iFrameRate)
 
-		// take fft
-		err = gomath.FFT(cp.filterBank.fftRealValue, cp.filterBank.fftComplexValue, cp.filterBank.fttSize)
-		if err != nil {
-			return err
+		var filterBank []float64 = cp.filterBank.fbankValue
+		for j := range filterBank {
+			filterBank[j] = 0
 		}
 
-		var filterBank []float64 = make([]float64, cp.filterBank.filterBankSize)
-		for j := 0; j < fttIndex; j++ {
-			cp.filterBank.fftRealValue[j] =
-				cp.filterBank.fftRealValue[j] * cp.filterBank.fftRealValue[j] +
-					cp.filterBank.fftComplexValue[j] * cp.filterBank.fftComplexValue[j]
+		if noise != nil {
+			noise.reduce(cp.filterBank.fftRealValue[:fttIndex])
 		}
 
 		//	Differential Power Spectrum
@@ -295,30 +349,46 @@ func (cp *CParam) Wav2Mfcc(data []float32, wavinfo waveIO.WavInfo, fParam *[]flo
 			}
 		}
 
-		// take logs
-		if cp.filterBank.isLogFBChannels {
-			for j := 0; j < cp.filterBank.filterBankSize; j++ {
-				if filterBank[j] >= float64(melfloor) {
-					filterBank[j] = math.Log(filterBank[j])
-				} else {
-					filterBank[j] = math.Log(float64(melfloor))
+		switch cp.frontEnd {
+		case FrontEndPLP, FrontEndRastaPLP:
+			cp.plp(filterBank, rasta)
+
+			if cp.mfcc.IsLiftCepstral {
+				err = cp.liftCepstral(filterBank)
+				if err != nil {
+					return err
 				}
 			}
-		}
 
-		// take dct
-		if !cp.mfcc.isFilter {
-			err = gomath.DCT(filterBank, &width)
-			if err != nil {
-				return err
+		case FrontEndSSC:
+			cp.subbandCentroids(filterBank, fttIndex)
+
+		default:
+			// take logs
+			if cp.filterBank.isLogFBChannels {
+				for j := 0; j < cp.filterBank.filterBankSize; j++ {
+					if filterBank[j] >= float64(melfloor) {
+						filterBank[j] = math.Log(filterBank[j])
+					} else {
+						filterBank[j] = math.Log(float64(melfloor))
+					}
+				}
 			}
 
-			// Liftering
-			if cp.mfcc.IsLiftCepstral {
-				err = cp.liftCepstral(filterBank)
+			// take dct
+			if !cp.mfcc.isFilter {
+				err = gomath.DCT(filterBank, &width)
 				if err != nil {
 					return err
 				}
+
+				// Liftering
+				if cp.mfcc.IsLiftCepstral {
+					err = cp.liftCepstral(filterBank)
+					if err != nil {
+						return err
+					}
+				}
 			}
 		}
 
@@ -369,6 +439,7 @@ func (cp *CParam) Wav2Mfcc(data []float32, wavinfo waveIO.WavInfo, fParam *[]flo
 //                of the conjunct params.
 func (cp *CParam) static2Full(fstatic []float32, col, row *int) ([]float32, error) {
 	var width int = *col
+	var first int = cp.firstCoef()
 	var iSOff, iDOff, ipt int
 	var fdelta, facce, fParam []float32
 	var err error
@@ -407,15 +478,15 @@ func (cp *CParam) static2Full(fstatic []float32, col, row *int) ([]float32, erro
 	*col = 0
 
 	if cp.mfcc.IsStatic {
-		*col += cp.mfcc.mfccOrder
+		*col += width - first
 	}
 
 	if cp.mfcc.IsDynamic {
-		*col += cp.mfcc.mfccOrder
+		*col += width - first
 	}
 
 	if cp.mfcc.IsAcce {
-		*col += cp.mfcc.mfccOrder
+		*col += width - first
 	}
 
 	// prepare for parameter buffer
@@ -424,21 +495,21 @@ func (cp *CParam) static2Full(fstatic []float32, col, row *int) ([]float32, erro
 	for i := 0; i < *row; i++ {
 
 		if cp.mfcc.IsStatic {
-			for j := 1; j < width; j++ {
+			for j := first; j < width; j++ {
 				fParam[ipt] = fstatic[(i + iSOff) * width + j]
 				ipt++
 			}
 		}
 
 		if cp.mfcc.IsDynamic {
-			for j := 1; j < width; j++ {
+			for j := first; j < width; j++ {
 				fParam[ipt] = fdelta[(i + iDOff) * width + j]
 				ipt++
 			}
 		}
 
 		if cp.mfcc.IsAcce {
-			for j := 1; j < width; j++ {
+			for j := first; j < width; j++ {
 				fParam[ipt] = facce[i * width + j]
 				ipt++
 			}
@@ -463,40 +534,7 @@ func (cp *CParam) FeatureNorm(fParam [][]float32, iVecSize, iVecNum int) error {
 		return fmt.Errorf("Nb of frames less than zero")
 	}
 
-	var cmsMean []float32 = make([]float32, iVecSize, iVecSize)
-	var cmsStdv []float32 = make([]float32, iVecSize, iVecSize)
-	var tempMean, tempStdv float32 = 0, 0
-
-	//Get the average value of the mV
-	for i := 0; i < iVecSize / 2; i++ {
-		for j := 0; j < iVecNum; j++ {
-			tempMean += fParam[j][i]
-			tempStdv += fParam[j][i] * fParam[j][i]
-		}
-
-		cmsMean[i] = tempMean / float32(iVecNum)
-
-		//Get the standard deviations
-		cmsStdv[i] = tempStdv / float32(iVecNum)
-		cmsStdv[i] -= cmsMean[i] * cmsMean[i]
-
-		if cmsStdv[i] <= 0 {
-			cmsStdv[i] = 1.0
-		} else {
-			cmsStdv[i] = float32(math.Sqrt(float64(cmsStdv[i])))
-		}
-
-		tempMean = 0
-		tempStdv = 0
-	}
-
-	//subtract the average value
-	for i := 0; i < iVecSize / 2; i++ {
-		for j := 0; j < iVecNum; j++ {
-			fParam[j][i] = (fParam[j][i] - cmsMean[i]) / cmsStdv[i]
-		}
-	}
-
+	cmvn(fParam[:iVecNum], iVecSize / 2)
 	return nil
 }
 
@@ -506,43 +544,15 @@ func (cp *CParam) FeatureNorm2(fParam []float32, iVecSize, iVecNum int) error {
 	}
 
 	if iVecNum <= 0 {
-		fmt.Errorf("Nb of frames less than zero")
-	}
-
-	var cmsMean []float32 = make([]float32, iVecSize, iVecSize)
-	var cmsStdv []float32 = make([]float32, iVecSize, iVecSize)
-	var tempMean, tempStdv float32 = 0, 0
-
-	//Get the average value of the mV
-	for i := 0; i < iVecSize / 2; i++ {
-		for j := 0; j < iVecNum; j++ {
-			tempMean += fParam[j * iVecSize + i]
-			tempStdv += fParam[j * iVecSize + i] * fParam[j * iVecSize + i]
-		}
-
-		cmsMean[i] = tempMean / float32(iVecNum)
-
-		//Get the standard deviations
-		cmsStdv[i] = tempStdv / float32(iVecNum)
-		cmsStdv[i] -= cmsMean[i] * cmsMean[i]
-
-		if cmsStdv[i] <= 0 {
-			cmsStdv[i] = 1.0
-		} else {
-			cmsStdv[i] = float32(math.Sqrt(float64(cmsStdv[i])))
-		}
-
-		tempMean = 0
-		tempStdv = 0
+		return fmt.Errorf("Nb of frames less than zero")
 	}
 
-	//subtract the average value
-	for i := 0; i < iVecSize / 2; i++ {
-		for j := 0; j < iVecNum; j++ {
-			fParam[j * iVecSize + i] = (fParam[j * iVecSize + i] - cmsMean[i]) / cmsStdv[i]
-		}
+	var rows [][]float32 = make([][]float32, iVecNum, iVecNum)
+	for j := 0; j < iVecNum; j++ {
+		rows[j] = fParam[j * iVecSize:(j + 1) * iVecSize]
 	}
 
+	cmvn(rows, iVecSize / 2)
 	return nil
 }
 
@@ -693,79 +703,22 @@ func (cp *CParam) PDASCC(pointNB int) {
 }
 
 //------------- Feature Warping -------------------------------------------------
-// nWinSize=300
-// vSize=nStep=特征维数
-// nInNum 输入特征帧数
-// data 输入特征
-// nOutNum 输出特征帧数
+// Warp the first vSize dimensions of the static coefficients to N(0, 1)
+// over a window of nWinSize frames, see NormWarping.
+// vSize  : dimensions to warp
+// nInNum : number of frames
+// nStep  : width of a frame in data
 func (cp *CParam) warping(data []float32, vSize int, nInNum *int, nStep, nWinSize int) error {
-
-	cp.createWarpTable()
-	var nOutNum int = *nInNum - nWinSize
-	if nOutNum <= 0 {
-		return fmt.Errorf("nOutNum can not <= 0")
+	if *nInNum <= 0 {
+		return fmt.Errorf("nInNum can not <= 0")
 	}
 
-	var warpBuf []float32 = make([]float32, nOutNum * nStep, nOutNum * nStep)
-	var warpFrmNo int = 0
-	var pDataIvt []float32 = make([]float32, nOutNum * nStep, nOutNum * nStep)
-
-	for i := 0; i < nStep; i++ {
-		//		var dst []float32 = make([]float32, nOutNum*nStep+i*nInNum, nOutNum*nStep+i*nInNum)
-		for j := 0; j < *nInNum; j++ {
-			//			dst[j] = data[j*nStep+i]
-			if j < nOutNum * nStep {
-				pDataIvt[j] = data[j * nStep + i]
-			}
-		}
-	}
-
-	var halfwin int = nWinSize >> 1
-	var minus_res []float32 = make([]float32, nWinSize, nWinSize)
-
-	for i := halfwin; i + halfwin < *nInNum; i++ {
-		for k := 0; k < vSize; k++ {
-
-			var p []float32 = append(pDataIvt,
-				make([]float32, nOutNum * nStep + k * (*nInNum) - nOutNum * nStep)...)
-
-			var curValue float32 = p[i]
-			t := halfwin - i
-			nIndex := 2 * halfwin - 1
-
-			for m := i - halfwin; m < i; m++ {
-				minus_res[t + m] = p[m] - curValue
-			}
-
-			t = halfwin - i - 1
-
-			for m := i + 1; m < i + halfwin; m++ {
-				minus_res[t + m] = p[m] - curValue
-			}
-
-			var ui []uint = make([]uint, nWinSize, nWinSize)
-			for i := 0; i < nWinSize; i++ {
-				ui[i] = uint(minus_res[i])
-			}
-
-			for m := 0; m < 2 * halfwin - 1; m++ {
-				nIndex -= int((ui[m] >> 31))
-			}
-
-			warpBuf[warpFrmNo * nStep + k] = cp.warpTable[nIndex]
-		}
-
-		for k := vSize; k < nStep; k++ {
-			warpBuf[warpFrmNo * nStep + k] = data[i * nStep + k]
-		}
-		warpFrmNo++
+	var rows [][]float32 = make([][]float32, *nInNum, *nInNum)
+	for i := 0; i < *nInNum; i++ {
+		rows[i] = data[i * nStep:i * nStep + vSize]
 	}
 
-	*nInNum = warpFrmNo
-
-	copy(data[:warpFrmNo * nStep], warpBuf[:warpFrmNo * nStep])
-
-	return nil
+	return Normalize(rows, NormWarping, nWinSize)
 }
 
 //------------- Rasta-filtering -------------------------------------------------
@@ -809,32 +762,6 @@ func (cp *CParam) rastaFiltering(data []float32, vSize int, nNum *int, nStep int
 	return nil
 }
 
-//------------- Create warping talbe --------------------------------------------
-func (cp *CParam) createWarpTable() {
-	var TableBegin, TableEnd, presice float64 = -10.0, 10.0, 1.0e-5
-	cp.warpTable = make([]float32, cp.warpWinLength, cp.warpWinLength)
-	var rankBuf []float64 = make([]float64, cp.warpWinLength, cp.warpWinLength)
-
-	for i := 0; i < cp.warpWinLength; i++ {
-		rankBuf[i] = float64(float64(cp.warpWinLength) - 0.5 - float64(i)) / float64(cp.warpWinLength)
-	}
-
-	var integral float64 = 0.0
-	var Index int = cp.warpWinLength - 1
-
-	for x := float64(TableBegin); x <= TableEnd; x += presice {
-		integral += float64(math.Exp(-x * x / 2.0) / math.Sqrt(2 * constant.PI) * presice)
-		if integral >= rankBuf[Index] {
-			cp.warpTable[Index] = float32(x)
-			Index--
-			if Index < 0 {
-				break
-			}
-		}
-	}
-	return
-}
-
 // mel -> frequency
 func (cp *CParam) freq(mel float32) float32 {
 	return float32(700 * (math.Exp(float64(mel) / float64(1127)) - 1))
@@ -851,21 +778,20 @@ func (cp *CParam) mel(freq float32) float32 {
 //     dVector : vector to be windowed
 //        iLen : length of the vector
 func (cp *CParam) doHamming(dVector []float64, iLen int) {
-	var a float64
-	if cp.hammingWinSize != nil && iLen != len(cp.hammingWinSize) {
-		cp.hammingWinSize = nil
+	if len(cp.hammingWinSize) != iLen {
+		cp.initHamming(iLen)
 	}
 
-	if cp.hammingWinSize == nil {
-		cp.hammingWinSize = make([]float64, iLen, iLen)
-		a = float64(2) * constant.PI / float64(iLen - 1)
-		for i := 0; i < iLen; i++ {
-			cp.hammingWinSize[i] = 0.54 - 0.46 * math.Cos(a * float64(i))
-		}
+	for i := 0; i < iLen; i++ {
+		dVector[i] *= cp.hammingWinSize[i]
 	}
+}
 
+func (cp *CParam) initHamming(iLen int) {
+	a := float64(2) * constant.PI / float64(iLen - 1)
+	cp.hammingWinSize = make([]float64, iLen, iLen)
 	for i := 0; i < iLen; i++ {
-		dVector[i] *= cp.hammingWinSize[i]
+		cp.hammingWinSize[i] = 0.54 - 0.46 * math.Cos(a * float64(i))
 	}
 }
 
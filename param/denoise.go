@@ -0,0 +1,161 @@
+package param
+
+import (
+	"fmt"
+	"github.com/liuxp0827/govpr/constant"
+	"sort"
+	"strings"
+)
+
+// NoiseReduction selects how Wav2Mfcc cleans the power spectrum before the
+// filter bank. The noise spectrum is estimated per utterance from its
+// quietest frames, so the stage adapts to whatever car or street noise the
+// recording has without a separate noise sample.
+type NoiseReduction int
+
+const (
+	NoiseReductionNone        NoiseReduction = iota // no noise reduction (default)
+	NoiseReductionSubtraction                       // power spectral subtraction with over-subtraction and a spectral floor
+	NoiseReductionWiener                            // Wiener filter with a decision-directed a priori SNR
+)
+
+var noiseReductionNames = []string{"none", "subtraction", "wiener"}
+
+func (nr NoiseReduction) String() string {
+	if nr < 0 || int(nr) >= len(noiseReductionNames) {
+		return fmt.Sprintf("NoiseReduction(%d)", int(nr))
+	}
+	return noiseReductionNames[nr]
+}
+
+func ParseNoiseReduction(name string) (NoiseReduction, error) {
+	for i, n := range noiseReductionNames {
+		if strings.EqualFold(name, n) {
+			return NoiseReduction(i), nil
+		}
+	}
+	return NoiseReductionNone, fmt.Errorf("unknown noise reduction %q", name)
+}
+
+// Select the noise reduction. The prosody front end works on the waveform
+// and is not affected.
+func (cp *CParam) SetNoiseReduction(nr NoiseReduction) error {
+	if nr < NoiseReductionNone || nr > NoiseReductionWiener {
+		return fmt.Errorf("unknown noise reduction %d", int(nr))
+	}
+	cp.noiseReduction = nr
+	return nil
+}
+
+func (cp *CParam) NoiseReduction() NoiseReduction {
+	return cp.noiseReduction
+}
+
+// powerSpectrum frames, pre-emphasises and windows the samples from start
+// and leaves the power spectrum in fftRealValue[0:fttSize/2].
+func (cp *CParam) powerSpectrum(data []float32, start int) {
+	fb := cp.filterBank
+	for j := 0; j < fb.fttSize; j++ {
+		if j < fb.frameSize {
+			fb.fftRealValue[j] = float64(data[start+j])
+		} else {
+			fb.fftRealValue[j] = 0
+		}
+	}
+
+	// Do pre-emphasis
+	if fb.isPreEmphasize {
+		cp.preEmphasise(fb.fftRealValue, fb.frameSize)
+	}
+
+	// Do hamming
+	if fb.isUseHamming {
+		cp.doHamming(fb.fftRealValue, fb.frameSize)
+	}
+
+	// take fft, the input is real so only the half spectrum is computed
+	fb.fftPlan.Forward(fb.fftRealValue, fb.fftRealValue, fb.fftComplexValue)
+
+	for j := 0; j < fb.fttSize>>1; j++ {
+		fb.fftRealValue[j] = fb.fftRealValue[j]*fb.fftRealValue[j] + fb.fftComplexValue[j]*fb.fftComplexValue[j]
+	}
+}
+
+type denoiser struct {
+	mode  NoiseReduction
+	noise []float64 // noise power spectrum
+	prior []float64 // clean power of the previous frame, for the Wiener a priori SNR
+}
+
+// newDenoiser estimates the noise power spectrum as the average spectrum of
+// the NOISE_FRAME_RATIO quietest frames of the utterance.
+func (cp *CParam) newDenoiser(data []float32, rows, frameRate int) *denoiser {
+	fttIndex := cp.filterBank.fttSize >> 1
+	d := &denoiser{
+		mode:  cp.noiseReduction,
+		noise: make([]float64, fttIndex),
+		prior: make([]float64, fttIndex),
+	}
+	if rows <= 0 {
+		return d
+	}
+
+	energy := make([]float64, rows)
+	order := make([]int, rows)
+	for i := 0; i < rows; i++ {
+		cp.powerSpectrum(data, i*frameRate)
+		for j := 0; j < fttIndex; j++ {
+			energy[i] += cp.filterBank.fftRealValue[j]
+		}
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return energy[order[a]] < energy[order[b]] })
+
+	n := int(float64(rows) * constant.NOISE_FRAME_RATIO)
+	if n < 1 {
+		n = 1
+	}
+	for _, i := range order[:n] {
+		cp.powerSpectrum(data, i*frameRate)
+		for j := 0; j < fttIndex; j++ {
+			d.noise[j] += cp.filterBank.fftRealValue[j]
+		}
+	}
+	for j := range d.noise {
+		d.noise[j] /= float64(n)
+	}
+	return d
+}
+
+// reduce cleans the power spectrum of one frame in place, frames must be
+// passed in time order.
+func (d *denoiser) reduce(power []float64) {
+	for j, p := range power {
+		n := d.noise[j]
+		if n <= 0 {
+			continue
+		}
+
+		switch d.mode {
+		case NoiseReductionSubtraction:
+			clean := p - constant.OVER_SUBTRACTION*n
+			if clean < constant.SPECTRAL_FLOOR*n {
+				clean = constant.SPECTRAL_FLOOR * n
+			}
+			power[j] = clean
+
+		case NoiseReductionWiener:
+			post := p/n - 1 // a posteriori SNR - 1
+			if post < 0 {
+				post = 0
+			}
+			xi := constant.WIENER_SMOOTHING*d.prior[j]/n + (1-constant.WIENER_SMOOTHING)*post
+			if xi < constant.SPECTRAL_FLOOR {
+				xi = constant.SPECTRAL_FLOOR
+			}
+			gain := xi / (1 + xi)
+			power[j] = gain * gain * p
+			d.prior[j] = power[j]
+		}
+	}
+}
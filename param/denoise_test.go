@@ -0,0 +1,171 @@
+package param
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/liuxp0827/govpr/constant"
+	"github.com/liuxp0827/govpr/waveIO"
+)
+
+func newTestCParam(t *testing.T, nr NoiseReduction) *CParam {
+	cp := NewCParam()
+	if err := cp.SetNoiseReduction(nr); err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.InitFBank2(constant.SAMPLERATE, constant.FRAME_LENGTH, constant.FILTER_BANK_SIZE,
+		constant.LOW_CUT_OFF, constant.HIGH_CUT_OFF); err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.InitMfcc(constant.MFCC_ORDER, constant.FRAME_SHIFTt); err != nil {
+		t.Fatal(err)
+	}
+	return cp
+}
+
+// testSignals returns 4 s of 1 kHz tone bursts, half a second on and half
+// off, alone and under white noise of the given standard deviation
+func testSignals(sigma float64) (clean, noisy []float32) {
+	rng := rand.New(rand.NewSource(1))
+	n := 4 * constant.SAMPLERATE
+	clean, noisy = make([]float32, n), make([]float32, n)
+	for i := range clean {
+		if (i/(constant.SAMPLERATE/2))%2 == 0 {
+			clean[i] = float32(3000 * math.Sin(2*math.Pi*1000*float64(i)/constant.SAMPLERATE))
+		}
+		// the clean signal keeps a faint noise, a log spectrum of silence
+		// is -inf
+		clean[i] += float32(rng.NormFloat64())
+		noisy[i] = clean[i] + float32(sigma*rng.NormFloat64())
+	}
+	return clean, noisy
+}
+
+// frameRate in samples of the test CParam
+const testFrameRate = constant.FRAME_SHIFTt * constant.SAMPLERATE / 1000
+
+func TestNoiseEstimate(t *testing.T) {
+	cp := newTestCParam(t, NoiseReductionSubtraction)
+	_, noisy := testSignals(300)
+	rows := (len(noisy) - cp.filterBank.frameSize) / testFrameRate
+	d := cp.newDenoiser(noisy, rows, testFrameRate)
+
+	// the quietest frames are the noise alone, of a flat spectrum
+	var est float64
+	for _, v := range d.noise {
+		est += v
+	}
+
+	var want float64
+	noise := make([]float32, len(noisy))
+	rng := rand.New(rand.NewSource(2))
+	for i := range noise {
+		noise[i] = float32(300 * rng.NormFloat64())
+	}
+	for i := 0; i < rows; i++ {
+		cp.powerSpectrum(noise, i*testFrameRate)
+		for _, v := range cp.filterBank.fftRealValue[:len(d.noise)] {
+			want += v
+		}
+	}
+	want /= float64(rows)
+
+	if est < want/2 || est > want*2 {
+		t.Fatalf("noise power estimated at %g, want about %g", est, want)
+	}
+}
+
+func TestReduce(t *testing.T) {
+	for _, nr := range []NoiseReduction{NoiseReductionSubtraction, NoiseReductionWiener} {
+		cp := newTestCParam(t, nr)
+		_, noisy := testSignals(300)
+		rows := (len(noisy) - cp.filterBank.frameSize) / testFrameRate
+		d := cp.newDenoiser(noisy, rows, testFrameRate)
+
+		// power of the noise between the bursts and of the tone band in
+		// the bursts, before and after the reduction
+		fftIndex := cp.filterBank.fttSize >> 1
+		toneBin := 1000 * cp.filterBank.fttSize / constant.SAMPLERATE
+		var noiseBefore, noiseAfter, toneBefore, toneAfter float64
+		power := make([]float64, fftIndex)
+		for i := 0; i < rows; i++ {
+			cp.powerSpectrum(noisy, i*testFrameRate)
+			copy(power, cp.filterBank.fftRealValue[:fftIndex])
+			d.reduce(cp.filterBank.fftRealValue[:fftIndex])
+			after := cp.filterBank.fftRealValue[:fftIndex]
+
+			// skip the frames across an edge of a burst
+			start, end := i*testFrameRate, i*testFrameRate+cp.filterBank.frameSize
+			half := constant.SAMPLERATE / 2
+			if start/half != (end-1)/half {
+				continue
+			}
+			if (start/half)%2 == 0 {
+				for j := toneBin - 2; j <= toneBin+2; j++ {
+					toneBefore += power[j]
+					toneAfter += after[j]
+				}
+				continue
+			}
+			for j := range power {
+				noiseBefore += power[j]
+				noiseAfter += after[j]
+			}
+		}
+
+		// a bin of white noise is of exponential power, subtraction of its
+		// mean and the floor leave about 0.56 of it
+		if noiseAfter > noiseBefore*0.7 {
+			t.Errorf("%v: noise power %g of %g left between the bursts", nr, noiseAfter, noiseBefore)
+		}
+		if toneAfter < toneBefore*0.8 {
+			t.Errorf("%v: tone power %g of %g left in the bursts", nr, toneAfter, toneBefore)
+		}
+	}
+}
+
+// features returns the static cepstra of data
+func features(t *testing.T, nr NoiseReduction, data []float32) []float32 {
+	cp := newTestCParam(t, nr)
+	cp.mfcc.IsDynamic = false
+	var para []float32
+	var col, row int
+	info := waveIO.WavInfo{Length: int64(len(data)), SampleRate: constant.SAMPLERATE, BitSPSample: constant.BIT_PER_SAMPLE}
+	if err := cp.Wav2Mfcc(append([]float32(nil), data...), info, &para, &col, &row); err != nil {
+		t.Fatal(err)
+	}
+	return para
+}
+
+func distance(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		d := float64(a[i] - b[i])
+		sum += d * d
+	}
+	return math.Sqrt(sum / float64(len(a)))
+}
+
+func TestWav2MfccNoisy(t *testing.T) {
+	clean, noisy := testSignals(300)
+	want := features(t, NoiseReductionNone, clean)
+	raw := distance(features(t, NoiseReductionNone, noisy), want)
+
+	for _, nr := range []NoiseReduction{NoiseReductionSubtraction, NoiseReductionWiener} {
+		if d := distance(features(t, nr, noisy), want); d >= raw {
+			t.Errorf("%v: features %g from the clean ones, %g without noise reduction", nr, d, raw)
+		}
+	}
+}
+
+func TestParseNoiseReduction(t *testing.T) {
+	for _, nr := range []NoiseReduction{NoiseReductionNone, NoiseReductionSubtraction, NoiseReductionWiener} {
+		if got, err := ParseNoiseReduction(nr.String()); err != nil || got != nr {
+			t.Errorf("ParseNoiseReduction(%q) = %v, %v", nr.String(), got, err)
+		}
+	}
+	if _, err := ParseNoiseReduction("loud"); err == nil {
+		t.Error("ParseNoiseReduction of an unknown name succeeded")
+	}
+}
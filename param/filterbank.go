@@ -1,5 +1,9 @@
 package param
 
+import (
+	gomath "github.com/liuxp0827/govpr/math"
+)
+
 type FilterBank struct {
 	sampleRate     int     // sample rate (samples / second)
 	frameSize      int     // frame size (in samples)
@@ -13,6 +17,12 @@ type FilterBank struct {
 	lowerFilterBanksWeight []float32 // array[1..fttSize/2] of lower fbank weighting
 	fftRealValue           []float64 // array[1..fttSize] of fft bins (real part)
 	fftComplexValue        []float64 // array[1..fttSize] of fft bins (image part)
+	fbankValue             []float64 // array[1..filterBankSize] of filter bank outputs
+	fftPlan                *gomath.RealFFTPlan
+	eqlWeight              []float64 // array[1..filterBankSize] of PLP equal loudness weights
+	plpCos                 []float64 // PLP spectrum -> autocorrelation table [order, filterBankSize+2]
+	workValue              []float64 // scratch for the PLP and SSC front ends
+	yinValue               []float64 // scratch for the YIN difference function
 
 	isUsePower      bool // use power rather than magnitude (d: false)
 	isLogFBChannels bool // log filterbank channels (d: true)
@@ -0,0 +1,342 @@
+package param
+
+import (
+	"fmt"
+	"github.com/liuxp0827/govpr/constant"
+	"math"
+	"strings"
+)
+
+// FrontEnd selects the per-frame parameters Wav2Mfcc computes. Every front
+// end shares the framing, windowing and FFT, and goes through the same
+// delta / acceleration stage, so the output is always a row-major
+// [frame][dimension] matrix.
+type FrontEnd int
+
+const (
+	FrontEndMFCC     FrontEnd = iota // mel frequency cepstra (default)
+	FrontEndLFCC                     // linear frequency cepstra
+	FrontEndPLP                      // perceptual linear prediction cepstra
+	FrontEndRastaPLP                 // PLP with RASTA filtering of the critical band trajectories
+	FrontEndSSC                      // spectral subband centroids
+	FrontEndProsody                  // log energy, log F0 and voicing probability
+)
+
+var frontEndNames = []string{"mfcc", "lfcc", "plp", "rasta-plp", "ssc", "prosody"}
+
+func (fe FrontEnd) String() string {
+	if fe < 0 || int(fe) >= len(frontEndNames) {
+		return fmt.Sprintf("FrontEnd(%d)", int(fe))
+	}
+	return frontEndNames[fe]
+}
+
+func ParseFrontEnd(name string) (FrontEnd, error) {
+	for i, n := range frontEndNames {
+		if strings.EqualFold(name, n) {
+			return FrontEnd(i), nil
+		}
+	}
+	return FrontEndMFCC, fmt.Errorf("unknown front end %q", name)
+}
+
+// Select the front end. Must be called before InitFBank/InitFBank2 since
+// LFCC and PLP change the filter bank layout.
+func (cp *CParam) SetFrontEnd(fe FrontEnd) error {
+	if fe < FrontEndMFCC || fe > FrontEndProsody {
+		return fmt.Errorf("unknown front end %d", int(fe))
+	}
+	cp.frontEnd = fe
+	return nil
+}
+
+func (cp *CParam) FrontEnd() FrontEnd {
+	return cp.frontEnd
+}
+
+// width of the raw static parameters, including the 0th coefficient of
+// the cepstral front ends
+func (cp *CParam) staticWidth() int {
+	switch cp.frontEnd {
+	case FrontEndSSC:
+		return cp.filterBank.filterBankSize
+	case FrontEndProsody:
+		return 3
+	}
+	return cp.mfcc.mfccOrder + 1
+}
+
+// index of the first static parameter kept in the output, the 0th
+// cepstral coefficient is dropped as it always has been for MFCC
+func (cp *CParam) firstCoef() int {
+	switch cp.frontEnd {
+	case FrontEndSSC, FrontEndProsody:
+		return 0
+	}
+	return 1
+}
+
+// frequency -> filter bank scale
+func (cp *CParam) scale(freq float32) float32 {
+	if cp.frontEnd == FrontEndLFCC {
+		return freq
+	}
+	return cp.mel(freq)
+}
+
+// filter bank scale -> frequency
+func (cp *CParam) unscale(v float32) float32 {
+	if cp.frontEnd == FrontEndLFCC {
+		return v
+	}
+	return cp.freq(v)
+}
+
+// Build the PLP tables from the filter bank centre frequencies: the equal
+// loudness weight of each channel and the cosine table that turns the
+// auditory spectrum into autocorrelations.
+func (cp *CParam) initPLP() {
+	fb := cp.filterBank
+	M := fb.filterBankSize
+
+	fb.eqlWeight = make([]float64, M, M)
+	for j := 0; j < M; j++ {
+		fsq := float64(fb.centerFreqs[j+1]) * float64(fb.centerFreqs[j+1])
+		fsub := fsq / (fsq + 1.6e5)
+		fb.eqlWeight[j] = fsub * fsub * ((fsq + 1.44e6) / (fsq + 9.61e6))
+	}
+
+	// inverse DFT of the even spectrum s[0..M+1], s[0] and s[M+1] appear
+	// once, the rest twice; the order is at most M-1
+	N := float64(2 * (M + 1))
+	fb.plpCos = make([]float64, M*(M+2), M*(M+2))
+	for k := 0; k < M; k++ {
+		for j := 0; j <= M+1; j++ {
+			w := 2.0
+			if j == 0 || j == M+1 {
+				w = 1.0
+			}
+			fb.plpCos[k*(M+2)+j] = w * math.Cos(constant.PI*float64(j*k)/float64(M+1)) / N
+		}
+	}
+}
+
+// plp replaces the power filter bank outputs in fbank by mfccOrder+1 PLP
+// cepstra: equal loudness, cube root compression, all-pole model of the
+// auditory spectrum and LPC -> cepstrum. The 0th coefficient is the log
+// of the prediction error.
+func (cp *CParam) plp(fbank []float64, rasta *rastaFilter) {
+	fb := cp.filterBank
+	M := fb.filterBankSize
+	order := cp.mfcc.mfccOrder
+
+	s := fb.workValue[0 : M+2]
+	r := fb.workValue[M+2 : M+2+order+1]
+	a := fb.workValue[2*(M+2) : 2*(M+2)+order+1]
+	tmp := fb.workValue[3*(M+2) : 3*(M+2)+order+1]
+
+	for j := 0; j < M; j++ {
+		e := math.Max(fbank[j], 1.0)
+		if rasta != nil {
+			e = math.Exp(rasta.filter(j, math.Log(e)))
+		}
+		s[j+1] = math.Cbrt(e * fb.eqlWeight[j])
+	}
+	s[0] = s[1]
+	s[M+1] = s[M]
+
+	for k := 0; k <= order; k++ {
+		r[k] = 0
+		for j, v := range s {
+			r[k] += v * fb.plpCos[k*(M+2)+j]
+		}
+	}
+
+	// Levinson-Durbin, A(z) = 1 + a[1]z^-1 + ... + a[order]z^-order
+	e := r[0]
+	for i := range a {
+		a[i] = 0
+	}
+	a[0] = 1
+	for i := 1; i <= order && e > 0; i++ {
+		acc := r[i]
+		for j := 1; j < i; j++ {
+			acc += a[j] * r[i-j]
+		}
+		k := -acc / e
+
+		copy(tmp, a)
+		for j := 1; j < i; j++ {
+			a[j] = tmp[j] + k*tmp[i-j]
+		}
+		a[i] = k
+		e *= 1 - k*k
+	}
+
+	if e <= 0 {
+		e = math.SmallestNonzeroFloat64
+	}
+
+	// LPC -> cepstrum
+	fbank[0] = math.Log(e)
+	for n := 1; n <= order; n++ {
+		c := -a[n]
+		for k := 1; k < n; k++ {
+			c -= float64(k) / float64(n) * fbank[k] * a[n-k]
+		}
+		fbank[n] = c
+	}
+}
+
+// rastaFilter band-passes the log critical band trajectories across frames,
+// H(z) = 0.1 * (2 + z^-1 - z^-3 - 2z^-4) / (1 - pole*z^-1).
+type rastaFilter struct {
+	pole    float64
+	started []bool
+	x       [][4]float64 // last 4 inputs per channel, newest first
+	y       []float64    // last output per channel
+}
+
+func newRastaFilter(channels int, pole float64) *rastaFilter {
+	return &rastaFilter{
+		pole:    pole,
+		started: make([]bool, channels, channels),
+		x:       make([][4]float64, channels, channels),
+		y:       make([]float64, channels, channels),
+	}
+}
+
+func (rf *rastaFilter) filter(channel int, v float64) float64 {
+	x := &rf.x[channel]
+	if !rf.started[channel] {
+		// start from a flat history so the first frames are not a step
+		x[0], x[1], x[2], x[3] = v, v, v, v
+		rf.started[channel] = true
+	}
+
+	y := 0.1*(2*v+x[0]-x[2]-2*x[3]) + rf.pole*rf.y[channel]
+	x[3], x[2], x[1], x[0] = x[2], x[1], x[0], v
+	rf.y[channel] = y
+	return y
+}
+
+// subbandCentroids writes the power weighted mean frequency (in kHz) of
+// every filter bank channel to out, reading the spectrum in fftRealValue.
+func (cp *CParam) subbandCentroids(out []float64, fttIndex int) {
+	fb := cp.filterBank
+	M := fb.filterBankSize
+
+	num := out[:M]
+	den := fb.workValue[:M]
+	for j := 0; j < M; j++ {
+		num[j], den[j] = 0, 0
+	}
+
+	for j := 0; j < fttIndex; j++ {
+		idx := int(fb.lowerFilterBanksIndex[j])
+		if idx < 0 {
+			continue
+		}
+
+		f := float64(j) * float64(fb.fttResolution) * 1e-3
+		p := fb.fftRealValue[j]
+		w := float64(fb.lowerFilterBanksWeight[j])
+		if idx != 0 {
+			num[idx-1] += f * w * p
+			den[idx-1] += w * p
+		}
+		if idx < M {
+			num[idx] += f * (1 - w) * p
+			den[idx] += (1 - w) * p
+		}
+	}
+
+	for j := 0; j < M; j++ {
+		if den[j] > 0 {
+			num[j] /= den[j]
+		} else {
+			num[j] = float64(fb.centerFreqs[j+1]) * 1e-3
+		}
+	}
+}
+
+// prosody writes log energy, log F0 (0 when unvoiced) and the voicing
+// probability of the frame starting at sample start to out. F0 is
+// estimated with YIN over a window of one frame plus the longest period.
+func (cp *CParam) prosody(data []float32, length int64, start int, out []float32) {
+	fb := cp.filterBank
+	W := fb.frameSize
+
+	var energy float64
+	for _, v := range data[start : start+W] {
+		energy += float64(v) * float64(v)
+	}
+	out[0] = float32(math.Log(math.Max(energy, 1.0)))
+	out[1], out[2] = 0, 0
+
+	maxLag := fb.sampleRate / constant.MIN_F0
+	minLag := fb.sampleRate / constant.MAX_F0
+	if int64(start+W+maxLag) > length {
+		start = int(length) - W - maxLag
+	}
+	if start < 0 || energy == 0 {
+		return
+	}
+	x := data[start : start+W+maxLag]
+
+	// cumulative mean normalized difference function
+	d := fb.yinValue[:maxLag+1]
+	d[0] = 1
+	var sum float64
+	for tau := 1; tau <= maxLag; tau++ {
+		var dt float64
+		for j := 0; j < W; j++ {
+			diff := float64(x[j]) - float64(x[j+tau])
+			dt += diff * diff
+		}
+		sum += dt
+		if sum > 0 {
+			d[tau] = dt * float64(tau) / sum
+		} else {
+			d[tau] = 1
+		}
+	}
+
+	// first dip under the threshold, followed down to its minimum,
+	// otherwise the global minimum
+	best := -1
+	for tau := minLag; tau <= maxLag; tau++ {
+		if d[tau] < constant.YIN_THRESHOLD {
+			for tau+1 <= maxLag && d[tau+1] < d[tau] {
+				tau++
+			}
+			best = tau
+			break
+		}
+	}
+
+	voiced := best > 0
+	if !voiced {
+		best = minLag
+		for tau := minLag; tau <= maxLag; tau++ {
+			if d[tau] < d[best] {
+				best = tau
+			}
+		}
+	}
+
+	out[2] = float32(math.Min(math.Max(1-d[best], 0), 1))
+	if !voiced {
+		return
+	}
+
+	// parabolic interpolation of the period
+	period := float64(best)
+	if best > minLag && best < maxLag {
+		den := d[best-1] - 2*d[best] + d[best+1]
+		if den != 0 {
+			period += (d[best-1] - d[best+1]) / (2 * den)
+		}
+	}
+	out[1] = float32(math.Log(float64(fb.sampleRate) / period))
+}
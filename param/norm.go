@@ -0,0 +1,244 @@
+package param
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// NormMode selects the feature normalisation applied after the deltas.
+type NormMode int
+
+const (
+	NormStaticCMVN  NormMode = iota // utterance CMVN of the first half of the dimensions, as FeatureNorm (default)
+	NormCMVN                        // utterance CMVN of all dimensions
+	NormSlidingCMVN                 // CMVN over a window of frames around each frame
+	NormWarping                     // feature warping to N(0, 1) over a window of frames around each frame
+)
+
+var normModeNames = []string{"static-cmvn", "cmvn", "sliding-cmvn", "warping"}
+
+func (m NormMode) String() string {
+	if m < 0 || int(m) >= len(normModeNames) {
+		return fmt.Sprintf("NormMode(%d)", int(m))
+	}
+	return normModeNames[m]
+}
+
+func ParseNormMode(name string) (NormMode, error) {
+	for i, n := range normModeNames {
+		if strings.EqualFold(name, n) {
+			return NormMode(i), nil
+		}
+	}
+	return NormStaticCMVN, fmt.Errorf("unknown normalisation %q", name)
+}
+
+// windowed modes need the frames around each frame, the others the whole
+// utterance
+func (m NormMode) windowed() bool {
+	return m == NormSlidingCMVN || m == NormWarping
+}
+
+// Normalize normalises features in place. window is the number of frames
+// the sliding modes look at, centred on each frame and shifted inwards at
+// the ends of the utterance so it always holds window frames when the
+// utterance is long enough. The result is the same as pushing the frames
+// through a Normalizer.
+func Normalize(features [][]float32, mode NormMode, window int) error {
+	if len(features) == 0 {
+		return fmt.Errorf("Nb of frames less than zero")
+	}
+
+	n, err := NewNormalizer(mode, window)
+	if err != nil {
+		return err
+	}
+
+	var out [][]float32
+	for _, frame := range features {
+		out = append(out, n.Push(frame)...)
+	}
+	out = append(out, n.Flush()...)
+
+	for i := range features {
+		copy(features[i], out[i])
+	}
+	return nil
+}
+
+// Normalizer normalises a stream of frames. The sliding modes return each
+// frame once the frames up to half a window after it have been pushed, the
+// utterance modes return every frame from Flush.
+type Normalizer struct {
+	mode   NormMode
+	window int
+	frames [][]float32 // pushed frames from first on
+	first  int         // utterance index of frames[0]
+	next   int         // utterance index of the next frame to return
+	count  int         // frames pushed
+}
+
+func NewNormalizer(mode NormMode, window int) (*Normalizer, error) {
+	if mode < NormStaticCMVN || mode > NormWarping {
+		return nil, fmt.Errorf("unknown normalisation %d", int(mode))
+	}
+	if mode.windowed() && window <= 0 {
+		return nil, fmt.Errorf("invalid normalisation window %d", window)
+	}
+	return &Normalizer{mode: mode, window: window}, nil
+}
+
+// Push adds one frame and returns the frames that can be normalised now.
+func (n *Normalizer) Push(frame []float32) [][]float32 {
+	n.frames = append(n.frames, append([]float32(nil), frame...))
+	n.count++
+
+	if !n.mode.windowed() {
+		return nil
+	}
+
+	var out [][]float32
+	for n.count >= n.window && n.count >= n.next-n.window/2+n.window {
+		out = append(out, n.normalizeFrame(n.next, n.count))
+		n.next++
+
+		// drop the frames no later window starts at, the last windows of
+		// the utterance start window frames before its end
+		keep := n.next - n.window/2
+		if keep > n.count-n.window {
+			keep = n.count - n.window
+		}
+		if drop := keep - n.first; drop > 0 {
+			n.frames = n.frames[drop:]
+			n.first += drop
+		}
+	}
+	return out
+}
+
+// Flush returns the remaining frames, the Normalizer can then be used for
+// the next utterance.
+func (n *Normalizer) Flush() [][]float32 {
+	var out [][]float32
+	switch n.mode {
+	case NormStaticCMVN:
+		if len(n.frames) > 0 {
+			cmvn(n.frames, len(n.frames[0])/2)
+		}
+		out = n.frames
+
+	case NormCMVN:
+		if len(n.frames) > 0 {
+			cmvn(n.frames, len(n.frames[0]))
+		}
+		out = n.frames
+
+	default:
+		for ; n.next < n.count; n.next++ {
+			out = append(out, n.normalizeFrame(n.next, n.count))
+		}
+	}
+
+	n.frames = nil
+	n.first, n.next, n.count = 0, 0, 0
+	return out
+}
+
+// normalizeFrame normalises frame i of an utterance of at least length
+// frames against its window.
+func (n *Normalizer) normalizeFrame(i, length int) []float32 {
+	start := i - n.window/2
+	if start+n.window > length {
+		start = length - n.window
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + n.window
+	if end > length {
+		end = length
+	}
+
+	window := n.frames[start-n.first : end-n.first]
+	frame := n.frames[i-n.first]
+	out := make([]float32, len(frame))
+
+	if n.mode == NormWarping {
+		for j, v := range frame {
+			out[j] = warp(window, j, v)
+		}
+		return out
+	}
+
+	size := float64(len(window))
+	for j, v := range frame {
+		var sum, sqr float64
+		for _, w := range window {
+			sum += float64(w[j])
+			sqr += float64(w[j]) * float64(w[j])
+		}
+
+		mean := sum / size
+		stdv := sqr/size - mean*mean
+		if stdv <= 0 {
+			stdv = 1.0
+		} else {
+			stdv = math.Sqrt(stdv)
+		}
+		out[j] = float32((float64(v) - mean) / stdv)
+	}
+	return out
+}
+
+// warp maps v to the standard normal value of the same rank among
+// dimension j of window: rank R counted from the largest value, ties
+// split evenly, gives the value z with Phi(z) = (N + 1/2 - R) / N.
+func warp(window [][]float32, j int, v float32) float32 {
+	var greater, equal int
+	for _, w := range window {
+		if w[j] > v {
+			greater++
+		} else if w[j] == v {
+			equal++
+		}
+	}
+
+	size := float64(len(window))
+	rank := float64(greater) + float64(equal-1)/2 + 1
+	p := (size + 0.5 - rank) / size
+	return float32(math.Sqrt2 * math.Erfinv(2*p-1))
+}
+
+// cmvn normalises the first dims dimensions of fParam to zero mean and
+// unit variance over the utterance.
+func cmvn(fParam [][]float32, dims int) {
+	var iVecNum int = len(fParam)
+	var tempMean, tempStdv float32 = 0, 0
+
+	for i := 0; i < dims; i++ {
+		for j := 0; j < iVecNum; j++ {
+			tempMean += fParam[j][i]
+			tempStdv += fParam[j][i] * fParam[j][i]
+		}
+
+		cmsMean := tempMean / float32(iVecNum)
+
+		//Get the standard deviations
+		cmsStdv := tempStdv/float32(iVecNum) - cmsMean*cmsMean
+
+		if cmsStdv <= 0 {
+			cmsStdv = 1.0
+		} else {
+			cmsStdv = float32(math.Sqrt(float64(cmsStdv)))
+		}
+
+		//subtract the average value
+		for j := 0; j < iVecNum; j++ {
+			fParam[j][i] = (fParam[j][i] - cmsMean) / cmsStdv
+		}
+
+		tempMean = 0
+		tempStdv = 0
+	}
+}
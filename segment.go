@@ -0,0 +1,164 @@
+package govpr
+
+import (
+	"github.com/liuxp0827/govpr/constant"
+	"github.com/liuxp0827/govpr/waveIO"
+)
+
+// SegmentScore is the average log-likelihood ratio of the frames [Start, End).
+// The times of a report are of the verify audio, the silence removed before
+// the features included; the precomputed frames follow the audio.
+type SegmentScore struct {
+	Start, End int // ms
+	Score      float64
+}
+
+// Turn is a stretch of the utterance attributed to one side.
+type Turn struct {
+	Start, End int  // ms
+	Claimed    bool // attributed to the claimed speaker
+	Score      float64
+}
+
+type SegmentReport struct {
+	Scores     []SegmentScore // sliding window scores, in time order
+	Turns      []Turn         // consecutive, covering the whole utterance
+	Changes    []int          // ms where a turn ends and the next begins
+	Proportion float64        // share of the frames attributed to the claimed speaker
+	Score      float64        // score of the whole utterance, as VerifyModel
+}
+
+// VerifySegments scores the verify data in sliding windows of window ms
+// every hop ms, <= 0 takes SEGMENT_WINDOW and SEGMENT_HOP. A frame is
+// attributed to the claimed speaker when the average log-likelihood ratio of
+// the window centred on it reaches threshold; turns shorter than a window are
+// merged into their neighbours. GetScore returns the whole utterance score
+// afterwards, as after VerifyModel.
+func (this *VPREngine) VerifySegments(window, hop int, threshold float64) (*SegmentReport, error) {
+	if window <= 0 {
+		window = constant.SEGMENT_WINDOW
+	}
+	if hop <= 0 {
+		hop = constant.SEGMENT_HOP
+	}
+
+	client, tmpubm, err := this.verifyModels()
+	if err != nil {
+		return nil, err
+	}
+
+	n := client.Frames
+	clientProbs := client.FrameLProbs(client.FeatureData, 0, int64(n))
+	worldProbs := tmpubm.FrameLProbs(tmpubm.FeatureData, 0, int64(n))
+
+	// prefix sums of the frame log-likelihood ratios
+	sum := make([]float64, n+1)
+	for i := 0; i < n; i++ {
+		sum[i+1] = sum[i] + clientProbs[i] - worldProbs[i]
+	}
+	mean := func(from, to int) float64 {
+		return (sum[to] - sum[from]) / float64(to-from)
+	}
+
+	this.score = mean(0, n)
+
+	win := msToFrames(window)
+	step := msToFrames(hop)
+	if win > n {
+		win = n
+	}
+
+	report := &SegmentReport{Score: this.score}
+	for start := 0; ; start += step {
+		if start+win > n {
+			start = n - win
+		}
+		report.Scores = append(report.Scores, SegmentScore{
+			Start: this.frameMs(start),
+			End:   this.frameMs(start + win),
+			Score: mean(start, start+win),
+		})
+		if start+win >= n {
+			break
+		}
+	}
+
+	claimed := make([]bool, n)
+	for i := range claimed {
+		from, to := i-win/2, i-win/2+win
+		if from < 0 {
+			from = 0
+		}
+		if to > n {
+			to = n
+		}
+		claimed[i] = mean(from, to) >= threshold
+	}
+
+	// merge short turns into their neighbours, shortest first
+	turns := frameRuns(claimed)
+	for len(turns) > 1 {
+		shortest := 0
+		for k, t := range turns {
+			if t[1]-t[0] < turns[shortest][1]-turns[shortest][0] {
+				shortest = k
+			}
+		}
+		t := turns[shortest]
+		if t[1]-t[0] >= win {
+			break
+		}
+		for i := t[0]; i < t[1]; i++ {
+			claimed[i] = !claimed[i]
+		}
+		turns = frameRuns(claimed)
+	}
+
+	var claimedFrames int
+	for k, t := range turns {
+		turn := Turn{
+			Start:   this.frameMs(t[0]),
+			End:     this.frameMs(t[1]),
+			Claimed: claimed[t[0]],
+			Score:   mean(t[0], t[1]),
+		}
+		if turn.Claimed {
+			claimedFrames += t[1] - t[0]
+		}
+		if k > 0 {
+			report.Changes = append(report.Changes, turn.Start)
+		}
+		report.Turns = append(report.Turns, turn)
+	}
+	report.Proportion = float64(claimedFrames) / float64(n)
+
+	return report, nil
+}
+
+// frameMs is the time in the verify audio of the start of frame i, mapped
+// across the silence removed by DelSilence
+func (this *VPREngine) frameMs(i int) int {
+	shift := constant.FRAME_SHIFTt * constant.SAMPLERATE / 1000
+	return waveIO.SourceIndex(this.verifySpans, i*shift) * 1000 / constant.SAMPLERATE
+}
+
+func msToFrames(ms int) int {
+	n := ms / constant.FRAME_SHIFTt
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// frameRuns splits flags into [start, end) runs of equal value
+func frameRuns(flags []bool) [][2]int {
+	var out [][2]int
+	start := 0
+	for i := 1; i <= len(flags); i++ {
+		if i == len(flags) || flags[i] != flags[start] {
+			out = append(out, [2]int{start, i})
+			start = i
+		}
+	}
+	return out
+}
@@ -0,0 +1,189 @@
+package govpr
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/liuxp0827/govpr/constant"
+	"github.com/liuxp0827/govpr/feature"
+	"github.com/liuxp0827/govpr/gmm"
+	"github.com/liuxp0827/govpr/log"
+	"github.com/liuxp0827/govpr/waveIO"
+	"io"
+)
+
+// log likelihoods of the verify stream against the user model and the ubm
+type verifyStats struct {
+	client    *gmm.GMM
+	logClient float64
+	logWorld  float64
+	frames    int
+}
+
+// AddTrainReader enrols from a wave stream of any length. The frames are
+// computed block by block and only their statistics against the ubm are
+// kept, TrainModel then does a single pass MAP adaptation of the means
+// instead of re-estimating on all frames. channel selects one channel of
+// a multi-channel wave, -1 averages the channels. The other formats of
+// waveIO.Decode are accepted too but decoded whole before framing.
+func (this *VPREngine) AddTrainReader(r io.Reader, channel int) error {
+	if this.trainStats == nil {
+		this.trainStats = this.ubm.NewStats()
+	}
+
+	return this.readStream(r, channel, func(frames [][]float32) error {
+		this.ubm.Accumulate(this.trainStats, frames)
+		return nil
+	})
+}
+
+// AddVerifyReader sets the wave stream to verify, see AddTrainReader. The
+// user model is loaded here since the frames are scored as they come.
+func (this *VPREngine) AddVerifyReader(r io.Reader, channel int) error {
+	client := gmm.NewGMM()
+	if err := client.LoadModel(this.userModelFile); err != nil {
+		log.Error(err)
+		return NewError(LSV_ERR_MODEL_LOAD_FAILED, err.Error())
+	}
+
+	stats := &verifyStats{client: client}
+	err := this.readStream(r, channel, func(frames [][]float32) error {
+		stats.add(this.ubm, frames)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	this.verifyStream = stats
+	return nil
+}
+
+func (this *VPREngine) readStream(r io.Reader, channel int, emit func([][]float32) error) error {
+	br := bufio.NewReaderSize(r, 0x4000)
+	format, err := waveIO.Sniff(br)
+	if err != nil {
+		return NewError(LSV_ERR_INVALID_PARAM, err.Error())
+	}
+
+	// only WAV is read block by block, compressed audio is decoded whole
+	var read func([]int16) (int, error)
+	if format == waveIO.FORMAT_WAV {
+		wave, err := waveIO.NewReader(br)
+		if err != nil {
+			return NewError(LSV_ERR_INVALID_PARAM, err.Error())
+		}
+
+		if wave.SampleRate != constant.SAMPLERATE {
+			return NewError(LSV_ERR_INVALID_PARAM,
+				fmt.Sprintf("wave sample rate %d, expected %d", wave.SampleRate, constant.SAMPLERATE))
+		}
+
+		if err = wave.SelectChannel(channel); err != nil {
+			return NewError(LSV_ERR_INVALID_PARAM, err.Error())
+		}
+		read = wave.Read
+	} else {
+		samples, err := this.decodeAudio(br, channel)
+		if err != nil {
+			return err
+		}
+		read = func(block []int16) (int, error) {
+			n := copy(block, samples)
+			samples = samples[n:]
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n, nil
+		}
+	}
+
+	stream, err := feature.NewStream(0, func(frames [][]float32) error {
+		if err := this.checkFeatures(frames); err != nil {
+			return err
+		}
+		return emit(frames)
+	})
+	if err != nil {
+		return NewError(LSV_ERR_MEM_INSUFFICIENT, err.Error())
+	}
+
+	block := make([]int16, constant.SAMPLERATE)
+	for {
+		n, err := read(block)
+		if n > 0 {
+			samples := block[:n]
+			if this.deleteSil {
+				samples = waveIO.DelSilence(samples, this.delSilRange)
+			}
+
+			if err := stream.Write(samples); err != nil {
+				log.Error(err)
+				return NewError(LSV_ERR_MEM_INSUFFICIENT, err.Error())
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return NewError(LSV_ERR_INVALID_PARAM, err.Error())
+		}
+	}
+
+	if err = stream.Close(); err != nil {
+		log.Error(err)
+		return NewError(LSV_ERR_MEM_INSUFFICIENT, err.Error())
+	}
+	return nil
+}
+
+func (s *verifyStats) add(ubm *gmm.GMM, frames [][]float32) {
+	n := int64(len(frames))
+	s.logClient += s.client.LProb(frames, 0, n)
+	s.logWorld += ubm.LProb(frames, 0, n)
+	s.frames += len(frames)
+}
+
+// trainFromStats adds the buffers and precomputed frames to the stream
+// statistics and adapts the user model from them.
+func (this *VPREngine) trainFromStats() error {
+	if len(this.trainBuf) > 0 || len(this.trainFeatures) > 0 {
+		features, err := this.features(this.trainBuf, this.trainFeatures)
+		if err != nil {
+			log.Error(err)
+			return NewError(LSV_ERR_MEM_INSUFFICIENT, err.Error())
+		}
+		this.ubm.Accumulate(this.trainStats, features)
+	}
+
+	if this.trainStats.Frames < this._minTrainFrames {
+		return LSV_ERR_NO_AVAILABLE_DATA
+	}
+
+	client := gmm.NewGMM()
+	client.DupModel(this.ubm)
+	if err := client.MAPAdapt(this.trainStats, constant.REL_FACTOR); err != nil {
+		log.Error(err)
+		return NewError(LSV_ERR_TRAINING_FAILED, err.Error())
+	}
+	return this.saveModel(client)
+}
+
+func (this *VPREngine) verifyFromStats() error {
+	stats := this.verifyStream
+	if len(this.verifyBuf) > 0 || len(this.verifyFeatures) > 0 {
+		features, err := this.features(this.verifyBuf, this.verifyFeatures)
+		if err != nil {
+			log.Error(err)
+			return NewError(LSV_ERR_MEM_INSUFFICIENT, err.Error())
+		}
+		stats.add(this.ubm, features)
+	}
+
+	if stats.frames < this._minVerFrames {
+		return LSV_ERR_NEED_MORE_SAMPLE
+	}
+
+	this.score = (stats.logClient - stats.logWorld) / float64(stats.frames)
+	return nil
+}
@@ -0,0 +1,381 @@
+package waveIO
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/jfreymuth/oggvorbis"
+	"github.com/mewkiz/flac"
+	"github.com/pion/opus"
+	"github.com/pion/opus/pkg/oggreader"
+	"io"
+	"math"
+	"os"
+)
+
+// formats recognised by Decode
+const (
+	FORMAT_WAV    = "wav"
+	FORMAT_FLAC   = "flac"
+	FORMAT_VORBIS = "vorbis"
+	FORMAT_OPUS   = "opus"
+	FORMAT_MP3    = "mp3"
+)
+
+// file name extensions of the formats Decode recognises
+var Extensions = []string{".wav", ".flac", ".ogg", ".oga", ".opus", ".mp3"}
+
+// ErrFormat is returned by Decode when the stream is in none of the
+// supported containers.
+var ErrFormat = errors.New("unknown audio format")
+
+// Opus always decodes at 48 kHz, the pre-skip is counted at this rate
+const opusRate = 48000
+
+// 120 ms, the longest Opus packet
+const opusMaxPacket = opusRate * 120 / 1000
+
+// Audio is a decoded recording, reduced to one channel.
+type Audio struct {
+	Format     string // one of the FORMAT_ constants
+	SampleRate int
+	Channels   int // channels of the source
+	Samples    []int16
+}
+
+// Decode decodes a WAV, FLAC, Ogg Vorbis, Ogg Opus or MP3 stream, the
+// container is recognised from its first bytes. The channels are averaged.
+func Decode(r io.Reader) (*Audio, error) {
+	return DecodeChannel(r, -1)
+}
+
+// DecodeChannel is Decode keeping one channel, counting from 0. A negative
+// channel averages all channels.
+func DecodeChannel(r io.Reader, channel int) (*Audio, error) {
+	br := bufio.NewReaderSize(r, 0x4000)
+	format, err := Sniff(br)
+	if err != nil {
+		return nil, err
+	}
+
+	var audio *Audio
+	var interleaved []int16
+	switch format {
+	case FORMAT_WAV:
+		return decodeWav(br, channel)
+	case FORMAT_FLAC:
+		audio, interleaved, err = decodeFlac(br)
+	case FORMAT_VORBIS:
+		audio, interleaved, err = decodeVorbis(br)
+	case FORMAT_OPUS:
+		audio, interleaved, err = decodeOpus(br)
+	case FORMAT_MP3:
+		audio, interleaved, err = decodeMp3(br)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", format, err)
+	}
+
+	if channel >= audio.Channels {
+		return nil, fmt.Errorf("channel %d out of range, the %s stream has %d", channel, format, audio.Channels)
+	}
+	audio.Samples = mixdown(interleaved, audio.Channels, channel)
+	return audio, nil
+}
+
+// DecodeFile decodes the file name, see Decode.
+func DecodeFile(name string) (*Audio, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(f)
+}
+
+// bytes Sniff peeks at, enough for an MPEG audio frame and the sync of the
+// next one
+const sniffSize = 2048
+
+// Sniff returns the format of the stream in r without consuming it.
+func Sniff(r *bufio.Reader) (string, error) {
+	head, err := r.Peek(sniffSize)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	switch {
+	case len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		return FORMAT_WAV, nil
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return FORMAT_FLAC, nil
+	case bytes.HasPrefix(head, []byte("OggS")):
+		// the first packet of the first page identifies the codec, it
+		// follows the 27 byte page header and the segment table
+		if len(head) < 27 || len(head) < 27+int(head[26]) {
+			return "", ErrFormat
+		}
+		packet := head[27+int(head[26]):]
+		if bytes.HasPrefix(packet, []byte("\x01vorbis")) {
+			return FORMAT_VORBIS, nil
+		}
+		if bytes.HasPrefix(packet, []byte("OpusHead")) {
+			return FORMAT_OPUS, nil
+		}
+	case len(head) >= 10 && string(head[0:3]) == "ID3" && head[3] != 0xff && head[4] != 0xff &&
+		head[6]|head[7]|head[8]|head[9] < 0x80:
+		// ID3v2 tag, its version and sync safe size
+		return FORMAT_MP3, nil
+	default:
+		// a raw PCM stream can start with the 11 bit frame sync, so the
+		// header must be valid and the next frame follow it. Only layer
+		// III is decoded, which also keeps out the PCM starting ff ff.
+		if n := mpegFrameSize(head); n > 0 && head[1]&0x06 == 0x02 && mpegFrameSize(head[n:]) > 0 {
+			return FORMAT_MP3, nil
+		}
+	}
+	return "", ErrFormat
+}
+
+// bitrates of the MPEG audio headers in kbit/s, by MPEG-1 or not, layer
+// I, II, III and the bitrate index from 1 to 14
+var mpegBitrates = [2][3][14]int{
+	{
+		{32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{
+		{32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+// sample rates of MPEG-1, the ones of MPEG-2 are halved and of MPEG-2.5
+// quartered
+var mpegSampleRates = [3]int{44100, 48000, 32000}
+
+// mpegFrameSize returns the length of the MPEG audio frame whose header
+// starts h, 0 if h does not start with a valid header. A free format
+// frame, of no bitrate, has no length in its header and is not valid.
+func mpegFrameSize(h []byte) int {
+	if len(h) < 4 || h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+		return 0
+	}
+	version := (h[1] >> 3) & 3 // 0 MPEG-2.5, 1 reserved, 2 MPEG-2, 3 MPEG-1
+	layer := (h[1] >> 1) & 3   // 0 reserved, 1 III, 2 II, 3 I
+	bitrate := int(h[2] >> 4)
+	rate := int((h[2] >> 2) & 3)
+	padding := int((h[2] >> 1) & 1)
+	if version == 1 || layer == 0 || bitrate == 0 || bitrate == 15 || rate == 3 || h[3]&3 == 2 {
+		return 0
+	}
+
+	row := 0
+	if version != 3 {
+		row = 1
+	}
+	kbps := mpegBitrates[row][3-layer][bitrate-1]
+	sampleRate := mpegSampleRates[rate]
+	switch version {
+	case 2:
+		sampleRate /= 2
+	case 0:
+		sampleRate /= 4
+	}
+
+	switch {
+	case layer == 3:
+		return (12*kbps*1000/sampleRate + padding) * 4
+	case layer == 1 && version != 3:
+		return 72*kbps*1000/sampleRate + padding
+	}
+	return 144*kbps*1000/sampleRate + padding
+}
+
+func decodeWav(r io.Reader, channel int) (*Audio, error) {
+	wave, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	if err = wave.SelectChannel(channel); err != nil {
+		return nil, err
+	}
+
+	audio := &Audio{Format: FORMAT_WAV, SampleRate: wave.SampleRate, Channels: wave.Channels}
+	block := make([]int16, wave.SampleRate)
+	for {
+		n, err := wave.Read(block)
+		audio.Samples = append(audio.Samples, block[:n]...)
+		if err == io.EOF {
+			return audio, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func decodeFlac(r io.Reader) (*Audio, []int16, error) {
+	stream, err := flac.New(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer stream.Close()
+
+	audio := &Audio{
+		Format:     FORMAT_FLAC,
+		SampleRate: int(stream.Info.SampleRate),
+		Channels:   int(stream.Info.NChannels),
+	}
+
+	// scale to 16 bits whatever the source depth
+	shift := int(stream.Info.BitsPerSample) - 16
+
+	var interleaved []int16
+	for {
+		frame, err := stream.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for i := 0; i < int(frame.BlockSize); i++ {
+			for _, sub := range frame.Subframes {
+				v := sub.Samples[i]
+				if shift > 0 {
+					v >>= uint(shift)
+				} else {
+					v <<= uint(-shift)
+				}
+				interleaved = append(interleaved, int16(v))
+			}
+		}
+	}
+	return audio, interleaved, nil
+}
+
+func decodeVorbis(r io.Reader) (*Audio, []int16, error) {
+	ogg, err := oggvorbis.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	audio := &Audio{Format: FORMAT_VORBIS, SampleRate: ogg.SampleRate(), Channels: ogg.Channels()}
+
+	var interleaved []int16
+	block := make([]float32, ogg.SampleRate()*ogg.Channels())
+	for {
+		n, err := ogg.Read(block)
+		for _, v := range block[:n] {
+			interleaved = append(interleaved, clip16(math.Floor(float64(v)*32768+0.5)))
+		}
+		if err == io.EOF {
+			return audio, interleaved, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+func decodeOpus(r io.Reader) (*Audio, []int16, error) {
+	ogg, header, err := oggreader.NewWith(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.ChannelMap > 1 {
+		return nil, nil, fmt.Errorf("channel mapping family %d not supported", header.ChannelMap)
+	}
+
+	channels := int(header.Channels)
+	decoder, err := opus.NewDecoderWithOutput(opusRate, channels)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	audio := &Audio{Format: FORMAT_OPUS, SampleRate: opusRate, Channels: channels}
+
+	var interleaved []int16
+	skip := int(header.PreSkip) * channels
+	block := make([]int16, opusMaxPacket*channels)
+	for {
+		packet, _, err := ogg.ParseNextPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if bytes.HasPrefix(packet, []byte("OpusTags")) {
+			continue
+		}
+
+		n, err := decoder.DecodeToInt16(packet, block)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		samples := block[:n*channels]
+		if skip > 0 {
+			k := skip
+			if k > len(samples) {
+				k = len(samples)
+			}
+			samples = samples[k:]
+			skip -= k
+		}
+		interleaved = append(interleaved, samples...)
+	}
+	return audio, interleaved, nil
+}
+
+// go-mp3 always decodes to 16 bit stereo
+func decodeMp3(r io.Reader) (*Audio, []int16, error) {
+	decoder, err := mp3.NewDecoder(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	audio := &Audio{Format: FORMAT_MP3, SampleRate: decoder.SampleRate(), Channels: 2}
+
+	data, err := io.ReadAll(decoder)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	interleaved := make([]int16, len(data)/2)
+	for i := range interleaved {
+		interleaved[i] = int16(data[2*i]) | int16(data[2*i+1])<<8
+	}
+	return audio, interleaved, nil
+}
+
+// mixdown keeps one channel of interleaved samples, or averages them all
+// when channel < 0.
+func mixdown(interleaved []int16, channels, channel int) []int16 {
+	if channels == 1 {
+		return interleaved
+	}
+
+	out := make([]int16, len(interleaved)/channels)
+	for i := range out {
+		frame := interleaved[i*channels : (i+1)*channels]
+		if channel >= 0 {
+			out[i] = frame[channel]
+			continue
+		}
+
+		var sum int
+		for _, v := range frame {
+			sum += int(v)
+		}
+		out[i] = int16(sum / channels)
+	}
+	return out
+}
@@ -0,0 +1,78 @@
+package waveIO
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// mpegFrames returns n MPEG-1 layer III frames of 128 kbit/s at 44.1 kHz,
+// of 417 bytes, with silent content
+func mpegFrames(n int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	return bytes.Repeat(frame, n)
+}
+
+func TestSniff(t *testing.T) {
+	pcm := func(samples ...int16) []byte {
+		var b bytes.Buffer
+		for i := 0; i < 1000; i++ {
+			binary.Write(&b, binary.LittleEndian, samples)
+		}
+		return b.Bytes()
+	}
+
+	for _, c := range []struct {
+		name   string
+		data   []byte
+		format string
+	}{
+		{"wav", append([]byte("RIFF\x00\x00\x00\x00WAVEfmt "), make([]byte, 32)...), FORMAT_WAV},
+		{"mp3", mpegFrames(3), FORMAT_MP3},
+		{"id3", append([]byte("ID3\x04\x00\x00\x00\x00\x00\x0a"), mpegFrames(1)...), FORMAT_MP3},
+		// the 11 bit sync alone
+		{"pcm -1", pcm(-1), ""},
+		// two valid layer I headers, which Decode does not decode
+		{"pcm -1 -32", pcm(-1, -32), ""},
+		{"pcm header", pcm(-1025, 144), ""}, // ff fb 90 00
+		// a valid header not followed by another frame
+		{"one frame", mpegFrames(1), ""},
+		{"frame and pcm", append(mpegFrames(1), pcm(1000)...), ""},
+	} {
+		format, err := Sniff(bufio.NewReader(bytes.NewReader(c.data)))
+		if c.format == "" {
+			if err != ErrFormat {
+				t.Errorf("%s: Sniff = %q, %v, want ErrFormat", c.name, format, err)
+			}
+			continue
+		}
+		if err != nil || format != c.format {
+			t.Errorf("%s: Sniff = %q, %v, want %q", c.name, format, err, c.format)
+		}
+	}
+}
+
+func TestMpegFrameSize(t *testing.T) {
+	for _, c := range []struct {
+		header []byte
+		size   int
+	}{
+		{[]byte{0xff, 0xfb, 0x90, 0x00}, 417}, // MPEG-1 layer III 128 kbit/s 44.1 kHz
+		{[]byte{0xff, 0xfb, 0x92, 0x00}, 418}, // padded
+		{[]byte{0xff, 0xf3, 0x88, 0x00}, 288}, // MPEG-2 layer III 64 kbit/s 16 kHz
+		{[]byte{0xff, 0xfd, 0x94, 0x00}, 480}, // MPEG-1 layer II 160 kbit/s 48 kHz
+		{[]byte{0xff, 0xff, 0x90, 0x00}, 312}, // MPEG-1 layer I 288 kbit/s 44.1 kHz
+		{[]byte{0xff, 0xeb, 0x90, 0x00}, 0},   // reserved version
+		{[]byte{0xff, 0xf9, 0x90, 0x00}, 0},   // reserved layer
+		{[]byte{0xff, 0xfb, 0x00, 0x00}, 0},   // free format
+		{[]byte{0xff, 0xfb, 0xf0, 0x00}, 0},   // bad bitrate
+		{[]byte{0xff, 0xfb, 0x9c, 0x00}, 0},   // reserved sample rate
+		{[]byte{0xff, 0xfb, 0x90, 0x02}, 0},   // reserved emphasis
+	} {
+		if size := mpegFrameSize(c.header); size != c.size {
+			t.Errorf("mpegFrameSize(% x) = %d, want %d", c.header, size, c.size)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package waveIO
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	WAVE_FORMAT_PCM        = 1
+	WAVE_FORMAT_IEEE_FLOAT = 3
+	WAVE_FORMAT_EXTENSIBLE = 0xfffe
+)
+
+// Reader decodes the data chunk of a RIFF WAVE stream block by block as
+// 16 bit samples of one channel, so files of any length can be processed
+// in bounded memory. PCM of 8, 16, 24 and 32 bits and 32/64 bit float are
+// supported, with any number of channels.
+type Reader struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	Format        int // WAVE_FORMAT_PCM or WAVE_FORMAT_IEEE_FLOAT
+
+	r         *bufio.Reader
+	remaining int64 // bytes left in the data chunk, < 0 reads up to EOF
+	channel   int   // selected channel, < 0 averages all channels
+	block     []byte
+}
+
+// NewReader parses the headers up to the data chunk. Chunks other than
+// "fmt " and "data" are skipped. A data chunk size of 0 or 0xffffffff, as
+// written by streaming encoders, reads until the end of r.
+func NewReader(r io.Reader) (*Reader, error) {
+	w := &Reader{r: bufio.NewReaderSize(r, 0x4000), channel: -1}
+
+	var riff [12]byte
+	if _, err := io.ReadFull(w.r, riff[:]); err != nil {
+		return nil, fmt.Errorf("invalid wave header: %v", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("invalid wave haeder")
+	}
+
+	var haveFmt bool
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(w.r, chunk[:]); err != nil {
+			return nil, fmt.Errorf("no data chunk: %v", err)
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			if err := w.readFmt(size); err != nil {
+				return nil, err
+			}
+			haveFmt = true
+
+		case "data":
+			if !haveFmt {
+				return nil, fmt.Errorf("data chunk before fmt chunk")
+			}
+			w.remaining = size
+			if size == 0 || size == 0xffffffff {
+				w.remaining = -1
+			}
+			return w, nil
+
+		default:
+			// chunks are padded to an even size
+			if _, err := io.CopyN(io.Discard, w.r, size+size&1); err != nil {
+				return nil, fmt.Errorf("chunk %q: %v", id, err)
+			}
+		}
+	}
+}
+
+func (w *Reader) readFmt(size int64) error {
+	if size < 16 {
+		return fmt.Errorf("fmt chunk too short")
+	}
+
+	buf := make([]byte, size+size&1)
+	if _, err := io.ReadFull(w.r, buf); err != nil {
+		return fmt.Errorf("fmt chunk: %v", err)
+	}
+
+	w.Format = int(binary.LittleEndian.Uint16(buf[0:2]))
+	w.Channels = int(binary.LittleEndian.Uint16(buf[2:4]))
+	w.SampleRate = int(binary.LittleEndian.Uint32(buf[4:8]))
+	w.BitsPerSample = int(binary.LittleEndian.Uint16(buf[14:16]))
+
+	// the sub format GUID starts with the format tag
+	if w.Format == WAVE_FORMAT_EXTENSIBLE && size >= 26 {
+		w.Format = int(binary.LittleEndian.Uint16(buf[24:26]))
+	}
+
+	switch {
+	case w.Channels <= 0 || w.SampleRate <= 0:
+		return fmt.Errorf("invalid wave format: %d channels at %d Hz", w.Channels, w.SampleRate)
+	case w.Format == WAVE_FORMAT_PCM && (w.BitsPerSample == 8 || w.BitsPerSample == 16 ||
+		w.BitsPerSample == 24 || w.BitsPerSample == 32):
+	case w.Format == WAVE_FORMAT_IEEE_FLOAT && (w.BitsPerSample == 32 || w.BitsPerSample == 64):
+	default:
+		return fmt.Errorf("unsupported wave format %d with %d bits per sample", w.Format, w.BitsPerSample)
+	}
+	return nil
+}
+
+// SelectChannel picks the channel Read returns, counting from 0. A
+// negative channel averages all channels, which is the default.
+func (w *Reader) SelectChannel(channel int) error {
+	if channel >= w.Channels {
+		return fmt.Errorf("channel %d out of range, the wave has %d", channel, w.Channels)
+	}
+	w.channel = channel
+	return nil
+}
+
+// Read decodes up to len(samples) samples of the selected channel. It
+// returns io.EOF after the last sample.
+func (w *Reader) Read(samples []int16) (int, error) {
+	width := w.BitsPerSample / 8
+	frame := width * w.Channels
+
+	want := len(samples) * frame
+	if w.remaining >= 0 && int64(want) > w.remaining {
+		want = int(w.remaining) / frame * frame
+	}
+	if want == 0 {
+		return 0, io.EOF
+	}
+
+	if cap(w.block) < want {
+		w.block = make([]byte, want)
+	}
+	block := w.block[:want]
+
+	n, err := io.ReadFull(w.r, block)
+	if err == io.ErrUnexpectedEOF || (err == io.EOF && n > 0) {
+		err = nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	n = n / frame * frame
+	if w.remaining >= 0 {
+		w.remaining -= int64(n)
+	}
+
+	count := n / frame
+	for i := 0; i < count; i++ {
+		f := block[i*frame : (i+1)*frame]
+		if w.channel >= 0 {
+			samples[i] = w.sample(f[w.channel*width:])
+			continue
+		}
+
+		var sum int
+		for c := 0; c < w.Channels; c++ {
+			sum += int(w.sample(f[c*width:]))
+		}
+		samples[i] = int16(sum / w.Channels)
+	}
+
+	if count == 0 {
+		return 0, io.EOF
+	}
+	return count, nil
+}
+
+// sample converts the sample at the start of b to 16 bits
+func (w *Reader) sample(b []byte) int16 {
+	if w.Format == WAVE_FORMAT_IEEE_FLOAT {
+		var v float64
+		if w.BitsPerSample == 32 {
+			v = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		} else {
+			v = math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}
+		v *= 32768
+		if v > math.MaxInt16 {
+			v = math.MaxInt16
+		} else if v < math.MinInt16 {
+			v = math.MinInt16
+		}
+		return int16(v)
+	}
+
+	switch w.BitsPerSample {
+	case 8:
+		return int16(int(b[0])-128) << 8
+	case 16:
+		return int16(binary.LittleEndian.Uint16(b))
+	case 24:
+		return int16(uint16(b[1]) | uint16(b[2])<<8)
+	}
+	return int16(binary.LittleEndian.Uint32(b) >> 16)
+}
@@ -0,0 +1,69 @@
+package waveIO
+
+import (
+	"fmt"
+	"math"
+)
+
+// half width of the resampling kernel in zero crossings
+const sincZeros = 16
+
+// Resample converts samples from one sample rate to another.
+func Resample(samples []int16, from, to int) ([]int16, error) {
+	if from <= 0 || to <= 0 {
+		return nil, fmt.Errorf("invalid sample rates %d -> %d", from, to)
+	}
+	if from == to {
+		return append([]int16(nil), samples...), nil
+	}
+	return ResampleStep(samples, float64(from)/float64(to)), nil
+}
+
+// ResampleStep reads samples at step input samples per output sample with
+// a Blackman windowed sinc, low-passed below the output Nyquist when
+// step > 1.
+func ResampleStep(samples []int16, step float64) []int16 {
+	cutoff := 1.0
+	if step > 1 {
+		cutoff = 1 / step
+	}
+	half := float64(sincZeros) / cutoff
+
+	out := make([]int16, int(float64(len(samples))/step))
+	for k := range out {
+		t := float64(k) * step
+		lo := int(math.Ceil(t - half))
+		hi := int(math.Floor(t + half))
+		if lo < 0 {
+			lo = 0
+		}
+		if hi >= len(samples) {
+			hi = len(samples) - 1
+		}
+
+		var sum float64
+		for i := lo; i <= hi; i++ {
+			d := float64(i) - t
+			w := 0.42 + 0.5*math.Cos(math.Pi*d/half) + 0.08*math.Cos(2*math.Pi*d/half)
+			sum += float64(samples[i]) * w * cutoff * sinc(cutoff*d)
+		}
+		out[k] = clip16(math.Floor(sum + 0.5))
+	}
+	return out
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+func clip16(v float64) int16 {
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	} else if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/liuxp0827/govpr/constant"
 	"math"
 	"os"
+	"sort"
 )
 
 type WaveChunk struct {
@@ -128,7 +129,7 @@ func WaveSave(detFile string, wavData []int16, sampsRate, length uint32) error {
 	// fmtChunk
 	waveIO.fmtChunk.bpchan = 16
 	waveIO.fmtChunk.bpsample = 2
-	waveIO.fmtChunk.bpsec = 32000
+	waveIO.fmtChunk.bpsec = sampsRate * 2
 	waveIO.fmtChunk.chans = 1
 	waveIO.fmtChunk.flength = 16
 	waveIO.fmtChunk.fmt = []byte{'f', 'm', 't', ' '}
@@ -214,6 +215,30 @@ func WaveLoad(srcFile string) ([]byte, error) {
 }
 
 func DelSilence(pnSrc []int16, K int) []int16 {
+	samples, _ := DelSilenceSpans(pnSrc, K)
+	return samples
+}
+
+// Span is the start of a block of samples kept by DelSilenceSpans, at Out
+// in its result and at Src in its source
+type Span struct {
+	Out, Src int
+}
+
+// SourceIndex maps the index i of a sample kept by DelSilenceSpans to its
+// index in the source, spans being in order. The samples of repeats removed
+// within a block shift the ones after them by as much, at most the block.
+func SourceIndex(spans []Span, i int) int {
+	k := sort.Search(len(spans), func(k int) bool { return spans[k].Out > i }) - 1
+	if k < 0 {
+		return i
+	}
+	return spans[k].Src + i - spans[k].Out
+}
+
+// DelSilenceSpans is DelSilence also returning where the kept blocks start
+func DelSilenceSpans(pnSrc []int16, K int) ([]int16, []Span) {
+	var spans []Span
 	var max_sample_value int = -(constant.SHRT_MAX)
 	var nSrcLen, outLength int64 = int64(len(pnSrc)), 0
 
@@ -254,6 +279,7 @@ func DelSilence(pnSrc []int16, K int) []int16 {
 		}
 
 		if eng > MIN_VOC_ENG*constant.VOC_BLOCK_LEN {
+			spans = append(spans, Span{int(outLength), constant.VOC_BLOCK_LEN * i})
 			j, p = 0, 0
 			old1, old2, old3 = 0, 0, 0
 			for k = 0; k < constant.VOC_BLOCK_LEN; k++ {
@@ -284,6 +310,7 @@ func DelSilence(pnSrc []int16, K int) []int16 {
 	}
 
 	if eng > MIN_VOC_ENG*nMod {
+		spans = append(spans, Span{int(outLength), constant.VOC_BLOCK_LEN * nWin})
 		j, p = 0, 0
 		old1, old2, old3 = 0, 0, 0
 		for i = 0; i < nMod; i++ {
@@ -307,5 +334,5 @@ func DelSilence(pnSrc []int16, K int) []int16 {
 		outLength += int64(j)
 	}
 
-	return pnTarget
+	return pnTarget, spans
 }
@@ -0,0 +1,34 @@
+package waveIO
+
+import (
+	"testing"
+
+	"github.com/liuxp0827/govpr/constant"
+)
+
+func TestDelSilenceSpans(t *testing.T) {
+	// loud, silent, loud and silent blocks
+	block := constant.VOC_BLOCK_LEN
+	src := make([]int16, 4*block)
+	for i := range src {
+		if (i/block)%2 == 0 {
+			src[i] = int16((i%200 - 100) * 100)
+		}
+	}
+
+	out, spans := DelSilenceSpans(src, 50)
+	if len(out) != 2*block {
+		t.Fatalf("%d samples kept, want %d", len(out), 2*block)
+	}
+	for _, c := range []struct{ out, src int }{{0, 0}, {block - 1, block - 1}, {block, 2 * block}, {2*block - 1, 3*block - 1}} {
+		if i := SourceIndex(spans, c.out); i != c.src {
+			t.Errorf("SourceIndex(%d) = %d, want %d", c.out, i, c.src)
+		}
+		if out[c.out] != src[c.src] {
+			t.Errorf("sample %d kept is %d, want %d of the source", c.out, out[c.out], src[c.src])
+		}
+	}
+	if i := SourceIndex(nil, 123); i != 123 {
+		t.Errorf("SourceIndex without spans = %d, want 123", i)
+	}
+}